@@ -0,0 +1,138 @@
+package main
+
+// AccessListTracer records the addresses and storage slots a transaction
+// touches through its instructions, as an EIP-2930 access list. It is what
+// eth_createAccessList runs the call with, as in geth.
+type AccessListTracer struct {
+	NoopTracer
+	excluded  map[[20]byte]bool
+	addresses [][20]byte // in the order they were first touched
+	slots     map[[20]byte][][32]byte
+}
+
+// NewAccessListTracer returns a tracer whose list starts as list. The
+// excluded addresses and the precompiles are only listed for their storage:
+// they are warm anyway.
+func NewAccessListTracer(list AccessList, excluded ...[20]byte) *AccessListTracer {
+	t := &AccessListTracer{
+		excluded: make(map[[20]byte]bool),
+		slots:    make(map[[20]byte][][32]byte),
+	}
+	for _, tuple := range list {
+		t.add(tuple.Address)
+		for _, slot := range tuple.StorageKeys {
+			t.addSlot(tuple.Address, slot)
+		}
+	}
+	for _, addr := range excluded {
+		t.excluded[addr] = true
+	}
+	return t
+}
+
+// addAddress lists addr unless it is excluded.
+func (t *AccessListTracer) addAddress(addr [20]byte) {
+	if !t.excluded[addr] && !isPrecompile(addr) {
+		t.add(addr)
+	}
+}
+
+func (t *AccessListTracer) add(addr [20]byte) {
+	if _, ok := t.slots[addr]; !ok {
+		t.addresses = append(t.addresses, addr)
+		t.slots[addr] = [][32]byte{}
+	}
+}
+
+func (t *AccessListTracer) addSlot(addr [20]byte, slot [32]byte) {
+	t.add(addr)
+	slots := t.slots[addr]
+	for _, s := range slots {
+		if s == slot {
+			return
+		}
+	}
+	t.slots[addr] = append(slots, slot)
+}
+
+// OnOpcode records the slot of SLOAD and SSTORE, and the address the other
+// instructions reading an account take.
+func (t *AccessListTracer) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	stack := ec.Stack.GetData()
+	switch op {
+	case SLOAD, SSTORE:
+		if len(stack) >= 1 {
+			t.addSlot(ec.Address, toWord256(stack[len(stack)-1]))
+		}
+	case BALANCE, EXTCODESIZE, EXTCODECOPY, EXTCODEHASH, SELFDESTRUCT:
+		if len(stack) >= 1 {
+			t.addAddress(toAddress(stack[len(stack)-1]))
+		}
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+		if len(stack) >= 2 {
+			t.addAddress(toAddress(stack[len(stack)-2]))
+		}
+	}
+}
+
+// AccessList returns the list recorded so far.
+func (t *AccessListTracer) AccessList() AccessList {
+	list := make(AccessList, 0, len(t.addresses))
+	for _, addr := range t.addresses {
+		slots := append([][32]byte{}, t.slots[addr]...)
+		list = append(list, AccessTuple{Address: addr, StorageKeys: slots})
+	}
+	return list
+}
+
+// isPrecompile reports whether addr is that of a precompiled contract on
+// mainnet, up to those of Prague. They are always warm, so they are not
+// worth listing even though the interpreter doesn't implement them.
+func isPrecompile(addr [20]byte) bool {
+	var prefix [19]byte
+	return [19]byte(addr[:19]) == prefix && addr[19] >= 0x01 && addr[19] <= 0x11
+}
+
+// CreateAccessList returns the access list of msg run in block on a copy of
+// state, which is left untouched: the storage slots it touches and the
+// addresses it reaches, but the sender, the recipient or created contract
+// and the precompiles. Since the list changes the gas the call has, and so
+// what it may reach, the call is run again with the list until the list no
+// longer grows. It also returns the result of the last run, which ran with
+// the list.
+func CreateAccessList(state *StateDB, block *BlockContext, msg *CallMsg, config Config, overrides *CallOverrides) (AccessList, *ExecutionResult, error) {
+	state = state.Copy()
+	var blockOverrides *CallOverrides
+	if overrides != nil {
+		if err := overrides.State.Apply(state); err != nil {
+			return nil, nil, err
+		}
+		blockOverrides = &CallOverrides{Block: overrides.Block}
+	}
+	to := CreateAddress(msg.From, state.GetNonce(msg.From))
+	if msg.To != nil {
+		to = *msg.To
+	}
+
+	list := msg.AccessList
+	for {
+		tracer := NewAccessListTracer(list, msg.From, to)
+		cfg := config
+		cfg.Tracer = tracer
+		if config.Tracer != nil {
+			cfg.Tracer = MultiTracer{config.Tracer, tracer}
+		}
+		call := *msg
+		call.AccessList = list
+		res, err := DoCall(state, block, &call, cfg, blockOverrides)
+		if err != nil {
+			return nil, nil, err
+		}
+		// The tracer starts from the list, so the list can only grow.
+		next := tracer.AccessList()
+		if len(next) == len(list) && next.StorageKeys() == list.StorageKeys() {
+			return next, res, nil
+		}
+		list = next
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+var (
+	accessContract = [20]byte{0xc0}
+	accessOther    = [20]byte{0x0a}
+	accessCallee   = [20]byte{0xca}
+)
+
+// newAccessState returns a state with a contract that reads a slot, the
+// balance of another account, and calls a contract reading a slot and the
+// first precompile.
+func newAccessState(t *testing.T) *StateDB {
+	t.Helper()
+	code := map[[20]byte]string{
+		accessContract: `
+			PUSH1 1 SLOAD POP
+			PUSH20 0x0a00000000000000000000000000000000000000 BALANCE POP
+			PUSH1 0 DUP1 DUP1 DUP1 PUSH20 0xca00000000000000000000000000000000000000 PUSH2 0xffff STATICCALL POP
+			PUSH1 0 DUP1 DUP1 DUP1 PUSH1 1 PUSH2 0xffff STATICCALL POP
+			STOP`,
+		accessCallee: "PUSH1 7 SLOAD POP STOP",
+	}
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1_000_000_000))
+	for addr, src := range code {
+		bytecode, err := Assemble(src)
+		if err != nil {
+			t.Fatalf("Unexpected assembler error: %v", err)
+		}
+		state.SetCode(addr, bytecode)
+	}
+	state.resetJournal()
+	return state
+}
+
+// TestCreateAccessList checks the list of a call, and that running the
+// call with it gives the same list back.
+func TestCreateAccessList(t *testing.T) {
+	state := newAccessState(t)
+	block := testBlock(big.NewInt(1))
+	msg := &CallMsg{From: testSender, To: &accessContract}
+
+	list, res, err := CreateAccessList(state, block, msg, Config{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Failed() {
+		t.Fatalf("Unexpected execution error: %v", res.Err)
+	}
+	// The sender and the precompile are warm anyway; the called contract
+	// is only listed for its storage.
+	want := AccessList{
+		{Address: accessContract, StorageKeys: [][32]byte{{31: 1}}},
+		{Address: accessOther, StorageKeys: [][32]byte{}},
+		{Address: accessCallee, StorageKeys: [][32]byte{{31: 7}}},
+	}
+	if !reflect.DeepEqual(list, want) {
+		t.Fatalf("Expected %+v, got %+v", want, list)
+	}
+
+	// The result is that of the call run with the list.
+	withList := *msg
+	withList.AccessList = list
+	called, err := DoCall(state, block, &withList, Config{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected call error: %v", err)
+	}
+	if called.UsedGas != res.UsedGas {
+		t.Errorf("Expected %d gas used with the list, got %d", res.UsedGas, called.UsedGas)
+	}
+
+	again, _, err := CreateAccessList(state, block, &withList, Config{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(again, list) {
+		t.Errorf("Expected the list to be stable, got %+v", again)
+	}
+}
+
+// TestAccessListGas checks that the accounts and slots of an access list
+// are warm (EIP-2929): each costs its warm cost when accessed, on top of
+// what listing it costs.
+func TestAccessListGas(t *testing.T) {
+	state := newAccessState(t)
+	block := testBlock(big.NewInt(1))
+	list := AccessList{
+		{Address: accessContract, StorageKeys: [][32]byte{{31: 1}}},
+		{Address: accessOther, StorageKeys: [][32]byte{}},
+	}
+
+	tests := []struct {
+		name string
+		list AccessList
+		gas  uint64 // of the slot and the balance read by the contract
+	}{
+		{"cold", nil, ColdSloadCost + ColdAccountAccessCost},
+		{
+			"warm",
+			list,
+			2*WarmStorageReadCost + 2*TxAccessListAddressGas + TxAccessListStorageKeyGas,
+		},
+	}
+
+	var used []uint64
+	for _, tt := range tests {
+		msg := &CallMsg{From: testSender, To: &accessContract, AccessList: tt.list}
+		res, err := DoCall(state, block, msg, Config{}, nil)
+		if err != nil || res.Failed() {
+			t.Fatalf("%s: Unexpected error: %v %v", tt.name, err, res.Err)
+		}
+		used = append(used, res.UsedGas-tt.gas)
+	}
+	if used[0] != used[1] {
+		t.Errorf("Expected the rest of the gas to be the same, got %d and %d", used[0], used[1])
+	}
+}
@@ -10,6 +10,11 @@ type Account struct {
 	Balance *big.Int
 	Code    []byte              // Contract bytecode
 	Storage map[[32]byte][]byte // Contract's persistent storage
+
+	// stored is set on accounts read from a backend. Their Storage only
+	// holds the slots accessed so far; the others are read from the
+	// backend on first access.
+	stored bool
 }
 
 func NewAccount() *Account {
@@ -20,3 +25,26 @@ func NewAccount() *Account {
 		Storage: make(map[[32]byte][]byte),
 	}
 }
+
+// copyAccount returns a copy of acc, with or without its storage.
+func copyAccount(acc *Account, withStorage bool) *Account {
+	cpy := &Account{
+		Nonce:   acc.Nonce,
+		Balance: new(big.Int).Set(acc.Balance),
+		Code:    acc.Code,
+		Storage: make(map[[32]byte][]byte),
+		stored:  acc.stored,
+	}
+	if withStorage {
+		for key, value := range acc.Storage {
+			cpy.Storage[key] = value
+		}
+	}
+	return cpy
+}
+
+// IsEmpty reports whether the account is empty as defined by EIP-161:
+// zero nonce, zero balance and no code.
+func (a *Account) IsEmpty() bool {
+	return a.Nonce == 0 && a.Balance.Sign() == 0 && len(a.Code) == 0
+}
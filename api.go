@@ -0,0 +1,798 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"prevm/hexutil"
+	"prevm/trie"
+)
+
+// ethAPI implements the eth_ JSON-RPC methods on top of a Node.
+type ethAPI struct {
+	node    *Node
+	filters *Filters
+}
+
+func newEthAPI(node *Node) *ethAPI {
+	return &ethAPI{node: node, filters: NewFilters(node)}
+}
+
+// register adds the methods and subscriptions of the API to server.
+func (api *ethAPI) register(server *RPCServer) {
+	server.Register("eth_chainId", api.chainID)
+	server.Register("eth_blockNumber", api.blockNumber)
+	server.Register("eth_gasPrice", api.gasPrice)
+	server.Register("eth_getBalance", api.getBalance)
+	server.Register("eth_getCode", api.getCode)
+	server.Register("eth_getStorageAt", api.getStorageAt)
+	server.Register("eth_getTransactionCount", api.getTransactionCount)
+	server.Register("eth_call", api.call)
+	server.Register("eth_estimateGas", api.estimateGas)
+	server.Register("eth_createAccessList", api.createAccessList)
+	server.Register("eth_sendRawTransaction", api.sendRawTransaction)
+	server.Register("eth_getTransactionReceipt", api.getTransactionReceipt)
+	server.Register("eth_getLogs", api.getLogs)
+	server.Register("eth_newFilter", api.newFilter)
+	server.Register("eth_newBlockFilter", api.newBlockFilter)
+	server.Register("eth_getFilterChanges", api.getFilterChanges)
+	server.Register("eth_uninstallFilter", api.uninstallFilter)
+
+	server.RegisterSubscription("newHeads", api.subscribeNewHeads)
+	server.RegisterSubscription("logs", api.subscribeLogs)
+	server.RegisterSubscription("newPendingTransactions", api.subscribePendingTransactions)
+}
+
+// rpcAddress is an address in JSON, as 0x-prefixed hex.
+type rpcAddress [20]byte
+
+func (a rpcAddress) MarshalText() ([]byte, error) {
+	return []byte(hexutil.Encode(a[:])), nil
+}
+
+func (a *rpcAddress) UnmarshalText(text []byte) error {
+	addr, err := parseAddress(string(text))
+	if err != nil {
+		return err
+	}
+	*a = addr
+	return nil
+}
+
+// rpcHash is a hash in JSON, as 0x-prefixed hex.
+type rpcHash [32]byte
+
+func (h rpcHash) MarshalText() ([]byte, error) {
+	return []byte(hexutil.Encode(h[:])), nil
+}
+
+func (h *rpcHash) UnmarshalText(text []byte) error {
+	b, err := hexutil.Decode(string(text))
+	if err != nil {
+		return err
+	}
+	if len(b) != 32 {
+		return fmt.Errorf("%w: %d bytes", ErrInvalidHashSize, len(b))
+	}
+	*h = rpcHash(b)
+	return nil
+}
+
+// blockParam is a block parameter: a number, a tag such as "latest" or, as
+// in EIP-1898, an object holding the number or the hash of the block.
+type blockParam struct {
+	tag    string // empty for a number or a hash
+	number uint64
+	hash   *[32]byte
+}
+
+// latestBlock returns the default block parameter. Params are decoded into
+// it, so each request needs its own.
+func latestBlock() *blockParam {
+	return &blockParam{tag: "latest"}
+}
+
+func (p *blockParam) UnmarshalJSON(input []byte) error {
+	if len(input) > 0 && input[0] == '{' {
+		var dec struct {
+			BlockNumber *string  `json:"blockNumber"`
+			BlockHash   *rpcHash `json:"blockHash"`
+		}
+		if err := json.Unmarshal(input, &dec); err != nil {
+			return err
+		}
+		switch {
+		case dec.BlockNumber != nil && dec.BlockHash != nil:
+			return errors.New("cannot specify both blockHash and blockNumber")
+		case dec.BlockHash != nil:
+			*p = blockParam{hash: (*[32]byte)(dec.BlockHash)}
+			return nil
+		case dec.BlockNumber != nil:
+			return p.parse(*dec.BlockNumber)
+		}
+		return errors.New("either blockHash or blockNumber must be specified")
+	}
+	var s string
+	if err := json.Unmarshal(input, &s); err != nil {
+		return err
+	}
+	return p.parse(s)
+}
+
+func (p *blockParam) parse(s string) error {
+	switch s {
+	case "latest", "pending", "safe", "finalized", "earliest":
+		*p = blockParam{tag: s}
+		return nil
+	}
+	number, err := hexutil.DecodeUint64(s)
+	if err != nil {
+		return err
+	}
+	*p = blockParam{number: number}
+	return nil
+}
+
+// block returns the block p stands for. Blocks are mined as soon as a
+// transaction comes in, so the pending, safe and finalized blocks are the
+// latest one.
+func (api *ethAPI) block(p *blockParam) (*Block, error) {
+	var block *Block
+	switch {
+	case p.hash != nil:
+		block = api.node.BlockByHash(*p.hash)
+	case p.tag == "earliest":
+		block = api.node.Genesis()
+	case p.tag != "":
+		block = api.node.Head()
+	default:
+		block = api.node.BlockByNumber(p.number)
+	}
+	if block == nil {
+		return nil, ErrUnknownBlock
+	}
+	return block, nil
+}
+
+// checkLatest returns an error unless p stands for the latest block, the
+// only one whose state is kept.
+func (api *ethAPI) checkLatest(p *blockParam) error {
+	block, err := api.block(p)
+	if err != nil {
+		return err
+	}
+	if block != api.node.Head() {
+		return fmt.Errorf("%w: block %d", ErrHistoricalState, block.Number)
+	}
+	return nil
+}
+
+// readState calls fn with the state of the block p stands for, which must
+// be the latest block.
+func (api *ethAPI) readState(p *blockParam, fn func(state *StateDB)) error {
+	if err := api.checkLatest(p); err != nil {
+		return err
+	}
+	api.node.ReadState(fn)
+	return nil
+}
+
+func (api *ethAPI) chainID(params json.RawMessage) (any, error) {
+	return (*hexutil.Big)(api.node.ChainID()), nil
+}
+
+func (api *ethAPI) blockNumber(params json.RawMessage) (any, error) {
+	return hexutil.Uint64(api.node.Head().Number), nil
+}
+
+// gasPrice returns the base fee of the next block, which is enough for a
+// transaction to be mined.
+func (api *ethAPI) gasPrice(params json.RawMessage) (any, error) {
+	head := api.node.Head()
+	price := CalcBaseFee(head.GasLimit, head.GasUsed, head.BaseFee)
+	if price == nil {
+		price = new(big.Int)
+	}
+	return (*hexutil.Big)(price), nil
+}
+
+func (api *ethAPI) getBalance(params json.RawMessage) (any, error) {
+	var addr rpcAddress
+	block := latestBlock()
+	if err := parseParams(params, 1, &addr, &block); err != nil {
+		return nil, err
+	}
+	var balance *big.Int
+	err := api.readState(block, func(state *StateDB) {
+		balance = new(big.Int).Set(state.GetBalance(addr))
+	})
+	return (*hexutil.Big)(balance), err
+}
+
+func (api *ethAPI) getCode(params json.RawMessage) (any, error) {
+	var addr rpcAddress
+	block := latestBlock()
+	if err := parseParams(params, 1, &addr, &block); err != nil {
+		return nil, err
+	}
+	var code []byte
+	err := api.readState(block, func(state *StateDB) {
+		code = bytes.Clone(state.GetCode(addr))
+	})
+	return hexutil.Bytes(code), err
+}
+
+func (api *ethAPI) getStorageAt(params json.RawMessage) (any, error) {
+	var (
+		addr rpcAddress
+		slot string
+	)
+	block := latestBlock()
+	if err := parseParams(params, 2, &addr, &slot, &block); err != nil {
+		return nil, err
+	}
+	key, err := parseWord(slot)
+	if err != nil {
+		return nil, invalidParams("invalid argument 1: %v", err)
+	}
+	var value [32]byte
+	err = api.readState(block, func(state *StateDB) {
+		value = toWord(state.GetStorage(addr, key))
+	})
+	return hexutil.Bytes(value[:]), err
+}
+
+func (api *ethAPI) getTransactionCount(params json.RawMessage) (any, error) {
+	var addr rpcAddress
+	block := latestBlock()
+	if err := parseParams(params, 1, &addr, &block); err != nil {
+		return nil, err
+	}
+	var nonce uint64
+	err := api.readState(block, func(state *StateDB) {
+		nonce = state.GetNonce(addr)
+	})
+	return hexutil.Uint64(nonce), err
+}
+
+// callArgs is the JSON form of a CallMsg.
+type callArgs struct {
+	From                 *rpcAddress     `json:"from"`
+	To                   *rpcAddress     `json:"to"`
+	Gas                  *hexutil.Uint64 `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas"`
+	Value                *hexutil.Big    `json:"value"`
+	Data                 *hexutil.Bytes  `json:"data"`
+	Input                *hexutil.Bytes  `json:"input"`
+	AccessList           []accessTuple   `json:"accessList"`
+}
+
+// accessTuple is the JSON form of an AccessTuple.
+type accessTuple struct {
+	Address     rpcAddress `json:"address"`
+	StorageKeys []rpcHash  `json:"storageKeys"`
+}
+
+func newAccessListJSON(list AccessList) []accessTuple {
+	enc := make([]accessTuple, len(list))
+	for i, tuple := range list {
+		enc[i] = accessTuple{Address: tuple.Address, StorageKeys: make([]rpcHash, len(tuple.StorageKeys))}
+		for j, key := range tuple.StorageKeys {
+			enc[i].StorageKeys[j] = key
+		}
+	}
+	return enc
+}
+
+// msg returns the message args stand for.
+func (args *callArgs) msg() (*CallMsg, error) {
+	if args.Data != nil && args.Input != nil && !bytes.Equal(*args.Data, *args.Input) {
+		return nil, invalidParams(`both "data" and "input" are set and not equal`)
+	}
+	if args.GasPrice != nil && (args.MaxFeePerGas != nil || args.MaxPriorityFeePerGas != nil) {
+		return nil, invalidParams("both gasPrice and (maxFeePerGas or maxPriorityFeePerGas) specified")
+	}
+	msg := &CallMsg{
+		To:                   (*[20]byte)(args.To),
+		GasPrice:             args.GasPrice.ToInt(),
+		MaxFeePerGas:         args.MaxFeePerGas.ToInt(),
+		MaxPriorityFeePerGas: args.MaxPriorityFeePerGas.ToInt(),
+		Value:                args.Value.ToInt(),
+	}
+	if args.From != nil {
+		msg.From = *args.From
+	}
+	if args.Gas != nil {
+		msg.Gas = uint64(*args.Gas)
+	}
+	switch {
+	case args.Input != nil:
+		msg.Data = *args.Input
+	case args.Data != nil:
+		msg.Data = *args.Data
+	}
+	for _, tuple := range args.AccessList {
+		keys := make([][32]byte, len(tuple.StorageKeys))
+		for i, key := range tuple.StorageKeys {
+			keys[i] = key
+		}
+		msg.AccessList = append(msg.AccessList, AccessTuple{Address: tuple.Address, StorageKeys: keys})
+	}
+	return msg, nil
+}
+
+// executionError returns the error of a failed call, with the revert data
+// and reason if it reverted.
+func executionError(res *ExecutionResult) error {
+	if !errors.Is(res.Err, ErrExecutionReverted) {
+		return res.Err
+	}
+	return rpcRevertError(newRevertError(res.ReturnData))
+}
+
+// rpcRevertError returns the JSON-RPC error of a revert.
+func rpcRevertError(revert *RevertError) *RPCError {
+	err := &RPCError{Code: rpcReverted, Message: revert.Error()}
+	if len(revert.Data) > 0 {
+		err.Data = hexutil.Encode(revert.Data)
+	}
+	return err
+}
+
+// callParams parses the params of eth_call, eth_estimateGas and
+// eth_createAccessList: the call, the block, then the state and block
+// overrides.
+func (api *ethAPI) callParams(params json.RawMessage) (*CallMsg, *CallOverrides, error) {
+	var (
+		args      callArgs
+		overrides CallOverrides
+	)
+	block := latestBlock()
+	if err := parseParams(params, 1, &args, &block, &overrides.State, &overrides.Block); err != nil {
+		return nil, nil, err
+	}
+	if err := api.checkLatest(block); err != nil {
+		return nil, nil, err
+	}
+	msg, err := args.msg()
+	return msg, &overrides, err
+}
+
+func (api *ethAPI) call(params json.RawMessage) (any, error) {
+	msg, overrides, err := api.callParams(params)
+	if err != nil {
+		return nil, err
+	}
+	res, err := api.node.Call(msg, overrides)
+	if err != nil {
+		return nil, err
+	}
+	if res.Failed() {
+		return nil, executionError(res)
+	}
+	return hexutil.Bytes(res.ReturnData), nil
+}
+
+// estimateGas returns the lowest gas limit the call succeeds with.
+func (api *ethAPI) estimateGas(params json.RawMessage) (any, error) {
+	msg, overrides, err := api.callParams(params)
+	if err != nil {
+		return nil, err
+	}
+	gas, err := api.node.EstimateGas(msg, overrides)
+	var revert *RevertError
+	if errors.As(err, &revert) {
+		return nil, rpcRevertError(revert)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hexutil.Uint64(gas), nil
+}
+
+// accessListResultJSON is the result of eth_createAccessList. Error is the
+// error the call failed with, if it did.
+type accessListResultJSON struct {
+	AccessList []accessTuple  `json:"accessList"`
+	GasUsed    hexutil.Uint64 `json:"gasUsed"`
+	Error      string         `json:"error,omitempty"`
+}
+
+func (api *ethAPI) createAccessList(params json.RawMessage) (any, error) {
+	msg, overrides, err := api.callParams(params)
+	if err != nil {
+		return nil, err
+	}
+	list, res, err := api.node.CreateAccessList(msg, overrides)
+	if err != nil {
+		return nil, err
+	}
+	result := &accessListResultJSON{AccessList: newAccessListJSON(list), GasUsed: hexutil.Uint64(res.UsedGas)}
+	if res.Failed() {
+		result.Error = executionError(res).Error()
+	}
+	return result, nil
+}
+
+func (api *ethAPI) sendRawTransaction(params json.RawMessage) (any, error) {
+	var raw hexutil.Bytes
+	if err := parseParams(params, 1, &raw); err != nil {
+		return nil, err
+	}
+	tx, err := DecodeTransaction(raw)
+	if err != nil {
+		return nil, invalidParams("invalid argument 0: %v", err)
+	}
+	hash, err := api.node.SendTransaction(tx)
+	if err != nil {
+		return nil, err
+	}
+	return rpcHash(hash), nil
+}
+
+// receiptJSON is the JSON form of a Receipt, as geth returns it.
+type receiptJSON struct {
+	BlockHash         rpcHash         `json:"blockHash"`
+	BlockNumber       hexutil.Uint64  `json:"blockNumber"`
+	ContractAddress   *rpcAddress     `json:"contractAddress"`
+	CumulativeGasUsed hexutil.Uint64  `json:"cumulativeGasUsed"`
+	EffectiveGasPrice *hexutil.Big    `json:"effectiveGasPrice"`
+	From              rpcAddress      `json:"from"`
+	GasUsed           hexutil.Uint64  `json:"gasUsed"`
+	Logs              []*logJSON      `json:"logs"`
+	LogsBloom         hexutil.Bytes   `json:"logsBloom"`
+	Status            hexutil.Uint64  `json:"status"`
+	To                *rpcAddress     `json:"to"`
+	TransactionHash   rpcHash         `json:"transactionHash"`
+	TransactionIndex  hexutil.Uint64  `json:"transactionIndex"`
+	Type              hexutil.Uint64  `json:"type"`
+	BlobGasUsed       *hexutil.Uint64 `json:"blobGasUsed,omitempty"`
+	BlobGasPrice      *hexutil.Big    `json:"blobGasPrice,omitempty"`
+}
+
+// logJSON is the JSON form of a Log.
+type logJSON struct {
+	Address          rpcAddress     `json:"address"`
+	Topics           []rpcHash      `json:"topics"`
+	Data             hexutil.Bytes  `json:"data"`
+	BlockNumber      hexutil.Uint64 `json:"blockNumber"`
+	TransactionHash  rpcHash        `json:"transactionHash"`
+	TransactionIndex hexutil.Uint64 `json:"transactionIndex"`
+	BlockHash        rpcHash        `json:"blockHash"`
+	LogIndex         hexutil.Uint64 `json:"logIndex"`
+	Removed          bool           `json:"removed"`
+}
+
+func newLogJSON(log *Log) *logJSON {
+	enc := &logJSON{
+		Address:          log.Address,
+		Topics:           make([]rpcHash, len(log.Topics)),
+		Data:             log.Data,
+		BlockNumber:      hexutil.Uint64(log.BlockNumber),
+		TransactionHash:  log.TxHash,
+		TransactionIndex: hexutil.Uint64(log.TxIndex),
+		BlockHash:        log.BlockHash,
+		LogIndex:         hexutil.Uint64(log.Index),
+		Removed:          log.Removed,
+	}
+	for i, topic := range log.Topics {
+		enc.Topics[i] = topic
+	}
+	return enc
+}
+
+func newLogsJSON(logs []*Log) []*logJSON {
+	enc := make([]*logJSON, len(logs))
+	for i, log := range logs {
+		enc[i] = newLogJSON(log)
+	}
+	return enc
+}
+
+func (api *ethAPI) getTransactionReceipt(params json.RawMessage) (any, error) {
+	var hash rpcHash
+	if err := parseParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+	block, i := api.node.Transaction(hash)
+	if block == nil {
+		return nil, nil
+	}
+	tx, receipt := block.Transactions[i], block.Receipts[i]
+	enc := &receiptJSON{
+		BlockHash:         block.Hash,
+		BlockNumber:       hexutil.Uint64(block.Number),
+		ContractAddress:   (*rpcAddress)(receipt.ContractAddress),
+		CumulativeGasUsed: hexutil.Uint64(receipt.CumulativeGasUsed),
+		EffectiveGasPrice: (*hexutil.Big)(receipt.EffectiveGasPrice),
+		From:              block.Senders[i],
+		GasUsed:           hexutil.Uint64(receipt.GasUsed),
+		Logs:              newLogsJSON(receipt.Logs),
+		LogsBloom:         receipt.Bloom[:],
+		Status:            hexutil.Uint64(receipt.Status),
+		To:                (*rpcAddress)(tx.To),
+		TransactionHash:   receipt.TxHash,
+		TransactionIndex:  hexutil.Uint64(receipt.TransactionIndex),
+		Type:              hexutil.Uint64(receipt.Type),
+	}
+	if tx.Type == BlobTxType {
+		blobGasUsed := hexutil.Uint64(receipt.BlobGasUsed)
+		enc.BlobGasUsed = &blobGasUsed
+		enc.BlobGasPrice = (*hexutil.Big)(receipt.BlobGasPrice)
+	}
+	return enc, nil
+}
+
+// filterJSON is the JSON form of a FilterQuery.
+type filterJSON struct {
+	BlockHash *rpcHash     `json:"blockHash"`
+	FromBlock *blockParam  `json:"fromBlock"`
+	ToBlock   *blockParam  `json:"toBlock"`
+	Addresses addressList  `json:"address"`
+	Topics    []topicsJSON `json:"topics"`
+}
+
+// addressList is an address or a list of addresses.
+type addressList []rpcAddress
+
+func (l *addressList) UnmarshalJSON(input []byte) error {
+	if len(input) > 0 && input[0] == '[' {
+		return json.Unmarshal(input, (*[]rpcAddress)(l))
+	}
+	var addr rpcAddress
+	if err := json.Unmarshal(input, &addr); err != nil {
+		return err
+	}
+	*l = addressList{addr}
+	return nil
+}
+
+// topicsJSON is the topics allowed at a position of a filter: null for any
+// topic, a topic or a list of topics.
+type topicsJSON []rpcHash
+
+func (t *topicsJSON) UnmarshalJSON(input []byte) error {
+	switch {
+	case string(input) == "null":
+		*t = nil
+		return nil
+	case len(input) > 0 && input[0] == '[':
+		var topics []*rpcHash
+		if err := json.Unmarshal(input, &topics); err != nil {
+			return err
+		}
+		*t = nil
+		for _, topic := range topics {
+			if topic == nil {
+				// null in a list matches any topic.
+				*t = nil
+				return nil
+			}
+			*t = append(*t, *topic)
+		}
+		return nil
+	}
+	var topic rpcHash
+	if err := json.Unmarshal(input, &topic); err != nil {
+		return err
+	}
+	*t = topicsJSON{topic}
+	return nil
+}
+
+// query returns the FilterQuery f stands for. The range of blocks starts
+// at the latest block by default, and is open-ended unless toBlock is a
+// number or the earliest block: it ends at the latest block for
+// eth_getLogs, and takes in the blocks to come for filters.
+func (api *ethAPI) query(f *filterJSON) (*FilterQuery, error) {
+	q := &FilterQuery{BlockHash: (*[32]byte)(f.BlockHash)}
+	if f.BlockHash != nil {
+		if f.FromBlock != nil || f.ToBlock != nil {
+			return nil, invalidParams("cannot specify both blockHash and fromBlock/toBlock")
+		}
+	} else {
+		var err error
+		if q.FromBlock, err = api.blockNumberOf(f.FromBlock); err != nil {
+			return nil, err
+		}
+		if f.ToBlock != nil && (f.ToBlock.tag == "" || f.ToBlock.tag == "earliest") {
+			if q.ToBlock, err = api.blockNumberOf(f.ToBlock); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, addr := range f.Addresses {
+		q.Addresses = append(q.Addresses, addr)
+	}
+	for _, topics := range f.Topics {
+		position := make([][32]byte, len(topics))
+		for i, topic := range topics {
+			position[i] = topic
+		}
+		q.Topics = append(q.Topics, position)
+	}
+	return q, nil
+}
+
+// blockNumberOf returns the number of the block p stands for, the latest
+// block if p is nil. Numbers past the latest block are kept as is.
+func (api *ethAPI) blockNumberOf(p *blockParam) (*uint64, error) {
+	if p == nil {
+		p = latestBlock()
+	}
+	if p.tag == "" && p.hash == nil {
+		return &p.number, nil
+	}
+	block, err := api.block(p)
+	if err != nil {
+		return nil, err
+	}
+	return &block.Number, nil
+}
+
+func (api *ethAPI) getLogs(params json.RawMessage) (any, error) {
+	var f filterJSON
+	if err := parseParams(params, 1, &f); err != nil {
+		return nil, err
+	}
+	q, err := api.query(&f)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := api.node.Logs(q)
+	if err != nil {
+		return nil, err
+	}
+	return newLogsJSON(logs), nil
+}
+
+func (api *ethAPI) newFilter(params json.RawMessage) (any, error) {
+	var f filterJSON
+	if err := parseParams(params, 1, &f); err != nil {
+		return nil, err
+	}
+	q, err := api.query(&f)
+	if err != nil {
+		return nil, err
+	}
+	return api.filters.NewLogFilter(q), nil
+}
+
+func (api *ethAPI) newBlockFilter(params json.RawMessage) (any, error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return api.filters.NewBlockFilter(), nil
+}
+
+func (api *ethAPI) getFilterChanges(params json.RawMessage) (any, error) {
+	var id string
+	if err := parseParams(params, 1, &id); err != nil {
+		return nil, err
+	}
+	logs, blocks, err := api.filters.Changes(id)
+	if err != nil {
+		return nil, err
+	}
+	if blocks != nil {
+		hashes := make([]rpcHash, len(blocks))
+		for i, hash := range blocks {
+			hashes[i] = hash
+		}
+		return hashes, nil
+	}
+	return newLogsJSON(logs), nil
+}
+
+func (api *ethAPI) uninstallFilter(params json.RawMessage) (any, error) {
+	var id string
+	if err := parseParams(params, 1, &id); err != nil {
+		return nil, err
+	}
+	return api.filters.Uninstall(id), nil
+}
+
+// headerJSON is the JSON form of a block header, as sent to newHeads
+// subscribers.
+type headerJSON struct {
+	ParentHash       rpcHash         `json:"parentHash"`
+	UncleHash        rpcHash         `json:"sha3Uncles"`
+	Coinbase         rpcAddress      `json:"miner"`
+	StateRoot        rpcHash         `json:"stateRoot"`
+	TxRoot           rpcHash         `json:"transactionsRoot"`
+	ReceiptRoot      rpcHash         `json:"receiptsRoot"`
+	Bloom            hexutil.Bytes   `json:"logsBloom"`
+	Difficulty       *hexutil.Big    `json:"difficulty"`
+	Number           hexutil.Uint64  `json:"number"`
+	GasLimit         hexutil.Uint64  `json:"gasLimit"`
+	GasUsed          hexutil.Uint64  `json:"gasUsed"`
+	Timestamp        hexutil.Uint64  `json:"timestamp"`
+	ExtraData        hexutil.Bytes   `json:"extraData"`
+	MixHash          rpcHash         `json:"mixHash"`
+	Nonce            hexutil.Bytes   `json:"nonce"`
+	BaseFee          *hexutil.Big    `json:"baseFeePerGas,omitempty"`
+	WithdrawalsRoot  *rpcHash        `json:"withdrawalsRoot,omitempty"`
+	BlobGasUsed      *hexutil.Uint64 `json:"blobGasUsed,omitempty"`
+	ExcessBlobGas    *hexutil.Uint64 `json:"excessBlobGas,omitempty"`
+	ParentBeaconRoot *rpcHash        `json:"parentBeaconBlockRoot,omitempty"`
+	Hash             rpcHash         `json:"hash"`
+}
+
+func newHeaderJSON(block *Block) *headerJSON {
+	enc := &headerJSON{
+		ParentHash:  block.ParentHash,
+		UncleHash:   EmptyUncleHash,
+		Coinbase:    block.Coinbase,
+		StateRoot:   block.StateRoot,
+		TxRoot:      block.TxRoot,
+		ReceiptRoot: block.ReceiptRoot,
+		Bloom:       block.Bloom[:],
+		Difficulty:  (*hexutil.Big)(block.Difficulty),
+		Number:      hexutil.Uint64(block.Number),
+		GasLimit:    hexutil.Uint64(block.GasLimit),
+		GasUsed:     hexutil.Uint64(block.GasUsed),
+		Timestamp:   hexutil.Uint64(block.Timestamp),
+		ExtraData:   block.ExtraData,
+		MixHash:     block.MixHash,
+		Nonce:       binary.BigEndian.AppendUint64(nil, block.Nonce),
+		Hash:        block.Hash,
+	}
+	// The fields the header of a block with a base fee carries, see
+	// Block.header.
+	if block.BaseFee != nil {
+		var zero hexutil.Uint64
+		withdrawalsRoot, parentBeaconRoot := rpcHash(trie.EmptyRoot), rpcHash{}
+		enc.BaseFee = (*hexutil.Big)(block.BaseFee)
+		enc.WithdrawalsRoot = &withdrawalsRoot
+		enc.BlobGasUsed, enc.ExcessBlobGas = &zero, &zero
+		enc.ParentBeaconRoot = &parentBeaconRoot
+	}
+	return enc
+}
+
+// subscribeNewHeads notifies the header of every new block.
+func (api *ethAPI) subscribeNewHeads(params json.RawMessage, notify func(any)) (func(), error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return api.node.OnBlock(func(block *Block) {
+		notify(newHeaderJSON(block))
+	}), nil
+}
+
+// subscribeLogs notifies every new log matching the filter given, one log
+// at a time.
+func (api *ethAPI) subscribeLogs(params json.RawMessage, notify func(any)) (func(), error) {
+	var f filterJSON
+	if err := parseParams(params, 0, &f); err != nil {
+		return nil, err
+	}
+	q, err := api.query(&f)
+	if err != nil {
+		return nil, err
+	}
+	return api.node.OnBlock(func(block *Block) {
+		for _, log := range q.blockLogs(block) {
+			notify(newLogJSON(log))
+		}
+	}), nil
+}
+
+// subscribePendingTransactions notifies the hash of every new transaction.
+// Transactions are mined as soon as they are sent, so they are notified
+// with the block holding them.
+func (api *ethAPI) subscribePendingTransactions(params json.RawMessage, notify func(any)) (func(), error) {
+	if err := parseParams(params, 0); err != nil {
+		return nil, err
+	}
+	return api.node.OnBlock(func(block *Block) {
+		for _, tx := range block.Transactions {
+			notify(rpcHash(tx.Hash()))
+		}
+	}), nil
+}
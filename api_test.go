@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"prevm/hexutil"
+)
+
+// newTestServer serves the eth_ methods of a Node started from the
+// development genesis, and returns its URL, node and server.
+func newTestServer(t *testing.T) (string, *Node, *RPCServer) {
+	t.Helper()
+	node := NewNode(DevGenesis(), NewStateDB())
+	server := NewRPCServer()
+	newEthAPI(node).register(server)
+	srv := httptest.NewServer(server)
+	t.Cleanup(srv.Close)
+	return srv.URL, node, server
+}
+
+// rpcCall calls method over HTTP and returns its result, or its error.
+func rpcCall(t *testing.T, url, method string, params ...any) (json.RawMessage, *RPCError) {
+	t.Helper()
+	if params == nil {
+		params = []any{}
+	}
+	body, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var res rpcResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		t.Fatalf("%s: Unexpected error: %v", method, err)
+	}
+	return res.Result, res.Error
+}
+
+// devKey returns the i-th development key and its address.
+func devKey(t *testing.T, i int) (*ecdsa.PrivateKey, [20]byte) {
+	t.Helper()
+	key, err := HexToPrivateKey(DevKeys[i])
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return key, PrivateKeyToAddress(key)
+}
+
+// signedRaw returns tx signed with key, as hex, and its hash.
+func signedRaw(t *testing.T, tx *Transaction, key *ecdsa.PrivateKey) (string, [32]byte) {
+	t.Helper()
+	signed, err := SignTransaction(tx, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return hexutil.Encode(raw), signed.Hash()
+}
+
+// TestEthAPIState checks the methods reading the chain and the state of the
+// genesis block.
+func TestEthAPIState(t *testing.T) {
+	url, _, _ := newTestServer(t)
+	_, dev := devKey(t, 0)
+	addr := hexutil.Encode(dev[:])
+
+	tests := []struct {
+		method string
+		params []any
+		want   string
+	}{
+		{"eth_chainId", nil, `"0x539"`},
+		{"eth_blockNumber", nil, `"0x0"`},
+		// The base fee of the block after an empty genesis block.
+		{"eth_gasPrice", nil, `"0x342770c0"`},
+		{"eth_getBalance", []any{addr, "latest"}, `"0x21e19e0c9bab2400000"`},
+		{"eth_getBalance", []any{addr, map[string]string{"blockNumber": "0x0"}}, `"0x21e19e0c9bab2400000"`},
+		{"eth_getTransactionCount", []any{addr}, `"0x0"`},
+		{"eth_getCode", []any{addr, "latest"}, `"0x"`},
+		{"eth_getStorageAt", []any{addr, "0x0", "latest"}, `"0x` + strings.Repeat("0", 64) + `"`},
+		{"eth_getTransactionReceipt", []any{"0x" + strings.Repeat("ab", 32)}, `null`},
+	}
+
+	for _, tt := range tests {
+		got, rpcErr := rpcCall(t, url, tt.method, tt.params...)
+		if rpcErr != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.method, rpcErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Expected %s, got %s", tt.method, tt.want, got)
+		}
+	}
+
+	errTests := []struct {
+		method string
+		params []any
+		code   int
+	}{
+		{"eth_getBalance", []any{addr, "0x5"}, rpcServerError},
+		{"eth_getBalance", []any{"0x01"}, rpcInvalidParams},
+		{"eth_getBalance", nil, rpcInvalidParams},
+		{"eth_nope", nil, rpcMethodNotFound},
+		{"eth_sendRawTransaction", []any{"0x01"}, rpcInvalidParams},
+	}
+	for _, tt := range errTests {
+		if _, rpcErr := rpcCall(t, url, tt.method, tt.params...); rpcErr == nil || rpcErr.Code != tt.code {
+			t.Errorf("%s %v: Expected error code %d, got %v", tt.method, tt.params, tt.code, rpcErr)
+		}
+	}
+}
+
+// TestEthAPITransactions deploys a contract and calls it through
+// eth_sendRawTransaction, then reads the receipts, the logs and the state
+// they left.
+func TestEthAPITransactions(t *testing.T) {
+	url, _, _ := newTestServer(t)
+	key, dev := devKey(t, 0)
+	topic := "0x" + strings.Repeat("77", 32)
+
+	// LOG1(0, 32, topic) of the word 42, then SSTORE(0, 1).
+	runtime, err := Assemble("PUSH1 42 PUSH1 0 MSTORE PUSH32 " + topic + " PUSH1 32 PUSH1 0 LOG1 PUSH1 1 PUSH1 0 SSTORE STOP")
+	if err != nil {
+		t.Fatalf("Unexpected assembler error: %v", err)
+	}
+	// Return the code appended to the 11 bytes of init code.
+	initCode, _ := Assemble("PUSH1 " + hexutil.EncodeUint64(uint64(len(runtime))) + " DUP1 PUSH1 11 PUSH1 0 CODECOPY PUSH1 0 RETURN")
+	contract := CreateAddress(dev, 0)
+
+	create := &Transaction{
+		Type:                 DynamicFeeTxType,
+		ChainID:              big.NewInt(DefaultChainID),
+		GasLimit:             200000,
+		MaxFeePerGas:         big.NewInt(2_000_000_000),
+		MaxPriorityFeePerGas: big.NewInt(1),
+		Data:                 append(initCode, runtime...),
+	}
+	call := &Transaction{
+		Type:     LegacyTxType,
+		ChainID:  big.NewInt(DefaultChainID),
+		Nonce:    1,
+		GasLimit: 100000,
+		GasPrice: big.NewInt(2_000_000_000),
+		To:       &contract,
+	}
+
+	var hashes []rpcHash
+	for _, tx := range []*Transaction{create, call} {
+		raw, want := signedRaw(t, tx, key)
+		got, rpcErr := rpcCall(t, url, "eth_sendRawTransaction", raw)
+		if rpcErr != nil {
+			t.Fatalf("Unexpected error: %v", rpcErr)
+		}
+		var hash rpcHash
+		if err := json.Unmarshal(got, &hash); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if hash != want {
+			t.Errorf("Expected the hash 0x%x, got 0x%x", want, hash)
+		}
+		hashes = append(hashes, hash)
+
+		// A transaction is only mined once.
+		if _, rpcErr := rpcCall(t, url, "eth_sendRawTransaction", raw); rpcErr == nil || !strings.Contains(rpcErr.Message, "already known") {
+			t.Errorf("Expected an already known error, got %v", rpcErr)
+		}
+	}
+
+	var receipts [2]receiptJSON
+	for i, hash := range hashes {
+		got, rpcErr := rpcCall(t, url, "eth_getTransactionReceipt", hash)
+		if rpcErr != nil {
+			t.Fatalf("Unexpected error: %v", rpcErr)
+		}
+		if err := json.Unmarshal(got, &receipts[i]); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		r := receipts[i]
+		if r.Status != 1 || r.BlockNumber != hexutil.Uint64(i+1) || r.TransactionHash != hash || r.From != rpcAddress(dev) || r.Type != hexutil.Uint64([]*Transaction{create, call}[i].Type) {
+			t.Errorf("%d: Unexpected receipt %s", i, got)
+		}
+	}
+	if r := receipts[0]; r.ContractAddress == nil || *r.ContractAddress != rpcAddress(contract) || r.To != nil {
+		t.Errorf("Expected the address of the created contract, got %v", r.ContractAddress)
+	}
+	if r := receipts[1]; len(r.Logs) != 1 || r.To == nil || *r.To != rpcAddress(contract) || r.ContractAddress != nil {
+		t.Fatalf("Expected a call with a log, got %+v", r)
+	}
+
+	// The logs of the call, found by address and topic.
+	log := receipts[1].Logs[0]
+	if log.Address != rpcAddress(contract) || len(log.Topics) != 1 || hexutil.Encode(log.Topics[0][:]) != topic ||
+		log.BlockHash != receipts[1].BlockHash || log.TransactionHash != hashes[1] {
+		t.Errorf("Unexpected log %+v", log)
+	}
+	contractHex := hexutil.Encode(contract[:])
+	filters := []struct {
+		name   string
+		filter map[string]any
+		want   int
+	}{
+		{"all", map[string]any{"fromBlock": "0x0", "toBlock": "latest"}, 1},
+		{"latest", map[string]any{}, 1},
+		{"address and topic", map[string]any{"fromBlock": "earliest", "address": contractHex, "topics": []any{topic}}, 1},
+		{"any topic", map[string]any{"fromBlock": "0x0", "address": []string{contractHex}, "topics": []any{nil}}, 1},
+		{"other topic", map[string]any{"fromBlock": "0x0", "topics": []any{"0x" + strings.Repeat("00", 32)}}, 0},
+		{"other address", map[string]any{"fromBlock": "0x0", "address": hexutil.Encode(dev[:])}, 0},
+		{"block hash", map[string]any{"blockHash": receipts[1].BlockHash}, 1},
+		{"creation block", map[string]any{"fromBlock": "0x1", "toBlock": "0x1"}, 0},
+	}
+	for _, tt := range filters {
+		got, rpcErr := rpcCall(t, url, "eth_getLogs", tt.filter)
+		if rpcErr != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, rpcErr)
+			continue
+		}
+		var logs []logJSON
+		if err := json.Unmarshal(got, &logs); err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		if len(logs) != tt.want {
+			t.Errorf("%s: Expected %d logs, got %s", tt.name, tt.want, got)
+		} else if tt.want == 1 && !reflect.DeepEqual(logs[0], *log) {
+			t.Errorf("%s: Expected the log of the receipt %+v, got %+v", tt.name, *log, logs[0])
+		}
+	}
+
+	// The state the transactions left.
+	stateTests := []struct {
+		method string
+		params []any
+		want   string
+	}{
+		{"eth_blockNumber", nil, `"0x2"`},
+		{"eth_getTransactionCount", []any{hexutil.Encode(dev[:])}, `"0x2"`},
+		{"eth_getCode", []any{contractHex}, `"` + hexutil.Encode(runtime) + `"`},
+		{"eth_getStorageAt", []any{contractHex, "0x0"}, `"0x` + strings.Repeat("0", 63) + `1"`},
+		{"eth_call", []any{map[string]any{"from": hexutil.Encode(dev[:]), "to": contractHex}}, `"0x"`},
+		// 21000, the LOG1 (1006), the MSTORE and its memory (6), 7 pushes and
+		// a cold SSTORE leaving the slot as it is (2200), which needs more
+		// than 2300 gas left: 101 more than the call uses.
+		{"eth_estimateGas", []any{map[string]any{"to": contractHex}}, `"0x5f0e"`},
+	}
+	for _, tt := range stateTests {
+		got, rpcErr := rpcCall(t, url, tt.method, tt.params...)
+		if rpcErr != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.method, rpcErr)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Expected %s, got %s", tt.method, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnknownMnemonic = errors.New("unknown mnemonic")
+	ErrInvalidOperand  = errors.New("invalid operand")
+	ErrMissingOperand  = errors.New("missing operand")
+	ErrUndefinedLabel  = errors.New("undefined label")
+	ErrDuplicateLabel  = errors.New("duplicate label")
+)
+
+// opcodeByName maps mnemonics, and a few common aliases, to opcodes.
+var opcodeByName = newOpcodeByName()
+
+func newOpcodeByName() map[string]byte {
+	byName := map[string]byte{
+		"SHA3":       KECCAK256,
+		"PREVRANDAO": DIFFICULTY,
+	}
+	for op, name := range opcodeNames {
+		if name != "" {
+			byName[name] = byte(op)
+		}
+	}
+	return byName
+}
+
+// asmItem is an assembled instruction, or raw data, before labels are
+// resolved.
+type asmItem struct {
+	line int
+	op   byte
+	data []byte // immediate of a PUSH, or the bytes of a DATA directive
+	raw  bool   // DATA directive: data is emitted as is
+
+	// label is the label a PUSH refers to. size is the size of its
+	// immediate, grown as needed when auto is set.
+	label string
+	size  int
+	auto  bool
+}
+
+func (it *asmItem) len() int {
+	if it.raw {
+		return len(it.data)
+	}
+	if it.label != "" {
+		return 1 + it.size
+	}
+	return 1 + len(it.data)
+}
+
+// Assemble translates assembly source into bytecode. The source is a list
+// of whitespace-separated tokens:
+//
+//	MNEMONIC          an instruction, e.g. MSTORE (case-insensitive)
+//	PUSHn operand     a push of exactly n bytes
+//	PUSH operand      a push sized to fit the operand
+//	DATA 0x...        raw bytes
+//	name:             a label for the offset of what follows, usually a JUMPDEST
+//
+// Operands are hex (0x...) or decimal numbers, or label names. Comments
+// start with ';', '#' or '//' and run to the end of the line. Tokens such
+// as "0x001a:" are taken as program counters and ignored, so the output of
+// the disassembler assembles back to the same code.
+//
+// PUSH with a zero operand is assembled as PUSH1 0x00 rather than PUSH0,
+// which the interpreter doesn't implement.
+func Assemble(src string) ([]byte, error) {
+	var (
+		items  []*asmItem
+		labels = make(map[string]int) // label -> index of the next item
+	)
+	for n, line := range strings.Split(src, "\n") {
+		n++
+		tokens := strings.Fields(stripComment(line))
+		for i := 0; i < len(tokens); i++ {
+			tok := tokens[i]
+			if name, ok := strings.CutSuffix(tok, ":"); ok {
+				if isNumber(name) {
+					continue // program counter
+				}
+				if !isIdent(name) {
+					return nil, fmt.Errorf("line %d: invalid label %q", n, name)
+				}
+				if _, ok := labels[name]; ok {
+					return nil, fmt.Errorf("line %d: %w: %s", n, ErrDuplicateLabel, name)
+				}
+				labels[name] = len(items)
+				continue
+			}
+
+			mnemonic := strings.ToUpper(tok)
+			operand := func() (string, error) {
+				if i+1 >= len(tokens) {
+					return "", fmt.Errorf("line %d: %w for %s", n, ErrMissingOperand, mnemonic)
+				}
+				i++
+				return tokens[i], nil
+			}
+
+			switch op, ok := opcodeByName[mnemonic]; {
+			case mnemonic == "DATA":
+				arg, err := operand()
+				if err != nil {
+					return nil, err
+				}
+				data, err := parseHexData(arg)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w: %s", n, ErrInvalidOperand, arg)
+				}
+				items = append(items, &asmItem{line: n, data: data, raw: true})
+
+			case mnemonic == "PUSH" || pushSize(op) > 0:
+				arg, err := operand()
+				if err != nil {
+					return nil, err
+				}
+				it, err := parsePush(n, op, arg)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, it)
+
+			case ok:
+				items = append(items, &asmItem{line: n, op: op})
+
+			default:
+				return nil, fmt.Errorf("line %d: %w: %s", n, ErrUnknownMnemonic, tok)
+			}
+		}
+	}
+
+	offsets, err := layout(items, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	code := make([]byte, 0, offsets[len(items)])
+	for _, it := range items {
+		switch {
+		case it.raw:
+			code = append(code, it.data...)
+		case it.label != "":
+			imm := new(big.Int).SetUint64(uint64(offsets[labels[it.label]])).FillBytes(make([]byte, it.size))
+			code = append(code, PUSH1+byte(it.size-1))
+			code = append(code, imm...)
+		default:
+			code = append(code, it.op)
+			code = append(code, it.data...)
+		}
+	}
+	return code, nil
+}
+
+// layout computes the offset of every item, plus the code size at the
+// end, sizing the label pushes. Sizes only grow, so it settles.
+func layout(items []*asmItem, labels map[string]int) ([]int, error) {
+	for _, it := range items {
+		if it.label == "" {
+			continue
+		}
+		if _, ok := labels[it.label]; !ok {
+			return nil, fmt.Errorf("line %d: %w: %s", it.line, ErrUndefinedLabel, it.label)
+		}
+	}
+
+	offsets := make([]int, len(items)+1)
+	for {
+		for i, it := range items {
+			offsets[i+1] = offsets[i] + it.len()
+		}
+		grown := false
+		for _, it := range items {
+			if it.label == "" {
+				continue
+			}
+			need := max(1, (big.NewInt(int64(offsets[labels[it.label]])).BitLen()+7)/8)
+			if need <= it.size {
+				continue
+			}
+			if !it.auto {
+				return nil, fmt.Errorf("line %d: %w: label %s at offset %d doesn't fit in PUSH%d", it.line, ErrInvalidOperand, it.label, offsets[labels[it.label]], it.size)
+			}
+			it.size = need
+			grown = true
+		}
+		if !grown {
+			return offsets, nil
+		}
+	}
+}
+
+// parsePush parses the operand of a PUSH. op is PUSH1-PUSH32, or 0 for an
+// automatically sized PUSH.
+func parsePush(line int, op byte, arg string) (*asmItem, error) {
+	size := pushSize(op)
+	if isIdent(arg) {
+		it := &asmItem{line: line, label: arg, size: size, auto: size == 0}
+		if it.auto {
+			it.size = 1
+		}
+		return it, nil
+	}
+
+	value, ok := parseNumber(arg)
+	if !ok || value.Sign() < 0 || value.BitLen() > 256 {
+		return nil, fmt.Errorf("line %d: %w: %s", line, ErrInvalidOperand, arg)
+	}
+	if size == 0 {
+		size = max(1, (value.BitLen()+7)/8)
+	}
+	if (value.BitLen()+7)/8 > size {
+		return nil, fmt.Errorf("line %d: %w: %s doesn't fit in PUSH%d", line, ErrInvalidOperand, arg, size)
+	}
+	return &asmItem{line: line, op: PUSH1 + byte(size-1), data: value.FillBytes(make([]byte, size))}, nil
+}
+
+// stripComment removes a trailing ';', '#' or '//' comment.
+func stripComment(line string) string {
+	for _, marker := range []string{";", "#", "//"} {
+		if i := strings.Index(line, marker); i >= 0 {
+			line = line[:i]
+		}
+	}
+	return line
+}
+
+// parseNumber parses a 0x-prefixed hex or a decimal number.
+func parseNumber(s string) (*big.Int, bool) {
+	if hex, ok := strings.CutPrefix(strings.ToLower(s), "0x"); ok {
+		if hex == "" {
+			return nil, false
+		}
+		return new(big.Int).SetString(hex, 16)
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func isNumber(s string) bool {
+	_, ok := parseNumber(s)
+	return ok
+}
+
+// parseHexData parses 0x-prefixed hex bytes.
+func parseHexData(s string) ([]byte, error) {
+	if !strings.HasPrefix(strings.ToLower(s), "0x") || len(s)%2 == 1 {
+		return nil, ErrInvalidOperand
+	}
+	return DecodeHex(s)
+}
+
+// isIdent reports whether s is a valid label name: a letter or underscore
+// followed by letters, digits, underscores or dots.
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		case i > 0 && (c == '.' || c >= '0' && c <= '9'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// asmCommand implements 'prevm asm'.
+func asmCommand(args []string) error {
+	fs := flag.NewFlagSet("asm", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: prevm asm [file]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Assembles the source in file, or stdin if omitted or '-', and prints the bytecode as hex.")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		src []byte
+		err error
+	)
+	if path := fs.Arg(0); path == "" || path == "-" {
+		src, err = io.ReadAll(os.Stdin)
+	} else {
+		src, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+	code, err := Assemble(string(src))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("0x%x\n", code)
+	return nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// TestAssemble checks the code assembled from small programs.
+func TestAssemble(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"empty", "", ""},
+		{"mnemonics", "push1 0x01 PUSH1 2 add", "6001600201"},
+		{"sized push", "PUSH 0 PUSH 255 PUSH 256 PUSH2 1", "600060ff610100610001"},
+		{"aliases", "SHA3 PREVRANDAO", "2044"},
+		{"data", "DATA 0xdeadbeef STOP", "deadbeef00"},
+		{
+			"comments and program counters",
+			"0x0000: PUSH1 0x01 ; one\n# a comment\n0x0002: POP // pop it",
+			"600150",
+		},
+		{
+			"labels",
+			"PUSH end JUMP\nDATA 0xfe\nend: JUMPDEST",
+			"6004" + "56" + "fe" + "5b",
+		},
+		{
+			"backward label",
+			"loop: JUMPDEST PUSH2 loop JUMP",
+			"5b" + "610000" + "56",
+		},
+		{
+			// The label is past 255, so its PUSH grows to two bytes.
+			"growing label",
+			"PUSH end JUMP DATA 0x" + hex.EncodeToString(make([]byte, 300)) + " end: JUMPDEST",
+			"610130" + "56" + hex.EncodeToString(make([]byte, 300)) + "5b",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := Assemble(tt.src)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("%s: Expected %s, got %x", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestAssembleErrors checks that invalid programs are rejected.
+func TestAssembleErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want error
+	}{
+		{"unknown mnemonic", "PUSH1 1 FOO", ErrUnknownMnemonic},
+		{"missing operand", "PUSH1", ErrMissingOperand},
+		{"operand too large", "PUSH1 0x100", ErrInvalidOperand},
+		{"negative operand", "PUSH -1", ErrInvalidOperand},
+		{"odd data", "DATA 0xabc", ErrInvalidOperand},
+		{"undefined label", "PUSH nowhere JUMP", ErrUndefinedLabel},
+		{"duplicate label", "a: JUMPDEST a: JUMPDEST", ErrDuplicateLabel},
+		{
+			"label too far for its push",
+			"PUSH1 end JUMP DATA 0x" + hex.EncodeToString(make([]byte, 300)) + " end: JUMPDEST",
+			ErrInvalidOperand,
+		},
+	}
+
+	for _, tt := range tests {
+		if _, err := Assemble(tt.src); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+// TestAssembleDisassembly checks that the disassembler output assembles
+// back to the same code, whatever the code holds.
+func TestAssembleDisassembly(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		{"arithmetic", "6001600201600052" + "60206000f3"},
+		{"jumps", "6003565b600156"},
+		{"all pushes", "7f" + hex.EncodeToString(bytes.Repeat([]byte{0xab}, 32)) + "61ffff"},
+		{"unknown opcodes", "0c0d0e0f21"},
+		{"truncated push", "00630102"},
+		{"metadata", "6080fe" + solcMetadata},
+	}
+
+	for _, tt := range tests {
+		code := unhex(tt.code)
+		got, err := Assemble(Disassemble(code).String())
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, code) {
+			t.Errorf("%s: Expected %x, got %x", tt.name, code, got)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"prevm/db"
+	"prevm/rlp"
+)
+
+// Database layout of a persisted state:
+//
+//	"a" + address         -> rlp([nonce, balance, codeHash])
+//	"c" + codeHash        -> code, stored once however many accounts share it
+//	"s" + address + slot  -> storage value
+var (
+	accountPrefix = []byte("a")
+	codePrefix    = []byte("c")
+	storagePrefix = []byte("s")
+)
+
+func accountKey(addr [20]byte) []byte {
+	return append(append([]byte{}, accountPrefix...), addr[:]...)
+}
+
+func codeKey(hash [32]byte) []byte {
+	return append(append([]byte{}, codePrefix...), hash[:]...)
+}
+
+func accountStoragePrefix(addr [20]byte) []byte {
+	return append(append([]byte{}, storagePrefix...), addr[:]...)
+}
+
+func storageKey(addr [20]byte, slot [32]byte) []byte {
+	return append(accountStoragePrefix(addr), slot[:]...)
+}
+
+// readAccount reads an account with its code from the backend. Its
+// storage slots are read as they are accessed, see accountSlot. It returns
+// nil if the account doesn't exist.
+func readAccount(backend db.KeyValueStore, addr [20]byte) (*Account, error) {
+	enc, err := backend.Get(accountKey(addr))
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeStoredAccount(backend, enc)
+}
+
+func decodeStoredAccount(backend db.KeyValueStore, enc []byte) (*Account, error) {
+	item, err := rlp.Decode(enc)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := item.Items(3)
+	if err != nil {
+		return nil, err
+	}
+
+	acc := NewAccount()
+	acc.stored = true
+	if acc.Nonce, err = fields[0].Uint64(); err != nil {
+		return nil, err
+	}
+	if acc.Balance, err = fields[1].BigInt(); err != nil {
+		return nil, err
+	}
+	codeHash, err := fields[2].Bytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(codeHash) != 32 {
+		return nil, ErrInvalidHashSize
+	}
+	if [32]byte(codeHash) != EmptyCodeHash {
+		if acc.Code, err = backend.Get(codeKey([32]byte(codeHash))); err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// readSlot reads a storage slot of addr from the backend, nil if it isn't
+// stored.
+func readSlot(backend db.KeyValueStore, addr [20]byte, slot [32]byte) ([]byte, error) {
+	value, err := backend.Get(storageKey(addr, slot))
+	if errors.Is(err, db.ErrNotFound) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// readStorage adds the stored slots of addr that are not in storage yet.
+func readStorage(backend db.KeyValueStore, addr [20]byte, storage map[[32]byte][]byte) error {
+	prefix := accountStoragePrefix(addr)
+	it := backend.NewIterator(prefix)
+	defer it.Release()
+	for it.Next() {
+		var slot [32]byte
+		copy(slot[:], it.Key()[len(prefix):])
+		if _, ok := storage[slot]; !ok {
+			storage[slot] = append([]byte(nil), it.Value()...)
+		}
+	}
+	return it.Error()
+}
+
+// accountSlot returns the value of a slot of acc, the account at addr. The
+// slots of a stored account are read from the backend on first access and
+// kept in its storage, those that aren't stored as nil.
+func (s *StateDB) accountSlot(addr [20]byte, acc *Account, slot [32]byte) []byte {
+	if value, ok := acc.Storage[slot]; ok || !acc.stored {
+		return value
+	}
+	value, err := readSlot(s.backend, addr, slot)
+	if err != nil {
+		s.setError(err)
+		return nil
+	}
+	acc.Storage[slot] = value
+	return value
+}
+
+// fullAccount returns acc, the account at addr, with all of its storage.
+// A stored account is copied and completed from the backend, so that the
+// cache keeps only the slots accessed.
+func (s *StateDB) fullAccount(addr [20]byte, acc *Account) *Account {
+	if !acc.stored {
+		return acc
+	}
+	cpy := copyAccount(acc, true)
+	cpy.stored = false
+	if err := readStorage(s.backend, addr, cpy.Storage); err != nil {
+		s.setError(err)
+	}
+	return cpy
+}
+
+// writeAccount adds the writes persisting acc, but its storage, to batch.
+func writeAccount(backend db.KeyValueStore, batch db.Batch, addr [20]byte, acc *Account) error {
+	codeHash := acc.CodeHash()
+	enc := rlp.EncodeList(
+		rlp.EncodeUint(acc.Nonce),
+		rlp.EncodeBigInt(acc.Balance),
+		rlp.EncodeBytes(codeHash[:]),
+	)
+	if err := batch.Put(accountKey(addr), enc); err != nil {
+		return err
+	}
+
+	if len(acc.Code) > 0 {
+		has, err := backend.Has(codeKey(codeHash))
+		if err != nil {
+			return err
+		}
+		if !has {
+			if err := batch.Put(codeKey(codeHash), acc.Code); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeSlot adds the write of a storage slot to batch, or its deletion if
+// the value is zero.
+func writeSlot(batch db.Batch, addr [20]byte, slot [32]byte, value []byte) error {
+	if isZero(value) {
+		return batch.Delete(storageKey(addr, slot))
+	}
+	return batch.Put(storageKey(addr, slot), value)
+}
+
+// deleteStorage adds the deletion of all stored slots of addr to batch.
+func deleteStorage(backend db.KeyValueStore, batch db.Batch, addr [20]byte) error {
+	prefix := accountStoragePrefix(addr)
+	it := backend.NewIterator(prefix)
+	defer it.Release()
+	for it.Next() {
+		if err := batch.Delete(append([]byte(nil), it.Key()...)); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+func isZero(value []byte) bool {
+	for _, b := range value {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// openState returns the state persisted in the LevelDB database at
+// datadir, created if needed, along with a function closing it. Without a
+// datadir the state is in memory only.
+func openState(datadir string) (*StateDB, func() error, error) {
+	if datadir == "" {
+		return NewStateDB(), func() error { return nil }, nil
+	}
+	store, err := db.OpenLevelDB(datadir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return OpenStateDB(store), store.Close, nil
+}
+
+// Commit writes the accounts and storage slots changed since the last
+// commit to the backend and empties the account cache. It must be called
+// between transactions. Without a backend it does nothing.
+//
+// Only the written slots of an account read from the backend are written
+// back. An account deleted or created anew loses all of its stored slots,
+// and a new one has all of its slots written.
+func (s *StateDB) Commit() error {
+	if s.backend == nil {
+		return nil
+	}
+	if s.dbErr != nil {
+		return s.dbErr
+	}
+	s.resetJournal()
+
+	batch := s.backend.NewBatch()
+	for addr := range s.pending {
+		acc, ok := s.accounts[addr]
+		if !ok || !acc.stored {
+			if err := deleteStorage(s.backend, batch, addr); err != nil {
+				return err
+			}
+		}
+		if !ok {
+			if err := batch.Delete(accountKey(addr)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := writeAccount(s.backend, batch, addr, acc); err != nil {
+			return err
+		}
+		if acc.stored {
+			continue
+		}
+		for slot, value := range acc.Storage {
+			if isZero(value) {
+				continue
+			}
+			if err := batch.Put(storageKey(addr, slot), value); err != nil {
+				return err
+			}
+		}
+	}
+	for slot := range s.dirtySlots {
+		acc, ok := s.accounts[slot.addr]
+		if !ok || !acc.stored {
+			continue
+		}
+		if err := writeSlot(batch, slot.addr, slot.key, acc.Storage[slot.key]); err != nil {
+			return err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+
+	s.pending = make(map[[20]byte]struct{})
+	s.dirtySlots = make(map[storageSlot]struct{})
+	s.accounts = make(map[[20]byte]*Account)
+	return nil
+}
+
+// hasAccounts reports whether the state holds any account, cached or in
+// the backend.
+func (s *StateDB) hasAccounts() bool {
+	if len(s.accounts) > 0 || s.backend == nil {
+		return len(s.accounts) > 0
+	}
+	it := s.backend.NewIterator(accountPrefix)
+	defer it.Release()
+	return it.Next()
+}
+
+// ForEachAccount calls fn for every account of the state, with all of its
+// storage, in no particular order. Accounts that are only in the backend,
+// and the storage of cached ones, are read for the call but not cached, so
+// the whole state never has to fit in memory.
+func (s *StateDB) ForEachAccount(fn func(addr [20]byte, acc *Account)) {
+	for addr, acc := range s.accounts {
+		fn(addr, s.fullAccount(addr, acc))
+	}
+	if s.backend == nil {
+		return
+	}
+
+	it := s.backend.NewIterator(accountPrefix)
+	defer it.Release()
+	for it.Next() {
+		var addr [20]byte
+		copy(addr[:], it.Key()[len(accountPrefix):])
+		if _, ok := s.accounts[addr]; ok {
+			continue
+		}
+		if _, deleted := s.pending[addr]; deleted {
+			continue
+		}
+
+		acc, err := decodeStoredAccount(s.backend, it.Value())
+		if err != nil {
+			s.setError(err)
+			return
+		}
+		if err := readStorage(s.backend, addr, acc.Storage); err != nil {
+			s.setError(err)
+			return
+		}
+		fn(addr, acc)
+	}
+	if err := it.Error(); err != nil {
+		s.setError(err)
+	}
+}
+
+// setError records the first backend error. Reads can't fail from the
+// caller's point of view, so the error is reported by Error and Commit.
+func (s *StateDB) setError(err error) {
+	if s.dbErr == nil {
+		logger.Error("State backend error", "error", err)
+		s.dbErr = err
+	}
+}
+
+// Error returns the first error hit while reading the backend.
+func (s *StateDB) Error() error {
+	return s.dbErr
+}
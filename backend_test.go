@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"prevm/db"
+	"testing"
+)
+
+// TestPersistedStorage checks that the slots of a persisted account are
+// read as they are accessed, and that commits only write the slots that
+// changed.
+func TestPersistedStorage(t *testing.T) {
+	store := db.NewMemoryDB()
+	addr := [20]byte{0xc0}
+
+	state := OpenStateDB(store)
+	state.SetBalance(addr, big.NewInt(1))
+	for i := byte(1); i <= 3; i++ {
+		state.SetStorage(addr, [32]byte{31: i}, []byte{i})
+	}
+	state.resetJournal()
+	root := state.StateRoot()
+	if err := state.Commit(); err != nil {
+		t.Fatalf("Unexpected commit error: %v", err)
+	}
+	entries := store.Len()
+
+	state = OpenStateDB(store)
+	if got := state.GetStorage(addr, [32]byte{31: 2}); !bytes.Equal(got, []byte{2}) {
+		t.Errorf("Expected slot 2 to hold 2, got %x", got)
+	}
+	if got := len(state.accounts[addr].Storage); got != 1 {
+		t.Errorf("Expected only the slot read to be loaded, got %d", got)
+	}
+	if state.StateRoot() != root {
+		t.Errorf("Expected the state root of the committed state")
+	}
+	if got := len(state.accounts[addr].Storage); got != 1 {
+		t.Errorf("Expected the state root to leave the cache alone, got %d slots", got)
+	}
+
+	// Clear a slot and set a new one.
+	state.SetStorage(addr, [32]byte{31: 1}, []byte{0})
+	state.SetStorage(addr, [32]byte{31: 9}, []byte{9})
+	if err := state.Commit(); err != nil {
+		t.Fatalf("Unexpected commit error: %v", err)
+	}
+	if store.Len() != entries {
+		t.Errorf("Expected %d entries, got %d", entries, store.Len())
+	}
+
+	tests := []struct {
+		slot  byte
+		value []byte
+	}{{1, nil}, {2, []byte{2}}, {3, []byte{3}}, {9, []byte{9}}}
+	state = OpenStateDB(store)
+	for _, tt := range tests {
+		if got := state.GetStorage(addr, [32]byte{31: tt.slot}); !bytes.Equal(got, tt.value) {
+			t.Errorf("Expected slot %d to hold %x, got %x", tt.slot, tt.value, got)
+		}
+	}
+
+	// A recreated account loses its stored slots.
+	state.CreateAccount(addr)
+	state.SetStorage(addr, [32]byte{31: 7}, []byte{7})
+	if err := state.Commit(); err != nil {
+		t.Fatalf("Unexpected commit error: %v", err)
+	}
+	state = OpenStateDB(store)
+	if got := state.GetStorage(addr, [32]byte{31: 2}); got != nil {
+		t.Errorf("Expected slot 2 to be gone, got %x", got)
+	}
+	if got := state.GetStorage(addr, [32]byte{31: 7}); !bytes.Equal(got, []byte{7}) {
+		t.Errorf("Expected slot 7 to hold 7, got %x", got)
+	}
+}
+
+// TestLevelDBState checks that a state committed to LevelDB is read back
+// whole once the database is closed and opened again.
+func TestLevelDBState(t *testing.T) {
+	dir := t.TempDir()
+	addr := [20]byte{0xc0}
+	code := []byte{0x60, 0x00, 0x54, 0x00}
+
+	store, err := db.OpenLevelDB(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	state := OpenStateDB(store)
+	state.SetBalance(addr, big.NewInt(1000))
+	state.SetNonce(addr, 3)
+	state.SetCode(addr, code)
+	state.SetStorage(addr, [32]byte{31: 1}, []byte{0x2a})
+	state.SetBalance(testSender, big.NewInt(5))
+	root := state.StateRoot()
+	if err := state.Commit(); err != nil {
+		t.Fatalf("Unexpected commit error: %v", err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	store, err = db.OpenLevelDB(dir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer store.Close()
+	state = OpenStateDB(store)
+	if got := state.GetBalance(addr).Int64(); got != 1000 {
+		t.Errorf("Expected balance 1000, got %d", got)
+	}
+	if got := state.GetNonce(addr); got != 3 {
+		t.Errorf("Expected nonce 3, got %d", got)
+	}
+	if got := state.GetCode(addr); !bytes.Equal(got, code) {
+		t.Errorf("Expected code %x, got %x", code, got)
+	}
+	if got := state.GetStorage(addr, [32]byte{31: 1}); !bytes.Equal(got, []byte{0x2a}) {
+		t.Errorf("Expected slot 1 to hold 2a, got %x", got)
+	}
+	if got := state.GetBalance(testSender).Int64(); got != 5 {
+		t.Errorf("Expected sender balance 5, got %d", got)
+	}
+	if state.StateRoot() != root {
+		t.Errorf("Expected the state root of the committed state")
+	}
+	if err := state.Error(); err != nil {
+		t.Errorf("Unexpected database error: %v", err)
+	}
+}
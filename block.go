@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Block level limits.
+const (
+	MaxBlobGasPerBlock = MaxBlobsPerTransaction * GasPerBlob // EIP-4844 (Cancun)
+	GWei               = 1_000_000_000
+
+	MinBlobGasPrice           = 1       // EIP-4844
+	BlobBaseFeeUpdateFraction = 3338477 // EIP-4844 (Cancun)
+
+	BaseFeeChangeDenominator = 8 // Bounds the base fee change between blocks to 12.5% (EIP-1559)
+	ElasticityMultiplier     = 2 // Blocks target half their gas limit (EIP-1559)
+)
+
+var (
+	ErrGasLimitReached     = errors.New("gas limit reached")
+	ErrBlobGasLimitReached = errors.New("blob gas limit reached")
+	ErrMissingGasLimit     = errors.New("block gas limit not set")
+)
+
+// GasPool tracks the gas still available to the transactions of a block.
+type GasPool uint64
+
+// AddGas makes gas available again, e.g. the unused part of a transaction's
+// gas limit.
+func (gp *GasPool) AddGas(amount uint64) *GasPool {
+	if uint64(*gp) > ^uint64(0)-amount {
+		panic("gas pool pushed above uint64")
+	}
+	*gp += GasPool(amount)
+	return gp
+}
+
+// SubGas reserves gas from the pool, failing if not enough is left.
+func (gp *GasPool) SubGas(amount uint64) error {
+	if uint64(*gp) < amount {
+		return fmt.Errorf("%w: have %d, want %d", ErrGasLimitReached, uint64(*gp), amount)
+	}
+	*gp -= GasPool(amount)
+	return nil
+}
+
+// Gas returns the gas left in the pool.
+func (gp *GasPool) Gas() uint64 {
+	return uint64(*gp)
+}
+
+// CalcBlobFee returns the blob base fee for the given excess blob gas of
+// a block (EIP-4844).
+func CalcBlobFee(excessBlobGas uint64) *big.Int {
+	return fakeExponential(big.NewInt(MinBlobGasPrice), new(big.Int).SetUint64(excessBlobGas), big.NewInt(BlobBaseFeeUpdateFraction))
+}
+
+// CalcBaseFee returns the base fee of the block following a block with
+// the given gas limit, gas used and base fee (EIP-1559). It moves towards
+// blocks using half of their gas limit. A nil base fee gives nil.
+func CalcBaseFee(gasLimit, gasUsed uint64, baseFee *big.Int) *big.Int {
+	if baseFee == nil {
+		return nil
+	}
+	target := gasLimit / ElasticityMultiplier
+	if target == 0 || gasUsed == target {
+		return new(big.Int).Set(baseFee)
+	}
+
+	// The change is proportional to how far the block was from the target.
+	delta := new(big.Int)
+	if gasUsed > target {
+		delta.SetUint64(gasUsed - target)
+	} else {
+		delta.SetUint64(target - gasUsed)
+	}
+	delta.Mul(delta, baseFee)
+	delta.Div(delta, new(big.Int).SetUint64(target))
+	delta.Div(delta, big.NewInt(BaseFeeChangeDenominator))
+
+	if gasUsed > target {
+		if delta.Sign() == 0 {
+			delta.SetInt64(1)
+		}
+		return delta.Add(baseFee, delta)
+	}
+	return delta.Sub(baseFee, delta)
+}
+
+// fakeExponential approximates factor * e ** (numerator / denominator)
+// using a Taylor expansion, as specified by EIP-4844.
+func fakeExponential(factor, numerator, denominator *big.Int) *big.Int {
+	output := new(big.Int)
+	accum := new(big.Int).Mul(factor, denominator)
+	for i := int64(1); accum.Sign() > 0; i++ {
+		output.Add(output, accum)
+
+		accum.Mul(accum, numerator)
+		accum.Div(accum, denominator)
+		accum.Div(accum, big.NewInt(i))
+	}
+	return output.Div(output, denominator)
+}
+
+// Withdrawal is a validator withdrawal from the consensus layer (EIP-4895).
+// It credits Amount Gwei to Address after all transactions of the block.
+type Withdrawal struct {
+	Index     uint64
+	Validator uint64
+	Address   [20]byte
+	Amount    uint64 // in Gwei
+}
+
+// RejectedTx is a transaction that could not be included in the block.
+type RejectedTx struct {
+	// Index is the position of the transaction in the list passed to ApplyBlock.
+	Index int
+	Err   error
+}
+
+// BlockResult is the outcome of applying a block.
+type BlockResult struct {
+	// State is the post-state. It is the processor's state, modified in place.
+	State *StateDB
+	// Transactions are the included transactions, in order. Receipts and
+	// Results are index-aligned with it.
+	Transactions []*Transaction
+	Receipts     []*Receipt
+	Results      []*ExecutionResult
+	// Rejected lists the transactions that were skipped because they were
+	// invalid or didn't fit in the block.
+	Rejected []RejectedTx
+
+	GasUsed     uint64
+	BlobGasUsed uint64
+	Bloom       Bloom
+	Logs        []*Log
+
+	// Roots of the post-state and of the block's transactions, receipts
+	// and withdrawals, as found in the block header.
+	StateRoot       [32]byte
+	TxRoot          [32]byte
+	ReceiptRoot     [32]byte
+	WithdrawalsRoot [32]byte
+}
+
+// BlockProcessor applies whole blocks of transactions on top of a state.
+type BlockProcessor struct {
+	State  *StateDB
+	Config Config
+}
+
+func NewBlockProcessor(state *StateDB) *BlockProcessor {
+	return &BlockProcessor{State: state}
+}
+
+// ApplyBlock runs the transactions of a block in order, followed by its
+// withdrawals. Transaction senders are recovered from their signatures.
+//
+// The block gas limit is enforced through a gas pool: each transaction
+// reserves its gas limit up front and hands back what it didn't use.
+// Transactions that are invalid or don't fit in the remaining gas are
+// rejected and skipped, the way a block builder would; the rest of the
+// block is still applied.
+func (p *BlockProcessor) ApplyBlock(block *BlockContext, txs []*Transaction, withdrawals []Withdrawal) (*BlockResult, error) {
+	if block.GasLimit == nil || !block.GasLimit.IsUint64() {
+		return nil, ErrMissingGasLimit
+	}
+
+	evm := NewEVM(p.State, block)
+	evm.Config = p.Config
+
+	gp := GasPool(block.GasLimit.Uint64())
+	result := &BlockResult{State: p.State}
+
+	for i, tx := range txs {
+		receipt, res, err := p.applyTransaction(evm, &gp, result, tx)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedTx{Index: i, Err: err})
+			logger.Debug("Rejected transaction", "index", i, "error", err)
+			continue
+		}
+
+		result.Transactions = append(result.Transactions, tx)
+		result.Receipts = append(result.Receipts, receipt)
+		result.Results = append(result.Results, res)
+		result.Logs = append(result.Logs, receipt.Logs...)
+		result.Bloom.Or(&receipt.Bloom)
+	}
+
+	// Withdrawals are processed after all transactions and cost no gas.
+	for _, w := range withdrawals {
+		amount := new(big.Int).Mul(new(big.Int).SetUint64(w.Amount), big.NewInt(GWei))
+		p.State.AddBalance(w.Address, amount)
+	}
+	p.State.Finalise()
+
+	txRoot, err := TransactionsRoot(result.Transactions)
+	if err != nil {
+		return nil, err
+	}
+	result.StateRoot = p.State.StateRoot()
+	result.TxRoot = txRoot
+	result.ReceiptRoot = ReceiptsRoot(result.Receipts)
+	result.WithdrawalsRoot = WithdrawalsRoot(withdrawals)
+
+	return result, nil
+}
+
+// applyTransaction runs a single transaction of the block and builds its
+// receipt. An error means the transaction was not included.
+func (p *BlockProcessor) applyTransaction(evm *EVM, gp *GasPool, result *BlockResult, tx *Transaction) (*Receipt, *ExecutionResult, error) {
+	sender, err := tx.Sender()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := gp.SubGas(tx.GasLimit); err != nil {
+		return nil, nil, err
+	}
+	if result.BlobGasUsed+tx.BlobGas() > MaxBlobGasPerBlock {
+		gp.AddGas(tx.GasLimit)
+		return nil, nil, fmt.Errorf("%w: have %d, want %d", ErrBlobGasLimitReached, MaxBlobGasPerBlock-result.BlobGasUsed, tx.BlobGas())
+	}
+
+	res, err := evm.ProcessTransaction(tx, sender)
+	if err != nil {
+		gp.AddGas(tx.GasLimit)
+		return nil, nil, err
+	}
+	gp.AddGas(tx.GasLimit - res.UsedGas)
+
+	result.GasUsed += res.UsedGas
+	result.BlobGasUsed += tx.BlobGas()
+
+	block := evm.BlockCtx
+	txHash := tx.Hash()
+	txIndex := uint(len(result.Receipts))
+
+	receipt := &Receipt{
+		Type:              tx.Type,
+		Status:            ReceiptStatusSuccessful,
+		CumulativeGasUsed: result.GasUsed,
+		Logs:              res.Logs,
+		TxHash:            txHash,
+		ContractAddress:   res.ContractAddress,
+		GasUsed:           res.UsedGas,
+		EffectiveGasPrice: tx.EffectiveGasPrice(block.BaseFee),
+		TransactionIndex:  txIndex,
+	}
+	if res.Failed() {
+		receipt.Status = ReceiptStatusFailed
+	}
+	if receipt.Logs == nil {
+		receipt.Logs = []*Log{}
+	}
+	if tx.Type == BlobTxType {
+		receipt.BlobGasUsed = tx.BlobGas()
+		receipt.BlobGasPrice = block.BlobBaseFee
+	}
+	if block.Number != nil {
+		receipt.BlockNumber = new(big.Int).Set(block.Number)
+	}
+
+	for i, log := range receipt.Logs {
+		log.TxHash = txHash
+		log.TxIndex = txIndex
+		log.Index = uint(len(result.Logs) + i)
+	}
+	receipt.Bloom = LogsBloom(receipt.Logs)
+
+	return receipt, res, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// signTestTx signs tx with the first development key.
+func signTestTx(t *testing.T, tx *Transaction) *Transaction {
+	t.Helper()
+	key, err := HexToPrivateKey(DevKeys[0])
+	if err != nil {
+		t.Fatalf("Unexpected key error: %v", err)
+	}
+	signed, err := SignTransaction(tx, key)
+	if err != nil {
+		t.Fatalf("Unexpected signing error: %v", err)
+	}
+	return signed
+}
+
+// TestApplyBlock applies a block with a transaction emitting a log, a plain
+// transfer, and two transactions that must be rejected, then checks the
+// receipts, the blooms and the withdrawal.
+func TestApplyBlock(t *testing.T) {
+	key, _ := HexToPrivateKey(DevKeys[0])
+	sender := PrivateKeyToAddress(key)
+	contract := [20]byte{0xc0}
+	to := [20]byte{0x02}
+	withdrawn := [20]byte{0x03}
+
+	state := NewStateDB()
+	state.SetBalance(sender, big.NewInt(1_000_000_000))
+	// LOG1(0, 0, 0x2a)
+	state.SetCode(contract, []byte{0x60, 0x2a, 0x60, 0x00, 0x60, 0x00, 0xa1, 0x00})
+
+	block := testBlock(big.NewInt(1))
+	block.GasLimit = big.NewInt(100_000)
+	txs := []*Transaction{
+		signTestTx(t, &Transaction{Nonce: 0, GasPrice: big.NewInt(1), GasLimit: 50_000, To: &contract}),
+		signTestTx(t, &Transaction{Nonce: 5, GasPrice: big.NewInt(1), GasLimit: 21_000, To: &to}),
+		signTestTx(t, &Transaction{Nonce: 1, GasPrice: big.NewInt(1), GasLimit: 21_000, To: &to, Value: big.NewInt(7)}),
+		signTestTx(t, &Transaction{Nonce: 2, GasPrice: big.NewInt(1), GasLimit: 60_000, To: &to}),
+	}
+	withdrawals := []Withdrawal{{Index: 0, Address: withdrawn, Amount: 1}}
+
+	res, err := NewBlockProcessor(state).ApplyBlock(block, txs, withdrawals)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(res.Transactions) != 2 || res.Transactions[0] != txs[0] || res.Transactions[1] != txs[2] {
+		t.Fatalf("Expected transactions 0 and 2 to be included, got %d", len(res.Transactions))
+	}
+	if len(res.Rejected) != 2 {
+		t.Fatalf("Expected 2 rejected transactions, got %d", len(res.Rejected))
+	}
+	for i, want := range []struct {
+		index int
+		err   error
+	}{{1, ErrNonceTooHigh}, {3, ErrGasLimitReached}} {
+		if got := res.Rejected[i]; got.Index != want.index || !errors.Is(got.Err, want.err) {
+			t.Errorf("Expected transaction %d rejected with %v, got %d with %v", want.index, want.err, got.Index, got.Err)
+		}
+	}
+
+	// 21000, 3 PUSH1 and LOG1 with no data.
+	first, second := res.Receipts[0], res.Receipts[1]
+	if first.GasUsed != 21759 || first.CumulativeGasUsed != 21759 {
+		t.Errorf("Expected 21759 gas used by the first transaction, got %d (%d)", first.GasUsed, first.CumulativeGasUsed)
+	}
+	if second.GasUsed != 21000 || second.CumulativeGasUsed != 42759 || res.GasUsed != 42759 {
+		t.Errorf("Expected 42759 cumulative gas, got %d (block %d)", second.CumulativeGasUsed, res.GasUsed)
+	}
+	if first.Status != ReceiptStatusSuccessful || second.TransactionIndex != 1 {
+		t.Errorf("Expected a successful receipt and index 1, got %d and %d", first.Status, second.TransactionIndex)
+	}
+
+	if len(res.Logs) != 1 || len(first.Logs) != 1 {
+		t.Fatalf("Expected 1 log, got %d", len(res.Logs))
+	}
+	log := res.Logs[0]
+	topic := [32]byte{31: 0x2a}
+	if log.Address != contract || len(log.Topics) != 1 || log.Topics[0] != topic {
+		t.Errorf("Expected a log of the contract with topic 0x2a, got %x %x", log.Address, log.Topics)
+	}
+	if log.TxHash != txs[0].Hash() || log.TxIndex != 0 || log.Index != 0 {
+		t.Errorf("Expected the log to point at the first transaction, got %x %d %d", log.TxHash, log.TxIndex, log.Index)
+	}
+
+	for name, bloom := range map[string]*Bloom{"receipt": &first.Bloom, "block": &res.Bloom} {
+		if !bloom.Test(contract[:]) || !bloom.Test(topic[:]) {
+			t.Errorf("Expected the %s bloom to hold the log address and topic", name)
+		}
+	}
+	if second.Bloom != (Bloom{}) {
+		t.Errorf("Expected an empty bloom for the transfer")
+	}
+
+	if got := state.GetBalance(to).Int64(); got != 7 {
+		t.Errorf("Expected recipient balance 7, got %d", got)
+	}
+	if got := state.GetBalance(withdrawn).Int64(); got != GWei {
+		t.Errorf("Expected withdrawal balance %d, got %d", GWei, got)
+	}
+	if res.StateRoot != state.StateRoot() {
+		t.Errorf("Expected the state root of the post-state")
+	}
+}
+
+// TestGasPool checks that the pool refuses to go below zero.
+func TestGasPool(t *testing.T) {
+	gp := GasPool(100)
+	if err := gp.SubGas(60); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := gp.SubGas(50); !errors.Is(err, ErrGasLimitReached) {
+		t.Errorf("Expected ErrGasLimitReached, got %v", err)
+	}
+	if gp.AddGas(10).Gas() != 50 {
+		t.Errorf("Expected 50 gas left, got %d", gp.Gas())
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"math/big"
+)
+
+// CallMsg is a message run the way eth_call runs it: a transaction that is
+// neither signed nor included, from any account.
+type CallMsg struct {
+	From [20]byte
+	To   *[20]byte // nil for a contract creation
+	// Gas is the gas limit, the block gas limit if zero.
+	Gas uint64
+	// The gas price fields pick the type of the transaction, as for a
+	// transaction. Calls without a price don't pay for gas.
+	GasPrice             *big.Int
+	MaxFeePerGas         *big.Int
+	MaxPriorityFeePerGas *big.Int
+	Value                *big.Int
+	Data                 []byte
+	AccessList           AccessList
+}
+
+// transaction returns the transaction msg stands for in block.
+func (msg *CallMsg) transaction(block *BlockContext) *Transaction {
+	tx := &Transaction{
+		ChainID:    block.ChainID,
+		GasLimit:   msg.Gas,
+		To:         msg.To,
+		Value:      msg.Value,
+		Data:       msg.Data,
+		AccessList: msg.AccessList,
+	}
+	if tx.GasLimit == 0 && block.GasLimit != nil {
+		tx.GasLimit = block.GasLimit.Uint64()
+	}
+
+	switch {
+	case msg.MaxFeePerGas != nil || msg.MaxPriorityFeePerGas != nil:
+		tx.Type = DynamicFeeTxType
+		tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = msg.MaxFeePerGas, msg.MaxPriorityFeePerGas
+		if tx.MaxPriorityFeePerGas == nil {
+			tx.MaxPriorityFeePerGas = new(big.Int)
+		}
+		// As in geth, a call with only a tip pays the base fee on top of it.
+		if tx.MaxFeePerGas == nil {
+			tx.MaxFeePerGas = new(big.Int).Set(tx.MaxPriorityFeePerGas)
+			if block.BaseFee != nil {
+				tx.MaxFeePerGas.Add(tx.MaxFeePerGas, block.BaseFee)
+			}
+		}
+	case len(msg.AccessList) > 0:
+		tx.Type = AccessListTxType
+		tx.GasPrice = msg.GasPrice
+	default:
+		tx.Type = LegacyTxType
+		tx.GasPrice = msg.GasPrice
+	}
+	if tx.FeeCap() == nil {
+		tx.GasPrice = new(big.Int)
+	}
+	return tx
+}
+
+// DoCall runs msg in block on a copy of state, which is left untouched,
+// with the overrides if not nil. The nonce of the sender isn't checked, and
+// neither is whether it has code. Like a transaction, the call fails with
+// an error if it is invalid, e.g. if the sender can't pay for the value
+// sent.
+func DoCall(state *StateDB, block *BlockContext, msg *CallMsg, config Config, overrides *CallOverrides) (*ExecutionResult, error) {
+	ctx := *block
+	state = state.Copy()
+	if overrides != nil {
+		overrides.Block.Apply(&ctx)
+		if err := overrides.State.Apply(state); err != nil {
+			return nil, err
+		}
+	}
+	tx := msg.transaction(&ctx)
+
+	// As in geth, a call that doesn't pay for gas runs with a zero base fee
+	// so that it passes the fee checks.
+	if tx.FeeCap().Sign() == 0 && ctx.BaseFee != nil {
+		ctx.BaseFee = new(big.Int)
+	}
+
+	evm := NewEVM(state, &ctx)
+	evm.Config = config
+	evm.Config.SkipAccountChecks = true
+	return evm.ProcessTransaction(tx, msg.From)
+}
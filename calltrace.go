@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"prevm/hexutil"
+	"strings"
+)
+
+// CallFrame is a call or contract creation recorded by the CallTracer,
+// with the frames it started.
+type CallFrame struct {
+	Type         byte // CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE or CREATE2
+	From         [20]byte
+	To           *[20]byte // nil for a failed contract creation
+	Value        *big.Int  // nil for STATICCALL
+	Gas          uint64
+	GasUsed      uint64
+	Input        []byte
+	Output       []byte
+	Error        string
+	RevertReason string
+	Calls        []*CallFrame
+}
+
+// callFrameJSON is the JSON form of a CallFrame. The fields and their order
+// follow geth's callTracer.
+type callFrameJSON struct {
+	From         hexutil.Bytes  `json:"from"`
+	Gas          hexutil.Uint64 `json:"gas"`
+	GasUsed      hexutil.Uint64 `json:"gasUsed"`
+	To           hexutil.Bytes  `json:"to,omitempty"`
+	Input        hexutil.Bytes  `json:"input"`
+	Output       hexutil.Bytes  `json:"output,omitempty"`
+	Error        string         `json:"error,omitempty"`
+	RevertReason string         `json:"revertReason,omitempty"`
+	Calls        []*CallFrame   `json:"calls,omitempty"`
+	Value        *hexutil.Big   `json:"value,omitempty"`
+	Type         string         `json:"type"`
+}
+
+func (f *CallFrame) MarshalJSON() ([]byte, error) {
+	enc := callFrameJSON{
+		From:         f.From[:],
+		Gas:          hexutil.Uint64(f.Gas),
+		GasUsed:      hexutil.Uint64(f.GasUsed),
+		Input:        f.Input,
+		Output:       f.Output,
+		Error:        f.Error,
+		RevertReason: f.RevertReason,
+		Calls:        f.Calls,
+		Value:        (*hexutil.Big)(f.Value),
+		Type:         OpcodeName(f.Type),
+	}
+	if f.To != nil {
+		enc.To = f.To[:]
+	}
+	if enc.Input == nil {
+		enc.Input = []byte{}
+	}
+	return json.Marshal(enc)
+}
+
+// Tree returns the frame and its calls as an indented tree, one frame per
+// line.
+func (f *CallFrame) Tree() string {
+	var b strings.Builder
+	f.writeTree(&b, "", "")
+	return b.String()
+}
+
+func (f *CallFrame) writeTree(b *strings.Builder, prefix, childPrefix string) {
+	fmt.Fprintf(b, "%s%s 0x%x", prefix, OpcodeName(f.Type), f.From)
+	if f.To != nil {
+		fmt.Fprintf(b, " -> 0x%x", *f.To)
+	}
+	if f.Value != nil && f.Value.Sign() != 0 {
+		fmt.Fprintf(b, " value: %d", f.Value)
+	}
+	fmt.Fprintf(b, " gas: %d used: %d", f.Gas, f.GasUsed)
+	if len(f.Input) > 0 {
+		fmt.Fprintf(b, " input: %s", abbreviate(f.Input))
+	}
+	if len(f.Output) > 0 {
+		fmt.Fprintf(b, " output: %s", abbreviate(f.Output))
+	}
+	if f.Error != "" {
+		fmt.Fprintf(b, " error: %s", f.Error)
+	}
+	if f.RevertReason != "" {
+		fmt.Fprintf(b, " reason: %q", f.RevertReason)
+	}
+	b.WriteByte('\n')
+
+	for i, call := range f.Calls {
+		if i == len(f.Calls)-1 {
+			call.writeTree(b, childPrefix+"└─ ", childPrefix+"   ")
+		} else {
+			call.writeTree(b, childPrefix+"├─ ", childPrefix+"│  ")
+		}
+	}
+}
+
+// abbreviate returns data as hex, shortened if longer than 32 bytes.
+func abbreviate(data []byte) string {
+	if len(data) <= 32 {
+		return hexutil.Encode(data)
+	}
+	return fmt.Sprintf("%s…(%d bytes)", hexutil.Encode(data[:32]), len(data))
+}
+
+// CallTracer records the tree of calls made by a transaction. Its output
+// matches geth's callTracer.
+type CallTracer struct {
+	NoopTracer
+	gasLimit uint64
+	root     *CallFrame
+	stack    []*CallFrame
+}
+
+// NewCallTracer returns a new CallTracer.
+func NewCallTracer() *CallTracer {
+	return &CallTracer{}
+}
+
+// Result returns the top-level frame of the last transaction, or nil if it
+// was invalid.
+func (t *CallTracer) Result() *CallFrame {
+	return t.root
+}
+
+func (t *CallTracer) OnTxStart(evm *EVM, tx *Transaction, sender [20]byte) {
+	t.gasLimit = tx.GasLimit
+	t.root, t.stack = nil, nil
+}
+
+func (t *CallTracer) OnTxEnd(res *ExecutionResult, err error) {
+	if err != nil {
+		t.root = nil
+		return
+	}
+	// The top-level frame reports the gas of the whole transaction.
+	if t.root != nil && res != nil {
+		t.root.GasUsed = res.UsedGas
+	}
+}
+
+func (t *CallTracer) OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int) {
+	f := &CallFrame{
+		Type:  typ,
+		From:  from,
+		To:    &to,
+		Gas:   gas,
+		Input: append([]byte(nil), input...),
+	}
+	if value != nil {
+		f.Value = new(big.Int).Set(value)
+	}
+	if depth == 1 {
+		f.Gas = t.gasLimit
+	}
+	t.stack = append(t.stack, f)
+}
+
+func (t *CallTracer) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	if len(t.stack) == 0 {
+		return
+	}
+	f := t.stack[len(t.stack)-1]
+	t.stack = t.stack[:len(t.stack)-1]
+
+	f.GasUsed = gasUsed
+	f.setOutput(output, err)
+
+	if len(t.stack) == 0 {
+		t.root = f
+		return
+	}
+	parent := t.stack[len(t.stack)-1]
+	parent.Calls = append(parent.Calls, f)
+}
+
+// setOutput records the outcome of the frame. Failed frames only keep
+// their output if they reverted, and failed creations have no address.
+func (f *CallFrame) setOutput(output []byte, err error) {
+	output = append([]byte(nil), output...)
+	if err == nil {
+		f.Output = output
+		return
+	}
+
+	f.Error = err.Error()
+	if f.Type == CREATE || f.Type == CREATE2 {
+		f.To = nil
+	}
+	if !errors.Is(err, ErrExecutionReverted) || len(output) == 0 {
+		return
+	}
+	f.Output = output
+	if reason, ok := UnpackRevert(output); ok {
+		f.RevertReason = reason
+	}
+}
+
+// Selectors of the revert data emitted by Solidity.
+var (
+	revertSelector = []byte{0x08, 0xc3, 0x79, 0xa0} // Error(string)
+	panicSelector  = []byte{0x4e, 0x48, 0x7b, 0x71} // Panic(uint256)
+)
+
+// panicReasons are the Solidity panic codes.
+var panicReasons = map[uint64]string{
+	0x00: "generic panic",
+	0x01: "assert(false)",
+	0x11: "arithmetic underflow or overflow",
+	0x12: "division or modulo by zero",
+	0x21: "enum overflow",
+	0x22: "invalid encoded storage byte array accessed",
+	0x31: "out-of-bounds array access; popping on an empty array",
+	0x32: "out-of-bounds access of an array or bytesN",
+	0x41: "out of memory",
+	0x51: "uninitialized function",
+}
+
+// UnpackRevert decodes revert data in the Error(string) or Panic(uint256)
+// form emitted by Solidity into a readable reason.
+func UnpackRevert(data []byte) (string, bool) {
+	if len(data) < 4 {
+		return "", false
+	}
+	selector, args := data[:4], data[4:]
+
+	switch string(selector) {
+	case string(revertSelector):
+		// ABI encoding of a string: offset, length, then the bytes.
+		if len(args) < 64 {
+			return "", false
+		}
+		offset, ok := abiUint(args[:32])
+		if !ok || offset > uint64(len(args)-32) {
+			return "", false
+		}
+		length, ok := abiUint(args[offset : offset+32])
+		if !ok || length > uint64(len(args))-offset-32 {
+			return "", false
+		}
+		return string(args[offset+32 : offset+32+length]), true
+
+	case string(panicSelector):
+		if len(args) < 32 {
+			return "", false
+		}
+		code := new(big.Int).SetBytes(args[:32])
+		if code.IsUint64() {
+			if reason, ok := panicReasons[code.Uint64()]; ok {
+				return reason, true
+			}
+		}
+		return fmt.Sprintf("unknown panic code: %#x", code), true
+	}
+	return "", false
+}
+
+// abiUint decodes a 32-byte ABI word that must fit in 64 bits.
+func abiUint(word []byte) (uint64, bool) {
+	for _, b := range word[:24] {
+		if b != 0 {
+			return 0, false
+		}
+	}
+	return binary.BigEndian.Uint64(word[24:]), true
+}
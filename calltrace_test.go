@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Contracts of testdata/calltrace/nested.json, whose calls were traced by
+// geth's callTracer.
+const (
+	// CALL 0xbb with value 3 and input 0x2a, then CREATE code that returns
+	// nothing and CREATE code that reverts.
+	nestedTop = "602a600052602060206001601f60037300000000000000000000000000000000000000bb62fffffff150" +
+		"6460006000f36000526005601b6000f050" +
+		"6460006000fd6000526005601b6000f05000"
+	// DELEGATECALL 0xcc, STATICCALL 0xdd and return 0x2a as a word.
+	nestedCallee = "60006000600060007300000000000000000000000000000000000000cc62fffffff450" +
+		"60006000600060007300000000000000000000000000000000000000dd62fffffffa50" +
+		"602a60005260206000f3"
+	// Revert with Error("boom").
+	revertError = "7f08c379a000000000000000000000000000000000000000000000000000000000600052" +
+		"60206004526004602452" +
+		"7f626f6f6d0000000000000000000000000000000000000000000000000000000060445260646000fd"
+	// Revert with Panic(0x11).
+	revertPanic = "7f4e487b7100000000000000000000000000000000000000000000000000000000600052601160045260246000fd"
+)
+
+// TestCallTracer checks the calls of nested frames against geth's
+// callTracer: CALL, DELEGATECALL, STATICCALL and CREATE, reverts with an
+// Error(string) and a Panic(uint256), and a failed CREATE without a to.
+// The JSON must match field for field, in the same order.
+func TestCallTracer(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "calltrace", "nested.json"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sender := [20]byte{14: 's', 'e', 'n', 'd', 'e', 'r'}
+	contract := [20]byte{12: 'c', 'o', 'n', 't', 'r', 'a', 'c', 't'}
+	state := NewStateDB()
+	state.SetBalance(sender, big.NewInt(1000))
+	for addr, code := range map[byte]string{0xbb: nestedCallee, 0xcc: revertError, 0xdd: revertPanic} {
+		raw, _ := DecodeHex(code)
+		state.SetCode([20]byte{19: addr}, raw)
+	}
+
+	evm := NewEVM(state, testBlock(nil))
+	tracer := NewCallTracer()
+	evm.Config.Tracer = tracer
+	code, _ := DecodeHex(nestedTop)
+	if _, _, err := evm.runCode(sender, contract, code, nil, big.NewInt(10), 1_000_000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	root := tracer.Result()
+	if root.Gas != 1_000_000 {
+		t.Errorf("Expected the gas of the top-level call to be its gas limit, got %d", root.Gas)
+	}
+	got, err := json.MarshalIndent(root, "", "  ")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	got = append(got, '\n')
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+
+	tree := root.Tree()
+	for _, line := range []string{
+		"├─ CALL 0x000000000000000000000000636f6e7472616374 -> 0x00000000000000000000000000000000000000bb value: 3",
+		"│  ├─ DELEGATECALL 0x00000000000000000000000000000000000000bb -> 0x00000000000000000000000000000000000000cc",
+		`reason: "boom"`,
+		`└─ STATICCALL`,
+		`reason: "arithmetic underflow or overflow"`,
+		"└─ CREATE 0x000000000000000000000000636f6e7472616374 gas:",
+	} {
+		if !strings.Contains(tree, line) {
+			t.Errorf("Expected the tree to contain %q, got\n%s", line, tree)
+		}
+	}
+}
+
+// TestCallTracerTransaction checks the top-level frame of transactions:
+// its gas is the gas limit and its gas used that of the transaction, and
+// a failed creation has no address.
+func TestCallTracerTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		to   *[20]byte
+		data string
+		err  string
+	}{
+		{"call", &[20]byte{0xcc}, "", "execution reverted"},
+		// Init code that reverts with Error("boom").
+		{"failed create", nil, revertError, "execution reverted"},
+		{"create", nil, "60006000f3", ""},
+	}
+
+	for _, tt := range tests {
+		state := NewStateDB()
+		state.SetBalance(testSender, big.NewInt(1_000_000))
+		code, _ := DecodeHex(revertError)
+		state.SetCode([20]byte{0xcc}, code)
+		data, _ := DecodeHex(tt.data)
+
+		evm := NewEVM(state, testBlock(nil))
+		tracer := NewCallTracer()
+		evm.Config.Tracer = tracer
+		tx := &Transaction{To: tt.to, Data: data, GasLimit: 100000, GasPrice: big.NewInt(1)}
+		res, err := evm.ProcessTransaction(tx, testSender)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+
+		root := tracer.Result()
+		if root.Gas != tx.GasLimit || root.GasUsed != res.UsedGas {
+			t.Errorf("%s: Expected gas %d and gas used %d, got %d and %d", tt.name, tx.GasLimit, res.UsedGas, root.Gas, root.GasUsed)
+		}
+		if root.Error != tt.err {
+			t.Errorf("%s: Expected error %q, got %q", tt.name, tt.err, root.Error)
+		}
+		switch {
+		case tt.err != "" && root.RevertReason != "boom":
+			t.Errorf("%s: Expected the revert reason boom, got %q", tt.name, root.RevertReason)
+		case tt.to == nil && tt.err != "" && root.To != nil:
+			t.Errorf("%s: Expected no address for a failed creation, got 0x%x", tt.name, *root.To)
+		case tt.to == nil && tt.err == "" && (root.To == nil || *root.To != CreateAddress(testSender, 0)):
+			t.Errorf("%s: Expected the address of the created contract, got %v", tt.name, root.To)
+		}
+
+		out, _ := json.Marshal(root)
+		if tt.to == nil && tt.err != "" && bytes.Contains(out, []byte(`"to"`)) {
+			t.Errorf("%s: Expected no to field, got %s", tt.name, out)
+		}
+	}
+
+	// An invalid transaction has no calls.
+	tracer := NewCallTracer()
+	evm := NewEVM(NewStateDB(), testBlock(nil))
+	evm.Config.Tracer = tracer
+	if _, err := evm.ProcessTransaction(&Transaction{To: &[20]byte{}, GasLimit: 21000, GasPrice: big.NewInt(1)}, testSender); err == nil {
+		t.Fatalf("Expected the transaction to be invalid")
+	}
+	if root := tracer.Result(); root != nil {
+		t.Errorf("Expected no calls, got %+v", root)
+	}
+}
+
+// TestUnpackRevert checks the decoding of Solidity revert data, and that
+// malformed data is left undecoded.
+func TestUnpackRevert(t *testing.T) {
+	boom, _ := DecodeHex("0x08c379a0" +
+		"0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000004" +
+		"626f6f6d00000000000000000000000000000000000000000000000000000000")
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		ok   bool
+	}{
+		{"error", boom, "boom", true},
+		{"panic", append([]byte{0x4e, 0x48, 0x7b, 0x71}, (&[32]byte{31: 0x12})[:]...), "division or modulo by zero", true},
+		{"unknown panic", append([]byte{0x4e, 0x48, 0x7b, 0x71}, (&[32]byte{31: 0x99})[:]...), "unknown panic code: 0x99", true},
+		{"short", boom[:3], "", false},
+		{"truncated string", boom[:len(boom)-32], "", false},
+		{"length too large", append(append([]byte(nil), boom[:68-1]...), append([]byte{0xff}, boom[68:]...)...), "", false},
+		{"other selector", []byte{1, 2, 3, 4}, "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := UnpackRevert(tt.data)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: Expected %q, %t, got %q, %t", tt.name, tt.want, tt.ok, got, ok)
+		}
+	}
+}
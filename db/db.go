@@ -0,0 +1,47 @@
+// Package db defines the key-value store interface the state is persisted
+// to, with an in-memory implementation and an on-disk one backed by
+// LevelDB.
+package db
+
+import "errors"
+
+// ErrNotFound is returned by Get when the key is not in the store.
+var ErrNotFound = errors.New("db: not found")
+
+// KeyValueStore is a persistent, ordered key-value store.
+type KeyValueStore interface {
+	// Get returns the value stored at key, or ErrNotFound.
+	Get(key []byte) ([]byte, error)
+	Has(key []byte) (bool, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+
+	// NewBatch returns a batch of writes applied atomically by Write.
+	NewBatch() Batch
+	// NewIterator iterates, in key order, over the entries whose key
+	// starts with prefix.
+	NewIterator(prefix []byte) Iterator
+
+	Close() error
+}
+
+// Batch collects writes to apply them at once.
+type Batch interface {
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// Write applies the batch to the store it was created from.
+	Write() error
+	Reset()
+}
+
+// Iterator walks over a range of entries. It starts before the first entry,
+// so Next must be called first.
+type Iterator interface {
+	Next() bool
+	Key() []byte
+	Value() []byte
+	// Error returns any error hit during iteration.
+	Error() error
+	// Release frees the resources of the iterator.
+	Release()
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testStore runs the basic KeyValueStore operations against a store.
+func testStore(t *testing.T, store KeyValueStore) {
+	if err := store.Put([]byte("a1"), []byte("one")); err != nil {
+		t.Fatalf("Expected no error on put, got %v", err)
+	}
+	value, err := store.Get([]byte("a1"))
+	if err != nil || !bytes.Equal(value, []byte("one")) {
+		t.Errorf("Expected one, got %q (%v)", value, err)
+	}
+	if _, err := store.Get([]byte("missing")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	batch := store.NewBatch()
+	batch.Put([]byte("a3"), []byte("three"))
+	batch.Put([]byte("a2"), []byte("two"))
+	batch.Put([]byte("b1"), []byte("other"))
+	batch.Delete([]byte("a1"))
+	if has, _ := store.Has([]byte("a2")); has {
+		t.Errorf("Expected batch writes to be invisible before Write")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("Expected no error on batch write, got %v", err)
+	}
+	if has, _ := store.Has([]byte("a1")); has {
+		t.Errorf("Expected a1 to be deleted by the batch")
+	}
+
+	it := store.NewIterator([]byte("a"))
+	var keys []string
+	for it.Next() {
+		keys = append(keys, string(it.Key())+"="+string(it.Value()))
+	}
+	it.Release()
+	if got := len(keys); got != 2 || keys[0] != "a2=two" || keys[1] != "a3=three" {
+		t.Errorf("Expected [a2=two a3=three], got %v", keys)
+	}
+
+	if err := store.Delete([]byte("a2")); err != nil {
+		t.Fatalf("Expected no error on delete, got %v", err)
+	}
+	if has, _ := store.Has([]byte("a2")); has {
+		t.Errorf("Expected a2 to be deleted")
+	}
+}
+
+// TestMemoryDB checks the in-memory store.
+func TestMemoryDB(t *testing.T) {
+	testStore(t, NewMemoryDB())
+}
+
+// TestLevelDB checks the on-disk store, including that data survives
+// closing and reopening it.
+func TestLevelDB(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenLevelDB(dir)
+	if err != nil {
+		t.Fatalf("Expected no error opening the database, got %v", err)
+	}
+	testStore(t, store)
+	store.Close()
+
+	store, err = OpenLevelDB(dir)
+	if err != nil {
+		t.Fatalf("Expected no error reopening the database, got %v", err)
+	}
+	defer store.Close()
+
+	value, err := store.Get([]byte("a3"))
+	if err != nil || !bytes.Equal(value, []byte("three")) {
+		t.Errorf("Expected three after reopening, got %q (%v)", value, err)
+	}
+}
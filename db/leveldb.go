@@ -0,0 +1,78 @@
+package db
+
+import (
+	"errors"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// LevelDB is a KeyValueStore persisted to a directory on disk.
+type LevelDB struct {
+	db *leveldb.DB
+}
+
+// OpenLevelDB opens the database in dir, creating it if needed.
+func OpenLevelDB(dir string) (*LevelDB, error) {
+	db, err := leveldb.OpenFile(dir, &opt.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &LevelDB{db: db}, nil
+}
+
+func (l *LevelDB) Get(key []byte) ([]byte, error) {
+	value, err := l.db.Get(key, nil)
+	if errors.Is(err, leveldb.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (l *LevelDB) Has(key []byte) (bool, error) {
+	return l.db.Has(key, nil)
+}
+
+func (l *LevelDB) Put(key, value []byte) error {
+	return l.db.Put(key, value, nil)
+}
+
+func (l *LevelDB) Delete(key []byte) error {
+	return l.db.Delete(key, nil)
+}
+
+func (l *LevelDB) NewBatch() Batch {
+	return &levelBatch{db: l.db, batch: new(leveldb.Batch)}
+}
+
+func (l *LevelDB) NewIterator(prefix []byte) Iterator {
+	return l.db.NewIterator(util.BytesPrefix(prefix), nil)
+}
+
+func (l *LevelDB) Close() error {
+	return l.db.Close()
+}
+
+type levelBatch struct {
+	db    *leveldb.DB
+	batch *leveldb.Batch
+}
+
+func (b *levelBatch) Put(key, value []byte) error {
+	b.batch.Put(key, value)
+	return nil
+}
+
+func (b *levelBatch) Delete(key []byte) error {
+	b.batch.Delete(key)
+	return nil
+}
+
+func (b *levelBatch) Write() error {
+	return b.db.Write(b.batch, nil)
+}
+
+func (b *levelBatch) Reset() {
+	b.batch.Reset()
+}
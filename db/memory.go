@@ -0,0 +1,187 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var errClosed = errors.New("db: closed")
+
+// MemoryDB is a KeyValueStore kept in memory. It is mostly useful for
+// tests and for running without a data directory.
+type MemoryDB struct {
+	mu   sync.RWMutex
+	data map[string][]byte
+}
+
+func NewMemoryDB() *MemoryDB {
+	return &MemoryDB{data: make(map[string][]byte)}
+}
+
+func (m *MemoryDB) Get(key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.data == nil {
+		return nil, errClosed
+	}
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return bytes.Clone(value), nil
+}
+
+func (m *MemoryDB) Has(key []byte) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.data == nil {
+		return false, errClosed
+	}
+	_, ok := m.data[string(key)]
+	return ok, nil
+}
+
+func (m *MemoryDB) Put(key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.data == nil {
+		return errClosed
+	}
+	m.data[string(key)] = bytes.Clone(value)
+	return nil
+}
+
+func (m *MemoryDB) Delete(key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.data == nil {
+		return errClosed
+	}
+	delete(m.data, string(key))
+	return nil
+}
+
+func (m *MemoryDB) NewBatch() Batch {
+	return &memoryBatch{db: m}
+}
+
+// NewIterator iterates over a snapshot of the matching entries taken when
+// the iterator is created.
+func (m *MemoryDB) NewIterator(prefix []byte) Iterator {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	it := &memoryIterator{index: -1}
+	for key, value := range m.data {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			it.keys = append(it.keys, key)
+			it.values = append(it.values, value)
+		}
+	}
+	sort.Sort(it)
+	return it
+}
+
+func (m *MemoryDB) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data = nil
+	return nil
+}
+
+// Len returns the number of entries in the store.
+func (m *MemoryDB) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.data)
+}
+
+type memoryWrite struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+type memoryBatch struct {
+	db     *MemoryDB
+	writes []memoryWrite
+}
+
+func (b *memoryBatch) Put(key, value []byte) error {
+	b.writes = append(b.writes, memoryWrite{key: bytes.Clone(key), value: bytes.Clone(value)})
+	return nil
+}
+
+func (b *memoryBatch) Delete(key []byte) error {
+	b.writes = append(b.writes, memoryWrite{key: bytes.Clone(key), delete: true})
+	return nil
+}
+
+func (b *memoryBatch) Write() error {
+	b.db.mu.Lock()
+	defer b.db.mu.Unlock()
+
+	if b.db.data == nil {
+		return errClosed
+	}
+	for _, w := range b.writes {
+		if w.delete {
+			delete(b.db.data, string(w.key))
+			continue
+		}
+		b.db.data[string(w.key)] = w.value
+	}
+	return nil
+}
+
+func (b *memoryBatch) Reset() {
+	b.writes = b.writes[:0]
+}
+
+type memoryIterator struct {
+	keys   []string
+	values [][]byte
+	index  int
+}
+
+func (it *memoryIterator) Len() int           { return len(it.keys) }
+func (it *memoryIterator) Less(i, j int) bool { return it.keys[i] < it.keys[j] }
+func (it *memoryIterator) Swap(i, j int) {
+	it.keys[i], it.keys[j] = it.keys[j], it.keys[i]
+	it.values[i], it.values[j] = it.values[j], it.values[i]
+}
+
+func (it *memoryIterator) Next() bool {
+	if it.index >= len(it.keys) {
+		return false
+	}
+	it.index++
+	return it.index < len(it.keys)
+}
+
+func (it *memoryIterator) Key() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return []byte(it.keys[it.index])
+}
+
+func (it *memoryIterator) Value() []byte {
+	if it.index < 0 || it.index >= len(it.keys) {
+		return nil
+	}
+	return it.values[it.index]
+}
+
+func (it *memoryIterator) Error() error { return nil }
+
+func (it *memoryIterator) Release() {
+	it.keys, it.values = nil, nil
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"maps"
+	"prevm/config"
+	"prevm/hexutil"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+)
+
+// debugCommand implements 'prevm debug': it runs bytecode like 'prevm run'
+// in an interactive step debugger.
+func debugCommand(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: prevm debug [flags] [codefile]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Steps through the bytecode given with --code, or read as hex from codefile ('-' for stdin).")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	call := addCallFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	c, err := call.setup(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+	// Logs would garble the screen.
+	config.Logger.SetLevel(log.ErrorLevel)
+
+	dbg := NewDebugger()
+	c.evm.Config.Tracer = dbg
+	done := make(chan debugResult, 1)
+	go func() {
+		ec, ret, err := c.run()
+		res := debugResult{ret: ret, err: err}
+		if ec != nil {
+			res.gasUsed = c.gas - ec.Gas
+		}
+		done <- res
+	}()
+
+	m, err := tea.NewProgram(newDebugModel(dbg, done), tea.WithAltScreen()).Run()
+	if err != nil {
+		return err
+	}
+	// The state is only committed if the call ran to the end, not if the
+	// debugger was quit halfway through it.
+	if m.(*debugModel).result == nil {
+		return nil
+	}
+	return c.evm.State.Commit()
+}
+
+// debugResult is the outcome of the debugged call.
+type debugResult struct {
+	ret     []byte
+	gasUsed uint64
+	err     error
+}
+
+var (
+	debugTitle   = lipgloss.NewStyle().Bold(true)
+	debugBox     = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	debugCurrent = lipgloss.NewStyle().Reverse(true)
+	debugBreak   = lipgloss.NewStyle().Foreground(lipgloss.Color("9"))
+	debugFaint   = lipgloss.NewStyle().Faint(true)
+)
+
+// debugModel is the bubbletea model of the debugger.
+type debugModel struct {
+	dbg    *Debugger
+	done   <-chan debugResult
+	state  *DebugState // the state execution is paused at
+	view   *DebugState // an earlier state from the history, if shown
+	result *debugResult
+
+	running   bool
+	prompting bool
+	input     textinput.Model
+	status    string
+
+	disasm        map[string]*Disassembly
+	width, height int
+}
+
+func newDebugModel(dbg *Debugger, done <-chan debugResult) *debugModel {
+	input := textinput.New()
+	input.Prompt = "break at (pc or opcode): "
+	return &debugModel{
+		dbg:     dbg,
+		done:    done,
+		running: true,
+		input:   input,
+		disasm:  make(map[string]*Disassembly),
+		width:   120,
+		height:  40,
+	}
+}
+
+func (m *debugModel) Init() tea.Cmd {
+	return m.wait()
+}
+
+// wait returns a command waiting for execution to pause or end.
+func (m *debugModel) wait() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case s := <-m.dbg.Paused():
+			return s
+		case res := <-m.done:
+			return res
+		}
+	}
+}
+
+func (m *debugModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case *DebugState:
+		m.state, m.running = msg, false
+		return m, nil
+
+	case debugResult:
+		m.result, m.running = &msg, false
+		return m, nil
+
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		return m, nil
+
+	case tea.KeyMsg:
+		if m.prompting {
+			return m.updatePrompt(msg)
+		}
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case "b":
+			m.prompting = true
+			m.input.SetValue("")
+			return m, m.input.Focus()
+		}
+		if m.running {
+			return m, nil
+		}
+		if mode, ok := debugKeys[msg.String()]; ok {
+			return m.forward(mode)
+		}
+		if reverse, ok := m.reverseKeys()[msg.String()]; ok {
+			m.reverse(reverse)
+		}
+	}
+	return m, nil
+}
+
+// debugKeys are the keys of the commands resuming execution.
+var debugKeys = map[string]debugMode{
+	"s": debugStep,
+	"n": debugNext,
+	"o": debugStepOut,
+	"c": debugContinue,
+}
+
+// reverseKeys are the keys of the commands going back in the history.
+func (m *debugModel) reverseKeys() map[string]func(int) (int, bool) {
+	return map[string]func(int) (int, bool){
+		"S": m.dbg.ReverseStep,
+		"N": m.dbg.ReverseNext,
+		"O": m.dbg.ReverseStepOut,
+		"C": m.dbg.ReverseContinue,
+	}
+}
+
+// forward runs a command resuming execution. If an earlier state is shown,
+// it first moves forward through the history.
+func (m *debugModel) forward(mode debugMode) (tea.Model, tea.Cmd) {
+	m.status = ""
+	if m.view != nil {
+		if i, ok := m.dbg.seek(m.view.Step, 1, mode); ok {
+			m.show(i)
+			return m, nil
+		}
+		m.view = nil
+	}
+	if m.result != nil || m.state == nil {
+		return m, nil
+	}
+	m.running = true
+	m.dbg.run(mode)
+	return m, m.wait()
+}
+
+// reverse goes back in the history to the instruction returned by seek.
+func (m *debugModel) reverse(seek func(int) (int, bool)) {
+	from := len(m.dbg.History().Steps())
+	if s := m.shown(); s != nil && (m.view != nil || m.result == nil) {
+		from = s.Step
+	}
+	i, ok := seek(from)
+	if !ok {
+		m.status = "nothing to go back to"
+		return
+	}
+	m.status = ""
+	m.show(i)
+}
+
+// show shows the state before the i-th instruction of the history.
+func (m *debugModel) show(i int) {
+	if m.result == nil && m.state != nil && i == m.state.Step {
+		m.view = nil
+		return
+	}
+	m.view = m.dbg.History().State(i)
+}
+
+// shown returns the state being shown.
+func (m *debugModel) shown() *DebugState {
+	if m.view != nil {
+		return m.view
+	}
+	return m.state
+}
+
+// updatePrompt handles the keys typed at the breakpoint prompt.
+func (m *debugModel) updatePrompt(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyEsc:
+		m.prompting = false
+		m.input.Blur()
+		return m, nil
+	case tea.KeyEnter:
+		m.prompting = false
+		m.input.Blur()
+		m.status = m.toggleBreakpoint(strings.TrimSpace(m.input.Value()))
+		return m, nil
+	}
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	return m, cmd
+}
+
+// toggleBreakpoint toggles the breakpoint described by arg, a PC or an
+// opcode mnemonic, and returns a status line.
+func (m *debugModel) toggleBreakpoint(arg string) string {
+	if arg == "" {
+		return ""
+	}
+	if op, ok := opcodeByName[strings.ToUpper(arg)]; ok {
+		if m.dbg.ToggleBreakpointOp(op) {
+			return "breakpoint set on " + OpcodeName(op)
+		}
+		return "breakpoint cleared on " + OpcodeName(op)
+	}
+	pc, ok := parseNumber(arg)
+	if !ok || !pc.IsUint64() {
+		return fmt.Sprintf("invalid breakpoint %q: want a pc or an opcode", arg)
+	}
+	if m.dbg.ToggleBreakpointPC(pc.Uint64()) {
+		return fmt.Sprintf("breakpoint set at pc 0x%04x", pc)
+	}
+	return fmt.Sprintf("breakpoint cleared at pc 0x%04x", pc)
+}
+
+func (m *debugModel) View() string {
+	var b strings.Builder
+	b.WriteString(m.header())
+	b.WriteByte('\n')
+
+	if s := m.shown(); s != nil {
+		// The disassembly takes the left of the screen; the stack,
+		// memory and storage are stacked on the right.
+		height := max(m.height-6, 10)
+		left := debugBox.Render(m.disassembly(s, height))
+		rightWidth := max(m.width-lipgloss.Width(left)-2, 40)
+		panelHeight := max(height/3-2, 1)
+		right := lipgloss.JoinVertical(lipgloss.Left,
+			m.panel("Stack", s.Stack.String(), rightWidth, panelHeight),
+			m.panel("Memory", s.Memory.String(), rightWidth, panelHeight),
+			m.panel("Storage", storageString(s.Storage), rightWidth, panelHeight),
+		)
+		b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, left, right))
+		b.WriteByte('\n')
+	}
+
+	b.WriteString(m.footer())
+	return b.String()
+}
+
+func (m *debugModel) header() string {
+	switch {
+	case m.view != nil:
+	case m.result != nil:
+		status := "success"
+		if m.result.err != nil {
+			status = m.result.err.Error()
+		}
+		return debugTitle.Render("Finished: "+status) +
+			fmt.Sprintf("  gas used: %d  return data: %s", m.result.gasUsed, hexutil.Encode(m.result.ret))
+	case m.state == nil || m.running:
+		return debugTitle.Render("Running…")
+	}
+	s := m.shown()
+	line := debugTitle.Render(fmt.Sprintf("0x%04x %s", s.PC, opName(s.Op))) +
+		fmt.Sprintf("  address: 0x%x  depth: %d  gas: %d  cost: %d", s.Address, s.Depth, s.Gas, s.Cost)
+	if s.Err != nil {
+		line += debugBreak.Render("  error: " + s.Err.Error())
+	}
+	if m.view != nil {
+		line += debugFaint.Render(fmt.Sprintf("  history: step %d of %d", s.Step+1, len(m.dbg.History().Steps())))
+	}
+	return line
+}
+
+func (m *debugModel) footer() string {
+	var b strings.Builder
+	pcs, ops := m.dbg.Breakpoints()
+	if len(pcs)+len(ops) > 0 {
+		var names []string
+		for _, pc := range pcs {
+			names = append(names, fmt.Sprintf("0x%04x", pc))
+		}
+		for _, op := range ops {
+			names = append(names, OpcodeName(op))
+		}
+		b.WriteString("breakpoints: " + strings.Join(names, ", ") + "\n")
+	}
+	if m.status != "" {
+		b.WriteString(m.status + "\n")
+	}
+	if m.prompting {
+		b.WriteString(m.input.View())
+	} else {
+		b.WriteString(debugFaint.Render("s step · n next · o step out · c continue · S N O C backwards · b breakpoint · q quit"))
+	}
+	return b.String()
+}
+
+// disassembly renders the instructions around the current one of s.
+func (m *debugModel) disassembly(s *DebugState, height int) string {
+	d := m.disasm[string(s.Code)]
+	if d == nil {
+		d = Disassemble(s.Code)
+		m.disasm[string(s.Code)] = d
+	}
+	pcs, _ := m.dbg.Breakpoints()
+
+	cur := slices.IndexFunc(d.Instructions, func(in Instruction) bool { return in.PC >= s.PC })
+	if cur < 0 {
+		cur = len(d.Instructions)
+	}
+	start := max(0, min(cur-height/2, len(d.Instructions)-height))
+	end := min(len(d.Instructions), start+height)
+
+	lines := []string{debugTitle.Render("Code")}
+	for _, in := range d.Instructions[start:end] {
+		marker := "  "
+		if slices.Contains(pcs, in.PC) {
+			marker = debugBreak.Render("● ")
+		}
+		line := fmt.Sprintf("0x%04x  %s", in.PC, in)
+		if in.PC == s.PC {
+			line = debugCurrent.Render(line)
+		}
+		lines = append(lines, marker+line)
+	}
+	if cur == len(d.Instructions) {
+		lines = append(lines, "  "+debugCurrent.Render(fmt.Sprintf("0x%04x  STOP (end of code)", s.PC)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// panel renders a titled box holding at most height lines of text.
+func (m *debugModel) panel(title, text string, width, height int) string {
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if len(lines) > height {
+		more := len(lines) - height + 1
+		lines = append(lines[:height-1], debugFaint.Render(fmt.Sprintf("… %d more", more)))
+	}
+	return debugBox.Width(width - 2).Render(debugTitle.Render(title) + "\n" + strings.Join(lines, "\n"))
+}
+
+// storageString formats storage slots, sorted.
+func storageString(storage map[[32]byte][32]byte) string {
+	if len(storage) == 0 {
+		return "[ empty ]"
+	}
+	slots := slices.SortedFunc(maps.Keys(storage), func(a, b [32]byte) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	var lines []string
+	for _, slot := range slots {
+		value := storage[slot]
+		lines = append(lines, fmt.Sprintf("%s: %s", hexutil.Encode(trimWord(slot)), hexutil.Encode(trimWord(value))))
+	}
+	return strings.Join(lines, "\n")
+}
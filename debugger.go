@@ -0,0 +1,265 @@
+package main
+
+import (
+	"maps"
+	"math/big"
+	"prevm/machine"
+	"slices"
+	"sync"
+)
+
+// DebugState is the state of the interpreter when the Debugger pauses
+// before an instruction. It is a copy, safe to keep after execution
+// resumes.
+type DebugState struct {
+	Step    int // index of the instruction in the Debugger's history
+	PC      uint64
+	Op      byte
+	Gas     uint64 // gas left before the instruction
+	Cost    uint64 // cost of the instruction
+	Depth   int
+	Address [20]byte // the account whose storage is used
+	Code    []byte   // the code running
+	Stack   *machine.Stack
+	Memory  *machine.Memory
+	Storage map[[32]byte][32]byte // the known slots of Address
+	Err     error                 // set if the instruction can't run
+}
+
+// debugMode is what the Debugger was asked to do when it last resumed.
+type debugMode int
+
+const (
+	debugStep     debugMode = iota // pause before the next instruction
+	debugNext                      // pause before the next instruction of the same or an outer frame
+	debugStepOut                   // pause before the next instruction of an outer frame
+	debugContinue                  // pause at breakpoints only
+)
+
+// Debugger is a Tracer that pauses execution before instructions and hands
+// the state to a frontend, which resumes it with Step, Next, StepOut or
+// Continue. Execution must run on another goroutine than the frontend's;
+// it blocks in the tracer while paused.
+//
+// The Debugger pauses before the first instruction, and at every
+// breakpoint whatever it was asked to do.
+//
+// It records the history of the execution, so that the frontend can go
+// back to earlier instructions while execution is paused: see History and
+// the Reverse methods.
+type Debugger struct {
+	NoopTracer
+	state   *StateDB
+	history *Recorder
+	paused  chan *DebugState
+	resume  chan struct{}
+
+	mu    sync.Mutex
+	mode  debugMode
+	depth int // depth of the frame last paused in
+	pcs   map[uint64]bool
+	ops   [256]bool
+}
+
+// NewDebugger returns a Debugger with no breakpoints.
+func NewDebugger() *Debugger {
+	return &Debugger{
+		history: NewRecorder(),
+		paused:  make(chan *DebugState),
+		resume:  make(chan struct{}),
+		pcs:     make(map[uint64]bool),
+	}
+}
+
+// Paused returns the channel on which the state is sent each time
+// execution pauses.
+func (d *Debugger) Paused() <-chan *DebugState {
+	return d.paused
+}
+
+// Step resumes execution until the next instruction, entering calls.
+func (d *Debugger) Step() { d.run(debugStep) }
+
+// Next resumes execution until the next instruction of the current frame,
+// running calls to completion.
+func (d *Debugger) Next() { d.run(debugNext) }
+
+// StepOut resumes execution until the current frame returns to its caller.
+func (d *Debugger) StepOut() { d.run(debugStepOut) }
+
+// Continue resumes execution until a breakpoint.
+func (d *Debugger) Continue() { d.run(debugContinue) }
+
+func (d *Debugger) run(mode debugMode) {
+	d.mu.Lock()
+	d.mode = mode
+	d.mu.Unlock()
+	d.resume <- struct{}{}
+}
+
+// ToggleBreakpointPC sets a breakpoint at pc, in any contract, or clears
+// it. It reports whether the breakpoint is now set.
+func (d *Debugger) ToggleBreakpointPC(pc uint64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pcs[pc] {
+		delete(d.pcs, pc)
+		return false
+	}
+	d.pcs[pc] = true
+	return true
+}
+
+// ToggleBreakpointOp sets a breakpoint on every instruction with opcode op,
+// or clears it. It reports whether the breakpoint is now set.
+func (d *Debugger) ToggleBreakpointOp(op byte) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ops[op] = !d.ops[op]
+	return d.ops[op]
+}
+
+// Breakpoints returns the PCs and opcodes with a breakpoint, sorted.
+func (d *Debugger) Breakpoints() (pcs []uint64, ops []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pcs = slices.Sorted(maps.Keys(d.pcs))
+	for op, set := range d.ops {
+		if set {
+			ops = append(ops, byte(op))
+		}
+	}
+	return pcs, ops
+}
+
+// History returns the recorded instructions. It must only be used while
+// execution is paused or over.
+func (d *Debugger) History() *Recorder {
+	return d.history
+}
+
+// ReverseStep returns the index in the history of the instruction run
+// before the from-th one. Like the other Reverse methods, it reports
+// false if there is nowhere to go back to. Pass the history's length as
+// from to go back from the end of execution.
+func (d *Debugger) ReverseStep(from int) (int, bool) {
+	return d.seek(from, -1, debugStep)
+}
+
+// ReverseNext returns the index of the previous instruction of the same
+// or an outer frame, skipping over calls.
+func (d *Debugger) ReverseNext(from int) (int, bool) {
+	return d.seek(from, -1, debugNext)
+}
+
+// ReverseStepOut returns the index of the previous instruction of an
+// outer frame: the call that started the current frame.
+func (d *Debugger) ReverseStepOut(from int) (int, bool) {
+	return d.seek(from, -1, debugStepOut)
+}
+
+// ReverseContinue returns the index of the previous instruction at a
+// breakpoint, or of the first instruction if there is none.
+func (d *Debugger) ReverseContinue(from int) (int, bool) {
+	if i, ok := d.seek(from, -1, debugContinue); ok {
+		return i, true
+	}
+	return 0, from > 0
+}
+
+// seek returns the index of the first instruction of the history after
+// from, or before it if dir is negative, at which mode would pause.
+func (d *Debugger) seek(from, dir int, mode debugMode) (int, bool) {
+	steps := d.history.Steps()
+	if len(steps) == 0 {
+		return 0, false
+	}
+	depth := steps[min(from, len(steps)-1)].Depth
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := from + dir; i >= 0 && i < len(steps); i += dir {
+		if d.stopsAt(mode, depth, steps[i].PC, steps[i].Op, steps[i].Depth) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (d *Debugger) OnTxStart(evm *EVM, tx *Transaction, sender [20]byte) {
+	d.state = evm.State
+	d.history.OnTxStart(evm, tx, sender)
+}
+
+func (d *Debugger) OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int) {
+	d.history.OnEnter(depth, typ, from, to, input, gas, value)
+}
+
+func (d *Debugger) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	d.history.OnExit(depth, output, gasUsed, err)
+}
+
+func (d *Debugger) OnStorageChange(addr [20]byte, slot, prev, value [32]byte) {
+	d.history.OnStorageChange(addr, slot, prev, value)
+}
+
+func (d *Debugger) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	d.history.OnOpcode(pc, op, gas, cost, ec, depth, err)
+	if !d.shouldPause(pc, op, depth) {
+		return
+	}
+	d.depth = depth
+	d.paused <- d.snapshot(pc, op, gas, cost, ec, err)
+	<-d.resume
+}
+
+func (d *Debugger) shouldPause(pc uint64, op byte, depth int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stopsAt(d.mode, d.depth, pc, op, depth)
+}
+
+// stopsAt reports whether mode, started at depth, stops at an instruction.
+// d.mu must be held.
+func (d *Debugger) stopsAt(mode debugMode, depth int, pc uint64, op byte, at int) bool {
+	if d.pcs[pc] || d.ops[op] {
+		return true
+	}
+	switch mode {
+	case debugStep:
+		return true
+	case debugNext:
+		return at <= depth
+	case debugStepOut:
+		return at < depth
+	}
+	return false
+}
+
+func (d *Debugger) snapshot(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, err error) *DebugState {
+	return &DebugState{
+		Step:    len(d.history.Steps()) - 1,
+		PC:      pc,
+		Op:      op,
+		Gas:     gas,
+		Cost:    cost,
+		Depth:   ec.Depth,
+		Address: ec.Address,
+		Code:    ec.Bytecode,
+		Stack:   ec.Stack.Copy(),
+		Memory:  ec.Memory.Copy(),
+		Storage: accountStorage(d.state, ec.Address),
+		Err:     err,
+	}
+}
+
+// accountStorage returns a copy of the known storage slots of addr.
+func accountStorage(state *StateDB, addr [20]byte) map[[32]byte][32]byte {
+	storage := make(map[[32]byte][32]byte)
+	if state != nil {
+		for slot, value := range state.GetAccount(addr).Storage {
+			storage[slot] = toWord(value)
+		}
+	}
+	return storage
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"prevm/config"
+	"time"
+)
+
+// runDemo runs two sample transactions against a contract and logs the
+// results. It was the original entry point of the program.
+func runDemo() {
+	logger := config.Logger
+
+	logger.Info("Starting EVM simulation...")
+
+	// 2. --- EVM Component Setup ---
+	state := NewStateDB()
+	logger.Debug("Initialized StateDB")
+
+	// --- Define Addresses ---
+	// var accountA_Addr [20]byte
+	// copy(accountA_Addr[:], []byte("9bbfed6889322e016e0a02ee459d306fc19545d8"))
+	accountA_Addr := [20]byte{0x9b, 0xbf, 0xed, 0x68, 0x89, 0x32, 0x2e, 0x01, 0x6e, 0x0a, 0x02, 0xee, 0x45, 0x9d, 0x30, 0x6f, 0xc1, 0x95, 0x45, 0xd8}
+	accountB_Addr := [20]byte{0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd}
+	contractAddr := [20]byte{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb}
+
+	// --- Setup Accounts in StateDB ---
+	// Account A starts with nonce 0 and 1 ETH.
+	accountA := NewAccount()
+	accountA.Balance = new(big.Int).SetUint64(1000000000000000000) // 1 ETH
+	accountA.Nonce = 0
+	state.accounts[accountA_Addr] = accountA
+	logger.Debug("Created Account A", "address", fmt.Sprintf("0x%x", accountA_Addr))
+
+	// Account B starts with nonce 0 and 1 ETH.
+	accountB := NewAccount()
+	accountB.Balance = new(big.Int).SetUint64(1000000000000000000) // 1 ETH
+	accountB.Nonce = 0
+	state.accounts[accountB_Addr] = accountB
+	logger.Debug("Created Account B", "address", fmt.Sprintf("0x%x", accountB_Addr))
+
+	// --- Contract Bytecode ---
+	// bytecode := []byte{
+	// 	PUSH32,
+	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+	// 	PUSH1,
+	// 	0x02,
+	// 	ADD,
+	// 	STOP,
+	// }
+
+	// bytecode = []byte{
+	// 	PUSH1, 1,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	DUP4,
+	//  STOP,
+	// }
+
+	// bytecode := []byte{
+	// 	PUSH5,
+	// 	0x02, 0x03, 0x01, 0xFF, 0x01,
+	// 	PUSH1,
+	// 	0x05,
+	// 	EXP,
+	// 	STOP,
+	// }
+
+	// bytecode := []byte{
+	// 	ADDRESS,
+	// 	BALANCE,
+	// 	CALLVALUE,
+	// 	PUSH1, 31,
+	// 	CALLDATALOAD,
+	// }
+
+	// bytecode := []byte{
+	// 	PUSH1, 32,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	CALLDATACOPY,
+	// 	PUSH1, 8,
+	// 	PUSH1, 31,
+	// 	PUSH1, 0,
+	// 	CALLDATACOPY,
+	// }
+
+	bytecode := []byte{
+		PUSH32,
+		0xFF, 0xFF, 0xFF, 0xFF, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00,
+		PUSH1, 0,
+		MSTORE,
+
+		PUSH1, 4,
+		PUSH1, 0,
+		KECCAK256,
+		TIMESTAMP,
+
+		ADDRESS,
+		CALLER,
+	}
+
+	contractAccount := NewAccount()
+	contractAccount.Code = bytecode
+	contractAccount.Balance = new(big.Int).SetUint64(2000000000000000000)
+	state.accounts[contractAddr] = contractAccount
+
+	logger.Debug("Created contract account", "address", fmt.Sprintf("0x%x", contractAddr))
+
+	// --- Block Context and EVM Setup ---
+	blockCtx := &BlockContext{
+		BaseFee:   big.NewInt(70000000000),
+		GasLimit:  big.NewInt(30000000),
+		Number:    big.NewInt(1),
+		Timestamp: big.NewInt(time.Now().Local().Unix()),
+		ChainID:   big.NewInt(1),
+	}
+	evm := NewEVM(state, blockCtx)
+	evm.Config.StateDiff = true
+	evm.Config.Tracer = NewLogTracer(logger)
+	logger.Info("EVM Initialized and all accounts are set up.")
+
+	// ===================================================================
+	// --- TRANSACTION 1: Account A calls the contract ---
+	// ===================================================================
+	logger.Info("--- Processing Tx 1: Account A calls contract ---")
+	tx1 := &Transaction{
+		Nonce:    0, // Account A's first transaction
+		GasPrice: big.NewInt(70000000000),
+		To:       &contractAddr,
+		Value:    big.NewInt(4400),
+		Data:     []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	tx1.GasLimit = estimateDemoGas(state, blockCtx, tx1, accountA_Addr)
+
+	result1, err1 := evm.ProcessTransaction(tx1, accountA_Addr)
+	if err1 != nil {
+		logger.Error("EVM execution failed for Tx 1", "error", err1)
+	} else {
+		logger.Info("Tx 1 successful!", "failed", result1.Failed(), "error", result1.Err)
+		logger.Info("Gas Used", "amount", result1.UsedGas)
+		logger.Info("Account A Nonce after Tx 1", "nonce", state.GetNonce(accountA_Addr))
+		logger.Info("Account A Balance after Tx 1", "balance", state.GetBalance(accountA_Addr))
+		logger.Info("Contract Balance after Tx 1", "balance", state.GetBalance(contractAddr))
+		fmt.Print(result1.StateDiff.Table())
+	}
+
+	fmt.Println() // Add a blank line for readability
+
+	// ===================================================================
+	// --- TRANSACTION 2: Account B calls the same contract ---
+	// ===================================================================
+	bytecode = []byte{
+		PUSH10, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00,
+		POP,
+		CODESIZE,
+	}
+	// bytecode = []byte{
+	// 	PUSH1, 2,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 0,
+	// 	PUSH1, 1,
+	// 	SWAP10,
+	// 	CODESIZE,
+	// }
+
+	contractAccount.Code = bytecode
+
+	logger.Info("--- Processing Tx 2: Account B calls contract ---")
+	tx2 := &Transaction{
+		Type:                 DynamicFeeTxType,
+		ChainID:              big.NewInt(1),
+		Nonce:                0, // Account B's first transaction
+		MaxFeePerGas:         big.NewInt(100000000000),
+		MaxPriorityFeePerGas: big.NewInt(2000000000),
+		To:                   &contractAddr,
+		Value:                big.NewInt(3250),
+		Data:                 []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+	}
+	tx2.GasLimit = estimateDemoGas(state, blockCtx, tx2, accountB_Addr)
+
+	result2, err2 := evm.ProcessTransaction(tx2, accountB_Addr)
+	if err2 != nil {
+		logger.Error("EVM execution failed for Tx 2", "error", err2)
+	} else {
+		logger.Info("Tx 2 successful!", "failed", result2.Failed(), "error", result2.Err)
+		logger.Info("Gas Used", "amount", result2.UsedGas)
+		logger.Info("Account B Nonce after Tx 2", "nonce", state.GetNonce(accountB_Addr))
+		logger.Info("Account B Balance after Tx 2", "balance", state.GetBalance(accountB_Addr))
+		logger.Info("Coinbase Balance after Tx 2", "balance", state.GetBalance(blockCtx.Coinbase))
+		logger.Info("State root after Tx 2", "root", fmt.Sprintf("0x%x", state.StateRoot()))
+	}
+}
+
+// estimateDemoGas returns the gas limit tx needs when sent by from. If it
+// can't be estimated, the transaction gets the whole block so that the demo
+// still shows how it fails.
+func estimateDemoGas(state *StateDB, block *BlockContext, tx *Transaction, from [20]byte) uint64 {
+	msg := &CallMsg{
+		From:                 from,
+		To:                   tx.To,
+		GasPrice:             tx.GasPrice,
+		MaxFeePerGas:         tx.MaxFeePerGas,
+		MaxPriorityFeePerGas: tx.MaxPriorityFeePerGas,
+		Value:                tx.Value,
+		Data:                 tx.Data,
+		AccessList:           tx.AccessList,
+	}
+	gas, err := EstimateGas(state, block, msg, Config{}, nil)
+	if err != nil {
+		config.Logger.Warn("Cannot estimate gas", "err", err)
+		return block.GasLimit.Uint64()
+	}
+	config.Logger.Info("Estimated gas", "gas", gas)
+	return gas
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"prevm/hexutil"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Account status in a state diff.
+const (
+	DiffCreated  = "created"
+	DiffDeleted  = "deleted"
+	DiffModified = "modified"
+)
+
+// StateDiff lists the accounts changed by a transaction, ordered by
+// address.
+type StateDiff []*AccountDiff
+
+// AccountDiff is the change to a single account. Only the fields that
+// changed are set.
+type AccountDiff struct {
+	Address [20]byte
+	Status  string
+	Balance *BalanceDiff
+	Nonce   *NonceDiff
+	Code    *CodeDiff
+	Storage map[[32]byte]SlotDiff
+}
+
+type (
+	BalanceDiff struct{ From, To *big.Int }
+	NonceDiff   struct{ From, To uint64 }
+	CodeDiff    struct{ From, To []byte }
+	SlotDiff    struct{ From, To [32]byte }
+)
+
+// journalPrestate reconstructs, from the journal, the accounts touched by
+// the current transaction as they were before it. A nil account didn't
+// exist. The storage of the returned accounts only holds the slots that
+// may have changed.
+func (s *StateDB) journalPrestate() map[[20]byte]*Account {
+	pre := make(map[[20]byte]*Account, len(s.journal.dirties))
+	for addr := range s.journal.dirties {
+		acc, ok := s.accounts[addr]
+		if !ok {
+			pre[addr] = nil
+			continue
+		}
+		cpy := copyAccount(acc, false)
+		for _, entry := range s.journal.entries {
+			if ch, ok := entry.(storageChange); ok && ch.account == addr {
+				cpy.Storage[ch.key] = acc.Storage[ch.key]
+			}
+		}
+		pre[addr] = cpy
+	}
+
+	// Undo the changes on the copies, newest first.
+	for i := len(s.journal.entries) - 1; i >= 0; i-- {
+		switch ch := s.journal.entries[i].(type) {
+		case createAccountChange:
+			if ch.prev == nil {
+				pre[ch.account] = nil
+				break
+			}
+			// Keep comparing the slots written after the account was
+			// replaced.
+			cpy := copyAccount(ch.prev, true)
+			if later := pre[ch.account]; later != nil {
+				for key := range later.Storage {
+					if _, ok := cpy.Storage[key]; !ok {
+						cpy.Storage[key] = nil
+					}
+				}
+			}
+			pre[ch.account] = cpy
+		case balanceChange:
+			pre[ch.account].Balance = ch.prev
+		case nonceChange:
+			pre[ch.account].Nonce = ch.prev
+		case codeChange:
+			pre[ch.account].Code = ch.prev
+		case storageChange:
+			// Unset slots are kept as nil so that they are still compared.
+			pre[ch.account].Storage[ch.key] = ch.prev
+		}
+	}
+	return pre
+}
+
+// diffState compares the prestate of the touched accounts with their
+// current state.
+func (s *StateDB) diffState(pre map[[20]byte]*Account) StateDiff {
+	var diff StateDiff
+	for addr, before := range pre {
+		after := s.loadAccount(addr)
+		if d := diffAccount(addr, before, after); d != nil {
+			diff = append(diff, d)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		return bytes.Compare(diff[i].Address[:], diff[j].Address[:]) < 0
+	})
+	return diff
+}
+
+// diffAccount returns the changes between two versions of an account, nil
+// meaning it doesn't exist, or nil if there are none.
+func diffAccount(addr [20]byte, before, after *Account) *AccountDiff {
+	if before == nil && after == nil {
+		return nil
+	}
+
+	d := &AccountDiff{Address: addr, Status: DiffModified}
+	switch {
+	case before == nil:
+		d.Status = DiffCreated
+		before = NewAccount()
+	case after == nil:
+		d.Status = DiffDeleted
+		after = NewAccount()
+	}
+
+	if before.Balance.Cmp(after.Balance) != 0 {
+		d.Balance = &BalanceDiff{From: new(big.Int).Set(before.Balance), To: new(big.Int).Set(after.Balance)}
+	}
+	if before.Nonce != after.Nonce {
+		d.Nonce = &NonceDiff{From: before.Nonce, To: after.Nonce}
+	}
+	if !bytes.Equal(before.Code, after.Code) {
+		d.Code = &CodeDiff{From: before.Code, To: after.Code}
+	}
+
+	// Slots missing from after are zero, whether deleted or never written.
+	slots := make(map[[32]byte]struct{})
+	for key := range before.Storage {
+		slots[key] = struct{}{}
+	}
+	if d.Status != DiffModified {
+		for key := range after.Storage {
+			slots[key] = struct{}{}
+		}
+	}
+	for key := range slots {
+		from, to := toWord(before.Storage[key]), toWord(after.Storage[key])
+		if from == to {
+			continue
+		}
+		if d.Storage == nil {
+			d.Storage = make(map[[32]byte]SlotDiff)
+		}
+		d.Storage[key] = SlotDiff{From: from, To: to}
+	}
+
+	if d.Status == DiffModified && d.Balance == nil && d.Nonce == nil && d.Code == nil && d.Storage == nil {
+		return nil
+	}
+	return d
+}
+
+// toWord left-pads a storage value to a full 32-byte word.
+func toWord(value []byte) [32]byte {
+	var word [32]byte
+	value = bytes.TrimLeft(value, "\x00")
+	copy(word[32-len(value):], value)
+	return word
+}
+
+type diffJSON struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+type accountDiffJSON struct {
+	Status  string              `json:"status"`
+	Balance *diffJSON           `json:"balance,omitempty"`
+	Nonce   *diffJSON           `json:"nonce,omitempty"`
+	Code    *diffJSON           `json:"code,omitempty"`
+	Storage map[string]diffJSON `json:"storage,omitempty"`
+}
+
+// MarshalJSON encodes the diff as an object keyed by address, with a
+// {"from", "to"} pair for every changed field and storage slot.
+func (d StateDiff) MarshalJSON() ([]byte, error) {
+	out := make(map[string]accountDiffJSON, len(d))
+	for _, acc := range d {
+		enc := accountDiffJSON{Status: acc.Status}
+		if acc.Balance != nil {
+			enc.Balance = &diffJSON{hexutil.EncodeBig(acc.Balance.From), hexutil.EncodeBig(acc.Balance.To)}
+		}
+		if acc.Nonce != nil {
+			enc.Nonce = &diffJSON{hexutil.EncodeUint64(acc.Nonce.From), hexutil.EncodeUint64(acc.Nonce.To)}
+		}
+		if acc.Code != nil {
+			enc.Code = &diffJSON{hexutil.Encode(acc.Code.From), hexutil.Encode(acc.Code.To)}
+		}
+		if len(acc.Storage) > 0 {
+			enc.Storage = make(map[string]diffJSON, len(acc.Storage))
+			for key, slot := range acc.Storage {
+				enc.Storage[hexutil.Encode(key[:])] = diffJSON{hexutil.Encode(slot.From[:]), hexutil.Encode(slot.To[:])}
+			}
+		}
+		out[hexutil.Encode(acc.Address[:])] = enc
+	}
+	return json.Marshal(out)
+}
+
+// Table renders the diff as a human-readable table, one row per changed
+// field. Balances are in wei.
+func (d StateDiff) Table() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tSTATUS\tFIELD\tFROM\tTO")
+
+	for _, acc := range d {
+		address, status := fmt.Sprintf("0x%x", acc.Address), acc.Status
+		row := func(field, from, to string) {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", address, status, field, from, to)
+			address, status = "", "" // only on the first row of the account
+		}
+
+		if acc.Balance != nil {
+			row("balance", acc.Balance.From.String(), acc.Balance.To.String())
+		}
+		if acc.Nonce != nil {
+			row("nonce", fmt.Sprint(acc.Nonce.From), fmt.Sprint(acc.Nonce.To))
+		}
+		if acc.Code != nil {
+			row("code", fmt.Sprintf("%d bytes", len(acc.Code.From)), fmt.Sprintf("%d bytes", len(acc.Code.To)))
+		}
+
+		keys := make([][32]byte, 0, len(acc.Storage))
+		for key := range acc.Storage {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		for _, key := range keys {
+			slot := acc.Storage[key]
+			row(fmt.Sprintf("slot 0x%x", trimWord(key)), fmt.Sprintf("0x%x", trimWord(slot.From)), fmt.Sprintf("0x%x", trimWord(slot.To)))
+		}
+		if address != "" {
+			row("-", "", "") // created or deleted empty account
+		}
+	}
+	w.Flush()
+	return sb.String()
+}
+
+// trimWord strips the leading zeros of a word, keeping at least one byte.
+func trimWord(word [32]byte) []byte {
+	trimmed := bytes.TrimLeft(word[:], "\x00")
+	if len(trimmed) == 0 {
+		return []byte{0}
+	}
+	return trimmed
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// TestStateDiff runs transactions against a contract and checks their
+// state diffs, in their JSON form.
+func TestStateDiff(t *testing.T) {
+	contract := [20]byte{0xc0}
+	tests := []struct {
+		name string
+		code []byte
+		to   *[20]byte
+		data []byte
+		want string
+	}{
+		{
+			// The second slot ends as it started.
+			name: "storage",
+			code: []byte{
+				0x60, 0x05, 0x60, 0x00, 0x55, // SSTORE(0, 5)
+				0x60, 0x09, 0x60, 0x02, 0x55, // SSTORE(2, 9)
+				0x60, 0x00, 0x60, 0x02, 0x55, // SSTORE(2, 0)
+			},
+			to: &contract,
+			want: `{` +
+				`"0x0100000000000000000000000000000000000000":{"status":"modified","nonce":{"from":"0x0","to":"0x1"}},` +
+				`"0xc000000000000000000000000000000000000000":{"status":"modified","storage":{` +
+				`"0x0000000000000000000000000000000000000000000000000000000000000000":{` +
+				`"from":"0x0000000000000000000000000000000000000000000000000000000000000001",` +
+				`"to":"0x0000000000000000000000000000000000000000000000000000000000000005"}}}}`,
+		},
+		{
+			// Init code running SSTORE(0, 7) and returning no code.
+			name: "creation",
+			data: []byte{0x60, 0x07, 0x60, 0x00, 0x55, 0x00},
+			want: `{` +
+				`"0x0100000000000000000000000000000000000000":{"status":"modified","nonce":{"from":"0x0","to":"0x1"}},` +
+				fmt.Sprintf(`"0x%x":{`, CreateAddress(testSender, 0)) + `"status":"created","nonce":{"from":"0x0","to":"0x1"},"storage":{` +
+				`"0x0000000000000000000000000000000000000000000000000000000000000000":{` +
+				`"from":"0x0000000000000000000000000000000000000000000000000000000000000000",` +
+				`"to":"0x0000000000000000000000000000000000000000000000000000000000000007"}}}}`,
+		},
+		{
+			// Only the nonce is left.
+			name: "reverted",
+			code: []byte{
+				0x60, 0x05, 0x60, 0x00, 0x55, // SSTORE(0, 5)
+				0x60, 0x00, 0x80, 0xfd, // REVERT(0, 0)
+			},
+			to:   &contract,
+			want: `{"0x0100000000000000000000000000000000000000":{"status":"modified","nonce":{"from":"0x0","to":"0x1"}}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		state := NewStateDB()
+		state.SetBalance(testSender, big.NewInt(1))
+		state.SetCode(contract, tt.code)
+		state.SetStorage(contract, [32]byte{}, []byte{0x01})
+		state.resetJournal()
+
+		tx := &Transaction{GasPrice: new(big.Int), GasLimit: 100_000, To: tt.to, Data: tt.data}
+		evm := NewEVM(state, testBlock(nil))
+		evm.Config.StateDiff = true
+		res, err := evm.ProcessTransaction(tx, testSender)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		got, err := json.Marshal(res.StateDiff)
+		if err != nil {
+			t.Fatalf("%s: Unexpected encoding error: %v", tt.name, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestStateDiffOff checks that no diff is built unless asked for.
+func TestStateDiffOff(t *testing.T) {
+	to := [20]byte{0x02}
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1000))
+
+	tx := &Transaction{GasPrice: new(big.Int), GasLimit: 21000, To: &to, Value: big.NewInt(1)}
+	res, err := NewEVM(state, testBlock(nil)).ProcessTransaction(tx, testSender)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.StateDiff != nil {
+		t.Errorf("Expected no state diff, got %d accounts", len(res.StateDiff))
+	}
+}
+
+// TestStateDiffTable checks the table rendering of a diff.
+func TestStateDiffTable(t *testing.T) {
+	diff := StateDiff{
+		{
+			Address: [20]byte{0x01},
+			Status:  DiffModified,
+			Balance: &BalanceDiff{From: big.NewInt(100), To: big.NewInt(40)},
+			Nonce:   &NonceDiff{From: 0, To: 1},
+		},
+		{
+			Address: [20]byte{0x02},
+			Status:  DiffCreated,
+			Storage: map[[32]byte]SlotDiff{{31: 0x01}: {To: [32]byte{31: 0xff}}},
+		},
+	}
+	want := "ACCOUNT                                     STATUS    FIELD      FROM  TO\n" +
+		"0x0100000000000000000000000000000000000000  modified  balance    100   40\n" +
+		"                                                      nonce      0     1\n" +
+		"0x0200000000000000000000000000000000000000  created   slot 0x01  0x00  0xff\n"
+	if got := diff.Table(); got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+// opcodeNames maps the opcode constants to their mnemonics. Undefined
+// opcodes have no name.
+var opcodeNames = newOpcodeNames()
+
+func newOpcodeNames() [256]string {
+	names := [256]string{
+		STOP: "STOP", ADD: "ADD", MUL: "MUL", SUB: "SUB", DIV: "DIV", SDIV: "SDIV",
+		MOD: "MOD", SMOD: "SMOD", ADDMOD: "ADDMOD", MULMOD: "MULMOD", EXP: "EXP",
+		SIGNEXTEND: "SIGNEXTEND",
+
+		LT: "LT", GT: "GT", SLT: "SLT", SGT: "SGT", EQ: "EQ", ISZERO: "ISZERO",
+		AND: "AND", OR: "OR", XOR: "XOR", NOT: "NOT", BYTE: "BYTE", SHL: "SHL",
+		SHR: "SHR", SAR: "SAR",
+
+		KECCAK256: "KECCAK256",
+
+		ADDRESS: "ADDRESS", BALANCE: "BALANCE", ORIGIN: "ORIGIN", CALLER: "CALLER",
+		CALLVALUE: "CALLVALUE", CALLDATALOAD: "CALLDATALOAD", CALLDATASIZE: "CALLDATASIZE",
+		CALLDATACOPY: "CALLDATACOPY", CODESIZE: "CODESIZE", CODECOPY: "CODECOPY",
+		GASPRICE: "GASPRICE", EXTCODESIZE: "EXTCODESIZE", EXTCODECOPY: "EXTCODECOPY",
+		RETURNDATASIZE: "RETURNDATASIZE", RETURNDATACOPY: "RETURNDATACOPY",
+		EXTCODEHASH: "EXTCODEHASH",
+
+		BLOCKHASH: "BLOCKHASH", COINBASE: "COINBASE", TIMESTAMP: "TIMESTAMP",
+		NUMBER: "NUMBER", DIFFICULTY: "DIFFICULTY", GASLIMIT: "GASLIMIT",
+		CHAINID: "CHAINID", SELFBALANCE: "SELFBALANCE", BASEFEE: "BASEFEE",
+		BLOBHASH: "BLOBHASH", BLOBBASEFEE: "BLOBBASEFEE",
+
+		POP: "POP", MLOAD: "MLOAD", MSTORE: "MSTORE", MSTORE8: "MSTORE8",
+		SLOAD: "SLOAD", SSTORE: "SSTORE", JUMP: "JUMP", JUMPI: "JUMPI", PC: "PC",
+		MSIZE: "MSIZE", GAS: "GAS", JUMPDEST: "JUMPDEST", TLOAD: "TLOAD",
+		TSTORE: "TSTORE", MCOPY: "MCOPY", PUSH0: "PUSH0",
+
+		CREATE: "CREATE", CALL: "CALL", CALLCODE: "CALLCODE", RETURN: "RETURN",
+		DELEGATECALL: "DELEGATECALL", CREATE2: "CREATE2", STATICCALL: "STATICCALL",
+		REVERT: "REVERT", INVALID: "INVALID", SELFDESTRUCT: "SELFDESTRUCT",
+	}
+	for i := 0; i < 32; i++ {
+		names[PUSH1+i] = fmt.Sprintf("PUSH%d", i+1)
+	}
+	for i := 0; i < 16; i++ {
+		names[DUP1+i] = fmt.Sprintf("DUP%d", i+1)
+		names[SWAP1+i] = fmt.Sprintf("SWAP%d", i+1)
+	}
+	for i := 0; i <= 4; i++ {
+		names[LOG0+i] = fmt.Sprintf("LOG%d", i)
+	}
+	return names
+}
+
+// OpcodeName returns the mnemonic of op, or "" if op is not a defined
+// opcode.
+func OpcodeName(op byte) string {
+	return opcodeNames[op]
+}
+
+// pushSize returns the number of immediate bytes following op.
+func pushSize(op byte) int {
+	if op >= PUSH1 && op <= PUSH32 {
+		return int(op-PUSH1) + 1
+	}
+	return 0
+}
+
+// Instruction is a single decoded instruction.
+type Instruction struct {
+	PC uint64
+	Op byte
+	// Immediate is the data of a PUSH instruction. It is shorter than the
+	// PUSH size when the code ends early; the EVM reads the missing bytes
+	// as zeros.
+	Immediate []byte
+}
+
+// Known reports whether the instruction is a defined opcode.
+func (in Instruction) Known() bool {
+	return opcodeNames[in.Op] != ""
+}
+
+// Truncated reports whether the code ended before the PUSH data did.
+func (in Instruction) Truncated() bool {
+	return len(in.Immediate) < pushSize(in.Op)
+}
+
+// String returns the instruction as "MNEMONIC immediate". Unknown opcodes
+// are written as DATA bytes.
+func (in Instruction) String() string {
+	switch {
+	case !in.Known():
+		return fmt.Sprintf("DATA 0x%02x", in.Op)
+	case pushSize(in.Op) > 0:
+		return fmt.Sprintf("%s 0x%x", opcodeNames[in.Op], in.Immediate)
+	}
+	return opcodeNames[in.Op]
+}
+
+// Disassembly is decoded bytecode.
+type Disassembly struct {
+	Instructions []Instruction
+	// Metadata is the Solidity CBOR metadata trailer, including its
+	// two-byte length, if the code ends with one. It is not decoded as
+	// instructions.
+	Metadata []byte
+}
+
+// Disassemble decodes code into instructions, leaving out the Solidity
+// metadata trailer.
+func Disassemble(code []byte) *Disassembly {
+	code, metadata := SplitMetadata(code)
+	d := &Disassembly{Metadata: metadata}
+	for pc := 0; pc < len(code); {
+		in := Instruction{PC: uint64(pc), Op: code[pc]}
+		pc++
+		if n := pushSize(in.Op); n > 0 {
+			end := min(pc+n, len(code))
+			in.Immediate = code[pc:end]
+			pc = end
+		}
+		d.Instructions = append(d.Instructions, in)
+	}
+	return d
+}
+
+// String returns one "PC: MNEMONIC immediate" line per instruction, with
+// the PC in hex. Unknown opcodes, truncated PUSH data and the metadata
+// trailer are written as DATA and flagged with comments, so that the
+// output assembles back to the same code.
+func (d *Disassembly) String() string {
+	var sb strings.Builder
+	var end uint64
+	for _, in := range d.Instructions {
+		switch {
+		case !in.Known():
+			fmt.Fprintf(&sb, "0x%04x: %s ; unknown opcode\n", in.PC, in)
+		case in.Truncated():
+			fmt.Fprintf(&sb, "0x%04x: DATA 0x%02x%x ; %s truncated, %d of %d bytes\n", in.PC, in.Op, in.Immediate, opcodeNames[in.Op], len(in.Immediate), pushSize(in.Op))
+		default:
+			fmt.Fprintf(&sb, "0x%04x: %s\n", in.PC, in)
+		}
+		end = in.PC + 1 + uint64(len(in.Immediate))
+	}
+	if len(d.Metadata) > 0 {
+		fmt.Fprintf(&sb, "0x%04x: DATA 0x%x ; solidity metadata\n", end, d.Metadata)
+	}
+	return sb.String()
+}
+
+// metadataKeys are the keys solc writes in the metadata map.
+var metadataKeys = [][]byte{[]byte("ipfs"), []byte("bzzr0"), []byte("bzzr1"), []byte("solc"), []byte("experimental")}
+
+// SplitMetadata splits the Solidity metadata trailer off code. solc
+// appends a CBOR encoded map followed by its length as a big-endian
+// uint16. The returned metadata includes the length and is nil if there
+// is no trailer.
+func SplitMetadata(code []byte) (body, metadata []byte) {
+	if len(code) < 2 {
+		return code, nil
+	}
+	size := int(binary.BigEndian.Uint16(code[len(code)-2:]))
+	start := len(code) - 2 - size
+	if size == 0 || start < 0 {
+		return code, nil
+	}
+	cbor := code[start : len(code)-2]
+	// A non-empty CBOR map of fewer than 24 entries starts with 0xa1-0xb7.
+	if cbor[0] < 0xa1 || cbor[0] > 0xb7 {
+		return code, nil
+	}
+	for _, key := range metadataKeys {
+		if bytes.Contains(cbor, key) {
+			return code[:start], code[start:]
+		}
+	}
+	return code, nil
+}
+
+// disasmCommand implements 'prevm disasm'.
+func disasmCommand(args []string) error {
+	fs := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: prevm disasm [flags] [codefile]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Disassembles the bytecode given with --code, or read as hex from codefile ('-' for stdin).")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	code := fs.String("code", "", "bytecode to disassemble, as hex")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	bytecode, err := readCode(*code, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if bytecode == nil {
+		return errors.New("no code given, use --code or a codefile")
+	}
+	fmt.Print(Disassemble(bytecode))
+	return nil
+}
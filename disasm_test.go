@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// solcMetadata is the trailer solc 0.8.19 appends to contracts: a CBOR map
+// with the IPFS hash of the metadata and the compiler version, followed by
+// its length.
+const solcMetadata = "a2646970667358221220" +
+	"0102030405060708091011121314151617181920212223242526272829303132" +
+	"64736f6c63430008130033"
+
+// TestDisassemble checks the listing of small programs, including unknown
+// opcodes, truncated PUSH data and a metadata trailer.
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want string
+	}{
+		{"empty", "", ""},
+		{
+			"push add",
+			"6001600201",
+			"0x0000: PUSH1 0x01\n0x0002: PUSH1 0x02\n0x0004: ADD\n",
+		},
+		{
+			"unknown opcode",
+			"0c00",
+			"0x0000: DATA 0x0c ; unknown opcode\n0x0001: STOP\n",
+		},
+		{
+			"truncated push",
+			"00630102",
+			"0x0000: STOP\n0x0001: DATA 0x630102 ; PUSH4 truncated, 2 of 4 bytes\n",
+		},
+		{
+			"metadata",
+			"6080fe" + solcMetadata,
+			"0x0000: PUSH1 0x80\n0x0002: INVALID\n0x0003: DATA 0x" + solcMetadata + " ; solidity metadata\n",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Disassemble(unhex(tt.code)).String(); got != tt.want {
+			t.Errorf("%s: Expected\n%s\ngot\n%s", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestSplitMetadata checks that only a trailer that looks like solc
+// metadata is split off.
+func TestSplitMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     string
+		metadata string
+	}{
+		{"solc trailer", "6080fe" + solcMetadata, solcMetadata},
+		{"no trailer", "6001600201", ""},
+		{"too short", "00", ""},
+		{"length past the start", "a1ff00ff", ""},
+		{"not a map", "6080fe" + "80" + "64736f6c63" + "0006", ""},
+		{"map without metadata keys", "6080fe" + "a1616101" + "0004", ""},
+	}
+
+	for _, tt := range tests {
+		code := unhex(tt.code)
+		body, metadata := SplitMetadata(code)
+		if !bytes.Equal(metadata, unhex(tt.metadata)) {
+			t.Errorf("%s: Expected metadata %s, got %x", tt.name, tt.metadata, metadata)
+		}
+		if !bytes.Equal(append(body, metadata...), code) {
+			t.Errorf("%s: Expected body and metadata to make up the code", tt.name)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"prevm/config"
+	"prevm/rlp"
+	"strings"
+)
+
+var (
+	ErrEmptyTypedTx    = errors.New("empty typed transaction bytes")
+	ErrInvalidAddress  = errors.New("invalid address length")
+	ErrInvalidHashSize = errors.New("invalid hash length")
+)
+
+// MarshalBinary returns the canonical encoding of the transaction: the RLP
+// list for legacy transactions, and type || rlp(payload) for typed ones.
+// This is the form wallets sign and send as a raw transaction.
+func (tx *Transaction) MarshalBinary() ([]byte, error) {
+	fields, err := tx.unsignedFields()
+	if err != nil {
+		return nil, err
+	}
+	fields = append(fields, rlp.EncodeBigInt(tx.V), rlp.EncodeBigInt(tx.R), rlp.EncodeBigInt(tx.S))
+
+	payload := rlp.EncodeList(fields...)
+	if tx.Type == LegacyTxType {
+		return payload, nil
+	}
+	return append([]byte{tx.Type}, payload...), nil
+}
+
+// UnmarshalBinary decodes the canonical encoding produced by MarshalBinary.
+// Blob transactions in their network form (with the blob sidecar attached)
+// are accepted too; the sidecar is dropped.
+func (tx *Transaction) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return rlp.ErrUnexpectedEnd
+	}
+
+	// Legacy transactions are a plain RLP list.
+	if b[0] >= 0xc0 {
+		item, err := rlp.Decode(b)
+		if err != nil {
+			return err
+		}
+		return tx.decodeFields(LegacyTxType, item)
+	}
+
+	// Typed transactions: type || payload.
+	if b[0] > 0x7f {
+		return fmt.Errorf("%w: type %d", ErrTxTypeNotSupported, b[0])
+	}
+	if len(b) <= 1 {
+		return ErrEmptyTypedTx
+	}
+	item, err := rlp.Decode(b[1:])
+	if err != nil {
+		return err
+	}
+
+	// The network form of a blob transaction is
+	// rlp([tx_payload_body, blobs, commitments, proofs]).
+	if b[0] == BlobTxType && item.IsList && len(item.List) > 0 && item.List[0].IsList {
+		item = item.List[0]
+	}
+	return tx.decodeFields(b[0], item)
+}
+
+// DecodeTransaction decodes a raw transaction.
+func DecodeTransaction(raw []byte) (*Transaction, error) {
+	tx := new(Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+	return tx, nil
+}
+
+// ParseRawTransaction decodes a hex encoded raw transaction, as returned by
+// wallets and eth_getRawTransactionByHash.
+func ParseRawTransaction(s string) (*Transaction, error) {
+	raw, err := DecodeHex(s)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeTransaction(raw)
+}
+
+// Hash returns the transaction hash: the Keccak-256 of its canonical
+// encoding. Transactions of an unsupported type hash to zero.
+func (tx *Transaction) Hash() [32]byte {
+	var hash [32]byte
+	enc, err := tx.MarshalBinary()
+	if err != nil {
+		return hash
+	}
+	copy(hash[:], config.Hash(enc))
+	return hash
+}
+
+// unsignedFields returns the RLP encoded fields of the transaction payload
+// in wire order, without the signature values.
+func (tx *Transaction) unsignedFields() ([][]byte, error) {
+	switch tx.Type {
+	case LegacyTxType:
+		return [][]byte{
+			rlp.EncodeUint(tx.Nonce),
+			rlp.EncodeBigInt(tx.GasPrice),
+			rlp.EncodeUint(tx.GasLimit),
+			encodeAddress(tx.To),
+			rlp.EncodeBigInt(tx.Value),
+			rlp.EncodeBytes(tx.Data),
+		}, nil
+
+	case AccessListTxType:
+		return [][]byte{
+			rlp.EncodeBigInt(tx.ChainID),
+			rlp.EncodeUint(tx.Nonce),
+			rlp.EncodeBigInt(tx.GasPrice),
+			rlp.EncodeUint(tx.GasLimit),
+			encodeAddress(tx.To),
+			rlp.EncodeBigInt(tx.Value),
+			rlp.EncodeBytes(tx.Data),
+			encodeAccessList(tx.AccessList),
+		}, nil
+
+	case DynamicFeeTxType, BlobTxType, SetCodeTxType:
+		fields := [][]byte{
+			rlp.EncodeBigInt(tx.ChainID),
+			rlp.EncodeUint(tx.Nonce),
+			rlp.EncodeBigInt(tx.MaxPriorityFeePerGas),
+			rlp.EncodeBigInt(tx.MaxFeePerGas),
+			rlp.EncodeUint(tx.GasLimit),
+			encodeAddress(tx.To),
+			rlp.EncodeBigInt(tx.Value),
+			rlp.EncodeBytes(tx.Data),
+			encodeAccessList(tx.AccessList),
+		}
+		if tx.Type == BlobTxType {
+			hashes := make([][]byte, len(tx.BlobHashes))
+			for i, h := range tx.BlobHashes {
+				hashes[i] = rlp.EncodeBytes(h[:])
+			}
+			fields = append(fields, rlp.EncodeBigInt(tx.MaxFeePerBlobGas), rlp.EncodeList(hashes...))
+		}
+		if tx.Type == SetCodeTxType {
+			fields = append(fields, encodeAuthList(tx.AuthList))
+		}
+		return fields, nil
+
+	default:
+		return nil, fmt.Errorf("%w: type %d", ErrTxTypeNotSupported, tx.Type)
+	}
+}
+
+// decodeFields fills in the transaction from the decoded payload list of a
+// transaction of the given type.
+func (tx *Transaction) decodeFields(txType byte, item rlp.Item) error {
+	var count int
+	switch txType {
+	case LegacyTxType:
+		count = 9
+	case AccessListTxType:
+		count = 11
+	case DynamicFeeTxType:
+		count = 12
+	case BlobTxType:
+		count = 14
+	case SetCodeTxType:
+		count = 13
+	default:
+		return fmt.Errorf("%w: type %d", ErrTxTypeNotSupported, txType)
+	}
+
+	items, err := item.Items(count)
+	if err != nil {
+		return err
+	}
+
+	r := &fieldReader{items: items}
+	*tx = Transaction{Type: txType}
+
+	if txType != LegacyTxType {
+		tx.ChainID = r.bigInt()
+	}
+	tx.Nonce = r.uint64()
+	if txType == LegacyTxType || txType == AccessListTxType {
+		tx.GasPrice = r.bigInt()
+	} else {
+		tx.MaxPriorityFeePerGas = r.bigInt()
+		tx.MaxFeePerGas = r.bigInt()
+	}
+	tx.GasLimit = r.uint64()
+	tx.To = r.address()
+	tx.Value = r.bigInt()
+	tx.Data = r.bytes()
+	if txType != LegacyTxType {
+		tx.AccessList = r.accessList()
+	}
+	if txType == BlobTxType {
+		tx.MaxFeePerBlobGas = r.bigInt()
+		tx.BlobHashes = r.hashes()
+	}
+	if txType == SetCodeTxType {
+		tx.AuthList = r.authList()
+	}
+	tx.V = r.bigInt()
+	tx.R = r.bigInt()
+	tx.S = r.bigInt()
+
+	// Legacy transactions carry their chain id inside V (EIP-155).
+	if txType == LegacyTxType {
+		tx.ChainID = deriveChainID(tx.V)
+	}
+
+	return r.err
+}
+
+func encodeAddress(addr *[20]byte) []byte {
+	if addr == nil {
+		return rlp.EncodeBytes(nil)
+	}
+	return rlp.EncodeBytes(addr[:])
+}
+
+func encodeAccessList(al AccessList) []byte {
+	tuples := make([][]byte, len(al))
+	for i, tuple := range al {
+		keys := make([][]byte, len(tuple.StorageKeys))
+		for j, key := range tuple.StorageKeys {
+			keys[j] = rlp.EncodeBytes(key[:])
+		}
+		tuples[i] = rlp.EncodeList(rlp.EncodeBytes(tuple.Address[:]), rlp.EncodeList(keys...))
+	}
+	return rlp.EncodeList(tuples...)
+}
+
+func encodeAuthList(auths []Authorization) []byte {
+	items := make([][]byte, len(auths))
+	for i, auth := range auths {
+		items[i] = rlp.EncodeList(
+			rlp.EncodeBigInt(auth.ChainID),
+			rlp.EncodeBytes(auth.Address[:]),
+			rlp.EncodeUint(auth.Nonce),
+			rlp.EncodeUint(uint64(auth.V)),
+			rlp.EncodeBigInt(auth.R),
+			rlp.EncodeBigInt(auth.S),
+		)
+	}
+	return rlp.EncodeList(items...)
+}
+
+// fieldReader reads the fields of a decoded list in order. The first error
+// is kept and every later read returns a zero value.
+type fieldReader struct {
+	items []rlp.Item
+	pos   int
+	err   error
+}
+
+func (r *fieldReader) next() (rlp.Item, bool) {
+	if r.err != nil {
+		return rlp.Item{}, false
+	}
+	if r.pos >= len(r.items) {
+		r.err = rlp.ErrWrongListLength
+		return rlp.Item{}, false
+	}
+	item := r.items[r.pos]
+	r.pos++
+	return item, true
+}
+
+func (r *fieldReader) fail(err error) {
+	if r.err == nil && err != nil {
+		r.err = fmt.Errorf("field %d: %w", r.pos-1, err)
+	}
+}
+
+func (r *fieldReader) uint64() uint64 {
+	item, ok := r.next()
+	if !ok {
+		return 0
+	}
+	v, err := item.Uint64()
+	r.fail(err)
+	return v
+}
+
+func (r *fieldReader) bigInt() *big.Int {
+	item, ok := r.next()
+	if !ok {
+		return nil
+	}
+	v, err := item.BigInt()
+	r.fail(err)
+	return v
+}
+
+func (r *fieldReader) bytes() []byte {
+	item, ok := r.next()
+	if !ok {
+		return nil
+	}
+	v, err := item.Bytes()
+	r.fail(err)
+	return v
+}
+
+// address reads a recipient address. The empty string means contract creation.
+func (r *fieldReader) address() *[20]byte {
+	b := r.bytes()
+	if r.err != nil || len(b) == 0 {
+		return nil
+	}
+	if len(b) != 20 {
+		r.fail(fmt.Errorf("%w: %d", ErrInvalidAddress, len(b)))
+		return nil
+	}
+	var addr [20]byte
+	copy(addr[:], b)
+	return &addr
+}
+
+func (r *fieldReader) list() []rlp.Item {
+	item, ok := r.next()
+	if !ok {
+		return nil
+	}
+	items, err := item.Items(-1)
+	r.fail(err)
+	return items
+}
+
+func (r *fieldReader) hashes() [][32]byte {
+	items := r.list()
+	hashes := make([][32]byte, 0, len(items))
+	for _, item := range items {
+		b, err := item.Bytes()
+		if err == nil && len(b) != 32 {
+			err = fmt.Errorf("%w: %d", ErrInvalidHashSize, len(b))
+		}
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		var h [32]byte
+		copy(h[:], b)
+		hashes = append(hashes, h)
+	}
+	return hashes
+}
+
+func (r *fieldReader) accessList() AccessList {
+	items := r.list()
+	al := make(AccessList, 0, len(items))
+	for _, item := range items {
+		tupleItems, err := item.Items(2)
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		tr := &fieldReader{items: tupleItems}
+		addr := tr.address()
+		keys := tr.hashes()
+		if tr.err == nil && addr == nil {
+			tr.err = ErrInvalidAddress
+		}
+		if tr.err != nil {
+			r.fail(tr.err)
+			return nil
+		}
+		al = append(al, AccessTuple{Address: *addr, StorageKeys: keys})
+	}
+	return al
+}
+
+func (r *fieldReader) authList() []Authorization {
+	items := r.list()
+	auths := make([]Authorization, 0, len(items))
+	for _, item := range items {
+		authItems, err := item.Items(6)
+		if err != nil {
+			r.fail(err)
+			return nil
+		}
+		ar := &fieldReader{items: authItems}
+		auth := Authorization{ChainID: ar.bigInt()}
+		addr := ar.address()
+		auth.Nonce = ar.uint64()
+		v := ar.uint64()
+		auth.R = ar.bigInt()
+		auth.S = ar.bigInt()
+		if ar.err == nil && (addr == nil || v > 0xff) {
+			ar.err = fmt.Errorf("invalid authorization tuple")
+		}
+		if ar.err != nil {
+			r.fail(ar.err)
+			return nil
+		}
+		auth.Address = *addr
+		auth.V = uint8(v)
+		auths = append(auths, auth)
+	}
+	return auths
+}
+
+// DecodeHex decodes a hex string with or without the 0x prefix.
+func DecodeHex(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
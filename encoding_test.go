@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"prevm/rlp"
+	"testing"
+)
+
+// txVectors are transactions of each type signed by geth with the key of
+// the EIP-155 example, 0x4646...46, along with their hashes and the hashes
+// they were signed over.
+var txVectors = []struct {
+	name    string
+	raw     string
+	typ     byte
+	hash    string
+	sigHash string
+}{
+	{
+		// The EIP-155 example transaction.
+		name:    "legacy eip-155",
+		raw:     "0xf86c098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83",
+		typ:     LegacyTxType,
+		hash:    "0x33469b22e9f636356c4160a87eb19df52b7412e8eac32a4a55ffe88ea8350788",
+		sigHash: "0xdaf5a779ae972f972197303d7b574746c7ef83eadac0f2791ad23db92e4c8e53",
+	},
+	{
+		name:    "legacy create before eip-155",
+		raw:     "0xf85401843b9aca0082ea6080808560006000f31ca018b7a48e84fb455d265603e782d65b26a1d04df7e8b286978e253660e7007efca010a18bf6c21ba6c07318491e8cc5a0ae6516a9e597c08bff20105880310d1482",
+		typ:     LegacyTxType,
+		hash:    "0x78104040f4e223ae549358295905a193f5ba253870f6ddc5ca158ccc018a1cf0",
+		sigHash: "0xcc5e7e2a1a8186eb5efd506fa07b62c76d3fb29d0ea57daca6b9d67d599c9bee",
+	},
+	{
+		name:    "access list",
+		raw:     "0x01f8c3010284b2d05e0082c3509435353535353535353535353535353535353535350582deadf85bf859940a00000000000000000000000000000000000000f842a00000000000000000000000000000000000000000000000000000000000000001a0000000000000000000000000000000000000000000000000000000000000000201a085c936534b6c34d1b81a9320b3f2b3233c16bef04a436abce673e1e9902867ffa029e6b37fa15cf27b2f7fa9e779f4bf9a55f2111c60d00e8d3120a6657cb9410e",
+		typ:     AccessListTxType,
+		hash:    "0x20ac2b73cd178648e0b0600bed19becf770a9cca89179bf525399ffb8ba1b58f",
+		sigHash: "0x275aba22550345548e53fb4ad6fe3558a5de556d3832fd10e04818f714bbf387",
+	},
+	{
+		name:    "dynamic fee",
+		raw:     "0x02f8c7010384773594008506fc23ac00829c409435353535353535353535353535353535353535350701f85bf859940a00000000000000000000000000000000000000f842a00000000000000000000000000000000000000000000000000000000000000001a0000000000000000000000000000000000000000000000000000000000000000201a04c445b5e54e33ed7e7a6a686d40644f771d6628fc175eda30894fad345c92926a0074a7a00be9dc05b22e29ef8b596997971b71671933ec99391332358babbac6e",
+		typ:     DynamicFeeTxType,
+		hash:    "0x84c72a4b52129e4d3a1bf2cc50fa94a0d78032e51e19cf91a540c35c57c16f8d",
+		sigHash: "0x33ee2453036a89f1f09250fcfba8bdcca018b9a156b30ecff09907dc236b45bb",
+	},
+	{
+		name:    "blob",
+		raw:     "0x03f88d0104843b9aca008504a817c8008275309435353535353535353535353535353535353535358080c003e1a001000000000000000000000000000000000000000000000000000000000000aa019f5c1d79d6d74d2126288184e4b6ddd32841a3763ddca56a314262ac62ec0573a01aef30658450ce8757a03ce6ec3dddb4da179300053285c7f16270c325d52d29",
+		typ:     BlobTxType,
+		hash:    "0xa27e388a967dec4eb918598fd9936ee2182345a2f58f57d4b7bdb7239da83627",
+		sigHash: "0x5b7b2c414f2f585053679afcd2c0b67d9cfd76cc9a5f6974a189c5e5fb4d2785",
+	},
+	{
+		name:    "set code",
+		raw:     "0x04f8ca0105843b9aca008504a817c800830138809435353535353535353535353535353535353535358080c0f85cf85a019400000000000000000000000000000000000000cc0601a0e7968dab6b777a74211d8838f4231a611d405d2270625b925d3e1e33b641fb63a070e4cdf42796f71daa0c7f9b9e97dd48b4afadf58fdeeaec4a661132b16d031180a0915435a4e7dec75f747a85ce1f2c7f733ce6959621a17535a7c3ed87b8d3e099a067be68994fdb2be3ee83ee83a72758631ea57aaaf0efe14a9e791ff0a3dbbe80",
+		typ:     SetCodeTxType,
+		hash:    "0x489e926a6012bf44a4e2d0ff52eaeb6e8f0b6b63362c9815c62c866b26dd714a",
+		sigHash: "0xda00af6220761a75e2494d75c7fbec245ba3ad059e55ef4fe2e1e2e82dfdca2e",
+	},
+}
+
+// TestDecodeTransaction checks that raw transactions of each type decode,
+// hash as geth hashes them and encode back to the same bytes.
+func TestDecodeTransaction(t *testing.T) {
+	for _, tt := range txVectors {
+		tx, err := ParseRawTransaction(tt.raw)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if tx.Type != tt.typ {
+			t.Errorf("%s: Expected type %d, got %d", tt.name, tt.typ, tx.Type)
+		}
+		if hash := tx.Hash(); fmt.Sprintf("0x%x", hash) != tt.hash {
+			t.Errorf("%s: Expected hash %s, got 0x%x", tt.name, tt.hash, hash)
+		}
+
+		raw, _ := DecodeHex(tt.raw)
+		enc, err := tx.MarshalBinary()
+		if err != nil {
+			t.Errorf("%s: Unexpected encoding error: %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(enc, raw) {
+			t.Errorf("%s: Expected the encoding\n%x\ngot\n%x", tt.name, raw, enc)
+		}
+	}
+}
+
+// TestDecodeTransactionFields checks the fields decoded from the EIP-155
+// example and from the set code transaction.
+func TestDecodeTransactionFields(t *testing.T) {
+	legacy, err := ParseRawTransaction(txVectors[0].raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if legacy.Nonce != 9 || legacy.GasPrice.Int64() != 20e9 || legacy.GasLimit != 21000 || legacy.Value.Int64() != 1e18 {
+		t.Errorf("Unexpected legacy fields: %+v", legacy)
+	}
+	if legacy.To == nil || *legacy.To != [20]byte(bytes.Repeat([]byte{0x35}, 20)) {
+		t.Errorf("Expected the recipient 0x3535...35, got %v", legacy.To)
+	}
+	if legacy.V.Int64() != 37 || legacy.ChainID.Int64() != 1 {
+		t.Errorf("Expected v 37 and chain id 1, got %d and %v", legacy.V, legacy.ChainID)
+	}
+
+	create, err := ParseRawTransaction(txVectors[1].raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if create.To != nil || !bytes.Equal(create.Data, []byte{0x60, 0x00, 0x60, 0x00, 0xf3}) {
+		t.Errorf("Expected a contract creation, got to %v and data %x", create.To, create.Data)
+	}
+
+	setCode, err := ParseRawTransaction(txVectors[5].raw)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(setCode.AuthList) != 1 {
+		t.Fatalf("Expected 1 authorization, got %d", len(setCode.AuthList))
+	}
+	auth := setCode.AuthList[0]
+	if auth.ChainID.Int64() != 1 || auth.Address != [20]byte{19: 0xcc} || auth.Nonce != 6 || auth.V != 1 {
+		t.Errorf("Unexpected authorization: %+v", auth)
+	}
+}
+
+// TestDecodeTransactionErrors checks that malformed input, such as the raw
+// transactions sent to eth_sendRawTransaction may be, is rejected.
+func TestDecodeTransactionErrors(t *testing.T) {
+	legacy := txVectors[0].raw
+	dynamic := txVectors[3].raw
+
+	tests := []struct {
+		name string
+		raw  string
+		want error
+	}{
+		{"empty", "0x", rlp.ErrUnexpectedEnd},
+		{"type only", "0x02", ErrEmptyTypedTx},
+		{"unknown type", "0x05c0", ErrTxTypeNotSupported},
+		{"reserved type byte", "0x80", ErrTxTypeNotSupported},
+		{"legacy trailing bytes", legacy + "00", rlp.ErrTrailingBytes},
+		{"typed trailing bytes", dynamic + "00", rlp.ErrTrailingBytes},
+		{"truncated", legacy[:len(legacy)-2], rlp.ErrValueTooLarge},
+		{"too few fields", "0xc3010203", rlp.ErrWrongListLength},
+		// The nonce 9 encoded as a one byte string instead of itself.
+		{"non-canonical byte", "0xf86d81098504a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83", rlp.ErrNonCanonical},
+		// The gas price with a leading zero byte.
+		{"leading zero", "0xf86d09860004a817c800825208943535353535353535353535353535353535353535880de0b6b3a76400008025a028ef61340bd939bc2195fe537567866003e1a15d3c71ff63e1590620aa636276a067cbe9d8997f761aecb703304b3800ccf555c9f3dc64214b297fb1966a3b6d83", rlp.ErrLeadingZeroInt},
+		// A list of 3 bytes in the long form, which is for 56 bytes or more.
+		{"non-canonical size", "0xf803010203", rlp.ErrNonCanonical},
+		{"short recipient", "0xcb0102038201020405808080", ErrInvalidAddress},
+	}
+
+	for _, tt := range tests {
+		raw, err := DecodeHex(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: Unexpected hex error: %v", tt.name, err)
+		}
+		if _, err := DecodeTransaction(raw); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"math/big"
+	"prevm/hexutil"
+)
+
+// blockContextJSON is the JSON form of a BlockContext. Numbers are read as
+// hex or decimal and written as hex.
+type blockContextJSON struct {
+	Coinbase    hexutil.Bytes            `json:"coinbase"`
+	Number      *hexutil.HexOrDecimal256 `json:"number,omitempty"`
+	Timestamp   *hexutil.HexOrDecimal256 `json:"timestamp,omitempty"`
+	Difficulty  *hexutil.HexOrDecimal256 `json:"difficulty,omitempty"`
+	GasLimit    *hexutil.HexOrDecimal256 `json:"gasLimit,omitempty"`
+	BaseFee     *hexutil.HexOrDecimal256 `json:"baseFee,omitempty"`
+	BlobBaseFee *hexutil.HexOrDecimal256 `json:"blobBaseFee,omitempty"`
+	ChainID     *hexutil.HexOrDecimal256 `json:"chainId,omitempty"`
+}
+
+// MarshalJSON encodes the block context. GetHash can't be encoded and is
+// left out.
+func (b *BlockContext) MarshalJSON() ([]byte, error) {
+	return json.Marshal(blockContextJSON{
+		Coinbase:    b.Coinbase[:],
+		Number:      (*hexutil.HexOrDecimal256)(b.Number),
+		Timestamp:   (*hexutil.HexOrDecimal256)(b.Timestamp),
+		Difficulty:  (*hexutil.HexOrDecimal256)(b.Difficulty),
+		GasLimit:    (*hexutil.HexOrDecimal256)(b.GasLimit),
+		BaseFee:     (*hexutil.HexOrDecimal256)(b.BaseFee),
+		BlobBaseFee: (*hexutil.HexOrDecimal256)(b.BlobBaseFee),
+		ChainID:     (*hexutil.HexOrDecimal256)(b.ChainID),
+	})
+}
+
+func (b *BlockContext) UnmarshalJSON(input []byte) error {
+	var dec blockContextJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if len(dec.Coinbase) != 0 && len(dec.Coinbase) != 20 {
+		return ErrInvalidAddress
+	}
+
+	*b = BlockContext{
+		Number:      toBig(dec.Number),
+		Timestamp:   toBig(dec.Timestamp),
+		Difficulty:  toBig(dec.Difficulty),
+		GasLimit:    toBig(dec.GasLimit),
+		BaseFee:     toBig(dec.BaseFee),
+		BlobBaseFee: toBig(dec.BlobBaseFee),
+		ChainID:     toBig(dec.ChainID),
+	}
+	copy(b.Coinbase[:], dec.Coinbase)
+	return nil
+}
+
+func toBig(i *hexutil.HexOrDecimal256) *big.Int {
+	if i == nil {
+		return nil
+	}
+	return new(big.Int).Set(i.ToInt())
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var ErrGasRequiredExceedsAllowance = errors.New("gas required exceeds allowance")
+
+// RevertError is the error of a call that reverted at every gas limit it
+// could be given, with the data it reverted with.
+type RevertError struct {
+	Reason string // the reason of a revert with Error(string), or empty
+	Data   []byte
+}
+
+func newRevertError(data []byte) *RevertError {
+	reason, _ := UnpackRevert(data)
+	return &RevertError{Reason: reason, Data: data}
+}
+
+func (e *RevertError) Error() string {
+	if e.Reason == "" {
+		return ErrExecutionReverted.Error()
+	}
+	return ErrExecutionReverted.Error() + ": " + e.Reason
+}
+
+func (e *RevertError) Unwrap() error {
+	return ErrExecutionReverted
+}
+
+// EstimateGas returns the lowest gas limit msg succeeds with in block, on a
+// copy of state, which is left untouched. The limit is searched between the
+// intrinsic gas of msg and a cap: the gas of msg if set, else the gas limit
+// of the block, lowered to what the sender can pay for if msg has a price.
+//
+// The search runs the call at each limit it tries rather than guessing from
+// the gas used: a call forwarding 63/64 of its gas, or consuming gas that
+// is refunded, needs more than it uses. If the call fails even at the cap,
+// EstimateGas returns a *RevertError if it reverted, and the error it
+// failed with otherwise.
+func EstimateGas(state *StateDB, block *BlockContext, msg *CallMsg, config Config, overrides *CallOverrides) (uint64, error) {
+	ctx := *block
+	state = state.Copy()
+	var blockOverrides *CallOverrides
+	if overrides != nil {
+		overrides.Block.Apply(&ctx)
+		if err := overrides.State.Apply(state); err != nil {
+			return 0, err
+		}
+		blockOverrides = &CallOverrides{Block: overrides.Block}
+	}
+	tx := msg.transaction(&ctx)
+	intrinsicGas, err := tx.IntrinsicGas()
+	if err != nil {
+		return 0, err
+	}
+
+	hi := tx.GasLimit
+	if feeCap := tx.FeeCap(); feeCap.Sign() > 0 {
+		available := state.GetBalance(msg.From)
+		if msg.Value != nil {
+			available = new(big.Int).Sub(available, msg.Value)
+		}
+		// A sender short of the value fails the run at the cap with
+		// ErrInsufficientFunds.
+		if available.Sign() >= 0 {
+			allowance := new(big.Int).Div(available, feeCap)
+			if allowance.IsUint64() && allowance.Uint64() < hi {
+				logger.Debug("Gas estimation capped by balance", "cap", hi, "allowance", allowance.Uint64())
+				hi = allowance.Uint64()
+			}
+		}
+	}
+
+	// run runs msg with gas. The intrinsic gas is checked like any other
+	// failure, and other invalid calls end the search with their error.
+	run := func(gas uint64) (bool, *ExecutionResult, error) {
+		call := *msg
+		call.Gas = gas
+		res, err := DoCall(state, block, &call, config, blockOverrides)
+		if errors.Is(err, ErrIntrinsicGas) {
+			return false, nil, nil
+		}
+		if err != nil {
+			return false, nil, err
+		}
+		return !res.Failed(), res, nil
+	}
+
+	ok, res, err := run(hi)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		switch {
+		case res == nil, errors.Is(res.Err, ErrOutOfGas):
+			return 0, fmt.Errorf("%w (%d)", ErrGasRequiredExceedsAllowance, hi)
+		case errors.Is(res.Err, ErrExecutionReverted):
+			return 0, newRevertError(res.ReturnData)
+		default:
+			return 0, res.Err
+		}
+	}
+
+	// The gas used before the refund bounds the limit from below. Calls
+	// usually succeed with it and the gas withheld from the calls they
+	// make, so try that first.
+	lo := max(intrinsicGas, res.UsedGas+res.RefundedGas) - 1
+	if optimistic := (res.UsedGas + res.RefundedGas + CallStipend) * 64 / 63; optimistic < hi {
+		ok, _, err := run(optimistic)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = optimistic
+		} else {
+			lo = optimistic
+		}
+	}
+	for lo+1 < hi {
+		mid := lo + (hi-lo)/2
+		ok, _, err := run(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+	return hi, nil
+}
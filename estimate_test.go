@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// TestEstimateGas checks the estimates of calls that succeed, and the
+// errors of those failing with the most gas they are allowed.
+func TestEstimateGas(t *testing.T) {
+	var (
+		to        = [20]byte{0x02}
+		store     = [20]byte{0x5e}
+		forwarder = [20]byte{0xf0}
+	)
+	code := map[[20]byte]string{
+		store: "PUSH1 1 PUSH1 0 SSTORE STOP",
+		// CALL the store asking for more gas than is left, so that it gets
+		// all but a 64th of it, and revert if it fails.
+		forwarder: `
+			PUSH1 0 DUP1 DUP1 DUP1 DUP1
+			PUSH20 0x5e00000000000000000000000000000000000000 PUSH4 0xffffffff CALL
+			PUSH ok JUMPI
+			PUSH1 0 DUP1 REVERT
+			ok: JUMPDEST STOP`,
+	}
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1_000_000_000))
+	for addr, src := range code {
+		bytecode, err := Assemble(src)
+		if err != nil {
+			t.Fatalf("Unexpected assembler error: %v", err)
+		}
+		state.SetCode(addr, bytecode)
+	}
+	state.resetJournal()
+	block := testBlock(big.NewInt(1))
+
+	tests := []struct {
+		name string
+		msg  CallMsg
+		want uint64 // 0 when only checked to be the lowest that works
+		err  error
+	}{
+		{name: "transfer", msg: CallMsg{To: &to, Value: big.NewInt(1)}, want: 21000},
+		{name: "storage write", msg: CallMsg{To: &store}, want: 21000 + 6 + ColdSloadCost + SstoreSetGas},
+		{name: "forwarded call", msg: CallMsg{To: &forwarder}},
+		{name: "allowance", msg: CallMsg{To: &store, Gas: 30000}, err: ErrGasRequiredExceedsAllowance},
+		{name: "reverted at the allowance", msg: CallMsg{To: &forwarder, Gas: 30000}, err: ErrExecutionReverted},
+		{
+			// The sender can only pay for 25000 gas at this price.
+			name: "balance",
+			msg:  CallMsg{To: &store, GasPrice: big.NewInt(40_000)},
+			err:  ErrGasRequiredExceedsAllowance,
+		},
+	}
+
+	for _, tt := range tests {
+		msg := tt.msg
+		msg.From = testSender
+		gas, err := EstimateGas(state, block, &msg, Config{}, nil)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if tt.want != 0 && gas != tt.want {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.want, gas)
+		}
+
+		// The estimate is the lowest gas limit that works.
+		for _, limit := range []uint64{gas, gas - 1} {
+			msg.Gas = limit
+			res, err := DoCall(state, block, &msg, Config{}, nil)
+			if err != nil && !errors.Is(err, ErrIntrinsicGas) {
+				t.Fatalf("%s: Unexpected call error: %v", tt.name, err)
+			}
+			if ok := err == nil && !res.Failed(); ok != (limit == gas) {
+				t.Errorf("%s: Expected success %t with %d gas, got %t", tt.name, limit == gas, limit, ok)
+			}
+			// Forwarding all but a 64th of the gas needs more than is used.
+			if err == nil && limit == gas && tt.name == "forwarded call" && res.UsedGas >= gas {
+				t.Errorf("%s: Expected less than %d gas used, got %d", tt.name, gas, res.UsedGas)
+			}
+		}
+	}
+}
+
+// TestEstimateGasRevertReason checks that the reason of a call reverting
+// at every gas limit is returned.
+func TestEstimateGasRevertReason(t *testing.T) {
+	reverter := [20]byte{0xee}
+	// Revert with Error("nope").
+	bytecode, err := Assemble(`
+		PUSH1 100 PUSH reason PUSH1 0 CODECOPY
+		PUSH1 100 PUSH1 0 REVERT
+		reason: DATA 0x08c379a0
+		DATA 0x0000000000000000000000000000000000000000000000000000000000000020
+		DATA 0x0000000000000000000000000000000000000000000000000000000000000004
+		DATA 0x6e6f706500000000000000000000000000000000000000000000000000000000`)
+	if err != nil {
+		t.Fatalf("Unexpected assembler error: %v", err)
+	}
+	state := NewStateDB()
+	state.SetCode(reverter, bytecode)
+	state.resetJournal()
+
+	_, err = EstimateGas(state, testBlock(nil), &CallMsg{From: testSender, To: &reverter}, Config{}, nil)
+	var revert *RevertError
+	if !errors.As(err, &revert) {
+		t.Fatalf("Expected a *RevertError, got %v", err)
+	}
+	if revert.Reason != "nope" || len(revert.Data) != 100 {
+		t.Errorf("Expected reason nope with 100 bytes of data, got %q with %d", revert.Reason, len(revert.Data))
+	}
+}
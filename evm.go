@@ -1,13 +1,41 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
+	"prevm/config"
+	"prevm/machine"
+	"prevm/rlp"
 )
 
 type EVM struct {
 	State    *StateDB
 	BlockCtx *BlockContext
 	// TxCtx    *TransactionContext
+	Config Config
+
+	// callGasTemp is the gas a CALL-family opcode forwards, worked out by
+	// its DynamicGas and used by its Execute.
+	callGasTemp uint64
+}
+
+// Config holds optional EVM behaviour.
+type Config struct {
+	// VerifySignatures makes ProcessTransaction recover the sender from the
+	// transaction signature and reject it if it doesn't match the sender
+	// passed in. When false the sender is trusted, which is convenient for
+	// unsigned test transactions.
+	VerifySignatures bool
+	// StateDiff makes ProcessTransaction list the accounts changed by the
+	// transaction in ExecutionResult.StateDiff. Building it replays the
+	// journal, so it is off unless asked for.
+	StateDiff bool
+	// SkipAccountChecks skips the nonce and EOA checks of the sender, for
+	// messages that are run without being sent, like eth_call.
+	SkipAccountChecks bool
+	// Tracer, if set, receives the events of every transaction.
+	Tracer Tracer
 }
 
 type RunState struct {
@@ -15,6 +43,88 @@ type RunState struct {
 	Opcode Opcode
 }
 
+// Execution constants.
+const (
+	CreateDataGas  uint64 = 200   // Per byte of deployed contract code
+	MaxCodeSize           = 24576 // EIP-170
+	RefundQuotient uint64 = 5     // Max refund is gasUsed / RefundQuotient (EIP-3529)
+
+	CallValueTransferGas uint64 = 9000  // Paid by a call sending value
+	CallNewAccountGas    uint64 = 25000 // Paid by a call sending value to an empty account
+	CallStipend          uint64 = 2300  // Free gas given to the callee of a call sending value
+	CallCreateDepth             = 1024  // Max depth of nested calls below the top-level frame
+)
+
+// Errors that make a transaction invalid. A transaction failing with one of
+// these is not included and leaves the state untouched.
+var (
+	ErrNonceTooLow       = errors.New("nonce too low")
+	ErrNonceTooHigh      = errors.New("nonce too high")
+	ErrNonceMax          = errors.New("nonce has max value")
+	ErrInsufficientFunds = errors.New("insufficient funds for gas * price + value")
+	ErrSenderNoEOA       = errors.New("sender not an eoa")
+)
+
+// Errors that end execution. The transaction is still included and pays for
+// its gas, but its state changes are rolled back.
+var (
+	ErrOutOfGas                 = errors.New("out of gas")
+	ErrInvalidOpcode            = errors.New("invalid or unimplemented opcode")
+	ErrExecutionReverted        = errors.New("execution reverted")
+	ErrCodeStoreOutOfGas        = errors.New("contract creation code storage out of gas")
+	ErrMaxCodeSizeExceeded      = errors.New("max code size exceeded")
+	ErrInvalidCode              = errors.New("invalid code: must not begin with 0xef")
+	ErrContractAddressCollision = errors.New("contract address collision")
+	ErrWriteProtection          = errors.New("write protection")
+	ErrInvalidJump              = errors.New("invalid jump destination")
+	ErrDepth                    = errors.New("max call depth exceeded")
+	ErrInsufficientBalance      = errors.New("insufficient balance for transfer")
+	ErrReturnDataOutOfBounds    = errors.New("return data out of bounds")
+)
+
+// ExecutionResult is the outcome of a transaction that made it into the
+// block, successful or not.
+type ExecutionResult struct {
+	// UsedGas is the gas charged to the sender, after refunds.
+	UsedGas uint64
+	// RefundedGas is the gas refunded from the refund counter.
+	RefundedGas uint64
+	// Err is the execution error, if any (out of gas, revert...).
+	Err error
+	// ReturnData is the data returned by the top level call, or the revert
+	// reason if the call reverted.
+	ReturnData []byte
+	// ContractAddress is the address of the created contract for contract
+	// creation transactions.
+	ContractAddress *[20]byte
+	// Logs are the logs emitted by a successful execution.
+	Logs []*Log
+	// StateDiff lists the accounts changed by the transaction, including
+	// gas payment and fees. It is only set with Config.StateDiff.
+	StateDiff StateDiff
+}
+
+// Failed reports whether the execution failed.
+func (r *ExecutionResult) Failed() bool {
+	return r.Err != nil
+}
+
+// Return returns the data returned by a successful execution.
+func (r *ExecutionResult) Return() []byte {
+	if r.Err != nil {
+		return nil
+	}
+	return r.ReturnData
+}
+
+// Revert returns the revert reason if the execution was reverted.
+func (r *ExecutionResult) Revert() []byte {
+	if !errors.Is(r.Err, ErrExecutionReverted) {
+		return nil
+	}
+	return r.ReturnData
+}
+
 func NewEVM(
 	state *StateDB,
 	blockCtx *BlockContext,
@@ -28,86 +138,512 @@ func NewEVM(
 }
 
 // ProcessTransaction is the main entry point for running a transaction.
-func (evm *EVM) ProcessTransaction(tx *Transaction, sender [20]byte) ([]byte, uint64, error) {
+// The returned error is set when the transaction is invalid and the state
+// was not modified. Execution failures such as a revert or running out of
+// gas are reported in ExecutionResult.Err instead: the transaction still
+// pays for the gas it used.
+func (evm *EVM) ProcessTransaction(tx *Transaction, sender [20]byte) (*ExecutionResult, error) {
+	tracer := evm.Config.Tracer
+	if tracer == nil {
+		return evm.processTransaction(tx, sender)
+	}
+
+	tracer.OnTxStart(evm, tx, sender)
+	evm.State.tracer = tracer
+	// Deferred so that a panic doesn't leave the tracer on the state.
+	defer func() { evm.State.tracer = nil }()
+	res, err := evm.processTransaction(tx, sender)
+	tracer.OnTxEnd(res, err)
+	return res, err
+}
+
+func (evm *EVM) processTransaction(tx *Transaction, sender [20]byte) (*ExecutionResult, error) {
 	// 1. Pre-validation using the full 'tx' object
+	// (Type specific rules, fee caps against the base fee, intrinsic gas.)
+	if err := tx.Validate(evm.BlockCtx); err != nil {
+		return nil, err
+	}
+
+	if evm.Config.VerifySignatures {
+		recovered, err := tx.Sender()
+		if err != nil {
+			return nil, err
+		}
+		if recovered != sender {
+			return nil, fmt.Errorf("%w: have 0x%x, want 0x%x", ErrSenderMismatch, recovered, sender)
+		}
+	}
+
+	evm.State.Prepare()
+
 	// (Nonce check, sufficient balance for gas, etc.)
-	senderAccount := evm.State.GetAccount(sender)
-	if senderAccount.Nonce != tx.Nonce { // Simplified nonce check
-		return nil, 0, fmt.Errorf("invalid nonce")
+	if !evm.Config.SkipAccountChecks {
+		if err := evm.checkSender(tx, sender); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Buy gas. The sender must be able to afford the worst case
+	// (gasLimit * maxFee + value + blob fee) but only pays the effective price.
+	gasPrice := tx.EffectiveGasPrice(evm.BlockCtx.BaseFee)
+	if err := evm.buyGas(tx, sender, gasPrice); err != nil {
+		return nil, err
 	}
 
-	// 2. Calculate Intrinsic Gas
+	// 3. Calculate Intrinsic Gas
 	// (Gas cost for the transaction data itself before any code execution)
+	// Validate has already checked that the gas limit covers it.
+	intrinsicGas, err := tx.IntrinsicGas()
+	if err != nil {
+		return nil, err
+	}
+	gasRemaining := tx.GasLimit - intrinsicGas
 
-	/*
-		intrinsicGas := calculateIntrinsicGas(tx.Data)
-		if tx.GasLimit < intrinsicGas {
-			return nil, 0, fmt.Errorf("intrinsic gas too low")
+	txCtx := &TransactionContext{
+		Origin:     sender,
+		GasPrice:   gasPrice,
+		Value:      tx.Value,
+		Data:       tx.Data,
+		BlobHashes: tx.BlobHashes,
+	}
+
+	value := tx.Value
+	if value == nil {
+		value = new(big.Int)
+	}
+
+	evm.warmAccessList(sender, tx.To, tx.AccessList)
+
+	// 4. Execute the code
+	result := &ExecutionResult{}
+	if tx.To == nil {
+		addr, ret, gasLeft, err := evm.create(sender, tx.Data, value, gasRemaining, txCtx)
+		result.ContractAddress = &addr
+		result.ReturnData, gasRemaining, result.Err = ret, gasLeft, err
+	} else {
+		evm.State.SetNonce(sender, evm.State.GetNonce(sender)+1)
+		if tx.Type == SetCodeTxType {
+			evm.applyAuthorizations(tx)
 		}
-		gasRemaining := tx.GasLimit - intrinsicGas
-	*/
-	var gasRemaining uint64 = tx.GasLimit
+		result.ReturnData, gasRemaining, result.Err = evm.call(sender, *tx.To, tx.Data, value, gasRemaining, txCtx)
+	}
 
-	// 3. Create the initial Execution Context (the first call frame)
-	var code []byte
-	var contractAddr [20]byte
+	// 5. Post-execution logic (e.g., refund remaining gas)
+	gasUsed := tx.GasLimit - gasRemaining
+	refund := min(evm.State.GetRefund(), gasUsed/RefundQuotient)
+	gasUsed -= refund
+	gasRemaining += refund
+
+	result.UsedGas = gasUsed
+	result.RefundedGas = refund
+	result.Logs = evm.State.Logs()
+
+	evm.settleFees(sender, gasPrice, gasUsed, gasRemaining)
 
-	if tx.To != nil {
-		contractAddr = *tx.To
-		code = evm.State.GetAccount(*tx.To).Code
+	var pre map[[20]byte]*Account
+	if evm.Config.StateDiff {
+		pre = evm.State.journalPrestate()
+	}
+	evm.State.Finalise()
+	if pre != nil {
+		result.StateDiff = evm.State.diffState(pre)
 	}
 
-	initialContext := NewExecutionContext(
-		sender,
-		contractAddr,
-		code,
-		tx.Data,
-		tx.Value,
-		gasRemaining,
-	)
+	return result, nil
+}
 
-	txCtx := &TransactionContext{
-		Origin:   sender,
-		GasPrice: tx.GasPrice,
-		Value:    tx.Value,
-		Data:     tx.Data,
+// ProcessRawTransaction decodes a raw signed transaction, as produced by a
+// wallet, recovers its sender from the signature and runs it.
+func (evm *EVM) ProcessRawTransaction(raw []byte) (*ExecutionResult, error) {
+	tx, err := DecodeTransaction(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode transaction: %w", err)
+	}
+	sender, err := tx.Sender()
+	if err != nil {
+		return nil, err
 	}
+	return evm.ProcessTransaction(tx, sender)
+}
 
-	// 4. Execute the code
-	returnData, err := evm.Execute(initialContext, txCtx)
+// checkSender checks the nonce of the sender and that it is an externally
+// owned account (EIP-3607).
+func (evm *EVM) checkSender(tx *Transaction, sender [20]byte) error {
+	stateNonce := evm.State.GetNonce(sender)
+	switch {
+	case tx.Nonce < stateNonce:
+		return fmt.Errorf("%w: address 0x%x, tx: %d state: %d", ErrNonceTooLow, sender, tx.Nonce, stateNonce)
+	case tx.Nonce > stateNonce:
+		return fmt.Errorf("%w: address 0x%x, tx: %d state: %d", ErrNonceTooHigh, sender, tx.Nonce, stateNonce)
+	case stateNonce+1 < stateNonce:
+		return fmt.Errorf("%w: address 0x%x, nonce: %d", ErrNonceMax, sender, stateNonce)
+	}
+
+	// Accounts delegating their code (EIP-7702) can still send transactions.
+	if code := evm.State.GetCode(sender); len(code) > 0 {
+		if _, ok := ParseDelegation(code); !ok {
+			return fmt.Errorf("%w: address 0x%x, code size: %d", ErrSenderNoEOA, sender, len(code))
+		}
+	}
+	return nil
+}
+
+// buyGas checks that the sender can cover the upfront cost of the
+// transaction and deducts the gas and blob gas it pays for.
+func (evm *EVM) buyGas(tx *Transaction, sender [20]byte, gasPrice *big.Int) error {
+	gasLimit := new(big.Int).SetUint64(tx.GasLimit)
+
+	// Worst case cost: gasLimit * maxFee + value + blobGas * maxFeePerBlobGas.
+	required := new(big.Int).Mul(gasLimit, tx.FeeCap())
+	if tx.Value != nil {
+		required.Add(required, tx.Value)
+	}
+	blobGas := new(big.Int).SetUint64(tx.BlobGas())
+	if tx.Type == BlobTxType {
+		required.Add(required, new(big.Int).Mul(blobGas, tx.MaxFeePerBlobGas))
+	}
+
+	balance := evm.State.GetBalance(sender)
+	if balance.Cmp(required) < 0 {
+		return fmt.Errorf("%w: address 0x%x have %d want %d", ErrInsufficientFunds, sender, balance, required)
+	}
+
+	// Actual cost: gasLimit * effectiveGasPrice + blobGas * blobBaseFee.
+	cost := new(big.Int).Mul(gasLimit, gasPrice)
+	if tx.Type == BlobTxType && evm.BlockCtx.BlobBaseFee != nil {
+		cost.Add(cost, new(big.Int).Mul(blobGas, evm.BlockCtx.BlobBaseFee))
+	}
+	evm.State.SubBalance(sender, cost)
+
+	return nil
+}
+
+// settleFees refunds the unused gas to the sender and pays the priority fee
+// for the used gas to the coinbase. The base fee part is burned by simply
+// not crediting it to anyone, as is the blob fee.
+func (evm *EVM) settleFees(sender [20]byte, gasPrice *big.Int, gasUsed, gasRemaining uint64) {
+	remaining := new(big.Int).Mul(new(big.Int).SetUint64(gasRemaining), gasPrice)
+	evm.State.AddBalance(sender, remaining)
+
+	tip := new(big.Int).Set(gasPrice)
+	if evm.BlockCtx.BaseFee != nil {
+		tip.Sub(tip, evm.BlockCtx.BaseFee)
+	}
+	fee := new(big.Int).Mul(new(big.Int).SetUint64(gasUsed), tip)
+	evm.State.AddBalance(evm.BlockCtx.Coinbase, fee)
+}
+
+// frame describes a call or contract creation to run in a new execution
+// context.
+type frame struct {
+	typ    byte     // CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE or CREATE2
+	from   [20]byte // the account making the call
+	caller [20]byte // CALLER in the new context
+	addr   [20]byte // ADDRESS in the new context, whose storage and balance are used
+	code   [20]byte // the account whose code runs
+	input  []byte
+	value  *big.Int
+	gas    uint64
+	depth  int
+	static bool
+	salt   [32]byte // CREATE2 only
+}
+
+// warmAccessList marks what a transaction from sender to to, nil for a
+// contract creation, has accessed before it runs: the sender, the
+// recipient, the coinbase (EIP-3651), the precompiles and its access list
+// (EIP-2929 and EIP-2930). A created contract is warmed when created.
+func (evm *EVM) warmAccessList(sender [20]byte, to *[20]byte, list AccessList) {
+	evm.State.WarmAddress(sender)
+	if to != nil {
+		evm.State.WarmAddress(*to)
+	}
+	evm.State.WarmAddress(evm.BlockCtx.Coinbase)
+	for i := byte(1); i <= 0x11; i++ {
+		evm.State.WarmAddress([20]byte{19: i}) // up to those of Prague
+	}
+	for _, tuple := range list {
+		evm.State.WarmAddress(tuple.Address)
+		for _, key := range tuple.StorageKeys {
+			evm.State.WarmSlot(tuple.Address, key)
+		}
+	}
+}
+
+// call runs the top level message call of a transaction. It returns the
+// return data, the gas left and the execution error.
+func (evm *EVM) call(caller, addr [20]byte, input []byte, value *big.Int, gas uint64, tx *TransactionContext) ([]byte, uint64, error) {
+	return evm.runCall(&frame{
+		typ:    CALL,
+		from:   caller,
+		caller: caller,
+		addr:   addr,
+		code:   addr,
+		input:  input,
+		value:  value,
+		gas:    gas,
+		depth:  1,
+	}, tx)
+}
+
+// runCall runs a message call in a new execution context: the top-level
+// call of a transaction or one made by the CALL family of opcodes. It
+// returns the return data, the gas left and the execution error.
+func (evm *EVM) runCall(f *frame, tx *TransactionContext) (ret []byte, gasLeft uint64, err error) {
+	if t := evm.Config.Tracer; t != nil {
+		value := f.value
+		if f.typ == STATICCALL {
+			value = nil
+		}
+		t.OnEnter(f.depth, f.typ, f.from, f.code, f.input, f.gas, value)
+		defer func() { t.OnExit(f.depth, ret, f.gas-gasLeft, err) }()
+	}
+
+	// A failed call that never started keeps its gas.
+	if f.depth > CallCreateDepth+1 {
+		return nil, f.gas, ErrDepth
+	}
+	transfer := f.typ == CALL || f.typ == CALLCODE
+	if transfer && evm.State.GetBalance(f.caller).Cmp(f.value) < 0 {
+		return nil, f.gas, ErrInsufficientBalance
+	}
+
+	snapshot := evm.State.Snapshot()
+
+	// CALLCODE sends the value to the calling account itself.
+	if transfer {
+		evm.State.Transfer(f.caller, f.addr, f.value)
+	}
+
+	// Follow an EIP-7702 delegation to the code it points at.
+	code := evm.State.GetCode(f.code)
+	if target, ok := ParseDelegation(code); ok {
+		code = evm.State.GetCode(target)
+	}
+
+	ec := NewExecutionContext(f.caller, f.addr, code, f.input, f.value, f.gas)
+	ec.Depth = f.depth
+	ec.IsStatic = f.static
+	ret, err = evm.Execute(ec, tx)
 	if err != nil {
-		return nil, 0, err
+		evm.State.RevertToSnapshot(snapshot)
+		if !errors.Is(err, ErrExecutionReverted) {
+			ec.Gas = 0
+		}
+	}
+	return ret, ec.Gas, err
+}
+
+// create runs the init code of a contract creation transaction and deploys
+// the code it returns. It returns the new contract address, the return
+// data, the gas left and the execution error.
+func (evm *EVM) create(caller [20]byte, initCode []byte, value *big.Int, gas uint64, tx *TransactionContext) ([20]byte, []byte, uint64, error) {
+	return evm.runCreate(&frame{
+		typ:    CREATE,
+		from:   caller,
+		caller: caller,
+		input:  initCode,
+		value:  value,
+		gas:    gas,
+		depth:  1,
+	}, tx)
+}
+
+// runCreate runs init code in a new execution context, for a contract
+// creation transaction or a CREATE or CREATE2 opcode, and deploys the code
+// it returns. It returns the new contract address, the return data, the
+// gas left and the execution error.
+func (evm *EVM) runCreate(f *frame, tx *TransactionContext) (addr [20]byte, ret []byte, gasLeft uint64, err error) {
+	nonce := evm.State.GetNonce(f.caller)
+	if f.typ == CREATE2 {
+		addr = Create2Address(f.caller, f.salt, config.Hash(f.input))
+	} else {
+		addr = CreateAddress(f.caller, nonce)
 	}
 
-	// 5. Post-execution logic (e.g., refund remaining gas)
-	gasUsed := tx.GasLimit - initialContext.Gas
+	if t := evm.Config.Tracer; t != nil {
+		t.OnEnter(f.depth, f.typ, f.caller, addr, f.input, f.gas, f.value)
+		defer func() { t.OnExit(f.depth, ret, f.gas-gasLeft, err) }()
+	}
+
+	if f.depth > CallCreateDepth+1 {
+		return addr, nil, f.gas, ErrDepth
+	}
+	if evm.State.GetBalance(f.caller).Cmp(f.value) < 0 {
+		return addr, nil, f.gas, ErrInsufficientBalance
+	}
+	evm.State.SetNonce(f.caller, nonce+1)
+	// The new address stays warm even if the creation fails (EIP-2929).
+	evm.State.WarmAddress(addr)
 
-	return returnData, gasUsed, nil
+	if evm.State.GetNonce(addr) != 0 || len(evm.State.GetCode(addr)) != 0 {
+		return addr, nil, 0, ErrContractAddressCollision
+	}
+
+	snapshot := evm.State.Snapshot()
+
+	// The new account keeps any balance sent to its address beforehand.
+	if !evm.State.Exist(addr) {
+		evm.State.CreateAccount(addr)
+	}
+	evm.State.SetNonce(addr, 1) // EIP-161
+	evm.State.Transfer(f.caller, addr, f.value)
+
+	ec := NewExecutionContext(f.caller, addr, f.input, nil, f.value, f.gas)
+	ec.Depth = f.depth
+	ret, err = evm.Execute(ec, tx)
+	if err == nil {
+		err = evm.storeCode(ec, addr, ret)
+	}
+	if err != nil {
+		evm.State.RevertToSnapshot(snapshot)
+		if !errors.Is(err, ErrExecutionReverted) {
+			ec.Gas = 0
+		}
+	}
+	return addr, ret, ec.Gas, err
+}
+
+// storeCode charges the code deposit cost and stores the code returned by
+// the init code as the contract's code.
+func (evm *EVM) storeCode(ec *ExecutionContext, addr [20]byte, code []byte) error {
+	if len(code) > MaxCodeSize {
+		return ErrMaxCodeSizeExceeded
+	}
+	if len(code) > 0 && code[0] == 0xef { // EIP-3541
+		return ErrInvalidCode
+	}
+
+	cost := uint64(len(code)) * CreateDataGas
+	if ec.Gas < cost {
+		return ErrCodeStoreOutOfGas
+	}
+	ec.Gas -= cost
+
+	evm.State.SetCode(addr, code)
+	return nil
+}
+
+// CreateAddress returns the address of a contract created by sender with
+// the given nonce: keccak256(rlp([sender, nonce]))[12:].
+func CreateAddress(sender [20]byte, nonce uint64) [20]byte {
+	var addr [20]byte
+	enc := rlp.EncodeList(rlp.EncodeBytes(sender[:]), rlp.EncodeUint(nonce))
+	copy(addr[:], config.Hash(enc)[12:])
+	return addr
+}
+
+// checkStack returns an error if a stack of size items doesn't hold the
+// operands of op, or has no room for its results.
+func checkStack(op byte, size int) error {
+	if pops := StackPops[op]; size < pops {
+		return fmt.Errorf("%w (%d <=> %d)", machine.ErrStackUnderflow, size, pops)
+	}
+	if limit := StackLimit + StackPops[op] - StackPushes[op]; size > limit {
+		return fmt.Errorf("%w: stack limit reached %d (%d)", machine.ErrStackOverflow, size, limit)
+	}
+	return nil
+}
+
+// Create2Address returns the address of a contract created by sender with
+// CREATE2: keccak256(0xff ++ sender ++ salt ++ keccak256(initCode))[12:].
+func Create2Address(sender [20]byte, salt [32]byte, initCodeHash []byte) [20]byte {
+	var addr [20]byte
+	data := make([]byte, 0, 1+20+32+32)
+	data = append(data, 0xff)
+	data = append(data, sender[:]...)
+	data = append(data, salt[:]...)
+	data = append(data, initCodeHash...)
+	copy(addr[:], config.Hash(data)[12:])
+	return addr
 }
 
 // execute runs the bytecode for a given context and returns the output data.
-func (evm *EVM) Execute(ec *ExecutionContext, tx *TransactionContext) ([]byte, error) {
-	// logger := config.Logger
+// On REVERT the revert data is returned along with ErrExecutionReverted.
+func (evm *EVM) Execute(ec *ExecutionContext, tx *TransactionContext) (ret []byte, err error) {
+	tracer := evm.Config.Tracer
+
+	// The instruction being run, for the fault hook.
+	var (
+		pc, gas, cost uint64
+		op            byte
+		traced        bool
+	)
+
+	// The stack is checked before each opcode runs, but an underflow or
+	// overflow panicking inside one is still an exceptional halt.
+	defer func() {
+		if r := recover(); r != nil {
+			stackErr, ok := r.(error)
+			if !ok || (!errors.Is(stackErr, machine.ErrStackUnderflow) && !errors.Is(stackErr, machine.ErrStackOverflow)) {
+				panic(r)
+			}
+			ret, err = nil, stackErr
+		}
+		if err != nil && traced {
+			tracer.OnFault(pc, op, gas, cost, ec, ec.Depth, err)
+		}
+	}()
 
 	for !ec.Stopped {
-		// Get the opcode object from the instruction set.
-		opcodeObj := ec.GetOp() // Assumes GetOp returns an Opcode interface object
+		pc, traced = ec.PC, false
 
-		if opcodeObj == nil {
-			return nil, fmt.Errorf("invalid or unimplemented opcode")
+		// Running off the end of the code is an implicit STOP.
+		op = STOP
+		if pc < uint64(len(ec.Bytecode)) {
+			op = ec.Bytecode[pc]
+		}
+		if InstructionSet[op] == nil {
+			err = fmt.Errorf("%w: 0x%02x", ErrInvalidOpcode, op)
+			if tracer != nil {
+				tracer.OnOpcode(pc, op, ec.Gas, 0, ec, ec.Depth, err)
+			}
+			return nil, err
 		}
 
-		// --- Gas Calculation (Crucial Missing Piece) ---
-		// A real implementation would have a complex gas calculation here.
-		// For now, we'll assume a simple static cost.
-		gasCost := GasCosts[ec.Bytecode[ec.PC-1]] // Get cost of the opcode we just read
-		if ec.Gas < gasCost {
-			return nil, fmt.Errorf("out of gas")
+		// --- Stack Validation ---
+		gas, cost = ec.Gas, GasCosts[op]
+		if err := checkStack(op, len(ec.Stack.GetData())); err != nil {
+			if tracer != nil {
+				tracer.OnOpcode(pc, op, gas, cost, ec, ec.Depth, err)
+			}
+			return nil, err
+		}
+
+		// --- Gas Calculation ---
+		// The static cost, plus the dynamic part of opcodes whose cost
+		// depends on their operands.
+		if dyn, ok := InstructionSet[op].(DynamicGas); ok {
+			extra, err := dyn.DynamicGas(evm, ec)
+			if err == nil && cost+extra < cost {
+				err = ErrOutOfGas
+			}
+			if err != nil {
+				if tracer != nil {
+					tracer.OnOpcode(pc, op, gas, cost, ec, ec.Depth, err)
+				}
+				return nil, err
+			}
+			cost += extra
+		}
+		if ec.Gas < cost {
+			if tracer != nil {
+				tracer.OnOpcode(pc, op, gas, cost, ec, ec.Depth, ErrOutOfGas)
+			}
+			return nil, ErrOutOfGas
+		}
+		if tracer != nil {
+			tracer.OnOpcode(pc, op, gas, cost, ec, ec.Depth, nil)
+			traced = true
 		}
-		ec.Gas -= gasCost
+		ec.Gas -= cost
 
 		// --- Execute the Opcode ---
+		opcodeObj := ec.GetOp()
 		if err := opcodeObj.Execute(evm, ec, evm.BlockCtx, tx); err != nil {
+			if errors.Is(err, ErrExecutionReverted) {
+				return ec.ReturnData, err
+			}
 			return nil, err
 		}
 	}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+var (
+	testSender   = [20]byte{0x01}
+	testCoinbase = [20]byte{0xcb}
+)
+
+// testBlock returns a block context with the given base fee, nil for a
+// block before EIP-1559.
+func testBlock(baseFee *big.Int) *BlockContext {
+	return &BlockContext{
+		BaseFee:    baseFee,
+		Coinbase:   testCoinbase,
+		Timestamp:  big.NewInt(1),
+		Number:     big.NewInt(1),
+		Difficulty: new(big.Int),
+		GasLimit:   big.NewInt(30_000_000),
+		ChainID:    big.NewInt(1),
+	}
+}
+
+// TestProcessTransactionFees checks the balances of the sender, the
+// recipient and the coinbase after a value transfer, for each way of
+// pricing gas.
+func TestProcessTransactionFees(t *testing.T) {
+	to := [20]byte{0x02}
+	tests := []struct {
+		name     string
+		baseFee  *big.Int
+		tx       *Transaction
+		sender   int64
+		coinbase int64
+	}{
+		{
+			name:    "legacy",
+			baseFee: big.NewInt(10),
+			tx:      &Transaction{Type: LegacyTxType, GasPrice: big.NewInt(20)},
+			// 21000 gas at 20, of which 10 is burned.
+			sender:   10_000_000 - 21000*20 - 1000,
+			coinbase: 21000 * 10,
+		},
+		{
+			name:     "legacy before london",
+			tx:       &Transaction{Type: LegacyTxType, GasPrice: big.NewInt(20)},
+			sender:   10_000_000 - 21000*20 - 1000,
+			coinbase: 21000 * 20,
+		},
+		{
+			name:    "dynamic fee",
+			baseFee: big.NewInt(10),
+			tx: &Transaction{
+				Type:                 DynamicFeeTxType,
+				ChainID:              big.NewInt(1),
+				MaxFeePerGas:         big.NewInt(100),
+				MaxPriorityFeePerGas: big.NewInt(5),
+			},
+			sender:   10_000_000 - 21000*15 - 1000,
+			coinbase: 21000 * 5,
+		},
+		{
+			name:    "tip capped by fee cap",
+			baseFee: big.NewInt(10),
+			tx: &Transaction{
+				Type:                 DynamicFeeTxType,
+				ChainID:              big.NewInt(1),
+				MaxFeePerGas:         big.NewInt(12),
+				MaxPriorityFeePerGas: big.NewInt(5),
+			},
+			sender:   10_000_000 - 21000*12 - 1000,
+			coinbase: 21000 * 2,
+		},
+	}
+
+	for _, tt := range tests {
+		state := NewStateDB()
+		state.SetBalance(testSender, big.NewInt(10_000_000))
+
+		tx := tt.tx
+		tx.To, tx.Value, tx.GasLimit = &to, big.NewInt(1000), 30000
+		res, err := NewEVM(state, testBlock(tt.baseFee)).ProcessTransaction(tx, testSender)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		if res.UsedGas != 21000 {
+			t.Errorf("%s: Expected 21000 gas used, got %d", tt.name, res.UsedGas)
+		}
+		if got := state.GetBalance(testSender).Int64(); got != tt.sender {
+			t.Errorf("%s: Expected sender balance %d, got %d", tt.name, tt.sender, got)
+		}
+		if got := state.GetBalance(to).Int64(); got != 1000 {
+			t.Errorf("%s: Expected recipient balance 1000, got %d", tt.name, got)
+		}
+		if got := state.GetBalance(testCoinbase).Int64(); got != tt.coinbase {
+			t.Errorf("%s: Expected coinbase balance %d, got %d", tt.name, tt.coinbase, got)
+		}
+		if got := state.GetNonce(testSender); got != 1 {
+			t.Errorf("%s: Expected sender nonce 1, got %d", tt.name, got)
+		}
+	}
+}
+
+// TestProcessTransactionRefund checks that clearing a storage slot is
+// refunded, within the cap of a fifth of the gas used (EIP-3529).
+func TestProcessTransactionRefund(t *testing.T) {
+	contract := [20]byte{0xc0}
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1_000_000))
+	state.SetCode(contract, []byte{0x60, 0x00, 0x60, 0x00, 0x55, 0x00}) // SSTORE(0, 0)
+	state.SetStorage(contract, [32]byte{}, []byte{0x01})
+
+	tx := &Transaction{Type: LegacyTxType, GasPrice: big.NewInt(1), GasLimit: 50000, To: &contract}
+	res, err := NewEVM(state, testBlock(nil)).ProcessTransaction(tx, testSender)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.RefundedGas != SstoreClearsScheduleRefund {
+		t.Errorf("Expected a refund of %d, got %d", SstoreClearsScheduleRefund, res.RefundedGas)
+	}
+	// 21000, 2 PUSH1 and a cold SSTORE resetting the slot (2100 + 2900).
+	if want := uint64(26006 - SstoreClearsScheduleRefund); res.UsedGas != want {
+		t.Errorf("Expected %d gas used, got %d", want, res.UsedGas)
+	}
+	if got, want := state.GetBalance(testSender).Uint64(), 1_000_000-res.UsedGas; got != want {
+		t.Errorf("Expected sender balance %d, got %d", want, got)
+	}
+}
+
+// TestProcessTransactionInvalid checks that invalid transactions are
+// rejected with the state untouched.
+func TestProcessTransactionInvalid(t *testing.T) {
+	to := [20]byte{0x02}
+	tests := []struct {
+		name string
+		tx   *Transaction
+		want error
+	}{
+		{"nonce too low", &Transaction{Nonce: 0, GasPrice: big.NewInt(1)}, ErrNonceTooLow},
+		{"nonce too high", &Transaction{Nonce: 2, GasPrice: big.NewInt(1)}, ErrNonceTooHigh},
+		{"insufficient funds", &Transaction{Nonce: 1, GasPrice: big.NewInt(1000)}, ErrInsufficientFunds},
+		{"intrinsic gas", &Transaction{Nonce: 1, GasPrice: big.NewInt(1), GasLimit: 20999}, ErrIntrinsicGas},
+	}
+
+	for _, tt := range tests {
+		state := NewStateDB()
+		state.SetBalance(testSender, big.NewInt(1_000_000))
+		state.SetNonce(testSender, 1)
+
+		tx := tt.tx
+		tx.To = &to
+		if tx.GasLimit == 0 {
+			tx.GasLimit = 21000
+		}
+		_, err := NewEVM(state, testBlock(nil)).ProcessTransaction(tx, testSender)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, err)
+		}
+		if got := state.GetBalance(testSender).Int64(); got != 1_000_000 {
+			t.Errorf("%s: Expected the balance to be untouched, got %d", tt.name, got)
+		}
+	}
+}
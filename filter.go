@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"maps"
+	"prevm/hexutil"
+	"slices"
+	"sync"
+	"time"
+)
+
+// FilterQuery selects logs by block range, address and topics, as
+// eth_getLogs does.
+type FilterQuery struct {
+	// BlockHash restricts the query to a single block. FromBlock and
+	// ToBlock are ignored when it is set.
+	BlockHash *[32]byte
+	// FromBlock and ToBlock bound the range of blocks, inclusive. nil
+	// stands for the first and the latest block.
+	FromBlock, ToBlock *uint64
+
+	// Addresses the logs must come from, any address if empty.
+	Addresses [][20]byte
+	// Topics restricts the topics by position: a log matches if, for each
+	// position, its topic is one of the listed ones. An empty position
+	// matches any topic, as long as the log has one there.
+	Topics [][][32]byte
+}
+
+// Matches reports whether log matches the addresses and topics of q.
+func (q *FilterQuery) Matches(log *Log) bool {
+	if len(q.Addresses) > 0 && !slices.Contains(q.Addresses, log.Address) {
+		return false
+	}
+	if len(q.Topics) > len(log.Topics) {
+		return false
+	}
+	for i, topics := range q.Topics {
+		if len(topics) > 0 && !slices.Contains(topics, log.Topics[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesBloom reports whether a block or receipt with the given bloom
+// may hold logs matching q.
+func (q *FilterQuery) MatchesBloom(bloom *Bloom) bool {
+	if len(q.Addresses) > 0 && !slices.ContainsFunc(q.Addresses, func(addr [20]byte) bool {
+		return bloom.Test(addr[:])
+	}) {
+		return false
+	}
+	for _, topics := range q.Topics {
+		if len(topics) > 0 && !slices.ContainsFunc(topics, func(topic [32]byte) bool {
+			return bloom.Test(topic[:])
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// blockLogs returns the logs of block matching q, including its block
+// range.
+func (q *FilterQuery) blockLogs(block *Block) []*Log {
+	switch {
+	case q.BlockHash != nil && *q.BlockHash != block.Hash,
+		q.FromBlock != nil && block.Number < *q.FromBlock,
+		q.ToBlock != nil && block.Number > *q.ToBlock,
+		!q.MatchesBloom(&block.Bloom):
+		return nil
+	}
+	var logs []*Log
+	for _, receipt := range block.Receipts {
+		for _, log := range receipt.Logs {
+			if q.Matches(log) {
+				logs = append(logs, log)
+			}
+		}
+	}
+	return logs
+}
+
+// FilterTimeout is how long a filter lives without being polled.
+const FilterTimeout = 5 * time.Minute
+
+var ErrFilterNotFound = errors.New("filter not found")
+
+// Filters holds the filters installed with eth_newFilter and
+// eth_newBlockFilter. They collect the matching logs, or the hashes of the
+// blocks, mined until they are polled. It is safe for concurrent use.
+type Filters struct {
+	mu      sync.Mutex
+	filters map[string]*pollFilter
+	cancel  func()
+}
+
+// pollFilter is an installed filter.
+type pollFilter struct {
+	query  *FilterQuery // nil for a block filter
+	logs   []*Log
+	blocks [][32]byte
+	polled time.Time
+}
+
+// NewFilters returns an empty set of filters for the blocks of node.
+func NewFilters(node *Node) *Filters {
+	f := &Filters{filters: make(map[string]*pollFilter)}
+	f.cancel = node.OnBlock(f.add)
+	return f
+}
+
+// Close uninstalls the filters and stops watching the node.
+func (f *Filters) Close() {
+	f.cancel()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.filters)
+}
+
+func (f *Filters) add(block *Block) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+	for _, filter := range f.filters {
+		if filter.query == nil {
+			filter.blocks = append(filter.blocks, block.Hash)
+		} else {
+			filter.logs = append(filter.logs, filter.query.blockLogs(block)...)
+		}
+	}
+}
+
+// expire uninstalls the filters that weren't polled for FilterTimeout.
+func (f *Filters) expire() {
+	deadline := time.Now().Add(-FilterTimeout)
+	maps.DeleteFunc(f.filters, func(id string, filter *pollFilter) bool {
+		return filter.polled.Before(deadline)
+	})
+}
+
+func (f *Filters) install(filter *pollFilter) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+	id := newFilterID()
+	filter.polled = time.Now()
+	f.filters[id] = filter
+	return id
+}
+
+// NewLogFilter installs a filter collecting the logs matching q and
+// returns its id.
+func (f *Filters) NewLogFilter(q *FilterQuery) string {
+	return f.install(&pollFilter{query: q})
+}
+
+// NewBlockFilter installs a filter collecting the hashes of new blocks and
+// returns its id.
+func (f *Filters) NewBlockFilter() string {
+	return f.install(&pollFilter{})
+}
+
+// Changes returns what filter id collected since it was last polled: the
+// logs of a log filter, or the block hashes of a block filter. Exactly one
+// of logs and blocks is non-nil.
+func (f *Filters) Changes(id string) (logs []*Log, blocks [][32]byte, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expire()
+	filter, ok := f.filters[id]
+	if !ok {
+		return nil, nil, ErrFilterNotFound
+	}
+	filter.polled = time.Now()
+	if filter.query == nil {
+		blocks, filter.blocks = filter.blocks, nil
+		return nil, append([][32]byte{}, blocks...), nil
+	}
+	logs, filter.logs = filter.logs, nil
+	return append([]*Log{}, logs...), nil, nil
+}
+
+// Uninstall removes filter id, reporting whether it was installed.
+func (f *Filters) Uninstall(id string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.filters[id]
+	delete(f.filters, id)
+	return ok
+}
+
+// newFilterID returns a random id for a filter or a subscription.
+func newFilterID() string {
+	var id [16]byte
+	rand.Read(id[:])
+	return hexutil.Encode(id[:])
+}
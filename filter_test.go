@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"prevm/hexutil"
+)
+
+// rpcResult calls method over HTTP and decodes its result into v.
+func rpcResult(t *testing.T, url string, v any, method string, params ...any) {
+	t.Helper()
+	got, rpcErr := rpcCall(t, url, method, params...)
+	if rpcErr != nil {
+		t.Fatalf("%s: Unexpected error: %v", method, rpcErr)
+	}
+	if err := json.Unmarshal(got, v); err != nil {
+		t.Fatalf("%s: Unexpected error: %v", method, err)
+	}
+}
+
+// TestFilterPolling checks that log and block filters return what was
+// mined since they were last polled, and fail once uninstalled.
+func TestFilterPolling(t *testing.T) {
+	url, node, _ := newTestServer(t)
+	contract, other := [20]byte{19: 0xc0}, [20]byte{19: 0xc1}
+	node.ReadState(func(state *StateDB) {
+		for _, addr := range [][20]byte{contract, other} {
+			state.SetCode(addr, []byte{0x60, 0x00, 0x80, 0xa0}) // PUSH1 0 DUP1 LOG0
+		}
+		state.Finalise()
+	})
+
+	var logFilter, blockFilter string
+	rpcResult(t, url, &logFilter, "eth_newFilter", map[string]any{"address": hexutil.Encode(contract[:])})
+	rpcResult(t, url, &blockFilter, "eth_newBlockFilter")
+
+	// The log of other doesn't match the filter.
+	var hashes []rpcHash
+	for nonce, to := range [][20]byte{contract, other} {
+		tx := transfer(t, uint64(nonce), to, 0)
+		if _, err := node.SendTransaction(tx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		hashes = append(hashes, tx.Hash())
+	}
+
+	var logs []logJSON
+	rpcResult(t, url, &logs, "eth_getFilterChanges", logFilter)
+	if len(logs) != 1 || logs[0].Address != contract || logs[0].TransactionHash != hashes[0] {
+		t.Errorf("Expected the log of the contract, got %+v", logs)
+	}
+	var blocks []rpcHash
+	rpcResult(t, url, &blocks, "eth_getFilterChanges", blockFilter)
+	if len(blocks) != 2 || blocks[0] != node.BlockByNumber(1).Hash || blocks[1] != node.Head().Hash {
+		t.Errorf("Expected the hashes of blocks 1 and 2, got %x", blocks)
+	}
+
+	// Nothing new since the last poll.
+	for _, id := range []string{logFilter, blockFilter} {
+		got, rpcErr := rpcCall(t, url, "eth_getFilterChanges", id)
+		if rpcErr != nil {
+			t.Fatalf("Unexpected error: %v", rpcErr)
+		}
+		if string(got) != "[]" {
+			t.Errorf("Expected no changes, got %s", got)
+		}
+	}
+
+	var ok bool
+	if rpcResult(t, url, &ok, "eth_uninstallFilter", logFilter); !ok {
+		t.Errorf("Expected the filter to be uninstalled")
+	}
+	if rpcResult(t, url, &ok, "eth_uninstallFilter", logFilter); ok {
+		t.Errorf("Expected the filter to be unknown")
+	}
+	if _, rpcErr := rpcCall(t, url, "eth_getFilterChanges", logFilter); rpcErr == nil {
+		t.Errorf("Expected an error polling an uninstalled filter")
+	}
+}
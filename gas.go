@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"prevm/machine"
+)
+
+// Memory and per-word gas costs.
+const (
+	MemoryGas    uint64 = 3   // Per word of memory, on top of the quadratic cost
+	QuadCoeffDiv uint64 = 512 // Divisor of the square of the words in the memory cost
+	CopyGas      uint64 = 3   // Per word copied by the *COPY opcodes
+	ExpByteGas   uint64 = 50  // Per byte of the EXP exponent (EIP-160)
+	LogDataGas   uint64 = 8   // Per byte of LOG data
+
+	Keccak256WordGas uint64 = 6 // Per word hashed by KECCAK256 and CREATE2
+)
+
+// Access costs of EIP-2929. The first access of an address or a storage
+// slot by a transaction costs these instead of the warm cost of the opcode.
+const (
+	ColdAccountAccessCost uint64 = 2600
+	ColdSloadCost         uint64 = 2100
+)
+
+// maxMemorySize is the largest memory whose cost fits in 64 bits, as in
+// geth. Expanding memory further is out of gas, which bounds the memory
+// opcodes and the sizes they work out.
+const maxMemorySize = 0x1FFFFFFFE0
+
+// memoryRange returns the end of the memory range of an opcode, given its
+// offset and size operands, and its size. An empty range has no end
+// whatever its offset. A range that doesn't fit in 64 bits can't be paid
+// for: it fails with ErrOutOfGas.
+func memoryRange(offset, size *big.Int) (end, n uint64, err error) {
+	s := new(big.Int).And(size, wordMask)
+	if s.Sign() == 0 {
+		return 0, 0, nil
+	}
+	o := new(big.Int).And(offset, wordMask)
+	if !s.IsUint64() || !o.IsUint64() {
+		return 0, 0, ErrOutOfGas
+	}
+	end = o.Uint64() + s.Uint64()
+	if end < o.Uint64() {
+		return 0, 0, ErrOutOfGas
+	}
+	return end, s.Uint64(), nil
+}
+
+// memoryGas returns the cost of expanding mem to hold end bytes, nothing if
+// it already does. Memory costs 3 gas per word plus the square of the
+// words over 512, so the cost of an expansion is the difference between
+// the costs of the new and old sizes.
+func memoryGas(mem *machine.Memory, end uint64) (uint64, error) {
+	if end > maxMemorySize {
+		return 0, ErrOutOfGas
+	}
+	words := toWordSize(end)
+	current := uint64(len(mem.GetData())) / 32
+	if words <= current {
+		return 0, nil
+	}
+	return memoryCost(words) - memoryCost(current), nil
+}
+
+func memoryCost(words uint64) uint64 {
+	return words*MemoryGas + words*words/QuadCoeffDiv
+}
+
+// toWordSize returns the number of 32-byte words holding size bytes.
+func toWordSize(size uint64) uint64 {
+	if size > math.MaxUint64-31 {
+		return math.MaxUint64/32 + 1
+	}
+	return (size + 31) / 32
+}
+
+// memoryOpGas returns the memory expansion cost of an opcode working on
+// the range at offset of size bytes, plus perWord gas for each of its
+// words. Both are bounded by maxMemorySize, so their sum doesn't overflow.
+func memoryOpGas(ec *ExecutionContext, offset, size *big.Int, perWord uint64) (uint64, error) {
+	end, n, err := memoryRange(offset, size)
+	if err != nil {
+		return 0, err
+	}
+	gas, err := memoryGas(ec.Memory, end)
+	if err != nil {
+		return 0, err
+	}
+	return gas + toWordSize(n)*perWord, nil
+}
+
+// accountAccessGas returns what accessing addr costs on top of the warm
+// cost, which opcodes reading an account charge statically, and warms it.
+func accountAccessGas(evm *EVM, addr [20]byte) uint64 {
+	if evm.State.WarmAddress(addr) {
+		return ColdAccountAccessCost - WarmStorageReadCost
+	}
+	return 0
+}
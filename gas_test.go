@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"prevm/machine"
+	"strings"
+	"testing"
+)
+
+// execCode runs code as the code of a contract with the given gas and
+// returns its context, along with the return data and error of the run.
+func execCode(state *StateDB, code string, input []byte, gas uint64) (*ExecutionContext, []byte, error) {
+	contract := [20]byte{0xc0}
+	raw, err := DecodeHex(code)
+	if err != nil {
+		return nil, nil, err
+	}
+	ec := NewExecutionContext(testSender, contract, raw, input, new(big.Int), gas)
+	tx := &TransactionContext{Origin: testSender, GasPrice: big.NewInt(1), Value: new(big.Int), Data: input}
+	ret, err := NewEVM(state, testBlock(nil)).Execute(ec, tx)
+	return ec, ret, err
+}
+
+// TestDynamicGas checks the gas charged by the opcodes whose cost depends
+// on their operands: memory expansion, copied and hashed words, exponent
+// bytes and log data.
+func TestDynamicGas(t *testing.T) {
+	tests := []struct {
+		name  string
+		code  string
+		input []byte
+		gas   uint64
+	}{
+		// PUSH1 1, PUSH1 0, MSTORE: one word of memory.
+		{"mstore", "6001600052", nil, 3 + 3 + 3 + 3},
+		// The same at offset 32, two words.
+		{"mstore second word", "6001602052", nil, 3 + 3 + 3 + 6},
+		// Up to 1024 bytes, 32 words and their square over 512.
+		{"mstore quadratic", "60016103e052", nil, 3 + 3 + 3 + 32*3 + 32*32/512},
+		// MLOAD of memory already paid for.
+		{"mload", "6001600052600051", nil, 12 + 3 + 3},
+		{"mload expansion", "602051", nil, 3 + 3 + 6},
+		// CALLDATACOPY(0, 0, 33): two words of memory, two words copied.
+		{"calldatacopy", "60216000600037", []byte{1}, 9 + 3 + 6 + 6},
+		// Nothing copied costs no memory, whatever the offset.
+		{"calldatacopy nothing", "6000600060ff37", nil, 9 + 3},
+		// CODECOPY(0, 0, 12): one word.
+		{"codecopy", "600c60006000396000", nil, 9 + 3 + 3 + 3 + 3},
+		// KECCAK256(0, 64): two words hashed.
+		{"keccak256", "6040600020", nil, 6 + 30 + 2*6 + 6},
+		{"keccak256 nothing", "6000600020", nil, 6 + 30},
+		// EXP(2, 256): a two byte exponent.
+		{"exp", "61010060020a", nil, 3 + 3 + 10 + 2*50},
+		{"exp zero", "6000600a0a", nil, 3 + 3 + 10},
+		// LOG0(0, 32) and LOG1 with a topic: 8 gas per byte of data.
+		{"log0", "60206000a0", nil, 3 + 3 + 375 + 3 + 32*8},
+		{"log1", "600060206000a1", nil, 3 + 3 + 3 + 750 + 3 + 32*8},
+		// RETURN(0, 64) and REVERT(0, 32).
+		{"return", "60406000f3", nil, 3 + 3 + 6},
+		{"revert", "60206000fd", nil, 3 + 3 + 3},
+	}
+
+	for _, tt := range tests {
+		ec, _, err := execCode(NewStateDB(), tt.code, tt.input, 100000)
+		if err != nil && !errors.Is(err, ErrExecutionReverted) {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if used := 100000 - ec.Gas; used != tt.gas {
+			t.Errorf("%s: Expected %d gas used, got %d", tt.name, tt.gas, used)
+		}
+	}
+}
+
+// TestDynamicGasResults checks what the opcodes charged for their operands
+// compute: the copied code, and powers taking the base off the top of the
+// stack and wrapping at 2^256.
+func TestDynamicGasResults(t *testing.T) {
+	// CODECOPY(0, 0, 12), RETURN(0, 32): the code, padded with zeros.
+	code := "600c6000600039" + "60206000f3"
+	_, ret, err := execCode(NewStateDB(), code, nil, 100000)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	raw, _ := DecodeHex(code)
+	if want := append(raw, make([]byte, 32-len(raw))...); !bytes.Equal(ret, want) {
+		t.Errorf("Expected the code\n%x\ngot\n%x", want, ret)
+	}
+
+	tests := []struct {
+		name string
+		code string
+		want *big.Int
+	}{
+		{"3^2", "600260030a", big.NewInt(9)},
+		{"2^256", "61010060020a", new(big.Int)},
+		{"2^255", "60ff60020a", new(big.Int).Lsh(big.NewInt(1), 255)},
+		{"x^0", "600060070a", big.NewInt(1)},
+	}
+	for _, tt := range tests {
+		ec, _, err := execCode(NewStateDB(), tt.code, nil, 100000)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		stack := ec.Stack.GetData()
+		if got := stack[len(stack)-1]; got.Cmp(tt.want) != 0 {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestSstoreGas checks the cost of SSTORE for each transition of a slot
+// (EIP-2200) and its sentry of the call stipend. The slot is cold the
+// first time it is written.
+func TestSstoreGas(t *testing.T) {
+	tests := []struct {
+		name     string
+		original byte
+		code     string
+		gas      uint64 // given to the code
+		want     uint64
+		err      error
+	}{
+		// SSTORE(0, 1) of a slot that was zero.
+		{"set", 0, "6001600055", 100000, 6 + ColdSloadCost + 20000, nil},
+		// SSTORE(0, 2) of a slot that was non-zero.
+		{"reset", 1, "6002600055", 100000, 6 + ColdSloadCost + 2900, nil},
+		{"no-op", 1, "6001600055", 100000, 6 + ColdSloadCost + 100, nil},
+		// The second write of the slot in the transaction.
+		{"dirty", 0, "60016000556002600055", 100000, 6 + ColdSloadCost + 20000 + 6 + 100, nil},
+		// No more than the stipend left once the operands are pushed.
+		{"sentry", 1, "6001600055", 6 + SstoreSentryGas, 0, ErrOutOfGas},
+		{"above the sentry", 1, "6001600055", 6 + SstoreSentryGas + 1, 6 + ColdSloadCost + 100, nil},
+		{"out of gas", 0, "6001600055", 6 + 19999, 0, ErrOutOfGas},
+	}
+
+	for _, tt := range tests {
+		state := NewStateDB()
+		state.SetNonce([20]byte{0xc0}, 1) // not deleted as empty
+		if tt.original != 0 {
+			state.SetStorage([20]byte{0xc0}, [32]byte{}, []byte{tt.original})
+		}
+		state.Finalise()
+
+		ec, _, err := execCode(state, tt.code, nil, tt.gas)
+		if tt.err != nil {
+			if !errors.Is(err, tt.err) {
+				t.Errorf("%s: Expected %v, got %v", tt.name, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if used := tt.gas - ec.Gas; used != tt.want {
+			t.Errorf("%s: Expected %d gas used, got %d", tt.name, tt.want, used)
+		}
+	}
+}
+
+// TestAccessGas checks the cost of the opcodes accessing an account or a
+// storage slot: cold the first time in the transaction, warm after, or
+// from the start when warmed beforehand as by an access list (EIP-2929).
+func TestAccessGas(t *testing.T) {
+	other := [20]byte{19: 0x0a}
+	// CALL(0, 0x0a, 0, 0, 0, 0, 0)
+	call := "6000600060006000" + "6000600a6000f1"
+	tests := []struct {
+		name  string
+		code  string
+		addrs [][20]byte // warm before the run
+		slots [][32]byte // of the contract, warm before the run
+		gas   uint64
+	}{
+		{"balance", "600a31", nil, nil, 3 + ColdAccountAccessCost},
+		{"balance twice", "600a31" + "600a31", nil, nil, 3 + ColdAccountAccessCost + 3 + WarmStorageReadCost},
+		{"balance warm", "600a31", [][20]byte{other}, nil, 3 + WarmStorageReadCost},
+		{"sload", "600054", nil, nil, 3 + ColdSloadCost},
+		{"sload twice", "600054" + "600054", nil, nil, 3 + ColdSloadCost + 3 + WarmStorageReadCost},
+		{"sload warm", "600054", nil, [][32]byte{{}}, 3 + WarmStorageReadCost},
+		// The slot was warmed by the SLOAD before it.
+		{"sstore after sload", "60005450" + "6001600055", nil, nil, 3 + ColdSloadCost + 2 + 6 + 20000},
+		{"sstore warm", "6001600055", nil, [][32]byte{{}}, 6 + 20000},
+		{"call", call, nil, nil, 21 + ColdAccountAccessCost},
+		{"call twice", call + "50" + call, nil, nil, 21 + ColdAccountAccessCost + 2 + 21 + WarmStorageReadCost},
+		{"call warm", call, [][20]byte{other}, nil, 21 + WarmStorageReadCost},
+	}
+
+	for _, tt := range tests {
+		state := NewStateDB()
+		for _, addr := range tt.addrs {
+			state.WarmAddress(addr)
+		}
+		for _, key := range tt.slots {
+			state.WarmSlot([20]byte{0xc0}, key)
+		}
+
+		ec, _, err := execCode(state, tt.code, nil, 100000)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if used := 100000 - ec.Gas; used != tt.gas {
+			t.Errorf("%s: Expected %d gas used, got %d", tt.name, tt.gas, used)
+		}
+	}
+}
+
+// TestMemoryGasLimits checks that memory beyond what 64-bit gas can pay
+// for is out of gas rather than allocated.
+func TestMemoryGasLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+	}{
+		// MSTORE past maxMemorySize.
+		{"mstore", "6001642000000000" + "52"},
+		// KECCAK256 of 2^64 bytes.
+		{"keccak256 size", "680100000000000000006000" + "20"},
+		// RETURN at an offset of 2^255.
+		{"return offset", "6020" + "7f8" + strings.Repeat("0", 63) + "f3"},
+		// LOG0 of 2^44 bytes.
+		{"log0", "6510000000000060" + "00a0"},
+	}
+
+	for _, tt := range tests {
+		_, _, err := execCode(NewStateDB(), tt.code, nil, 30_000_000)
+		if !errors.Is(err, ErrOutOfGas) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, ErrOutOfGas, err)
+		}
+	}
+}
+
+// TestStackValidation checks that the stack is validated before the opcode
+// is charged for: an opcode missing operands fails with a stack underflow
+// even without the gas to run it, and uses no gas.
+func TestStackValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		gas  uint64
+		want error
+		used uint64
+	}{
+		{"add", "6001" + "01", 100, machine.ErrStackUnderflow, 3},
+		{"add without gas", "6001" + "01", 3, machine.ErrStackUnderflow, 3},
+		// MSTORE with only an offset would otherwise be charged for it.
+		{"mstore", "61ffff" + "52", 100, machine.ErrStackUnderflow, 3},
+		{"sstore", "6001" + "55", 100000, machine.ErrStackUnderflow, 3},
+		{"return", "f3", 0, machine.ErrStackUnderflow, 0},
+		{"overflow", strings.Repeat("6000", StackLimit+1), 100000, machine.ErrStackOverflow, StackLimit * 3},
+		{"dup overflow", strings.Repeat("6000", StackLimit) + "80", 100000, machine.ErrStackOverflow, StackLimit * 3},
+		{"swap at the limit", strings.Repeat("6000", StackLimit) + "90", 100000, nil, StackLimit*3 + 3},
+	}
+
+	for _, tt := range tests {
+		ec, _, err := execCode(NewStateDB(), tt.code, nil, tt.gas)
+		if tt.want == nil && err != nil || tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, err)
+			continue
+		}
+		if used := tt.gas - ec.Gas; used != tt.used {
+			t.Errorf("%s: Expected %d gas used, got %d", tt.name, tt.used, used)
+		}
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"prevm/hexutil"
+)
+
+var ErrInvalidGenesis = errors.New("invalid genesis")
+
+// Genesis is a geth-style genesis file: the block fields that seed the
+// BlockContext and the allocation of the initial state. Numbers are read as
+// hex or decimal; they are written back as hex.
+type Genesis struct {
+	Config        *ChainConfig
+	Nonce         uint64
+	Timestamp     uint64
+	ExtraData     []byte
+	GasLimit      uint64
+	Difficulty    *big.Int
+	Mixhash       [32]byte
+	Coinbase      [20]byte
+	Alloc         GenesisAlloc
+	Number        uint64
+	GasUsed       uint64
+	ParentHash    [32]byte
+	BaseFee       *big.Int
+	ExcessBlobGas *uint64
+	BlobGasUsed   *uint64
+}
+
+// ChainConfig holds the parts of the chain configuration prevm uses.
+type ChainConfig struct {
+	ChainID *big.Int `json:"chainId"`
+}
+
+// GenesisAlloc is the initial state, keyed by address.
+type GenesisAlloc map[[20]byte]GenesisAccount
+
+// GenesisAccount is an account of the initial state.
+type GenesisAccount struct {
+	Code    []byte
+	Storage map[[32]byte][32]byte
+	Balance *big.Int
+	Nonce   uint64
+}
+
+type genesisJSON struct {
+	Config        *ChainConfig             `json:"config,omitempty"`
+	Nonce         hexutil.HexOrDecimal64   `json:"nonce"`
+	Timestamp     hexutil.HexOrDecimal64   `json:"timestamp"`
+	ExtraData     hexutil.Bytes            `json:"extraData"`
+	GasLimit      hexutil.HexOrDecimal64   `json:"gasLimit"`
+	Difficulty    *hexutil.HexOrDecimal256 `json:"difficulty"`
+	Mixhash       string                   `json:"mixHash,omitempty"`
+	Coinbase      string                   `json:"coinbase,omitempty"`
+	Alloc         GenesisAlloc             `json:"alloc"`
+	Number        hexutil.HexOrDecimal64   `json:"number"`
+	GasUsed       hexutil.HexOrDecimal64   `json:"gasUsed"`
+	ParentHash    string                   `json:"parentHash,omitempty"`
+	BaseFee       *hexutil.HexOrDecimal256 `json:"baseFeePerGas,omitempty"`
+	ExcessBlobGas *hexutil.HexOrDecimal64  `json:"excessBlobGas,omitempty"`
+	BlobGasUsed   *hexutil.HexOrDecimal64  `json:"blobGasUsed,omitempty"`
+}
+
+type genesisAccountJS struct {
+	Code    hexutil.Bytes            `json:"code,omitempty"`
+	Storage map[string]string        `json:"storage,omitempty"`
+	Balance *hexutil.HexOrDecimal256 `json:"balance"`
+	Nonce   hexutil.HexOrDecimal64   `json:"nonce,omitempty"`
+}
+
+func (g *Genesis) UnmarshalJSON(input []byte) error {
+	var dec genesisJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+
+	*g = Genesis{
+		Config:    dec.Config,
+		Nonce:     uint64(dec.Nonce),
+		Timestamp: uint64(dec.Timestamp),
+		ExtraData: dec.ExtraData,
+		GasLimit:  uint64(dec.GasLimit),
+		Number:    uint64(dec.Number),
+		GasUsed:   uint64(dec.GasUsed),
+		Alloc:     dec.Alloc,
+	}
+	if g.Alloc == nil {
+		g.Alloc = make(GenesisAlloc)
+	}
+	if dec.Difficulty != nil {
+		g.Difficulty = new(big.Int).Set(dec.Difficulty.ToInt())
+	}
+	if dec.BaseFee != nil {
+		g.BaseFee = new(big.Int).Set(dec.BaseFee.ToInt())
+	}
+	if dec.ExcessBlobGas != nil {
+		excess := uint64(*dec.ExcessBlobGas)
+		g.ExcessBlobGas = &excess
+	}
+	if dec.BlobGasUsed != nil {
+		used := uint64(*dec.BlobGasUsed)
+		g.BlobGasUsed = &used
+	}
+
+	var err error
+	if g.Mixhash, err = parseWord(dec.Mixhash); err != nil {
+		return fmt.Errorf("%w: mixHash: %v", ErrInvalidGenesis, err)
+	}
+	if g.ParentHash, err = parseWord(dec.ParentHash); err != nil {
+		return fmt.Errorf("%w: parentHash: %v", ErrInvalidGenesis, err)
+	}
+	if dec.Coinbase != "" {
+		if g.Coinbase, err = parseAddress(dec.Coinbase); err != nil {
+			return fmt.Errorf("%w: coinbase: %v", ErrInvalidGenesis, err)
+		}
+	}
+	return nil
+}
+
+func (g *Genesis) MarshalJSON() ([]byte, error) {
+	enc := genesisJSON{
+		Config:     g.Config,
+		Nonce:      hexutil.HexOrDecimal64(g.Nonce),
+		Timestamp:  hexutil.HexOrDecimal64(g.Timestamp),
+		ExtraData:  g.ExtraData,
+		GasLimit:   hexutil.HexOrDecimal64(g.GasLimit),
+		Difficulty: (*hexutil.HexOrDecimal256)(new(big.Int)),
+		Mixhash:    hexutil.Encode(g.Mixhash[:]),
+		Coinbase:   hexutil.Encode(g.Coinbase[:]),
+		Alloc:      g.Alloc,
+		Number:     hexutil.HexOrDecimal64(g.Number),
+		GasUsed:    hexutil.HexOrDecimal64(g.GasUsed),
+		ParentHash: hexutil.Encode(g.ParentHash[:]),
+	}
+	if enc.ExtraData == nil {
+		enc.ExtraData = []byte{}
+	}
+	if g.Difficulty != nil {
+		enc.Difficulty = (*hexutil.HexOrDecimal256)(g.Difficulty)
+	}
+	if g.BaseFee != nil {
+		enc.BaseFee = (*hexutil.HexOrDecimal256)(g.BaseFee)
+	}
+	if g.ExcessBlobGas != nil {
+		enc.ExcessBlobGas = (*hexutil.HexOrDecimal64)(g.ExcessBlobGas)
+	}
+	if g.BlobGasUsed != nil {
+		enc.BlobGasUsed = (*hexutil.HexOrDecimal64)(g.BlobGasUsed)
+	}
+	return json.Marshal(enc)
+}
+
+func (ga *GenesisAlloc) UnmarshalJSON(input []byte) error {
+	var dec map[string]genesisAccountJS
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+
+	*ga = make(GenesisAlloc, len(dec))
+	for key, acc := range dec {
+		addr, err := parseAddress(key)
+		if err != nil {
+			return fmt.Errorf("%w: alloc %s: %v", ErrInvalidGenesis, key, err)
+		}
+		account := GenesisAccount{
+			Code:    acc.Code,
+			Nonce:   uint64(acc.Nonce),
+			Balance: new(big.Int),
+		}
+		if acc.Balance != nil {
+			account.Balance.Set(acc.Balance.ToInt())
+		}
+		if len(acc.Storage) > 0 {
+			account.Storage = make(map[[32]byte][32]byte, len(acc.Storage))
+		}
+		for k, v := range acc.Storage {
+			slot, err := parseWord(k)
+			if err != nil {
+				return fmt.Errorf("%w: alloc %s: storage key %s: %v", ErrInvalidGenesis, key, k, err)
+			}
+			value, err := parseWord(v)
+			if err != nil {
+				return fmt.Errorf("%w: alloc %s: storage value %s: %v", ErrInvalidGenesis, key, v, err)
+			}
+			account.Storage[slot] = value
+		}
+		(*ga)[addr] = account
+	}
+	return nil
+}
+
+func (ga GenesisAlloc) MarshalJSON() ([]byte, error) {
+	enc := make(map[string]genesisAccountJS, len(ga))
+	for addr, acc := range ga {
+		account := genesisAccountJS{
+			Code:    acc.Code,
+			Nonce:   hexutil.HexOrDecimal64(acc.Nonce),
+			Balance: (*hexutil.HexOrDecimal256)(new(big.Int)),
+		}
+		if acc.Balance != nil {
+			account.Balance = (*hexutil.HexOrDecimal256)(acc.Balance)
+		}
+		if len(acc.Storage) > 0 {
+			account.Storage = make(map[string]string, len(acc.Storage))
+		}
+		for slot, value := range acc.Storage {
+			account.Storage[hexutil.Encode(slot[:])] = hexutil.Encode(value[:])
+		}
+		enc[hexutil.Encode(addr[:])] = account
+	}
+	return json.Marshal(enc)
+}
+
+// LoadGenesis reads a genesis file.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	genesis := new(Genesis)
+	if err := json.Unmarshal(data, genesis); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return genesis, nil
+}
+
+// Save writes the genesis to a file as indented JSON.
+func (g *Genesis) Save(path string) error {
+	data, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// Apply writes the allocation into state. Accounts already in the state
+// are replaced.
+func (g *Genesis) Apply(state *StateDB) {
+	g.Alloc.Apply(state)
+}
+
+// Apply writes the accounts into state, replacing existing ones.
+func (ga GenesisAlloc) Apply(state *StateDB) {
+	for addr, alloc := range ga {
+		state.CreateAccount(addr)
+		if alloc.Balance != nil {
+			state.SetBalance(addr, alloc.Balance)
+		}
+		state.SetNonce(addr, alloc.Nonce)
+		if len(alloc.Code) > 0 {
+			state.SetCode(addr, append([]byte(nil), alloc.Code...))
+		}
+		for slot, value := range alloc.Storage {
+			state.SetStorage(addr, slot, append([]byte(nil), value[:]...))
+		}
+	}
+	// Keep empty accounts: EIP-161 only removes them once touched.
+	state.resetJournal()
+}
+
+// ToBlock returns the block context described by the genesis block fields.
+// Post-merge genesis files carry the randomness in mixHash with a zero
+// difficulty; it is used as Difficulty (PREVRANDAO) in that case.
+func (g *Genesis) ToBlock() *BlockContext {
+	block := &BlockContext{
+		Coinbase:   g.Coinbase,
+		Timestamp:  new(big.Int).SetUint64(g.Timestamp),
+		Number:     new(big.Int).SetUint64(g.Number),
+		Difficulty: new(big.Int),
+		GasLimit:   new(big.Int).SetUint64(g.GasLimit),
+	}
+	if g.Difficulty != nil {
+		block.Difficulty.Set(g.Difficulty)
+	}
+	if block.Difficulty.Sign() == 0 {
+		block.Difficulty.SetBytes(g.Mixhash[:])
+	}
+	if g.BaseFee != nil {
+		block.BaseFee = new(big.Int).Set(g.BaseFee)
+	}
+	if g.Config != nil && g.Config.ChainID != nil {
+		block.ChainID = new(big.Int).Set(g.Config.ChainID)
+	}
+	if g.ExcessBlobGas != nil {
+		block.BlobBaseFee = CalcBlobFee(*g.ExcessBlobGas)
+	}
+	return block
+}
+
+// DevGenesis returns the genesis of a development chain: the accounts of
+// DevKeys hold 10000 ether each, blocks have a gas limit of 30M gas and the
+// base fee starts at 1 gwei.
+func DevGenesis() *Genesis {
+	genesis := &Genesis{
+		Config:   &ChainConfig{ChainID: big.NewInt(DefaultChainID)},
+		GasLimit: 30_000_000,
+		BaseFee:  big.NewInt(1_000_000_000),
+		Alloc:    make(GenesisAlloc),
+	}
+	balance := new(big.Int).Mul(big.NewInt(10_000), big.NewInt(1e18))
+	for _, hex := range DevKeys {
+		key, err := HexToPrivateKey(hex)
+		if err != nil {
+			panic(err)
+		}
+		genesis.Alloc[PrivateKeyToAddress(key)] = GenesisAccount{Balance: new(big.Int).Set(balance)}
+	}
+	return genesis
+}
+
+// DumpGenesis returns a genesis holding the full state, with the block
+// fields and chain configuration of header when it is not nil. Loading and
+// applying the result reproduces the state.
+func DumpGenesis(state *StateDB, header *Genesis) *Genesis {
+	genesis := &Genesis{Alloc: make(GenesisAlloc)}
+	if header != nil {
+		// The alloc is replaced, the rest is carried over as is.
+		*genesis = *header
+		genesis.Alloc = make(GenesisAlloc)
+	}
+	state.ForEachAccount(func(addr [20]byte, acc *Account) {
+		alloc := GenesisAccount{
+			Balance: new(big.Int).Set(acc.Balance),
+			Nonce:   acc.Nonce,
+		}
+		if len(acc.Code) > 0 {
+			alloc.Code = append([]byte(nil), acc.Code...)
+		}
+		for slot, value := range acc.Storage {
+			if isZero(value) {
+				continue
+			}
+			if alloc.Storage == nil {
+				alloc.Storage = make(map[[32]byte][32]byte)
+			}
+			alloc.Storage[slot] = toWord(value)
+		}
+		genesis.Alloc[addr] = alloc
+	})
+	return genesis
+}
+
+// parseAddress parses a 20-byte address, with or without the 0x prefix.
+func parseAddress(s string) ([20]byte, error) {
+	b, err := DecodeHex(s)
+	if err != nil {
+		return [20]byte{}, err
+	}
+	if len(b) != 20 {
+		return [20]byte{}, fmt.Errorf("%w: %d bytes", ErrInvalidAddress, len(b))
+	}
+	return [20]byte(b), nil
+}
+
+// parseWord parses a hex string of up to 32 bytes, left-padding it to a
+// full word. The empty string is the zero word.
+func parseWord(s string) ([32]byte, error) {
+	var word [32]byte
+	if s == "" {
+		return word, nil
+	}
+	b, err := DecodeHex(s)
+	if err != nil {
+		return word, err
+	}
+	if len(b) > 32 {
+		return word, fmt.Errorf("%w: %d bytes", ErrInvalidHashSize, len(b))
+	}
+	copy(word[32-len(b):], b)
+	return word, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testGenesis is a geth-style genesis file, with numbers in hex and in
+// decimal.
+const testGenesis = `{
+  "config": {"chainId": 1337, "londonBlock": 0},
+  "nonce": "0x42",
+  "timestamp": "0x64",
+  "extraData": "0x70726576",
+  "gasLimit": "30000000",
+  "difficulty": "0x0",
+  "mixHash": "0x0000000000000000000000000000000000000000000000000000000000000abc",
+  "coinbase": "0x00000000000000000000000000000000000000cb",
+  "baseFeePerGas": "1000000000",
+  "excessBlobGas": "0x0",
+  "alloc": {
+    "0x00000000000000000000000000000000000000c0": {
+      "code": "0x600054",
+      "storage": {
+        "0x00": "0x2a",
+        "0x0000000000000000000000000000000000000000000000000000000000000001": "0x00000000000000000000000000000000000000000000000000000000000000ff"
+      },
+      "balance": "0x10",
+      "nonce": "0x3"
+    },
+    "00000000000000000000000000000000000000aa": {
+      "balance": "1000000000000000000000"
+    }
+  }
+}`
+
+// TestGenesisRoundTrip checks that a genesis file applied to a state and
+// dumped back loads into the same genesis.
+func TestGenesisRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	if err := os.WriteFile(path, []byte(testGenesis), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	genesis, err := LoadGenesis(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	contract := [20]byte{19: 0xc0}
+	funded := [20]byte{19: 0xaa}
+	state := NewStateDB()
+	genesis.Apply(state)
+	if got := state.GetBalance(funded); got.String() != "1000000000000000000000" {
+		t.Errorf("Expected a balance of 1000 ether, got %s", got)
+	}
+	if got := state.GetBalance(contract).Int64(); got != 16 {
+		t.Errorf("Expected balance 16, got %d", got)
+	}
+	if got := state.GetNonce(contract); got != 3 {
+		t.Errorf("Expected nonce 3, got %d", got)
+	}
+	if got := state.GetCode(contract); !bytes.Equal(got, []byte{0x60, 0x00, 0x54}) {
+		t.Errorf("Expected code 600054, got %x", got)
+	}
+	if got, want := state.GetStorage(contract, [32]byte{}), [32]byte{31: 0x2a}; !bytes.Equal(got, want[:]) {
+		t.Errorf("Expected slot 0 to hold 2a, got %x", got)
+	}
+
+	block := genesis.ToBlock()
+	if block.ChainID.Int64() != 1337 || block.GasLimit.Int64() != 30_000_000 || block.Timestamp.Int64() != 100 {
+		t.Errorf("Unexpected block context: %+v", block)
+	}
+	if block.Difficulty.Int64() != 0xabc {
+		t.Errorf("Expected the mix hash as PREVRANDAO, got %d", block.Difficulty)
+	}
+
+	dumpPath := filepath.Join(t.TempDir(), "dump.json")
+	if err := DumpGenesis(state, genesis).Save(dumpPath); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dumped, err := LoadGenesis(dumpPath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want, _ := json.Marshal(genesis)
+	got, _ := json.Marshal(dumped)
+	if !bytes.Equal(got, want) {
+		t.Errorf("Expected the dump to load as\n%s\ngot\n%s", want, got)
+	}
+	if dumped.Mixhash != genesis.Mixhash || string(dumped.ExtraData) != "prev" || dumped.Nonce != 0x42 {
+		t.Errorf("Expected the mix hash, extra data and nonce to be kept, got %x, %q and %d", dumped.Mixhash, dumped.ExtraData, dumped.Nonce)
+	}
+}
+
+// TestGenesisErrors checks that malformed addresses and storage are
+// rejected.
+func TestGenesisErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"short address", `{"alloc": {"0x01": {"balance": "0x1"}}}`},
+		{"storage key too long", `{"alloc": {"0x00000000000000000000000000000000000000c0": {"storage": {"0x` + string(bytes.Repeat([]byte("00"), 33)) + `": "0x01"}}}}`},
+		{"storage value not hex", `{"alloc": {"0x00000000000000000000000000000000000000c0": {"storage": {"0x01": "0xzz"}}}}`},
+		{"mix hash too long", `{"mixHash": "0x` + string(bytes.Repeat([]byte("00"), 33)) + `", "alloc": {}}`},
+	}
+
+	for _, tt := range tests {
+		var genesis Genesis
+		if err := json.Unmarshal([]byte(tt.input), &genesis); !errors.Is(err, ErrInvalidGenesis) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, ErrInvalidGenesis, err)
+		}
+	}
+
+	var genesis Genesis
+	if err := json.Unmarshal([]byte(`{"alloc": {"0x00000000000000000000000000000000000000c0": {"balance": "0x1"}}}`), &genesis); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if genesis.Alloc[[20]byte{19: 0xc0}].Balance.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("Expected balance 1, got %v", genesis.Alloc[[20]byte{19: 0xc0}].Balance)
+	}
+}
@@ -0,0 +1,226 @@
+// Package hexutil implements the 0x-prefixed hex encoding used by the
+// Ethereum JSON APIs: Bytes for data, Uint64 and Big for quantities.
+package hexutil
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrMissingPrefix = errors.New("hex string without 0x prefix")
+	ErrEmptyNumber   = errors.New("hex string \"0x\"")
+	ErrLeadingZero   = errors.New("hex number with leading zero digits")
+	ErrOddLength     = errors.New("hex string of odd length")
+	ErrUint64Range   = errors.New("hex number > 64 bits")
+	ErrBig256Range   = errors.New("hex number > 256 bits")
+)
+
+// Encode encodes b as a 0x-prefixed hex string.
+func Encode(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// Decode decodes a 0x-prefixed hex string of even length.
+func Decode(s string) ([]byte, error) {
+	raw, err := checkPrefix(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw)%2 == 1 {
+		return nil, ErrOddLength
+	}
+	return hex.DecodeString(raw)
+}
+
+// EncodeUint64 encodes i as a hex quantity.
+func EncodeUint64(i uint64) string {
+	return "0x" + strconv.FormatUint(i, 16)
+}
+
+// DecodeUint64 decodes a hex quantity.
+func DecodeUint64(s string) (uint64, error) {
+	raw, err := checkNumber(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(raw) > 16 {
+		return 0, ErrUint64Range
+	}
+	return strconv.ParseUint(raw, 16, 64)
+}
+
+// EncodeBig encodes i as a hex quantity. Negative numbers keep their sign.
+func EncodeBig(i *big.Int) string {
+	if i.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(i).Text(16)
+	}
+	return "0x" + i.Text(16)
+}
+
+// DecodeBig decodes a hex quantity of at most 256 bits.
+func DecodeBig(s string) (*big.Int, error) {
+	raw, err := checkNumber(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > 64 {
+		return nil, ErrBig256Range
+	}
+	i, ok := new(big.Int).SetString(raw, 16)
+	if !ok {
+		return nil, fmt.Errorf("invalid hex number %q", s)
+	}
+	return i, nil
+}
+
+func checkPrefix(s string) (string, error) {
+	if !strings.HasPrefix(s, "0x") && !strings.HasPrefix(s, "0X") {
+		return "", ErrMissingPrefix
+	}
+	return s[2:], nil
+}
+
+func checkNumber(s string) (string, error) {
+	raw, err := checkPrefix(s)
+	if err != nil {
+		return "", err
+	}
+	if len(raw) == 0 {
+		return "", ErrEmptyNumber
+	}
+	if len(raw) > 1 && raw[0] == '0' {
+		return "", ErrLeadingZero
+	}
+	return raw, nil
+}
+
+// Bytes marshals as a 0x-prefixed hex string.
+type Bytes []byte
+
+func (b Bytes) MarshalText() ([]byte, error) {
+	return []byte(Encode(b)), nil
+}
+
+func (b *Bytes) UnmarshalText(text []byte) error {
+	dec, err := Decode(string(text))
+	if err != nil {
+		return err
+	}
+	*b = dec
+	return nil
+}
+
+func (b Bytes) String() string {
+	return Encode(b)
+}
+
+// Uint64 marshals as a hex quantity.
+type Uint64 uint64
+
+func (i Uint64) MarshalText() ([]byte, error) {
+	return []byte(EncodeUint64(uint64(i))), nil
+}
+
+func (i *Uint64) UnmarshalText(text []byte) error {
+	dec, err := DecodeUint64(string(text))
+	if err != nil {
+		return err
+	}
+	*i = Uint64(dec)
+	return nil
+}
+
+// Big marshals as a hex quantity.
+type Big big.Int
+
+func (b *Big) MarshalText() ([]byte, error) {
+	return []byte(EncodeBig((*big.Int)(b))), nil
+}
+
+func (b *Big) UnmarshalText(text []byte) error {
+	dec, err := DecodeBig(string(text))
+	if err != nil {
+		return err
+	}
+	*b = Big(*dec)
+	return nil
+}
+
+// ToInt returns b as a *big.Int.
+func (b *Big) ToInt() *big.Int {
+	return (*big.Int)(b)
+}
+
+// HexOrDecimal64 unmarshals from a hex quantity or a decimal number, given
+// as a JSON string or number, as found in genesis files. It marshals as a
+// hex quantity.
+type HexOrDecimal64 uint64
+
+func (i HexOrDecimal64) MarshalText() ([]byte, error) {
+	return []byte(EncodeUint64(uint64(i))), nil
+}
+
+func (i *HexOrDecimal64) UnmarshalJSON(input []byte) error {
+	s := unquote(input)
+	if !has0xPrefix(s) {
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		*i = HexOrDecimal64(n)
+		return nil
+	}
+	n, err := strconv.ParseUint(s[2:], 16, 64)
+	if err != nil {
+		return fmt.Errorf("invalid hex number %q", s)
+	}
+	*i = HexOrDecimal64(n)
+	return nil
+}
+
+// HexOrDecimal256 is the big integer counterpart of HexOrDecimal64,
+// limited to 256 bits.
+type HexOrDecimal256 big.Int
+
+func (b *HexOrDecimal256) MarshalText() ([]byte, error) {
+	return []byte(EncodeBig((*big.Int)(b))), nil
+}
+
+func (b *HexOrDecimal256) UnmarshalJSON(input []byte) error {
+	s := unquote(input)
+	base, digits := 10, s
+	if has0xPrefix(s) {
+		base, digits = 16, s[2:]
+	}
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok {
+		return fmt.Errorf("invalid number %q", s)
+	}
+	if n.Sign() < 0 || n.BitLen() > 256 {
+		return fmt.Errorf("%w: %s", ErrBig256Range, s)
+	}
+	*b = HexOrDecimal256(*n)
+	return nil
+}
+
+// ToInt returns b as a *big.Int.
+func (b *HexOrDecimal256) ToInt() *big.Int {
+	return (*big.Int)(b)
+}
+
+func has0xPrefix(s string) bool {
+	return strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X")
+}
+
+func unquote(input []byte) string {
+	s := string(input)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+package hexutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// TestBytes checks the encoding and decoding of hex data.
+func TestBytes(t *testing.T) {
+	if got := Encode([]byte{0x01, 0xab}); got != "0x01ab" {
+		t.Errorf("Expected 0x01ab, got %s", got)
+	}
+	if got := Encode(nil); got != "0x" {
+		t.Errorf("Expected 0x, got %s", got)
+	}
+
+	dec, err := Decode("0x01ab")
+	if err != nil || !bytes.Equal(dec, []byte{0x01, 0xab}) {
+		t.Errorf("Expected 01ab, got %x (%v)", dec, err)
+	}
+	if _, err := Decode("01ab"); !errors.Is(err, ErrMissingPrefix) {
+		t.Errorf("Expected ErrMissingPrefix, got %v", err)
+	}
+	if _, err := Decode("0x1ab"); !errors.Is(err, ErrOddLength) {
+		t.Errorf("Expected ErrOddLength, got %v", err)
+	}
+}
+
+// TestQuantities checks the encoding and decoding of hex numbers.
+func TestQuantities(t *testing.T) {
+	if got := EncodeUint64(0); got != "0x0" {
+		t.Errorf("Expected 0x0, got %s", got)
+	}
+	if got := EncodeUint64(1024); got != "0x400" {
+		t.Errorf("Expected 0x400, got %s", got)
+	}
+
+	n, err := DecodeUint64("0x400")
+	if err != nil || n != 1024 {
+		t.Errorf("Expected 1024, got %d (%v)", n, err)
+	}
+	if _, err := DecodeUint64("0x0400"); !errors.Is(err, ErrLeadingZero) {
+		t.Errorf("Expected ErrLeadingZero, got %v", err)
+	}
+	if _, err := DecodeUint64("0x"); !errors.Is(err, ErrEmptyNumber) {
+		t.Errorf("Expected ErrEmptyNumber, got %v", err)
+	}
+	if _, err := DecodeUint64("0x10000000000000000"); !errors.Is(err, ErrUint64Range) {
+		t.Errorf("Expected ErrUint64Range, got %v", err)
+	}
+
+	b, err := DecodeBig("0xde0b6b3a7640000")
+	if err != nil || b.Cmp(big.NewInt(1e18)) != 0 {
+		t.Errorf("Expected 1e18, got %v (%v)", b, err)
+	}
+}
+
+// TestJSON checks that the types marshal as JSON strings.
+func TestJSON(t *testing.T) {
+	type payload struct {
+		Data   Bytes  `json:"data"`
+		Nonce  Uint64 `json:"nonce"`
+		Amount *Big   `json:"amount"`
+	}
+	in := payload{Data: Bytes{0xca, 0xfe}, Nonce: 7, Amount: (*Big)(big.NewInt(255))}
+
+	enc, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := `{"data":"0xcafe","nonce":"0x7","amount":"0xff"}`
+	if string(enc) != want {
+		t.Errorf("Expected %s, got %s", want, enc)
+	}
+
+	var out payload
+	if err := json.Unmarshal(enc, &out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !bytes.Equal(out.Data, in.Data) || out.Nonce != in.Nonce || out.Amount.ToInt().Cmp(in.Amount.ToInt()) != 0 {
+		t.Errorf("Expected %+v, got %+v", in, out)
+	}
+}
+
+// TestHexOrDecimal checks that genesis style numbers decode from hex and
+// decimal, quoted or not.
+func TestHexOrDecimal(t *testing.T) {
+	for _, input := range []string{`"0x400"`, `"1024"`, `1024`} {
+		var i HexOrDecimal64
+		if err := json.Unmarshal([]byte(input), &i); err != nil || i != 1024 {
+			t.Errorf("Expected 1024 from %s, got %d (%v)", input, i, err)
+		}
+
+		var b HexOrDecimal256
+		if err := json.Unmarshal([]byte(input), &b); err != nil || b.ToInt().Int64() != 1024 {
+			t.Errorf("Expected 1024 from %s, got %v (%v)", input, b.ToInt(), err)
+		}
+	}
+
+	var b HexOrDecimal256
+	if err := json.Unmarshal([]byte(`"0x1`+strings.Repeat("0", 64)+`"`), &b); !errors.Is(err, ErrBig256Range) {
+		t.Errorf("Expected ErrBig256Range, got %v", err)
+	}
+
+	enc, _ := json.Marshal(HexOrDecimal64(1024))
+	if string(enc) != `"0x400"` {
+		t.Errorf("Expected \"0x400\", got %s", enc)
+	}
+}
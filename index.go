@@ -0,0 +1,114 @@
+package main
+
+import (
+	"slices"
+	"sort"
+)
+
+// LogIndex indexes logs by address and topic so that filter queries don't
+// have to go through every log. Logs must be added in chain order. It is
+// not safe for concurrent use.
+type LogIndex struct {
+	logs      []*Log
+	byAddress map[[20]byte][]int // positions in logs
+	byTopic   map[[32]byte][]int // positions in logs, the topic at any position
+}
+
+// NewLogIndex returns an empty index.
+func NewLogIndex() *LogIndex {
+	return &LogIndex{
+		byAddress: make(map[[20]byte][]int),
+		byTopic:   make(map[[32]byte][]int),
+	}
+}
+
+// Add adds logs to the index, after those already in it.
+func (idx *LogIndex) Add(logs ...*Log) {
+	for _, log := range logs {
+		i := len(idx.logs)
+		idx.logs = append(idx.logs, log)
+		idx.byAddress[log.Address] = append(idx.byAddress[log.Address], i)
+		for j, topic := range log.Topics {
+			// A topic may repeat, but a log is listed once.
+			if !slices.Contains(log.Topics[:j], topic) {
+				idx.byTopic[topic] = append(idx.byTopic[topic], i)
+			}
+		}
+	}
+}
+
+// Query returns the logs matching q, in order. The block hash of q is
+// ignored: callers look the block up and query its number.
+func (idx *LogIndex) Query(q *FilterQuery) []*Log {
+	// The logs of the range of blocks.
+	start, end := 0, len(idx.logs)
+	if q.FromBlock != nil {
+		start = sort.Search(len(idx.logs), func(i int) bool {
+			return idx.logs[i].BlockNumber >= *q.FromBlock
+		})
+	}
+	if q.ToBlock != nil {
+		end = sort.Search(len(idx.logs), func(i int) bool {
+			return idx.logs[i].BlockNumber > *q.ToBlock
+		})
+	}
+
+	logs := []*Log{}
+	candidates := idx.candidates(q)
+	if candidates == nil {
+		for _, log := range idx.logs[start:max(start, end)] {
+			if q.Matches(log) {
+				logs = append(logs, log)
+			}
+		}
+		return logs
+	}
+	for _, i := range candidates {
+		if i >= start && i < end && q.Matches(idx.logs[i]) {
+			logs = append(logs, idx.logs[i])
+		}
+	}
+	return logs
+}
+
+// candidates returns the sorted positions of the logs that may match q:
+// those from one of its addresses or, failing that, those holding one of
+// the topics of its most selective position. It returns nil if q matches
+// any address and topic.
+func (idx *LogIndex) candidates(q *FilterQuery) []int {
+	if len(q.Addresses) > 0 {
+		var lists [][]int
+		for _, addr := range q.Addresses {
+			lists = append(lists, idx.byAddress[addr])
+		}
+		return union(lists)
+	}
+	var best []int
+	for _, topics := range q.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		var lists [][]int
+		for _, topic := range topics {
+			lists = append(lists, idx.byTopic[topic])
+		}
+		if positions := union(lists); best == nil || len(positions) < len(best) {
+			best = positions
+		}
+	}
+	return best
+}
+
+// union merges sorted lists of positions into a sorted list without
+// duplicates. It never returns nil.
+func union(lists [][]int) []int {
+	if len(lists) == 1 && lists[0] != nil {
+		return lists[0]
+	}
+	merged := []int{}
+	for _, list := range lists {
+		merged = append(merged, list...)
+	}
+	slices.Sort(merged)
+	return slices.Compact(merged)
+}
@@ -4,6 +4,14 @@ var InstructionSet [256]Opcode
 
 var GasCosts [256]uint64
 
+// StackLimit is the maximum number of items on the stack.
+const StackLimit = 1024
+
+// StackPops and StackPushes are the number of items each opcode takes off
+// the stack and puts on it. They are checked before the opcode is charged
+// for, so that an opcode without the items it needs fails up front.
+var StackPops, StackPushes [256]int
+
 func init() {
 	// --- 0x00: Stop and Arithmetic Operations ---
 	InstructionSet[STOP] = &Stop{}
@@ -52,8 +60,8 @@ func init() {
 	InstructionSet[GASPRICE] = &GasPrice{}
 	// InstructionSet[EXTCODESIZE] = &ExtCodeSize{}
 	// InstructionSet[EXTCODECOPY] = &ExtCodeCopy{}
-	// InstructionSet[RETURNDATASIZE] = &ReturnDataSize{}
-	// InstructionSet[RETURNDATACOPY] = &ReturnDataCopy{}
+	InstructionSet[RETURNDATASIZE] = &ReturnDataSize{}
+	InstructionSet[RETURNDATACOPY] = &ReturnDataCopy{}
 	// InstructionSet[EXTCODEHASH] = &ExtCodeHash{}
 
 	// --- 0x40: Block Information ---
@@ -66,20 +74,21 @@ func init() {
 	InstructionSet[CHAINID] = &ChainId{}
 	// InstructionSet[SELFBALANCE] = &SelfBalance{}
 	// InstructionSet[BASEFEE] = &BaseFee{}
+	InstructionSet[BLOBHASH] = &BlobHash{}
 
 	// --- 0x50: Stack, Memory, Storage and Flow Operations ---
 	InstructionSet[POP] = &Pop{}
 	InstructionSet[MLOAD] = &Mload{}
 	InstructionSet[MSTORE] = &Mstore{}
 	// InstructionSet[MSTORE8] = &Mstore8{}
-	// InstructionSet[SLOAD] = &Sload{}
-	// InstructionSet[SSTORE] = &Sstore{}
-	// InstructionSet[JUMP] = &Jump{}
-	// InstructionSet[JUMPI] = &Jumpi{}
+	InstructionSet[SLOAD] = &Sload{}
+	InstructionSet[SSTORE] = &Sstore{}
+	InstructionSet[JUMP] = &Jump{}
+	InstructionSet[JUMPI] = &Jumpi{}
 	// InstructionSet[PC] = &Pc{}
 	// InstructionSet[MSIZE] = &Msize{}
 	// InstructionSet[GAS] = &Gas{}
-	// InstructionSet[JUMPDEST] = &JumpDest{}
+	InstructionSet[JUMPDEST] = &JumpDest{}
 
 	// --- 0x60 & 0x70: Push Operations (Unified) ---
 	for i := 0x60; i <= 0x7F; i++ {
@@ -97,19 +106,19 @@ func init() {
 	}
 
 	// --- 0xa0: Logging Operations (Unified) ---
-	// for i := 0xa0; i <= 0xa4; i++ {
-	// 	InstructionSet[i] = &Log{}
-	// }
+	for i := 0xa0; i <= 0xa4; i++ {
+		InstructionSet[i] = &LogN{}
+	}
 
 	// --- 0xf0: System Operations ---
-	// InstructionSet[CREATE] = &Create{}
-	// InstructionSet[CALL] = &Call{}
-	// InstructionSet[CALLCODE] = &CallCode{}
-	// InstructionSet[RETURN] = &Return{}
-	// InstructionSet[DELEGATECALL] = &DelegateCall{}
-	// InstructionSet[CREATE2] = &Create2{}
-	// InstructionSet[STATICCALL] = &StaticCall{}
-	// InstructionSet[REVERT] = &Revert{}
+	InstructionSet[CREATE] = &Create{}
+	InstructionSet[CALL] = &Call{}
+	InstructionSet[CALLCODE] = &CallCode{}
+	InstructionSet[RETURN] = &Return{}
+	InstructionSet[DELEGATECALL] = &DelegateCall{}
+	InstructionSet[CREATE2] = &Create2{}
+	InstructionSet[STATICCALL] = &StaticCall{}
+	InstructionSet[REVERT] = &Revert{}
 	// InstructionSet[SELFDESTRUCT] = &SelfDestruct{}
 
 	// ===================================================================
@@ -168,6 +177,7 @@ func init() {
 	GasCosts[CHAINID] = 2
 	GasCosts[SELFBALANCE] = 5
 	GasCosts[BASEFEE] = 2
+	GasCosts[BLOBHASH] = 3
 	GasCosts[POP] = 2
 	GasCosts[MLOAD] = 3
 	GasCosts[MSTORE] = 3
@@ -207,4 +217,46 @@ func init() {
 	GasCosts[LOG2] = 375 * 3
 	GasCosts[LOG3] = 375 * 4
 	GasCosts[LOG4] = 375 * 5
+
+	// ===================================================================
+	// --- Stack Requirements (Items Popped, Items Pushed) ---
+	// ===================================================================
+
+	setStack := func(pops, pushes int, ops ...byte) {
+		for _, op := range ops {
+			StackPops[op], StackPushes[op] = pops, pushes
+		}
+	}
+	setStack(2, 1, ADD, MUL, SUB, DIV, SDIV, MOD, SMOD, EXP, SIGNEXTEND)
+	setStack(3, 1, ADDMOD, MULMOD)
+	setStack(2, 1, LT, GT, SLT, SGT, EQ, AND, OR, XOR, BYTE, SHL, SHR, SAR)
+	setStack(1, 1, ISZERO, NOT)
+	setStack(2, 1, KECCAK256)
+	setStack(0, 1, ADDRESS, ORIGIN, CALLER, CALLVALUE, CALLDATASIZE, CODESIZE, GASPRICE, RETURNDATASIZE)
+	setStack(1, 1, BALANCE, CALLDATALOAD, EXTCODESIZE, EXTCODEHASH)
+	setStack(3, 0, CALLDATACOPY, CODECOPY, RETURNDATACOPY)
+	setStack(4, 0, EXTCODECOPY)
+	setStack(1, 1, BLOCKHASH, BLOBHASH)
+	setStack(0, 1, COINBASE, TIMESTAMP, NUMBER, DIFFICULTY, GASLIMIT, CHAINID, SELFBALANCE, BASEFEE, BLOBBASEFEE)
+	setStack(1, 0, POP, JUMP)
+	setStack(1, 1, MLOAD, SLOAD, TLOAD)
+	setStack(2, 0, MSTORE, MSTORE8, SSTORE, JUMPI, TSTORE)
+	setStack(3, 0, MCOPY)
+	setStack(0, 1, PC, MSIZE, GAS, PUSH0)
+	for i := 0; i < 32; i++ {
+		setStack(0, 1, byte(PUSH1+i))
+	}
+	for i := 0; i < 16; i++ {
+		setStack(i+1, i+2, byte(DUP1+i))
+		setStack(i+2, i+2, byte(SWAP1+i))
+	}
+	for i := 0; i <= 4; i++ {
+		setStack(i+2, 0, byte(LOG0+i))
+	}
+	setStack(3, 1, CREATE)
+	setStack(4, 1, CREATE2)
+	setStack(7, 1, CALL, CALLCODE)
+	setStack(6, 1, DELEGATECALL, STATICCALL)
+	setStack(2, 0, RETURN, REVERT)
+	setStack(1, 0, SELFDESTRUCT)
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"math/big"
+)
+
+// journalEntry is a single reversible change to the state.
+type journalEntry interface {
+	// revert undoes the change.
+	revert(s *StateDB)
+	// dirtied returns the account modified by the change, if any.
+	dirtied() *[20]byte
+}
+
+// journal is the ordered list of state changes made by the current
+// transaction. Snapshots are indices into it.
+type journal struct {
+	entries []journalEntry
+	// dirties counts the entries touching each account, so that accounts
+	// can be forgotten again when their changes are reverted.
+	dirties map[[20]byte]int
+}
+
+func newJournal() *journal {
+	return &journal{dirties: make(map[[20]byte]int)}
+}
+
+func (j *journal) append(entry journalEntry) {
+	j.entries = append(j.entries, entry)
+	if addr := entry.dirtied(); addr != nil {
+		j.dirties[*addr]++
+	}
+}
+
+func (j *journal) length() int {
+	return len(j.entries)
+}
+
+// revert undoes all entries from the end of the journal down to snapshot,
+// in reverse order, and drops them.
+func (j *journal) revert(s *StateDB, snapshot int) {
+	for i := len(j.entries) - 1; i >= snapshot; i-- {
+		j.entries[i].revert(s)
+
+		if addr := j.entries[i].dirtied(); addr != nil {
+			if j.dirties[*addr]--; j.dirties[*addr] == 0 {
+				delete(j.dirties, *addr)
+			}
+		}
+	}
+	j.entries = j.entries[:snapshot]
+}
+
+type (
+	createAccountChange struct {
+		account [20]byte
+		prev    *Account // nil if the account didn't exist
+	}
+	balanceChange struct {
+		account [20]byte
+		prev    *big.Int
+	}
+	nonceChange struct {
+		account [20]byte
+		prev    uint64
+	}
+	codeChange struct {
+		account [20]byte
+		prev    []byte
+	}
+	storageChange struct {
+		account [20]byte
+		key     [32]byte
+		prev    []byte
+		existed bool
+	}
+	refundChange struct {
+		prev uint64
+	}
+	addLogChange        struct{}
+	accessAddressChange struct {
+		address [20]byte
+	}
+	accessSlotChange struct {
+		slot storageSlot
+	}
+)
+
+func (ch createAccountChange) revert(s *StateDB) {
+	if ch.prev == nil {
+		delete(s.accounts, ch.account)
+		return
+	}
+	s.accounts[ch.account] = ch.prev
+}
+
+func (ch balanceChange) revert(s *StateDB) {
+	s.accounts[ch.account].Balance = ch.prev
+}
+
+func (ch nonceChange) revert(s *StateDB) {
+	s.accounts[ch.account].Nonce = ch.prev
+}
+
+func (ch codeChange) revert(s *StateDB) {
+	s.accounts[ch.account].Code = ch.prev
+}
+
+func (ch storageChange) revert(s *StateDB) {
+	if !ch.existed {
+		delete(s.accounts[ch.account].Storage, ch.key)
+		return
+	}
+	s.accounts[ch.account].Storage[ch.key] = ch.prev
+}
+
+func (ch refundChange) revert(s *StateDB) {
+	s.refund = ch.prev
+}
+
+func (ch addLogChange) revert(s *StateDB) {
+	s.logs = s.logs[:len(s.logs)-1]
+}
+
+func (ch accessAddressChange) revert(s *StateDB) {
+	delete(s.accessedAddrs, ch.address)
+}
+
+func (ch accessSlotChange) revert(s *StateDB) {
+	delete(s.accessedSlots, ch.slot)
+}
+
+func (ch createAccountChange) dirtied() *[20]byte { return &ch.account }
+func (ch balanceChange) dirtied() *[20]byte       { return &ch.account }
+func (ch nonceChange) dirtied() *[20]byte         { return &ch.account }
+func (ch codeChange) dirtied() *[20]byte          { return &ch.account }
+func (ch storageChange) dirtied() *[20]byte       { return &ch.account }
+func (ch refundChange) dirtied() *[20]byte        { return nil }
+func (ch addLogChange) dirtied() *[20]byte        { return nil }
+func (ch accessAddressChange) dirtied() *[20]byte { return nil }
+func (ch accessSlotChange) dirtied() *[20]byte    { return nil }
@@ -81,16 +81,27 @@ func (m *Memory) Get(offset, size uint64) []byte {
 }
 
 func (m *Memory) Display() error {
+	fmt.Println("--- Memory ---")
+	fmt.Print(m.String())
+	fmt.Println("--------------")
+
+	if len(m.data) == 0 {
+		return errors.New("")
+	}
+	return nil
+}
+
+// String formats the memory as a hexdump of 32-byte lines, as printed by
+// Display.
+func (m *Memory) String() string {
 	data := m.GetData()
 	memSize := len(data)
 
-	fmt.Println("--- Memory ---")
 	if memSize == 0 {
-		fmt.Println("[ empty ]")
-		fmt.Println("--------------")
-		return errors.New("")
+		return "[ empty ]\n"
 	}
 
+	var sb strings.Builder
 	// Iterate through memory in 32-byte chunks.
 	for i := 0; i < memSize; i += 32 {
 		// Determine the end of the current line's slice.
@@ -104,9 +115,12 @@ func (m *Memory) Display() error {
 		}
 
 		// Print the memory address and the hex representation of the data.
-		fmt.Printf("0x%04x:  %s\n", i, strings.Join(hexBytes, " "))
+		fmt.Fprintf(&sb, "0x%04x:  %s\n", i, strings.Join(hexBytes, " "))
 	}
-	fmt.Println("--------------")
+	return sb.String()
+}
 
-	return nil
+// Copy returns a copy of the memory.
+func (m *Memory) Copy() *Memory {
+	return &Memory{data: append(make([]byte, 0, len(m.data)), m.data...)}
 }
@@ -3,6 +3,7 @@ package machine
 import (
 	"bytes"
 	"math/big"
+	"strings"
 	"testing"
 )
 
@@ -96,3 +97,18 @@ func TestMemoryZeroSizeOperations(t *testing.T) {
 		t.Errorf("Get with zero size should not expand memory")
 	}
 }
+
+// TestMemoryString checks the Display hexdump formatting.
+func TestMemoryString(t *testing.T) {
+	mem := NewMemory()
+	if got := mem.String(); got != "[ empty ]\n" {
+		t.Errorf("Expected empty memory marker, got %q", got)
+	}
+
+	mem.Set(33, []byte{0xab})
+	expected := "0x0000:  " + strings.TrimSuffix(strings.Repeat("00 ", 32), " ") + "\n" +
+		"0x0020:  00 ab" + strings.Repeat(" 00", 30) + "\n"
+	if got := mem.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"prevm/config"
+	"strings"
 
 	"github.com/charmbracelet/log"
 )
@@ -14,7 +14,10 @@ type Stack struct {
 	maxDepth int
 }
 
-var logger = config.Logger
+var (
+	ErrStackUnderflow = errors.New("stack underflow")
+	ErrStackOverflow  = errors.New("stack overflow")
+)
 
 // NewStack creates a new stack with a specified maximum depth.
 // The EVM standard is a max depth of 1024.
@@ -33,7 +36,7 @@ func (s *Stack) GetData() []*big.Int {
 // Panics if the stack exceeds its maximum depth (stack overflow).
 func (s *Stack) Push(val *big.Int) {
 	if len(s.data) >= s.maxDepth {
-		logger.Fatal("stack overflow")
+		panic(ErrStackOverflow)
 	}
 	s.data = append(s.data, val)
 }
@@ -41,9 +44,8 @@ func (s *Stack) Push(val *big.Int) {
 // Pop removes and returns the top item from the stack.
 // Panics if the stack is empty (stack underflow).
 func (s *Stack) Pop() *big.Int {
-
 	if len(s.data) == 0 {
-		logger.Fatal("stack underflow")
+		panic(ErrStackUnderflow)
 	}
 	lastIndex := len(s.data) - 1
 	val := s.data[lastIndex]
@@ -52,33 +54,51 @@ func (s *Stack) Pop() *big.Int {
 }
 
 func (s *Stack) Display() error {
+	fmt.Println("--- Stack ---")
+	fmt.Print(s.String())
+	fmt.Println("-------------")
+
+	if len(s.data) == 0 {
+		log.Errorf("Stack empty.")
+		return errors.New("")
+	}
+	return nil
+}
+
+// String formats the stack from top to bottom, one item per line, as
+// printed by Display.
+func (s *Stack) String() string {
 	data := s.GetData()
 	stackSize := len(data)
 
-	fmt.Println("--- Stack ---")
 	if stackSize == 0 {
-		fmt.Println("[ empty ]")
-		fmt.Println("-------------")
-		log.Errorf("Stack empty.")
-		return errors.New("")
+		return "[ empty ]\n"
 	}
 
+	var sb strings.Builder
 	// Print from top to bottom (last element to first)
 	for i := stackSize - 1; i >= 0; i-- {
 		// Format the big.Int as a 64-character hex string (32 bytes), left-padded with zeros.
 		formattedValue := fmt.Sprintf("0x%064x", data[i])
 		// Print the index from the top (0 is the top) and the value.
-		fmt.Printf("[%d]: %s\n", stackSize-1-i, formattedValue)
+		fmt.Fprintf(&sb, "[%d]: %s\n", stackSize-1-i, formattedValue)
 	}
-	fmt.Println("-------------")
+	return sb.String()
+}
 
-	return nil
+// Copy returns a deep copy of the stack.
+func (s *Stack) Copy() *Stack {
+	cpy := &Stack{data: make([]*big.Int, len(s.data)), maxDepth: s.maxDepth}
+	for i, v := range s.data {
+		cpy.data[i] = new(big.Int).Set(v)
+	}
+	return cpy
 }
 
 func (s *Stack) Dup(n int) {
 	// Ensure the stack is deep enough for the operation.
 	if len(s.data) < n {
-		logger.Fatal("stack underflow on DUP operation")
+		panic(fmt.Errorf("%w on DUP operation", ErrStackUnderflow))
 	}
 
 	indexToDup := len(s.data) - n
@@ -86,13 +106,12 @@ func (s *Stack) Dup(n int) {
 
 	s.Push(new(big.Int).Set(val))
 
-	logger.Debug(s.Display())
 }
 
 func (s *Stack) Swap(n int) {
 	// The stack needs at least n+1 items to perform a swap.
 	if len(s.data) < n+1 {
-		logger.Fatal("stack underflow on SWAP operation")
+		panic(fmt.Errorf("%w on SWAP operation", ErrStackUnderflow))
 	}
 
 	// Calculate the indices of the two items to swap.
@@ -53,5 +53,35 @@ func TestStackOverflow(t *testing.T) {
 	s.Push(big.NewInt(2))
 
 	// This third push should cause a panic.
-	// s.Push(big.NewInt(3))
+	s.Push(big.NewInt(3))
+}
+
+// TestStackString checks the Display formatting, top of the stack first.
+func TestStackString(t *testing.T) {
+	s := NewStack(1024)
+	if got := s.String(); got != "[ empty ]\n" {
+		t.Errorf("Expected empty stack marker, got %q", got)
+	}
+
+	s.Push(big.NewInt(1))
+	s.Push(big.NewInt(0xff))
+	expected := "[0]: 0x00000000000000000000000000000000000000000000000000000000000000ff\n" +
+		"[1]: 0x0000000000000000000000000000000000000000000000000000000000000001\n"
+	if got := s.String(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+// TestStackCopy checks that a copy doesn't share items with the original.
+func TestStackCopy(t *testing.T) {
+	s := NewStack(1024)
+	s.Push(big.NewInt(1))
+
+	cpy := s.Copy()
+	s.GetData()[0].SetInt64(2)
+	s.Push(big.NewInt(3))
+
+	if len(cpy.GetData()) != 1 || cpy.GetData()[0].Int64() != 1 {
+		t.Errorf("Expected copy to hold [1], got %v", cpy.GetData())
+	}
 }
@@ -1,189 +1,64 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"math/big"
-	"prevm/config"
-	"time"
+	"os"
 )
 
-func main() {
-	logger := config.Logger
-
-	logger.Info("Starting EVM simulation...")
-
-	// 2. --- EVM Component Setup ---
-	state := NewStateDB()
-	logger.Debug("Initialized StateDB")
-
-	// --- Define Addresses ---
-	// var accountA_Addr [20]byte
-	// copy(accountA_Addr[:], []byte("9bbfed6889322e016e0a02ee459d306fc19545d8"))
-	accountA_Addr := [20]byte{0x9b, 0xbf, 0xed, 0x68, 0x89, 0x32, 0x2e, 0x01, 0x6e, 0x0a, 0x02, 0xee, 0x45, 0x9d, 0x30, 0x6f, 0xc1, 0x95, 0x45, 0xd8}
-	accountB_Addr := [20]byte{0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd, 0xdd}
-	contractAddr := [20]byte{0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb, 0xbb}
-
-	// --- Setup Accounts in StateDB ---
-	// Account A starts with nonce 0 and 1 ETH.
-	accountA := NewAccount()
-	accountA.Balance = new(big.Int).SetUint64(1000000000000000000) // 1 ETH
-	accountA.Nonce = 0
-	state.accounts[accountA_Addr] = accountA
-	logger.Debug("Created Account A", "address", fmt.Sprintf("0x%x", accountA_Addr))
-
-	// Account B starts with nonce 0 and 1 ETH.
-	accountB := NewAccount()
-	accountB.Balance = new(big.Int).SetUint64(1000000000000000000) // 1 ETH
-	accountB.Nonce = 0
-	state.accounts[accountB_Addr] = accountB
-	logger.Debug("Created Account B", "address", fmt.Sprintf("0x%x", accountB_Addr))
-
-	// --- Contract Bytecode ---
-	// bytecode := []byte{
-	// 	PUSH32,
-	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
-	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
-	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
-	// 	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
-	// 	PUSH1,
-	// 	0x02,
-	// 	ADD,
-	// 	STOP,
-	// }
-
-	// bytecode = []byte{
-	// 	PUSH1, 1,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	DUP4,
-	//  STOP,
-	// }
-
-	// bytecode := []byte{
-	// 	PUSH5,
-	// 	0x02, 0x03, 0x01, 0xFF, 0x01,
-	// 	PUSH1,
-	// 	0x05,
-	// 	EXP,
-	// 	STOP,
-	// }
-
-	// bytecode := []byte{
-	// 	ADDRESS,
-	// 	BALANCE,
-	// 	CALLVALUE,
-	// 	PUSH1, 31,
-	// 	CALLDATALOAD,
-	// }
-
-	// bytecode := []byte{
-	// 	PUSH1, 32,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	CALLDATACOPY,
-	// 	PUSH1, 8,
-	// 	PUSH1, 31,
-	// 	PUSH1, 0,
-	// 	CALLDATACOPY,
-	// }
-
-	bytecode := []byte{
-		PUSH32,
-		0xFF, 0xFF, 0xFF, 0xFF, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00,
-		PUSH1, 0,
-		MSTORE,
-
-		PUSH1, 4,
-		PUSH1, 0,
-		KECCAK256,
-		TIMESTAMP,
-
-		ADDRESS,
-		CALLER,
-	}
-
-	contractAccount := NewAccount()
-	contractAccount.Code = bytecode
-	contractAccount.Balance = new(big.Int).SetUint64(2000000000000000000)
-	state.accounts[contractAddr] = contractAccount
-
-	logger.Debug("Created contract account", "address", fmt.Sprintf("0x%x", contractAddr))
-
-	// --- Block Context and EVM Setup ---
-	blockCtx := &BlockContext{
-		BaseFee:   big.NewInt(70000000000),
-		Number:    big.NewInt(1),
-		Timestamp: big.NewInt(time.Now().Local().Unix()),
-		ChainID:   big.NewInt(1),
-	}
-	evm := NewEVM(state, blockCtx)
-	logger.Info("EVM Initialized and all accounts are set up.")
+// command is a subcommand of the prevm binary.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
 
-	// ===================================================================
-	// --- TRANSACTION 1: Account A calls the contract ---
-	// ===================================================================
-	logger.Info("--- Processing Tx 1: Account A calls contract ---")
-	tx1 := &Transaction{
-		Nonce:    0, // Account A's first transaction
-		GasLimit: 100000,
-		To:       &contractAddr,
-		Value:    big.NewInt(4400),
-		Data:     []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
-	}
+var commands = []*command{
+	{name: "run", usage: "run bytecode and print its result", run: runCommand},
+	{name: "debug", usage: "step through bytecode in an interactive debugger", run: debugCommand},
+	{name: "disasm", usage: "disassemble bytecode", run: disasmCommand},
+	{name: "asm", usage: "assemble mnemonics into bytecode", run: asmCommand},
+	{name: "serve", usage: "serve a local chain over JSON-RPC", run: serveCommand},
+	{name: "demo", usage: "run the sample transactions", run: func([]string) error { runDemo(); return nil }},
+}
 
-	_, gasUsed1, err1 := evm.ProcessTransaction(tx1, accountA_Addr)
-	if err1 != nil {
-		logger.Error("EVM execution failed for Tx 1", "error", err1)
-	} else {
-		logger.Info("Tx 1 successful!")
-		logger.Info("Gas Used", "amount", gasUsed1)
-		logger.Info("Account A Nonce after Tx 1", "nonce", state.GetAccount(accountA_Addr).Nonce)
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
 	}
-
-	fmt.Println() // Add a blank line for readability
-
-	// ===================================================================
-	// --- TRANSACTION 2: Account B calls the same contract ---
-	// ===================================================================
-	bytecode = []byte{
-		PUSH10, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00,
-		POP,
-		CODESIZE,
+	name, args := os.Args[1], os.Args[2:]
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
 	}
-	// bytecode = []byte{
-	// 	PUSH1, 2,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 0,
-	// 	PUSH1, 1,
-	// 	SWAP10,
-	// 	CODESIZE,
-	// }
-
-	contractAccount.Code = bytecode
 
-	logger.Info("--- Processing Tx 2: Account B calls contract ---")
-	tx2 := &Transaction{
-		Nonce:    0, // Account B's first transaction
-		GasLimit: 100000,
-		To:       &contractAddr,
-		Value:    big.NewInt(3250),
-		Data:     []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "prevm %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		return
 	}
+	fmt.Fprintf(os.Stderr, "prevm: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
 
-	_, gasUsed2, err2 := evm.ProcessTransaction(tx2, accountB_Addr)
-	if err2 != nil {
-		logger.Error("EVM execution failed for Tx 2", "error", err2)
-	} else {
-		logger.Info("Tx 2 successful!")
-		logger.Info("Gas Used", "amount", gasUsed2)
-		logger.Info("Account B Nonce after Tx 2", "nonce", state.GetAccount(accountB_Addr).Nonce)
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: prevm <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
 	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'prevm <command> -h' for the flags of a command.")
 }
@@ -0,0 +1,425 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math/big"
+	"prevm/config"
+	"prevm/rlp"
+	"prevm/trie"
+	"runtime/debug"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultChainID is the chain id of a Node whose genesis doesn't set one.
+const DefaultChainID = 1337
+
+var (
+	ErrAlreadyKnown    = errors.New("already known")
+	ErrUnknownBlock    = errors.New("unknown block")
+	ErrHistoricalState = errors.New("historical state not available")
+	ErrInternal        = errors.New("internal error")
+)
+
+// EmptyUncleHash is the hash of an empty list of uncles.
+var EmptyUncleHash = [32]byte(config.Hash(rlp.EncodeList()))
+
+// Block is a block of a Node's chain. Blocks never change once mined.
+type Block struct {
+	Number      uint64
+	Hash        [32]byte
+	ParentHash  [32]byte
+	Coinbase    [20]byte
+	StateRoot   [32]byte
+	TxRoot      [32]byte
+	ReceiptRoot [32]byte
+	Bloom       Bloom
+	Difficulty  *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Timestamp   uint64
+	ExtraData   []byte
+	MixHash     [32]byte
+	Nonce       uint64
+	BaseFee     *big.Int // nil before London
+
+	// The transactions of the block, with their senders and receipts.
+	Transactions []*Transaction
+	Senders      [][20]byte
+	Receipts     []*Receipt
+}
+
+// header returns the RLP encoding of the block header. London and later
+// headers carry the fields of the forks up to Cancun, all empty but the
+// base fee.
+func (b *Block) header() []byte {
+	fields := [][]byte{
+		rlp.EncodeBytes(b.ParentHash[:]),
+		rlp.EncodeBytes(EmptyUncleHash[:]),
+		rlp.EncodeBytes(b.Coinbase[:]),
+		rlp.EncodeBytes(b.StateRoot[:]),
+		rlp.EncodeBytes(b.TxRoot[:]),
+		rlp.EncodeBytes(b.ReceiptRoot[:]),
+		rlp.EncodeBytes(b.Bloom[:]),
+		rlp.EncodeBigInt(b.Difficulty),
+		rlp.EncodeUint(b.Number),
+		rlp.EncodeUint(b.GasLimit),
+		rlp.EncodeUint(b.GasUsed),
+		rlp.EncodeUint(b.Timestamp),
+		rlp.EncodeBytes(b.ExtraData),
+		rlp.EncodeBytes(b.MixHash[:]),
+		rlp.EncodeBytes(new(big.Int).SetUint64(b.Nonce).FillBytes(make([]byte, 8))),
+	}
+	if b.BaseFee != nil {
+		withdrawalsRoot := trie.EmptyRoot
+		var parentBeaconRoot [32]byte
+		fields = append(fields,
+			rlp.EncodeBigInt(b.BaseFee),
+			rlp.EncodeBytes(withdrawalsRoot[:]),
+			rlp.EncodeUint(0), // blob gas used
+			rlp.EncodeUint(0), // excess blob gas
+			rlp.EncodeBytes(parentBeaconRoot[:]),
+		)
+	}
+	return rlp.EncodeList(fields...)
+}
+
+// Node is a local chain that mines a block for every transaction it is
+// sent, as development nodes do. It is safe for concurrent use.
+//
+// Only the state of the latest block is kept.
+type Node struct {
+	// Config is the EVM configuration transactions and calls run with.
+	Config Config
+
+	mu        sync.Mutex
+	state     *StateDB
+	chainID   *big.Int
+	blocks    []*Block // by number, from the genesis block
+	byHash    map[[32]byte]*Block
+	txs       map[[32]byte]txLocation
+	logs      *LogIndex
+	listeners map[int]func(*Block)
+	nextID    int
+}
+
+// txLocation is the position of a transaction in the chain.
+type txLocation struct {
+	block *Block
+	index int
+}
+
+// NewNode returns a Node whose chain starts at genesis, on top of state.
+// The accounts of genesis are only applied to a state without any, so that
+// the state of a database carries over from a previous run. Its blocks
+// don't: the chain starts again at the genesis block.
+func NewNode(genesis *Genesis, state *StateDB) *Node {
+	if !state.hasAccounts() {
+		genesis.Apply(state)
+	}
+
+	n := &Node{
+		state:     state,
+		chainID:   big.NewInt(DefaultChainID),
+		byHash:    make(map[[32]byte]*Block),
+		txs:       make(map[[32]byte]txLocation),
+		logs:      NewLogIndex(),
+		listeners: make(map[int]func(*Block)),
+	}
+	if genesis.Config != nil && genesis.Config.ChainID != nil {
+		n.chainID = new(big.Int).Set(genesis.Config.ChainID)
+	}
+
+	block := &Block{
+		Number:      genesis.Number,
+		ParentHash:  genesis.ParentHash,
+		Coinbase:    genesis.Coinbase,
+		StateRoot:   state.StateRoot(),
+		TxRoot:      trie.EmptyRoot,
+		ReceiptRoot: trie.EmptyRoot,
+		Difficulty:  new(big.Int),
+		GasLimit:    genesis.GasLimit,
+		GasUsed:     genesis.GasUsed,
+		Timestamp:   genesis.Timestamp,
+		ExtraData:   genesis.ExtraData,
+		MixHash:     genesis.Mixhash,
+		Nonce:       genesis.Nonce,
+	}
+	if genesis.Difficulty != nil {
+		block.Difficulty.Set(genesis.Difficulty)
+	}
+	if genesis.BaseFee != nil {
+		block.BaseFee = new(big.Int).Set(genesis.BaseFee)
+	}
+	block.Hash = [32]byte(config.Hash(block.header()))
+	n.addBlock(block)
+	return n
+}
+
+// ChainID returns the chain id of the node.
+func (n *Node) ChainID() *big.Int {
+	return new(big.Int).Set(n.chainID)
+}
+
+// Genesis returns the first block of the chain.
+func (n *Node) Genesis() *Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.blocks[0]
+}
+
+// Head returns the latest block.
+func (n *Node) Head() *Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.head()
+}
+
+func (n *Node) head() *Block {
+	return n.blocks[len(n.blocks)-1]
+}
+
+// BlockByNumber returns the block with the given number, or nil.
+func (n *Node) BlockByNumber(number uint64) *Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.blockByNumber(number)
+}
+
+func (n *Node) blockByNumber(number uint64) *Block {
+	first := n.blocks[0].Number
+	if number < first || number-first >= uint64(len(n.blocks)) {
+		return nil
+	}
+	return n.blocks[number-first]
+}
+
+// BlockByHash returns the block with the given hash, or nil.
+func (n *Node) BlockByHash(hash [32]byte) *Block {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.byHash[hash]
+}
+
+// Transaction returns the block holding the transaction with the given
+// hash and its index in the block, or nil.
+func (n *Node) Transaction(hash [32]byte) (*Block, int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	loc, ok := n.txs[hash]
+	if !ok {
+		return nil, 0
+	}
+	return loc.block, loc.index
+}
+
+// ReadState calls fn with the state of the latest block, which fn must not
+// modify or keep.
+func (n *Node) ReadState(fn func(state *StateDB)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fn(n.state)
+}
+
+// Call runs msg on top of the latest block, with the overrides if not nil,
+// without changing the state.
+func (n *Node) Call(msg *CallMsg, overrides *CallOverrides) (res *ExecutionResult, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer recoverPanic(&err)
+	return DoCall(n.state, n.blockContext(n.head()), msg, n.Config, overrides)
+}
+
+// EstimateGas returns the lowest gas limit msg succeeds with on top of the
+// head block, with the overrides if not nil. See EstimateGas.
+func (n *Node) EstimateGas(msg *CallMsg, overrides *CallOverrides) (gas uint64, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer recoverPanic(&err)
+	return EstimateGas(n.state, n.blockContext(n.head()), msg, n.Config, overrides)
+}
+
+// CreateAccessList returns the access list of msg on top of the head block,
+// with the overrides if not nil, and the result of msg run with it. See
+// CreateAccessList.
+func (n *Node) CreateAccessList(msg *CallMsg, overrides *CallOverrides) (list AccessList, res *ExecutionResult, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	defer recoverPanic(&err)
+	return CreateAccessList(n.state, n.blockContext(n.head()), msg, n.Config, overrides)
+}
+
+// SendTransaction mines a block holding tx and returns the hash of tx.
+// Invalid transactions are rejected with their error and leave the chain
+// unchanged.
+func (n *Node) SendTransaction(tx *Transaction) ([32]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	hash := tx.Hash()
+	if _, ok := n.txs[hash]; ok {
+		return hash, fmt.Errorf("%w: 0x%x", ErrAlreadyKnown, hash)
+	}
+	sender, err := tx.Sender()
+	if err != nil {
+		return hash, err
+	}
+
+	parent := n.head()
+	ctx := n.blockContext(&Block{
+		Number:    parent.Number + 1,
+		Timestamp: max(uint64(time.Now().Unix()), parent.Timestamp+1),
+		GasLimit:  parent.GasLimit,
+		BaseFee:   CalcBaseFee(parent.GasLimit, parent.GasUsed, parent.BaseFee),
+		MixHash:   parent.Hash,
+	})
+	res, err := n.applyBlock(ctx, tx)
+	if err != nil {
+		return hash, err
+	}
+	if len(res.Rejected) > 0 {
+		return hash, res.Rejected[0].Err
+	}
+	if err := n.state.Commit(); err != nil {
+		return hash, err
+	}
+
+	block := &Block{
+		Number:       ctx.Number.Uint64(),
+		ParentHash:   parent.Hash,
+		StateRoot:    res.StateRoot,
+		TxRoot:       res.TxRoot,
+		ReceiptRoot:  res.ReceiptRoot,
+		Bloom:        res.Bloom,
+		Difficulty:   new(big.Int),
+		GasLimit:     parent.GasLimit,
+		GasUsed:      res.GasUsed,
+		Timestamp:    ctx.Timestamp.Uint64(),
+		MixHash:      parent.Hash,
+		BaseFee:      ctx.BaseFee,
+		Transactions: res.Transactions,
+		Senders:      [][20]byte{sender},
+		Receipts:     res.Receipts,
+	}
+	block.Hash = [32]byte(config.Hash(block.header()))
+	for _, receipt := range block.Receipts {
+		receipt.BlockHash = block.Hash
+		for _, log := range receipt.Logs {
+			log.BlockHash, log.BlockNumber = block.Hash, block.Number
+		}
+	}
+	n.addBlock(block)
+
+	logger.Debug("Mined block", "number", block.Number, "hash", fmt.Sprintf("0x%x", block.Hash), "tx", fmt.Sprintf("0x%x", hash))
+	return hash, nil
+}
+
+// applyBlock applies a block holding tx to the state. If it panics, the
+// changes of the transaction are reverted and the state is left as it was
+// before.
+func (n *Node) applyBlock(ctx *BlockContext, tx *Transaction) (res *BlockResult, err error) {
+	defer func() {
+		// Prepare starts the journal afresh for the transaction and a panic
+		// comes before it is finalised, so the whole journal holds its
+		// changes.
+		if errors.Is(err, ErrInternal) {
+			n.state.RevertToSnapshot(0)
+		}
+	}()
+	defer recoverPanic(&err)
+
+	p := NewBlockProcessor(n.state)
+	p.Config = n.Config
+	return p.ApplyBlock(ctx, []*Transaction{tx}, nil)
+}
+
+// recoverPanic turns a panic into an ErrInternal error in err, so that a
+// bug hit by a call or transaction fails that request rather than the
+// node. It must be deferred.
+func recoverPanic(err *error) {
+	if r := recover(); r != nil {
+		logger.Error("Recovered from panic", "panic", r, "stack", string(debug.Stack()))
+		*err = fmt.Errorf("%w: %v", ErrInternal, r)
+	}
+}
+
+// addBlock appends block to the chain and hands it to the listeners.
+func (n *Node) addBlock(block *Block) {
+	n.blocks = append(n.blocks, block)
+	n.byHash[block.Hash] = block
+	for i, tx := range block.Transactions {
+		n.txs[tx.Hash()] = txLocation{block: block, index: i}
+	}
+	for _, receipt := range block.Receipts {
+		n.logs.Add(receipt.Logs...)
+	}
+	for _, id := range slices.Sorted(maps.Keys(n.listeners)) {
+		n.listeners[id](block)
+	}
+}
+
+// OnBlock registers fn to be called with every block mined from now on,
+// in order, after the functions registered before it. fn is called with
+// the node locked: it must neither block nor call the node. The returned
+// function unregisters fn.
+func (n *Node) OnBlock(fn func(block *Block)) (cancel func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	id := n.nextID
+	n.nextID++
+	n.listeners[id] = fn
+	return func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.listeners, id)
+	}
+}
+
+// blockContext returns the context transactions of block run in.
+func (n *Node) blockContext(block *Block) *BlockContext {
+	ctx := &BlockContext{
+		Coinbase:    block.Coinbase,
+		Number:      new(big.Int).SetUint64(block.Number),
+		Timestamp:   new(big.Int).SetUint64(block.Timestamp),
+		Difficulty:  new(big.Int).SetBytes(block.MixHash[:]),
+		GasLimit:    new(big.Int).SetUint64(block.GasLimit),
+		ChainID:     n.ChainID(),
+		BlobBaseFee: CalcBlobFee(0),
+		GetHash:     n.getHash,
+	}
+	if block.Difficulty != nil && block.Difficulty.Sign() != 0 {
+		ctx.Difficulty.Set(block.Difficulty)
+	}
+	if block.BaseFee != nil {
+		ctx.BaseFee = new(big.Int).Set(block.BaseFee)
+	}
+	return ctx
+}
+
+// getHash is the BLOCKHASH lookup of the chain. It runs with n.mu held.
+func (n *Node) getHash(number uint64) [32]byte {
+	if block := n.blockByNumber(number); block != nil {
+		return block.Hash
+	}
+	return [32]byte{}
+}
+
+// Logs returns the logs of the chain matching q, in order.
+func (n *Node) Logs(q *FilterQuery) ([]*Log, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if q.BlockHash != nil {
+		block := n.byHash[*q.BlockHash]
+		if block == nil {
+			return nil, fmt.Errorf("%w: 0x%x", ErrUnknownBlock, *q.BlockHash)
+		}
+		byNumber := *q
+		byNumber.FromBlock, byNumber.ToBlock = &block.Number, &block.Number
+		q = &byNumber
+	}
+	return n.logs.Query(q), nil
+}
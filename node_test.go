@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// panicTracer panics on the first storage write, like a bug in the middle
+// of a transaction.
+type panicTracer struct {
+	NoopTracer
+}
+
+func (panicTracer) OnStorageChange(addr [20]byte, slot, prev, value [32]byte) {
+	panic("storage write")
+}
+
+// transfer returns a signed transfer of value wei from the first
+// development account.
+func transfer(t *testing.T, nonce uint64, to [20]byte, value int64) *Transaction {
+	t.Helper()
+	key, _ := devKey(t, 0)
+	tx, err := SignTransaction(&Transaction{
+		Type:     LegacyTxType,
+		ChainID:  big.NewInt(DefaultChainID),
+		Nonce:    nonce,
+		GasLimit: 100000,
+		GasPrice: big.NewInt(2_000_000_000),
+		To:       &to,
+		Value:    big.NewInt(value),
+	}, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return tx
+}
+
+// TestNodePanic checks that a transaction that panics fails with
+// ErrInternal and leaves the state and the chain as they were.
+func TestNodePanic(t *testing.T) {
+	node := NewNode(DevGenesis(), NewStateDB())
+	_, sender := devKey(t, 0)
+	contract := [20]byte{19: 0xc0}
+	node.ReadState(func(state *StateDB) {
+		state.SetCode(contract, []byte{0x60, 0x01, 0x60, 0x00, 0x55}) // SSTORE(0, 1)
+		state.Finalise()
+	})
+	var balance *big.Int
+	node.ReadState(func(state *StateDB) { balance = new(big.Int).Set(state.GetBalance(sender)) })
+
+	node.Config.Tracer = panicTracer{}
+	if _, err := node.SendTransaction(transfer(t, 0, contract, 5)); !errors.Is(err, ErrInternal) {
+		t.Fatalf("Expected %v, got %v", ErrInternal, err)
+	}
+	node.ReadState(func(state *StateDB) {
+		if got := state.GetBalance(sender); got.Cmp(balance) != 0 {
+			t.Errorf("Expected the balance %d, got %d", balance, got)
+		}
+		if got := state.GetNonce(sender); got != 0 {
+			t.Errorf("Expected nonce 0, got %d", got)
+		}
+		if got := state.GetBalance(contract); got.Sign() != 0 {
+			t.Errorf("Expected no value sent, got %d", got)
+		}
+		if got := state.GetStorage(contract, [32]byte{}); len(got) != 0 {
+			t.Errorf("Expected an empty slot, got %x", got)
+		}
+	})
+	if head := node.Head().Number; head != 0 {
+		t.Errorf("Expected no block mined, got block %d", head)
+	}
+
+	// The same transaction goes through once the bug is gone.
+	node.Config.Tracer = nil
+	if _, err := node.SendTransaction(transfer(t, 0, contract, 5)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	node.ReadState(func(state *StateDB) {
+		if got := state.GetBalance(contract).Int64(); got != 5 {
+			t.Errorf("Expected balance 5, got %d", got)
+		}
+	})
+}
+
+// TestNodeDatadir checks that the state of mined blocks is committed to
+// the database, and that a node opening it again keeps it rather than
+// applying the genesis.
+func TestNodeDatadir(t *testing.T) {
+	datadir := t.TempDir()
+	to := [20]byte{19: 0x2a}
+	_, sender := devKey(t, 0)
+
+	state, closeDB, err := openState(datadir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	node := NewNode(DevGenesis(), state)
+	if _, err := node.SendTransaction(transfer(t, 0, to, 1000)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var balance *big.Int
+	node.ReadState(func(state *StateDB) { balance = new(big.Int).Set(state.GetBalance(sender)) })
+	if err := closeDB(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	state, closeDB, err = openState(datadir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer closeDB()
+	node = NewNode(DevGenesis(), state)
+	node.ReadState(func(state *StateDB) {
+		if got := state.GetBalance(to).Int64(); got != 1000 {
+			t.Errorf("Expected balance 1000, got %d", got)
+		}
+		if got := state.GetBalance(sender); got.Cmp(balance) != 0 {
+			t.Errorf("Expected the sender to have paid for the transaction, %d, got %d", balance, got)
+		}
+		if got := state.GetNonce(sender); got != 1 {
+			t.Errorf("Expected nonce 1, got %d", got)
+		}
+	})
+	if root := node.Genesis().StateRoot; root != state.StateRoot() {
+		t.Errorf("Expected the genesis block to hold the state root 0x%x, got 0x%x", state.StateRoot(), root)
+	}
+}
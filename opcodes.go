@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"prevm/config"
@@ -11,6 +12,13 @@ type Opcode interface {
 	Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error
 }
 
+// DynamicGas is implemented by opcodes whose cost depends on their operands
+// or on the state. It returns the cost on top of the static cost in
+// GasCosts, which is charged with it before the opcode runs.
+type DynamicGas interface {
+	DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error)
+}
+
 var logger = config.Logger
 
 // ====================================
@@ -28,16 +36,11 @@ func (o *Stop) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *
 type Add struct{}
 
 func (o *Add) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-
-	logger.Debug(fmt.Sprintln(ec.Stack.Display()))
-
 	x := ec.Stack.Pop()
 	y := ec.Stack.Pop()
 	res := new(big.Int).Add(x, y)
 	ec.Stack.Push(res)
 
-	logger.Info("Result:", "ADD", res)
-
 	return nil
 }
 
@@ -45,15 +48,11 @@ func (o *Add) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *T
 type Sub struct{}
 
 func (o *Sub) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	logger.Debug("Stack", "Data", ec.Stack.GetData())
-
 	x := ec.Stack.Pop()
 	y := ec.Stack.Pop()
 	res := new(big.Int).Sub(x, y)
 	ec.Stack.Push(res)
 
-	logger.Info("Result:", "SUB", res)
-
 	return nil
 }
 
@@ -203,18 +202,25 @@ func (o *MulMod) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx
 type Exp struct{}
 
 func (o *Exp) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	// The items are popped in reverse order: N, then y, then x.
-	y := ec.Stack.Pop()
-	x := ec.Stack.Pop()
+	// The base is on top of the exponent. The result wraps at 2^256, which
+	// also keeps a large exponent from blowing up.
+	x := new(big.Int).And(ec.Stack.Pop(), wordMask)
+	y := new(big.Int).And(ec.Stack.Pop(), wordMask)
 
-	res := new(big.Int).Exp(x, y, nil)
+	res := new(big.Int).Exp(x, y, maxU256)
 
 	ec.Stack.Push(res)
-	logger.Debug(fmt.Sprintln(ec.Stack.Display()))
 
 	return nil
 }
 
+// DynamicGas charges 50 gas per byte of the exponent (EIP-160).
+func (o *Exp) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	exponent := new(big.Int).And(stack[len(stack)-2], wordMask)
+	return uint64((exponent.BitLen()+7)/8) * ExpByteGas, nil
+}
+
 // ==============
 // --- SHA-3 ---
 // ==============
@@ -229,11 +235,14 @@ func (o *Keccak) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx
 
 	ec.Stack.Push(new(big.Int).SetBytes(hash))
 
-	logger.Debug("KECCAK", "data", fmt.Sprintf("0x%x", data), "hash", fmt.Sprintf("0x%x", hash))
-
 	return nil
 }
 
+func (o *Keccak) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	return memoryOpGas(ec, stack[len(stack)-1], stack[len(stack)-2], Keccak256WordGas)
+}
+
 // =================================
 // --- ENVIRONMENTAL OPERATIONS ---
 // =================================
@@ -244,8 +253,6 @@ func (o *Address) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, t
 	addr := new(big.Int).SetBytes(ec.Address[:])
 	ec.Stack.Push(addr)
 
-	logger.Debug("ADDRESS", "address", fmt.Sprintf("0x%x", addr))
-
 	return nil
 }
 
@@ -253,22 +260,21 @@ func (o *Address) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, t
 type Balance struct{}
 
 func (o *Balance) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	var address [20]byte
+	address := toAddress(ec.Stack.Pop())
 
-	addressInt := ec.Stack.Pop()
-	addressBytes := addressInt.Bytes()
-	copy(address[20-len(addressBytes):], addressBytes)
-
-	account := evm.State.GetAccount(address)
-	bal := account.Balance
-
-	logger.Debug("BALANCE", "address", fmt.Sprintf("0x%x", address), "balance", fmt.Sprintf("%d WEI", bal))
+	bal := evm.State.GetBalance(address)
 
 	ec.Stack.Push(bal)
 
 	return nil
 }
 
+// DynamicGas charges the cold access of the account (EIP-2929).
+func (o *Balance) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	return accountAccessGas(evm, toAddress(stack[len(stack)-1])), nil
+}
+
 // Origin (0x32)
 type Origin struct{}
 
@@ -285,8 +291,6 @@ type Caller struct{}
 func (o *Caller) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
 	callAddr := ec.Caller
 
-	logger.Debug("CALLER", "address", fmt.Sprintf("0x%x", callAddr))
-
 	addrInt := new(big.Int).SetBytes(callAddr[:])
 
 	ec.Stack.Push(addrInt)
@@ -298,11 +302,7 @@ func (o *Caller) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx
 type CallValue struct{}
 
 func (o *CallValue) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	value := tx.Value
-
-	logger.Debug("CALLVALUE", "value", fmt.Sprintf("%d WEI", value))
-
-	ec.Stack.Push(value)
+	ec.Stack.Push(new(big.Int).Set(ec.CallValue))
 
 	return nil
 }
@@ -311,13 +311,15 @@ func (o *CallValue) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext,
 type CallDataLoad struct{}
 
 func (o *CallDataLoad) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	offset := ec.Stack.Pop().Uint64()
-
-	data := new(big.Int).SetBytes(tx.Data[offset:])
+	offset := ec.Stack.Pop()
 
-	logger.Debug("CALLDATALOAD", "data", fmt.Sprintf("%X", data))
+	// Bytes past the end of the call data read as zero.
+	var data []byte
+	if offset.IsUint64() {
+		data = getData(ec.CallData, offset.Uint64(), 32)
+	}
 
-	ec.Stack.Push(data)
+	ec.Stack.Push(new(big.Int).SetBytes(data))
 
 	return nil
 }
@@ -326,14 +328,7 @@ func (o *CallDataLoad) Execute(evm *EVM, ec *ExecutionContext, block *BlockConte
 type CallDataSize struct{}
 
 func (o *CallDataSize) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	offset := ec.Stack.Pop().Uint64()
-
-	data := tx.Data[offset:]
-	size := len(data)
-
-	logger.Debug("CALLDATASIZE", "data", fmt.Sprintf("%X", data), "size", size)
-
-	ec.Stack.Push(new(big.Int).SetInt64(int64(size)))
+	ec.Stack.Push(new(big.Int).SetInt64(int64(len(ec.CallData))))
 
 	return nil
 }
@@ -346,30 +341,20 @@ func (o *CallDataCopy) Execute(evm *EVM, ec *ExecutionContext, block *BlockConte
 	offset := ec.Stack.Pop().Uint64()
 	size := ec.Stack.Pop().Uint64()
 
-	dataToCopy := make([]byte, size)
-
-	calldataEnd := uint64(len(tx.Data))
-
-	if offset < calldataEnd {
-		copyEnd := min(offset+size,
-			calldataEnd)
-		copy(dataToCopy, tx.Data[offset:copyEnd])
-	}
-	// logger.Debug("CALLDATACOPY", "data", fmt.Sprintf("%x", dataToCopy))
-
-	ec.Memory.Set(destOffset, dataToCopy)
-
-	logger.Debug("CALLDATACOPY", "memory", ec.Memory.Display())
+	ec.Memory.Set(destOffset, getData(ec.CallData, offset, size))
 
 	return nil
 }
 
+func (o *CallDataCopy) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return copyGas(ec)
+}
+
 // CodeSize (0x38)
 type CodeSize struct{}
 
 func (o *CodeSize) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
 	len := new(big.Int).SetUint64(uint64(len(ec.Bytecode)))
-	logger.Debug("CODESIZE", "size", fmt.Sprint(len))
 
 	ec.Stack.Push(len)
 
@@ -380,13 +365,26 @@ func (o *CodeSize) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext,
 type CodeCopy struct{}
 
 func (o *CodeCopy) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	code := ec.Bytecode
+	destOffset := ec.Stack.Pop().Uint64()
+	offset := ec.Stack.Pop().Uint64()
+	size := ec.Stack.Pop().Uint64()
 
-	ec.Memory.Set(0, code)
+	ec.Memory.Set(destOffset, getData(ec.Bytecode, offset, size))
 
 	return nil
 }
 
+func (o *CodeCopy) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return copyGas(ec)
+}
+
+// copyGas returns the cost of the memory a *COPY opcode writes to and of
+// the words it copies.
+func copyGas(ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	return memoryOpGas(ec, stack[len(stack)-1], stack[len(stack)-3], CopyGas)
+}
+
 // GasPrice (0x3A)
 type GasPrice struct{}
 
@@ -398,6 +396,38 @@ func (o *GasPrice) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext,
 	return nil
 }
 
+// ReturnDataSize (0x3d)
+type ReturnDataSize struct{}
+
+func (o *ReturnDataSize) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	ec.Stack.Push(new(big.Int).SetInt64(int64(len(ec.LastReturnData))))
+
+	return nil
+}
+
+// ReturnDataCopy (0x3e)
+type ReturnDataCopy struct{}
+
+func (o *ReturnDataCopy) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	destOffset := ec.Stack.Pop().Uint64()
+	offset := ec.Stack.Pop()
+	size := ec.Stack.Pop()
+
+	// Unlike the other copies, reading past the end is an error (EIP-211).
+	end := new(big.Int).Add(offset, size)
+	if !end.IsUint64() || end.Uint64() > uint64(len(ec.LastReturnData)) {
+		return ErrReturnDataOutOfBounds
+	}
+
+	ec.Memory.Set(destOffset, ec.LastReturnData[offset.Uint64():end.Uint64()])
+
+	return nil
+}
+
+func (o *ReturnDataCopy) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return copyGas(ec)
+}
+
 // =========================
 // --- BLOCK OPERATIONS ---
 // =========================
@@ -405,7 +435,21 @@ func (o *GasPrice) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext,
 type BlockHash struct{}
 
 func (o *BlockHash) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	panic("unimplemented")
+	num := ec.Stack.Pop()
+
+	// Only the 256 most recent complete blocks are available; anything
+	// else pushes zero.
+	if block.GetHash == nil || block.Number == nil || !num.IsUint64() || num.Cmp(block.Number) >= 0 {
+		ec.Stack.Push(new(big.Int))
+		return nil
+	}
+	if new(big.Int).Sub(block.Number, num).Cmp(big.NewInt(256)) > 0 {
+		ec.Stack.Push(new(big.Int))
+		return nil
+	}
+
+	hash := block.GetHash(num.Uint64())
+	ec.Stack.Push(new(big.Int).SetBytes(hash[:]))
 
 	return nil
 }
@@ -429,8 +473,6 @@ func (o *TimeStamp) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext,
 
 	ec.Stack.Push(time)
 
-	logger.Debug("TIMESTAMP", "unix", time)
-
 	return nil
 }
 
@@ -460,7 +502,13 @@ func (o *PrevRandao) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext
 type GasLimit struct{}
 
 func (o *GasLimit) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	ec.ReturnData = block.GasLimit.Bytes()
+	gasLimit := new(big.Int)
+	if block.GasLimit != nil {
+		gasLimit.Set(block.GasLimit)
+	}
+
+	ec.Stack.Push(gasLimit)
+
 	return nil
 }
 
@@ -480,13 +528,10 @@ type SelfBalance struct{}
 
 func (o *SelfBalance) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
 	addr := ec.Address
-	account := evm.State.GetAccount(addr)
-	bal := account.Balance
+	bal := evm.State.GetBalance(addr)
 
 	ec.Stack.Push(bal)
 
-	logger.Debug("SELFBALANCE", "address", addr, "balance", bal)
-
 	return nil
 }
 
@@ -498,8 +543,6 @@ func (o *BaseFee) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, t
 
 	ec.Stack.Push(baseFee)
 
-	logger.Debug("BASEFEE", "fee", baseFee)
-
 	return nil
 }
 
@@ -507,7 +550,17 @@ func (o *BaseFee) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, t
 type BlobHash struct{}
 
 func (o *BlobHash) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
-	panic("unimplemented")
+	index := ec.Stack.Pop()
+
+	// Out of range indices push zero.
+	if !index.IsUint64() || index.Uint64() >= uint64(len(tx.BlobHashes)) {
+		ec.Stack.Push(new(big.Int))
+		return nil
+	}
+
+	hash := tx.BlobHashes[index.Uint64()]
+	ec.Stack.Push(new(big.Int).SetBytes(hash[:]))
+
 	return nil
 }
 
@@ -536,20 +589,187 @@ func (o *Mload) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx
 	return nil
 }
 
+// wordSize is the size of the memory MLOAD and MSTORE work on.
+var wordSize = big.NewInt(32)
+
+func (o *Mload) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	return memoryOpGas(ec, stack[len(stack)-1], wordSize, 0)
+}
+
 // MStore (0x52)
 type Mstore struct{}
 
 func (o *Mstore) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
 	offset := ec.Stack.Pop().Uint64()
-	value := ec.Stack.Pop()
+	value := toWord256(ec.Stack.Pop())
+
+	ec.Memory.Set(offset, value[:])
+
+	return nil
+}
+
+func (o *Mstore) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	return memoryOpGas(ec, stack[len(stack)-1], wordSize, 0)
+}
+
+// Storage gas costs (EIP-2200, with the warm access costs of EIP-2929 and
+// the reduced refunds of EIP-3529).
+const (
+	WarmStorageReadCost        = 100
+	SstoreSetGas               = 20000
+	SstoreResetGas             = 2900
+	SstoreSentryGas            = 2300
+	SstoreClearsScheduleRefund = 4800
+)
+
+// SLoad (0x54)
+type Sload struct{}
+
+func (o *Sload) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	slot := toWord256(ec.Stack.Pop())
+	value := evm.State.GetStorage(ec.Address, slot)
+	if t := evm.Config.Tracer; t != nil {
+		t.OnStorageRead(ec.Address, slot, toWord(value))
+	}
+
+	ec.Stack.Push(new(big.Int).SetBytes(value))
+
+	return nil
+}
+
+// DynamicGas charges the cold access of the slot (EIP-2929).
+func (o *Sload) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	if evm.State.WarmSlot(ec.Address, toWord256(stack[len(stack)-1])) {
+		return ColdSloadCost - WarmStorageReadCost, nil
+	}
+	return 0, nil
+}
 
-	ec.Memory.Set32(offset, value)
+// SStore (0x55)
+type Sstore struct{}
 
-	logger.Debug("Memory", ec.Memory.Display())
+func (o *Sstore) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	if ec.IsStatic {
+		return ErrWriteProtection
+	}
+
+	slot := toWord256(ec.Stack.Pop())
+	newValue := toWord256(ec.Stack.Pop())
+
+	current := toWord(evm.State.GetStorage(ec.Address, slot))
+	original := toWord(evm.State.GetCommittedStorage(ec.Address, slot))
+	sstoreRefund(evm.State, original, current, newValue)
+
+	evm.State.SetStorage(ec.Address, slot, newValue[:])
 
 	return nil
 }
 
+func (o *Sstore) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	// EIP-2200: SSTORE fails if no more than the call stipend is left.
+	if ec.Gas <= SstoreSentryGas {
+		return 0, ErrOutOfGas
+	}
+
+	stack := ec.Stack.GetData()
+	slot := toWord256(stack[len(stack)-1])
+	value := toWord256(stack[len(stack)-2])
+	current := toWord(evm.State.GetStorage(ec.Address, slot))
+	original := toWord(evm.State.GetCommittedStorage(ec.Address, slot))
+
+	gas := sstoreGas(original, current, value) - GasCosts[SSTORE]
+	// A cold slot is charged its access on top (EIP-2929).
+	if evm.State.WarmSlot(ec.Address, slot) {
+		gas += ColdSloadCost
+	}
+	return gas, nil
+}
+
+// sstoreGas returns the cost of an SSTORE (EIP-2200).
+func sstoreGas(original, current, value [32]byte) uint64 {
+	var zero [32]byte
+
+	switch {
+	case current == value: // no-op
+		return WarmStorageReadCost
+	case original == current && original == zero: // first write in this transaction
+		return SstoreSetGas
+	case original == current:
+		return SstoreResetGas
+	}
+	// The slot was already written in this transaction.
+	return WarmStorageReadCost
+}
+
+// sstoreRefund adjusts the refund counter for an SSTORE (EIP-3529).
+func sstoreRefund(state *StateDB, original, current, value [32]byte) {
+	var zero [32]byte
+
+	if current == value {
+		return
+	}
+	if original == current { // first write in this transaction
+		if original != zero && value == zero {
+			state.AddRefund(SstoreClearsScheduleRefund)
+		}
+		return
+	}
+
+	// The slot was already written in this transaction.
+	if original != zero {
+		if current == zero {
+			state.SubRefund(SstoreClearsScheduleRefund)
+		} else if value == zero {
+			state.AddRefund(SstoreClearsScheduleRefund)
+		}
+	}
+	if original == value { // reset to the original value
+		if original == zero {
+			state.AddRefund(SstoreSetGas - WarmStorageReadCost)
+		} else {
+			state.AddRefund(SstoreResetGas - WarmStorageReadCost)
+		}
+	}
+}
+
+// Jump (0x56)
+type Jump struct{}
+
+func (o *Jump) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	dest := ec.Stack.Pop()
+	if !ec.validJumpdest(dest) {
+		return fmt.Errorf("%w: %v", ErrInvalidJump, dest)
+	}
+	ec.PC = dest.Uint64()
+	return nil
+}
+
+// JumpI (0x57)
+type Jumpi struct{}
+
+func (o *Jumpi) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	dest := ec.Stack.Pop()
+	cond := ec.Stack.Pop()
+	if cond.Sign() == 0 {
+		return nil
+	}
+	if !ec.validJumpdest(dest) {
+		return fmt.Errorf("%w: %v", ErrInvalidJump, dest)
+	}
+	ec.PC = dest.Uint64()
+	return nil
+}
+
+// JumpDest (0x5b) only marks a valid jump destination.
+type JumpDest struct{}
+
+func (o *JumpDest) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	return nil
+}
+
 // PC (x058)
 type Pc struct{}
 
@@ -606,16 +826,320 @@ func (o *Swap) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *
 
 	ec.Stack.Swap(depth)
 
-	logger.Debug(fmt.Sprintf("SWAP%d", depth), ec.Stack.Display())
+	return nil
+}
+
+// ===========================
+// --- LOGGING OPERATIONS ---
+// ===========================
+// LogN handles all LOG opcodes from LOG0 (0xa0) to LOG4 (0xa4).
+type LogN struct{}
+
+func (o *LogN) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	opValue := ec.Bytecode[ec.PC-1]
+	numTopics := int(opValue - LOG0)
+
+	if ec.IsStatic {
+		return ErrWriteProtection
+	}
+
+	offset := ec.Stack.Pop().Uint64()
+	size := ec.Stack.Pop().Uint64()
+
+	topics := make([][32]byte, numTopics)
+	for i := range topics {
+		topics[i] = toWord256(ec.Stack.Pop())
+	}
+
+	log := &Log{
+		Address: ec.Address,
+		Topics:  topics,
+		Data:    append([]byte(nil), ec.Memory.Get(offset, size)...),
+	}
+	if block.Number != nil {
+		log.BlockNumber = block.Number.Uint64()
+	}
+	evm.State.AddLog(log)
 
 	return nil
 }
 
+// DynamicGas charges the memory of the data and 8 gas per byte of it; the
+// static cost covers the topics.
+func (o *LogN) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	end, size, err := memoryRange(stack[len(stack)-1], stack[len(stack)-2])
+	if err != nil {
+		return 0, err
+	}
+	gas, err := memoryGas(ec.Memory, end)
+	if err != nil {
+		return 0, err
+	}
+	// The memory cost bounds the size, so that this can't overflow.
+	return gas + size*LogDataGas, nil
+}
+
 // ==========================
 // --- SYSTEM OPERATIONS ---
 // ==========================
-// Call implements the CALL opcode (0xf1).
+// Create (0xf0) and Create2 (0xf5) deploy a contract from init code in
+// memory.
+type Create struct{}
+type Create2 struct{}
+
+func (o *Create) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return createGas(ec, false)
+}
+
+func (o *Create2) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return createGas(ec, true)
+}
+
+// createGas returns the cost of the memory holding the init code of a
+// CREATE or CREATE2 and of its words: 2 gas per word (EIP-3860), and 6
+// more per word hashed by CREATE2.
+func createGas(ec *ExecutionContext, hashed bool) (uint64, error) {
+	stack := ec.Stack.GetData()
+	size := new(big.Int).And(stack[len(stack)-3], wordMask)
+	if !size.IsUint64() || size.Uint64() > MaxInitCodeSize {
+		return 0, ErrMaxInitCodeSize
+	}
+	perWord := InitCodeWordGas
+	if hashed {
+		perWord += Keccak256WordGas
+	}
+	return memoryOpGas(ec, stack[len(stack)-2], size, perWord)
+}
+
+func (o *Create) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	return create(evm, ec, tx, CREATE)
+}
+
+func (o *Create2) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	return create(evm, ec, tx, CREATE2)
+}
+
+// create runs a CREATE or CREATE2 and pushes the address of the new
+// contract, or zero if it failed.
+func create(evm *EVM, ec *ExecutionContext, tx *TransactionContext, typ byte) error {
+	if ec.IsStatic {
+		return ErrWriteProtection
+	}
+
+	value := ec.Stack.Pop()
+	offset := ec.Stack.Pop().Uint64()
+	size := ec.Stack.Pop().Uint64()
+	f := &frame{
+		typ:    typ,
+		from:   ec.Address,
+		caller: ec.Address,
+		input:  append([]byte(nil), ec.Memory.Get(offset, size)...),
+		value:  value,
+		depth:  ec.Depth + 1,
+	}
+	if typ == CREATE2 {
+		f.salt = toWord256(ec.Stack.Pop())
+	}
+
+	// All but one 64th of the gas is passed on (EIP-150).
+	f.gas = ec.Gas - ec.Gas/64
+	ec.Gas -= f.gas
+
+	addr, ret, gasLeft, err := evm.runCreate(f, tx)
+	ec.Gas += gasLeft
+
+	if err == nil {
+		ec.Stack.Push(new(big.Int).SetBytes(addr[:]))
+	} else {
+		ec.Stack.Push(new(big.Int))
+	}
+	// Only a revert returns data to the creator.
+	ec.LastReturnData = nil
+	if errors.Is(err, ErrExecutionReverted) {
+		ec.LastReturnData = ret
+	}
+
+	return nil
+}
+
+// Call (0xf1), CallCode (0xf2), DelegateCall (0xf4) and StaticCall (0xfa)
+// run the code of another account.
 type Call struct{}
+type CallCode struct{}
+type DelegateCall struct{}
+type StaticCall struct{}
+
+func (o *Call) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return callGas(evm, ec, CALL)
+}
+
+func (o *CallCode) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return callGas(evm, ec, CALLCODE)
+}
+
+func (o *DelegateCall) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return callGas(evm, ec, DELEGATECALL)
+}
+
+func (o *StaticCall) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return callGas(evm, ec, STATICCALL)
+}
+
+// callGas returns the dynamic cost of a call: the memory of its input and
+// output, the cold access, value transfer and new account surcharges, plus
+// the gas passed on to the callee, which is kept in evm.callGasTemp for
+// Execute. The callee gets all but one 64th of the gas left after the
+// surcharges, or the gas asked for if less (EIP-150).
+func callGas(evm *EVM, ec *ExecutionContext, op byte) (uint64, error) {
+	stack := ec.Stack.GetData()
+	hasValue := op == CALL || op == CALLCODE
+
+	// The memory of the input and of the output.
+	args := len(stack) - 4
+	if !hasValue {
+		args++
+	}
+	argsEnd, _, err := memoryRange(stack[args], stack[args-1])
+	if err != nil {
+		return 0, err
+	}
+	retEnd, _, err := memoryRange(stack[args-2], stack[args-3])
+	if err != nil {
+		return 0, err
+	}
+	cost, err := memoryGas(ec.Memory, max(argsEnd, retEnd))
+	if err != nil {
+		return 0, err
+	}
+
+	to := toAddress(stack[len(stack)-2])
+	cost += accountAccessGas(evm, to)
+	// Calling an account that delegates its code (EIP-7702) also accesses
+	// the account it delegates to.
+	if target, ok := ParseDelegation(evm.State.GetCode(to)); ok {
+		cost += WarmStorageReadCost + accountAccessGas(evm, target)
+	}
+
+	if hasValue && stack[len(stack)-3].Sign() != 0 {
+		cost += CallValueTransferGas
+		if op == CALL && evm.State.Empty(to) {
+			cost += CallNewAccountGas
+		}
+	}
+
+	if ec.Gas < GasCosts[op]+cost {
+		return cost, nil // out of gas
+	}
+	available := ec.Gas - GasCosts[op] - cost
+	available -= available / 64
+
+	gas := available
+	if requested := new(big.Int).And(stack[len(stack)-1], wordMask); requested.IsUint64() && requested.Uint64() < gas {
+		gas = requested.Uint64()
+	}
+	evm.callGasTemp = gas
+
+	return cost + gas, nil
+}
+
+func (o *Call) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	ec.Stack.Pop() // gas, worked out by callGas
+	to := toAddress(ec.Stack.Pop())
+	value := ec.Stack.Pop()
+	if ec.IsStatic && value.Sign() != 0 {
+		return ErrWriteProtection
+	}
+
+	return call(evm, ec, tx, &frame{
+		typ:    CALL,
+		from:   ec.Address,
+		caller: ec.Address,
+		addr:   to,
+		code:   to,
+		value:  value,
+		static: ec.IsStatic,
+	})
+}
+
+func (o *CallCode) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	ec.Stack.Pop() // gas, worked out by callGas
+	to := toAddress(ec.Stack.Pop())
+	value := ec.Stack.Pop()
+
+	return call(evm, ec, tx, &frame{
+		typ:    CALLCODE,
+		from:   ec.Address,
+		caller: ec.Address,
+		addr:   ec.Address,
+		code:   to,
+		value:  value,
+		static: ec.IsStatic,
+	})
+}
+
+func (o *DelegateCall) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	ec.Stack.Pop() // gas, worked out by callGas
+	to := toAddress(ec.Stack.Pop())
+
+	// The callee runs with the caller and value of the current context.
+	return call(evm, ec, tx, &frame{
+		typ:    DELEGATECALL,
+		from:   ec.Address,
+		caller: ec.Caller,
+		addr:   ec.Address,
+		code:   to,
+		value:  ec.CallValue,
+		static: ec.IsStatic,
+	})
+}
+
+func (o *StaticCall) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	ec.Stack.Pop() // gas, worked out by callGas
+	to := toAddress(ec.Stack.Pop())
+
+	return call(evm, ec, tx, &frame{
+		typ:    STATICCALL,
+		from:   ec.Address,
+		caller: ec.Address,
+		addr:   to,
+		code:   to,
+		value:  new(big.Int),
+		static: true,
+	})
+}
+
+// call completes f with the input and gas of a CALL-family opcode, whose
+// gas and address operands have been popped, runs it and pushes 1 on
+// success or 0 on failure.
+func call(evm *EVM, ec *ExecutionContext, tx *TransactionContext, f *frame) error {
+	argsOffset := ec.Stack.Pop().Uint64()
+	argsSize := ec.Stack.Pop().Uint64()
+	retOffset := ec.Stack.Pop().Uint64()
+	retSize := ec.Stack.Pop().Uint64()
+
+	f.input = append([]byte(nil), ec.Memory.Get(argsOffset, argsSize)...)
+	f.gas = evm.callGasTemp
+	f.depth = ec.Depth + 1
+	if (f.typ == CALL || f.typ == CALLCODE) && f.value.Sign() != 0 {
+		f.gas += CallStipend
+	}
+
+	ret, gasLeft, err := evm.runCall(f, tx)
+	ec.Gas += gasLeft
+
+	if err == nil {
+		ec.Stack.Push(big.NewInt(1))
+	} else {
+		ec.Stack.Push(new(big.Int))
+	}
+	if err == nil || errors.Is(err, ErrExecutionReverted) {
+		copy(ec.Memory.Get(retOffset, retSize), ret)
+	}
+	ec.LastReturnData = ret
+
+	return nil
+}
 
 // Return (0xf3)
 type Return struct{}
@@ -626,9 +1150,8 @@ func (o *Return) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx
 
 	bytes := ec.Memory.Get(offset, size)
 
-	ec.ReturnData = bytes
-
-	logger.Debug("RETURN", "return_data", bytes)
+	ec.ReturnData = append([]byte(nil), bytes...)
+	ec.Stop()
 
 	// ec.Stack.Clear()
 	// ec.Memory.Clear()
@@ -637,6 +1160,35 @@ func (o *Return) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx
 
 }
 
+func (o *Return) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return returnGas(ec)
+}
+
+// Revert (0xfd)
+type Revert struct{}
+
+func (o *Revert) Execute(evm *EVM, ec *ExecutionContext, block *BlockContext, tx *TransactionContext) error {
+	offset := ec.Stack.Pop().Uint64()
+	size := ec.Stack.Pop().Uint64()
+
+	// Unlike other errors, REVERT hands its data and remaining gas back
+	// to the caller.
+	ec.ReturnData = append([]byte(nil), ec.Memory.Get(offset, size)...)
+	ec.Stop()
+
+	return ErrExecutionReverted
+}
+
+func (o *Revert) DynamicGas(evm *EVM, ec *ExecutionContext) (uint64, error) {
+	return returnGas(ec)
+}
+
+// returnGas returns the cost of the memory RETURN and REVERT return.
+func returnGas(ec *ExecutionContext) (uint64, error) {
+	stack := ec.Stack.GetData()
+	return memoryOpGas(ec, stack[len(stack)-1], stack[len(stack)-2], 0)
+}
+
 // EVM Opcodes as constants
 const (
 	// --- 0x00: Stop and Arithmetic Operations ---
@@ -700,6 +1252,8 @@ const (
 	CHAINID     = 0x46
 	SELFBALANCE = 0x47
 	BASEFEE     = 0x48
+	BLOBHASH    = 0x49
+	BLOBBASEFEE = 0x4a
 
 	// --- 0x50: Stack, Memory, Storage and Flow Operations ---
 	POP      = 0x50
@@ -714,6 +1268,10 @@ const (
 	MSIZE    = 0x59
 	GAS      = 0x5a
 	JUMPDEST = 0x5b
+	TLOAD    = 0x5c
+	TSTORE   = 0x5d
+	MCOPY    = 0x5e
+	PUSH0    = 0x5f
 
 	// --- 0x60 & 0x70: Push Operations ---
 	PUSH1  = 0x60
@@ -801,5 +1359,6 @@ const (
 	CREATE2      = 0xf5
 	STATICCALL   = 0xfa
 	REVERT       = 0xfd
+	INVALID      = 0xfe
 	SELFDESTRUCT = 0xff
 )
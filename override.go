@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"prevm/hexutil"
+)
+
+var ErrConflictingOverride = errors.New("conflicting override")
+
+// CallOverrides are the changes to the state and to the block a call runs
+// with, as in eth_call. They only apply to the call.
+type CallOverrides struct {
+	State StateOverride
+	Block *BlockOverrides
+}
+
+// StateOverride replaces parts of accounts for a call, keyed by address.
+type StateOverride map[[20]byte]OverrideAccount
+
+// OverrideAccount holds the fields of an account to replace; the others
+// are left as they are. State and StateDiff can't both be set.
+type OverrideAccount struct {
+	Balance *big.Int
+	Nonce   *uint64
+	Code    []byte // nil to keep the code, empty to remove it
+	// State replaces the whole storage.
+	State map[[32]byte][32]byte
+	// StateDiff replaces the given slots.
+	StateDiff map[[32]byte][32]byte
+}
+
+// Apply writes the overrides into state, as if they had always been
+// there. It must be called between transactions.
+func (o StateOverride) Apply(state *StateDB) error {
+	for addr, account := range o {
+		if account.State != nil && account.StateDiff != nil {
+			return fmt.Errorf("%w: account 0x%x has both state and stateDiff", ErrConflictingOverride, addr)
+		}
+	}
+	for addr, account := range o {
+		if account.Balance != nil {
+			state.SetBalance(addr, account.Balance)
+		}
+		if account.Nonce != nil {
+			state.SetNonce(addr, *account.Nonce)
+		}
+		if account.Code != nil {
+			state.SetCode(addr, append([]byte(nil), account.Code...))
+		}
+		slots := account.StateDiff
+		if account.State != nil {
+			// Hide the stored slots as well as the cached ones.
+			acc := state.getOrNewAccount(addr)
+			acc.Storage, acc.stored = make(map[[32]byte][]byte), false
+			slots = account.State
+		}
+		for slot, value := range slots {
+			state.SetStorage(addr, slot, append([]byte(nil), value[:]...))
+		}
+	}
+	// Like the genesis allocation, the overrides are where the call
+	// starts from: they are neither journaled nor a change of the call.
+	state.resetJournal()
+	return nil
+}
+
+// BlockOverrides replaces fields of the block a call runs in. nil fields
+// are left as they are.
+type BlockOverrides struct {
+	Number      *big.Int
+	Timestamp   *big.Int
+	GasLimit    *big.Int
+	Coinbase    *[20]byte
+	Random      *[32]byte // the PREVRANDAO value
+	BaseFee     *big.Int
+	BlobBaseFee *big.Int
+}
+
+// Apply writes the overrides into block.
+func (o *BlockOverrides) Apply(block *BlockContext) {
+	if o == nil {
+		return
+	}
+	if o.Number != nil {
+		block.Number = new(big.Int).Set(o.Number)
+	}
+	if o.Timestamp != nil {
+		block.Timestamp = new(big.Int).Set(o.Timestamp)
+	}
+	if o.GasLimit != nil {
+		block.GasLimit = new(big.Int).Set(o.GasLimit)
+	}
+	if o.Coinbase != nil {
+		block.Coinbase = *o.Coinbase
+	}
+	if o.Random != nil {
+		block.Difficulty = new(big.Int).SetBytes(o.Random[:])
+	}
+	if o.BaseFee != nil {
+		block.BaseFee = new(big.Int).Set(o.BaseFee)
+	}
+	if o.BlobBaseFee != nil {
+		block.BlobBaseFee = new(big.Int).Set(o.BlobBaseFee)
+	}
+}
+
+// overrideAccountJSON is the JSON form of an OverrideAccount, as in geth.
+type overrideAccountJSON struct {
+	Balance   *hexutil.Big             `json:"balance,omitempty"`
+	Nonce     *hexutil.Uint64          `json:"nonce,omitempty"`
+	Code      *hexutil.Bytes           `json:"code,omitempty"`
+	State     map[string]hexutil.Bytes `json:"state,omitempty"`
+	StateDiff map[string]hexutil.Bytes `json:"stateDiff,omitempty"`
+}
+
+// MarshalJSON encodes the overrides as an object keyed by address.
+func (o StateOverride) MarshalJSON() ([]byte, error) {
+	enc := make(map[string]overrideAccountJSON, len(o))
+	for addr, account := range o {
+		acc := overrideAccountJSON{
+			Balance:   (*hexutil.Big)(account.Balance),
+			Nonce:     (*hexutil.Uint64)(account.Nonce),
+			State:     encodeSlots(account.State),
+			StateDiff: encodeSlots(account.StateDiff),
+		}
+		if account.Code != nil {
+			code := hexutil.Bytes(account.Code)
+			acc.Code = &code
+		}
+		enc[hexutil.Encode(addr[:])] = acc
+	}
+	return json.Marshal(enc)
+}
+
+func (o *StateOverride) UnmarshalJSON(input []byte) error {
+	var dec map[string]overrideAccountJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*o = make(StateOverride, len(dec))
+	for key, acc := range dec {
+		addr, err := parseAddress(key)
+		if err != nil {
+			return fmt.Errorf("override %q: %w", key, err)
+		}
+		account := OverrideAccount{
+			Balance: acc.Balance.ToInt(),
+			Nonce:   (*uint64)(acc.Nonce),
+		}
+		if acc.Code != nil {
+			account.Code = append([]byte{}, *acc.Code...)
+		}
+		if account.State, err = decodeSlots(acc.State); err != nil {
+			return fmt.Errorf("override %q: state: %w", key, err)
+		}
+		if account.StateDiff, err = decodeSlots(acc.StateDiff); err != nil {
+			return fmt.Errorf("override %q: stateDiff: %w", key, err)
+		}
+		(*o)[addr] = account
+	}
+	return nil
+}
+
+func encodeSlots(slots map[[32]byte][32]byte) map[string]hexutil.Bytes {
+	if slots == nil {
+		return nil
+	}
+	enc := make(map[string]hexutil.Bytes, len(slots))
+	for slot, value := range slots {
+		enc[hexutil.Encode(slot[:])] = append(hexutil.Bytes(nil), value[:]...)
+	}
+	return enc
+}
+
+// decodeSlots decodes storage slots and values of up to 32 bytes. An empty
+// object gives an empty map, so that a state override can clear the
+// storage.
+func decodeSlots(dec map[string]hexutil.Bytes) (map[[32]byte][32]byte, error) {
+	if dec == nil {
+		return nil, nil
+	}
+	slots := make(map[[32]byte][32]byte, len(dec))
+	for key, value := range dec {
+		slot, err := parseWord(key)
+		if err != nil {
+			return nil, err
+		}
+		if len(value) > 32 {
+			return nil, fmt.Errorf("%w: %d bytes", ErrInvalidHashSize, len(value))
+		}
+		var word [32]byte
+		copy(word[32-len(value):], value)
+		slots[slot] = word
+	}
+	return slots, nil
+}
+
+// blockOverridesJSON is the JSON form of BlockOverrides, as in geth.
+type blockOverridesJSON struct {
+	Number        *hexutil.Big    `json:"number,omitempty"`
+	Time          *hexutil.Uint64 `json:"time,omitempty"`
+	GasLimit      *hexutil.Uint64 `json:"gasLimit,omitempty"`
+	FeeRecipient  *rpcAddress     `json:"feeRecipient,omitempty"`
+	PrevRandao    *rpcHash        `json:"prevRandao,omitempty"`
+	BaseFeePerGas *hexutil.Big    `json:"baseFeePerGas,omitempty"`
+	BlobBaseFee   *hexutil.Big    `json:"blobBaseFee,omitempty"`
+}
+
+func (o *BlockOverrides) MarshalJSON() ([]byte, error) {
+	enc := blockOverridesJSON{
+		Number:        (*hexutil.Big)(o.Number),
+		FeeRecipient:  (*rpcAddress)(o.Coinbase),
+		PrevRandao:    (*rpcHash)(o.Random),
+		BaseFeePerGas: (*hexutil.Big)(o.BaseFee),
+		BlobBaseFee:   (*hexutil.Big)(o.BlobBaseFee),
+	}
+	if o.Timestamp != nil {
+		t := hexutil.Uint64(o.Timestamp.Uint64())
+		enc.Time = &t
+	}
+	if o.GasLimit != nil {
+		gas := hexutil.Uint64(o.GasLimit.Uint64())
+		enc.GasLimit = &gas
+	}
+	return json.Marshal(enc)
+}
+
+func (o *BlockOverrides) UnmarshalJSON(input []byte) error {
+	var dec blockOverridesJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*o = BlockOverrides{
+		Number:      dec.Number.ToInt(),
+		Coinbase:    (*[20]byte)(dec.FeeRecipient),
+		Random:      (*[32]byte)(dec.PrevRandao),
+		BaseFee:     dec.BaseFeePerGas.ToInt(),
+		BlobBaseFee: dec.BlobBaseFee.ToInt(),
+	}
+	if dec.Time != nil {
+		o.Timestamp = new(big.Int).SetUint64(uint64(*dec.Time))
+	}
+	if dec.GasLimit != nil {
+		o.GasLimit = new(big.Int).SetUint64(uint64(*dec.GasLimit))
+	}
+	return nil
+}
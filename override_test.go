@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"prevm/db"
+	"prevm/hexutil"
+)
+
+// returnWord is the code of a contract running src and returning the word
+// it leaves on the stack.
+func returnWord(t *testing.T, src string) []byte {
+	t.Helper()
+	code, err := Assemble(src + " PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN")
+	if err != nil {
+		t.Fatalf("Unexpected assembler error: %v", err)
+	}
+	return code
+}
+
+// TestCallOverrides checks that a call sees the state and block overrides,
+// and that the state it runs on is left unchanged.
+func TestCallOverrides(t *testing.T) {
+	contract, other := [20]byte{19: 0xc0}, [20]byte{19: 0xc1}
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1_000_000_000))
+	state.SetBalance(other, big.NewInt(5))
+	state.SetNonce(contract, 1)
+	state.SetCode(contract, returnWord(t, "PUSH1 0 SLOAD"))
+	state.SetStorage(contract, [32]byte{}, []byte{0x01})
+	state.SetStorage(contract, [32]byte{31: 1}, []byte{0x02})
+	state.Finalise()
+	root := state.StateRoot()
+
+	nonce := uint64(5)
+	word := func(b byte) [32]byte { return [32]byte{31: b} }
+	var created [32]byte
+	addr := CreateAddress(contract, nonce)
+	copy(created[12:], addr[:])
+	tests := []struct {
+		name      string
+		code      string // the code of contract, if overridden
+		overrides CallOverrides
+		want      [32]byte
+	}{
+		{
+			name: "none",
+			want: word(1),
+		},
+		{
+			name:      "balance",
+			code:      "PUSH1 0xc1 BALANCE",
+			overrides: CallOverrides{State: StateOverride{other: {Balance: big.NewInt(42)}}},
+			want:      word(42),
+		},
+		{
+			// The address of a contract created by contract depends on its
+			// nonce.
+			name:      "nonce",
+			code:      "PUSH1 0 DUP1 DUP1 CREATE",
+			overrides: CallOverrides{State: StateOverride{contract: {Nonce: &nonce}}},
+			want:      created,
+		},
+		{
+			name: "state",
+			code: "PUSH1 0 SLOAD PUSH1 1 SLOAD ADD",
+			overrides: CallOverrides{State: StateOverride{contract: {
+				State: map[[32]byte][32]byte{word(1): word(7)},
+			}}},
+			want: word(7),
+		},
+		{
+			name: "state diff",
+			code: "PUSH1 0 SLOAD PUSH1 1 SLOAD ADD",
+			overrides: CallOverrides{State: StateOverride{contract: {
+				StateDiff: map[[32]byte][32]byte{word(1): word(7)},
+			}}},
+			want: word(8),
+		},
+		{
+			name:      "number",
+			code:      "NUMBER",
+			overrides: CallOverrides{Block: &BlockOverrides{Number: big.NewInt(100)}},
+			want:      word(100),
+		},
+		{
+			name:      "timestamp",
+			code:      "TIMESTAMP",
+			overrides: CallOverrides{Block: &BlockOverrides{Timestamp: big.NewInt(200)}},
+			want:      word(200),
+		},
+		{
+			// The base fee and the tip of 1.
+			name:      "base fee",
+			code:      "GASPRICE",
+			overrides: CallOverrides{Block: &BlockOverrides{BaseFee: big.NewInt(9)}},
+			want:      word(10),
+		},
+		{
+			name:      "coinbase",
+			code:      "COINBASE",
+			overrides: CallOverrides{Block: &BlockOverrides{Coinbase: &other}},
+			want:      word(0xc1),
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.code != "" {
+			if tt.overrides.State == nil {
+				tt.overrides.State = make(StateOverride)
+			}
+			account := tt.overrides.State[contract]
+			account.Code = returnWord(t, tt.code)
+			tt.overrides.State[contract] = account
+		}
+		// A call paying for gas, so that it runs with the base fee of the
+		// block.
+		msg := &CallMsg{From: testSender, To: &contract, Gas: 100000, MaxFeePerGas: big.NewInt(100), MaxPriorityFeePerGas: big.NewInt(1)}
+		res, err := DoCall(state, testBlock(big.NewInt(1)), msg, Config{}, &tt.overrides)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if res.Failed() {
+			t.Errorf("%s: Unexpected execution error: %v", tt.name, res.Err)
+			continue
+		}
+		if got := [32]byte(res.ReturnData); got != tt.want {
+			t.Errorf("%s: Expected %x, got %x", tt.name, tt.want, got)
+		}
+		if got := state.StateRoot(); got != root {
+			t.Errorf("%s: Expected the state to be unchanged, got the root 0x%x", tt.name, got)
+		}
+	}
+
+	// State replaces the storage and StateDiff patches it: not both.
+	both := CallOverrides{State: StateOverride{contract: {
+		State:     map[[32]byte][32]byte{},
+		StateDiff: map[[32]byte][32]byte{},
+	}}}
+	msg := &CallMsg{From: testSender, To: &contract}
+	if _, err := DoCall(state, testBlock(nil), msg, Config{}, &both); !errors.Is(err, ErrConflictingOverride) {
+		t.Errorf("Expected %v, got %v", ErrConflictingOverride, err)
+	}
+}
+
+// TestEthCallOverrides checks the JSON form of the overrides of eth_call,
+// and that the state of the node is left unchanged.
+func TestEthCallOverrides(t *testing.T) {
+	url, node, _ := newTestServer(t)
+	contract := [20]byte{19: 0xc0}
+	contractHex := hexutil.Encode(contract[:])
+	call := map[string]any{"to": contractHex}
+	var root [32]byte
+	node.ReadState(func(state *StateDB) { root = state.StateRoot() })
+
+	tests := []struct {
+		name   string
+		params []any
+		want   byte
+	}{
+		{
+			name: "code and state",
+			params: []any{call, "latest", map[string]any{contractHex: map[string]any{
+				"code":  hexutil.Encode(returnWord(t, "PUSH1 1 SLOAD")),
+				"state": map[string]any{"0x01": "0x2a"},
+			}}},
+			want: 0x2a,
+		},
+		{
+			name: "block",
+			params: []any{call, "latest", map[string]any{contractHex: map[string]any{
+				"code": hexutil.Encode(returnWord(t, "NUMBER TIMESTAMP ADD")),
+			}}, map[string]any{"number": "0x10", "time": "0x20"}},
+			want: 0x30,
+		},
+	}
+	for _, tt := range tests {
+		got, rpcErr := rpcCall(t, url, "eth_call", tt.params...)
+		if rpcErr != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, rpcErr)
+			continue
+		}
+		want := [32]byte{31: tt.want}
+		if string(got) != `"`+hexutil.Encode(want[:])+`"` {
+			t.Errorf("%s: Expected 0x%x, got %s", tt.name, want, got)
+		}
+	}
+
+	both := map[string]any{contractHex: map[string]any{"state": map[string]any{}, "stateDiff": map[string]any{}}}
+	if _, rpcErr := rpcCall(t, url, "eth_call", call, "latest", both); rpcErr == nil {
+		t.Errorf("Expected an error for both state and stateDiff")
+	}
+	node.ReadState(func(state *StateDB) {
+		if got := state.StateRoot(); got != root {
+			t.Errorf("Expected the state of the node to be unchanged, got the root 0x%x", got)
+		}
+		if code := state.GetCode(contract); len(code) != 0 {
+			t.Errorf("Expected no code, got %x", code)
+		}
+	})
+}
+
+// TestStateOverridePersisted checks that a state override replaces the
+// storage of a persisted account, including the slots not loaded yet.
+func TestStateOverridePersisted(t *testing.T) {
+	store := db.NewMemoryDB()
+	contract := [20]byte{19: 0xc0}
+	state := OpenStateDB(store)
+	state.SetCode(contract, returnWord(t, "PUSH1 0 SLOAD PUSH1 1 SLOAD ADD"))
+	state.SetStorage(contract, [32]byte{}, []byte{0x01})
+	state.SetStorage(contract, [32]byte{31: 1}, []byte{0x02})
+	state.resetJournal()
+	if err := state.Commit(); err != nil {
+		t.Fatalf("Unexpected commit error: %v", err)
+	}
+
+	state = OpenStateDB(store)
+	overrides := CallOverrides{State: StateOverride{contract: {
+		State: map[[32]byte][32]byte{{31: 1}: {31: 7}},
+	}}}
+	msg := &CallMsg{From: testSender, To: &contract}
+	res, err := DoCall(state, testBlock(nil), msg, Config{}, &overrides)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got, want := [32]byte(res.ReturnData), [32]byte{31: 7}; got != want {
+		t.Errorf("Expected %x, got %x", want, got)
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"prevm/hexutil"
+	"reflect"
+)
+
+var ErrReplayMismatch = errors.New("replay does not match the captured result")
+
+// Prestate is everything needed to re-run a transaction outside of the
+// state it originally ran on: the accounts and storage slots it accessed,
+// as they were before it ran, the block it ran in and the block hashes it
+// looked up. It is meant to be attached to bug reports.
+type Prestate struct {
+	Env         *BlockContext
+	Alloc       GenesisAlloc
+	BlockHashes map[uint64][32]byte
+	Sender      [20]byte
+	Transaction *Transaction
+	// Result is the outcome of the original run, checked by Verify.
+	Result *CapturedResult
+}
+
+// CapturedResult is the outcome of a transaction, in a form that can be
+// compared across runs.
+type CapturedResult struct {
+	GasUsed    hexutil.Uint64  `json:"gasUsed"`
+	Error      string          `json:"error,omitempty"`
+	ReturnData hexutil.Bytes   `json:"returnData"`
+	StateDiff  json.RawMessage `json:"stateDiff"`
+}
+
+// prestateRecorder records the accounts and storage slots read or written
+// through the StateDB accessors, as they were on first access.
+type prestateRecorder struct {
+	accounts map[[20]byte]*Account // nil if the account didn't exist
+	slots    map[storageSlot][]byte
+	hashes   map[uint64][32]byte
+}
+
+func newPrestateRecorder() *prestateRecorder {
+	return &prestateRecorder{
+		accounts: make(map[[20]byte]*Account),
+		slots:    make(map[storageSlot][]byte),
+		hashes:   make(map[uint64][32]byte),
+	}
+}
+
+func (r *prestateRecorder) recordAccount(addr [20]byte, acc *Account) {
+	if _, ok := r.accounts[addr]; ok {
+		return
+	}
+	if acc == nil {
+		r.accounts[addr] = nil
+		return
+	}
+	r.accounts[addr] = copyAccount(acc, false)
+}
+
+func (r *prestateRecorder) recordSlot(addr [20]byte, key [32]byte, value []byte) {
+	if _, ok := r.slots[storageSlot{addr, key}]; ok {
+		return
+	}
+	r.slots[storageSlot{addr, key}] = value
+}
+
+// alloc returns the recorded accounts with their recorded storage.
+func (r *prestateRecorder) alloc() GenesisAlloc {
+	alloc := make(GenesisAlloc)
+	for addr, acc := range r.accounts {
+		if acc == nil {
+			continue
+		}
+		account := GenesisAccount{
+			Code:    acc.Code,
+			Balance: acc.Balance,
+			Nonce:   acc.Nonce,
+		}
+		for slot, value := range r.slots {
+			if slot.addr != addr || isZero(value) {
+				continue
+			}
+			if account.Storage == nil {
+				account.Storage = make(map[[32]byte][32]byte)
+			}
+			account.Storage[slot.key] = toWord(value)
+		}
+		alloc[addr] = account
+	}
+	return alloc
+}
+
+// CapturePrestate runs tx like ProcessTransaction while recording the
+// prestate it touches. The transaction is applied to the state as usual.
+func (evm *EVM) CapturePrestate(tx *Transaction, sender [20]byte) (*Prestate, *ExecutionResult, error) {
+	recorder := newPrestateRecorder()
+	evm.State.recorder = recorder
+	defer func() { evm.State.recorder = nil }()
+
+	// Record block hash lookups by wrapping the block's GetHash.
+	block := *evm.BlockCtx
+	if getHash := block.GetHash; getHash != nil {
+		block.GetHash = func(number uint64) [32]byte {
+			hash := getHash(number)
+			recorder.hashes[number] = hash
+			return hash
+		}
+	}
+	origBlock := evm.BlockCtx
+	evm.BlockCtx = &block
+	defer func() { evm.BlockCtx = origBlock }()
+
+	// The captured result includes the state diff.
+	stateDiff := evm.Config.StateDiff
+	evm.Config.StateDiff = true
+	defer func() { evm.Config.StateDiff = stateDiff }()
+
+	res, err := evm.ProcessTransaction(tx, sender)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	captured, err := captureResult(res)
+	if err != nil {
+		return nil, nil, err
+	}
+	prestate := &Prestate{
+		Env:         origBlock,
+		Alloc:       recorder.alloc(),
+		BlockHashes: recorder.hashes,
+		Sender:      sender,
+		Transaction: tx,
+		Result:      captured,
+	}
+	return prestate, res, nil
+}
+
+func captureResult(res *ExecutionResult) (*CapturedResult, error) {
+	diff, err := json.Marshal(res.StateDiff)
+	if err != nil {
+		return nil, err
+	}
+	captured := &CapturedResult{
+		GasUsed:    hexutil.Uint64(res.UsedGas),
+		ReturnData: res.ReturnData,
+		StateDiff:  diff,
+	}
+	if res.Err != nil {
+		captured.Error = res.Err.Error()
+	}
+	if captured.ReturnData == nil {
+		captured.ReturnData = []byte{}
+	}
+	return captured, nil
+}
+
+// Replay runs the captured transaction on a fresh state holding only the
+// prestate.
+func (p *Prestate) Replay() (*ExecutionResult, error) {
+	state := NewStateDB()
+	p.Alloc.Apply(state)
+
+	block := *p.Env
+	block.GetHash = func(number uint64) [32]byte {
+		return p.BlockHashes[number]
+	}
+
+	evm := NewEVM(state, &block)
+	evm.Config.StateDiff = true
+	return evm.ProcessTransaction(p.Transaction, p.Sender)
+}
+
+// Verify checks that res, typically returned by Replay, matches the
+// captured result.
+func (p *Prestate) Verify(res *ExecutionResult) error {
+	if p.Result == nil {
+		return fmt.Errorf("%w: no captured result", ErrReplayMismatch)
+	}
+	got, err := captureResult(res)
+	if err != nil {
+		return err
+	}
+
+	want := p.Result
+	switch {
+	case got.GasUsed != want.GasUsed:
+		return fmt.Errorf("%w: gas used %d, captured %d", ErrReplayMismatch, got.GasUsed, want.GasUsed)
+	case got.Error != want.Error:
+		return fmt.Errorf("%w: error %q, captured %q", ErrReplayMismatch, got.Error, want.Error)
+	case !bytes.Equal(got.ReturnData, want.ReturnData):
+		return fmt.Errorf("%w: return data %x, captured %x", ErrReplayMismatch, []byte(got.ReturnData), []byte(want.ReturnData))
+	}
+
+	// Compare the diffs semantically, not byte for byte, so that
+	// hand-edited files still verify.
+	var gotDiff, wantDiff any
+	if err := json.Unmarshal(got.StateDiff, &gotDiff); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(want.StateDiff, &wantDiff); err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(gotDiff, wantDiff) {
+		return fmt.Errorf("%w: state diff %s, captured %s", ErrReplayMismatch, got.StateDiff, want.StateDiff)
+	}
+	return nil
+}
+
+type prestateJSON struct {
+	Env         *BlockContext                    `json:"env"`
+	Alloc       GenesisAlloc                     `json:"alloc"`
+	BlockHashes map[hexutil.Uint64]hexutil.Bytes `json:"blockHashes,omitempty"`
+	Sender      hexutil.Bytes                    `json:"sender"`
+	Transaction hexutil.Bytes                    `json:"transaction"`
+	Result      *CapturedResult                  `json:"result,omitempty"`
+}
+
+func (p *Prestate) MarshalJSON() ([]byte, error) {
+	raw, err := p.Transaction.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	enc := prestateJSON{
+		Env:         p.Env,
+		Alloc:       p.Alloc,
+		Sender:      p.Sender[:],
+		Transaction: raw,
+		Result:      p.Result,
+	}
+	if len(p.BlockHashes) > 0 {
+		enc.BlockHashes = make(map[hexutil.Uint64]hexutil.Bytes, len(p.BlockHashes))
+		for number, hash := range p.BlockHashes {
+			enc.BlockHashes[hexutil.Uint64(number)] = append([]byte(nil), hash[:]...)
+		}
+	}
+	return json.Marshal(enc)
+}
+
+func (p *Prestate) UnmarshalJSON(input []byte) error {
+	var dec prestateJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	if dec.Env == nil {
+		return errors.New("prestate: missing env")
+	}
+	if len(dec.Sender) != 20 {
+		return fmt.Errorf("prestate: sender: %w", ErrInvalidAddress)
+	}
+	tx, err := DecodeTransaction(dec.Transaction)
+	if err != nil {
+		return fmt.Errorf("prestate: transaction: %w", err)
+	}
+
+	*p = Prestate{
+		Env:         dec.Env,
+		Alloc:       dec.Alloc,
+		BlockHashes: make(map[uint64][32]byte, len(dec.BlockHashes)),
+		Sender:      [20]byte(dec.Sender),
+		Transaction: tx,
+		Result:      dec.Result,
+	}
+	if p.Alloc == nil {
+		p.Alloc = make(GenesisAlloc)
+	}
+	for number, hash := range dec.BlockHashes {
+		if len(hash) != 32 {
+			return fmt.Errorf("prestate: block hash %d: %w", number, ErrInvalidHashSize)
+		}
+		p.BlockHashes[uint64(number)] = [32]byte(hash)
+	}
+	return nil
+}
+
+// Save writes the prestate to a file as indented JSON.
+func (p *Prestate) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// LoadPrestate reads a prestate file written by Save.
+func LoadPrestate(path string) (*Prestate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := new(Prestate)
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return p, nil
+}
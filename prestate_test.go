@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+)
+
+// TestCaptureReplay captures the prestate of a transaction, saves it to a
+// file, loads it back and checks that replaying it gives the same result.
+func TestCaptureReplay(t *testing.T) {
+	key, _ := HexToPrivateKey(DevKeys[0])
+	sender := PrivateKeyToAddress(key)
+	contract := [20]byte{0xc0}
+	unrelated := [20]byte{0x0f}
+
+	state := NewStateDB()
+	state.SetBalance(sender, big.NewInt(1_000_000_000))
+	state.SetBalance(unrelated, big.NewInt(1))
+	// SSTORE(0, SLOAD(1)), SSTORE(2, BLOCKHASH(0))
+	state.SetCode(contract, []byte{0x60, 0x01, 0x54, 0x60, 0x00, 0x55, 0x60, 0x00, 0x40, 0x60, 0x02, 0x55, 0x00})
+	state.SetStorage(contract, [32]byte{31: 0x01}, []byte{0x2a})
+	state.SetStorage(contract, [32]byte{31: 0x05}, []byte{0x05})
+	state.resetJournal()
+
+	block := testBlock(big.NewInt(1))
+	block.GetHash = func(number uint64) [32]byte { return [32]byte{0xbb, byte(number)} }
+	tx := signTestTx(t, &Transaction{GasPrice: big.NewInt(2), GasLimit: 100_000, To: &contract})
+
+	prestate, res, err := NewEVM(state, block).CapturePrestate(tx, sender)
+	if err != nil {
+		t.Fatalf("Unexpected capture error: %v", err)
+	}
+	if res.Failed() {
+		t.Fatalf("Unexpected execution error: %v", res.Err)
+	}
+
+	if _, ok := prestate.Alloc[unrelated]; ok {
+		t.Errorf("Expected untouched accounts to be left out")
+	}
+	storage := prestate.Alloc[contract].Storage
+	if len(storage) != 1 || storage[[32]byte{31: 0x01}] != ([32]byte{31: 0x2a}) {
+		t.Errorf("Expected only the slot read to be captured, got %x", storage)
+	}
+	if hash, ok := prestate.BlockHashes[0]; !ok || hash != ([32]byte{0xbb}) {
+		t.Errorf("Expected the hash of block 0 to be captured, got %x", prestate.BlockHashes)
+	}
+
+	path := filepath.Join(t.TempDir(), "prestate.json")
+	if err := prestate.Save(path); err != nil {
+		t.Fatalf("Unexpected save error: %v", err)
+	}
+	loaded, err := LoadPrestate(path)
+	if err != nil {
+		t.Fatalf("Unexpected load error: %v", err)
+	}
+	replayed, err := loaded.Replay()
+	if err != nil {
+		t.Fatalf("Unexpected replay error: %v", err)
+	}
+	if err := loaded.Verify(replayed); err != nil {
+		t.Errorf("Expected the replay to verify, got %v", err)
+	}
+
+	// A different prestate gives a different state diff.
+	loaded.Alloc[contract].Storage[[32]byte{31: 0x01}] = [32]byte{31: 0x2b}
+	if replayed, err = loaded.Replay(); err != nil {
+		t.Fatalf("Unexpected replay error: %v", err)
+	}
+	if err := loaded.Verify(replayed); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("Expected ErrReplayMismatch, got %v", err)
+	}
+}
@@ -32,8 +32,18 @@ type ExecutionContext struct {
 	Stopped bool
 	// ReturnData is the data returned from this execution context.
 	ReturnData []byte
+	// LastReturnData is the data returned by the last call or failed
+	// create made from this context, read by RETURNDATASIZE and
+	// RETURNDATACOPY.
+	LastReturnData []byte
 	// True if this is a STATICCALL context
 	IsStatic bool
+	// Depth is the call depth of this context, 1 for the top-level call.
+	Depth int
+
+	// jumpdests marks the valid jump destinations of Bytecode. It is
+	// computed on the first jump.
+	jumpdests []bool
 }
 
 // BlockContext holds information about the current block.
@@ -53,18 +63,10 @@ type BlockContext struct {
 	GasLimit *big.Int
 	// ChainID identifies the specific chain. Accessible via CHAINID opcode.
 	ChainID *big.Int
-}
-
-// This is the full transaction object, with the nonce.
-type Transaction struct {
-	Nonce    uint64
-	GasLimit uint64
-	GasPrice *big.Int
-	// From     *[20]byte // read from ethereum docs and change
-	To    *[20]byte
-	Value *big.Int
-	Data  []byte
-	// ... V, R, S for signature later
+	// BlobBaseFee (EIP-4844) is the price per unit of blob gas in this block.
+	BlobBaseFee *big.Int
+	// GetHash returns the hash of a previous block by number. Accessible via BLOCKHASH opcode.
+	GetHash func(number uint64) [32]byte
 }
 
 // TransactionContext holds information specific to the transaction being processed.
@@ -90,6 +92,10 @@ type TransactionContext struct {
 	// This is accessed by opcodes like CALLDATALOAD (0x35), CALLDATASIZE (0x36),
 	// and CALLDATACOPY (0x37).
 	Data []byte
+
+	// BlobHashes are the versioned hashes of the blobs carried by the
+	// transaction (EIP-4844). Accessible via the BLOBHASH (0x49) opcode.
+	BlobHashes [][32]byte
 }
 
 // NewExecutionContext creates a new execution context.
@@ -97,7 +103,7 @@ func NewExecutionContext(caller, address [20]byte, bytecode []byte, calldata []b
 	return &ExecutionContext{
 		Address:   address,
 		Bytecode:  bytecode,
-		Stack:     machine.NewStack(1024),
+		Stack:     machine.NewStack(StackLimit),
 		Memory:    machine.NewMemory(),
 		PC:        0,
 		Caller:    caller,
@@ -153,3 +159,50 @@ func (ec *ExecutionContext) GetOp() Opcode {
 	ec.PC++
 	return InstructionSet[opByte]
 }
+
+// validJumpdest reports whether dest is a JUMPDEST instruction of the code,
+// as opposed to a 0x5b byte inside PUSH data.
+func (ec *ExecutionContext) validJumpdest(dest *big.Int) bool {
+	if !dest.IsUint64() || dest.Uint64() >= uint64(len(ec.Bytecode)) {
+		return false
+	}
+	if ec.jumpdests == nil {
+		ec.jumpdests = make([]bool, len(ec.Bytecode))
+		for pc := 0; pc < len(ec.Bytecode); pc++ {
+			op := ec.Bytecode[pc]
+			if op == JUMPDEST {
+				ec.jumpdests[pc] = true
+			}
+			pc += pushSize(op)
+		}
+	}
+	return ec.jumpdests[dest.Uint64()]
+}
+
+// getData returns size bytes of data from offset, padded with zeros past
+// its end.
+func getData(data []byte, offset, size uint64) []byte {
+	out := make([]byte, size)
+	if offset < uint64(len(data)) {
+		copy(out, data[offset:])
+	}
+	return out
+}
+
+// wordMask is 2^256-1, the largest value of a stack item.
+var wordMask = new(big.Int).Sub(maxU256, big.NewInt(1))
+
+// toWord256 returns a stack item as a 32-byte word. The arithmetic
+// opcodes don't wrap, so items may be negative or wider than 256 bits: they
+// are taken modulo 2^256, as a wrapping EVM would have computed them.
+func toWord256(v *big.Int) [32]byte {
+	var word [32]byte
+	new(big.Int).And(v, wordMask).FillBytes(word[:])
+	return word
+}
+
+// toAddress returns the address held in the low 20 bytes of a stack item.
+func toAddress(v *big.Int) [20]byte {
+	word := toWord256(v)
+	return [20]byte(word[12:])
+}
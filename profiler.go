@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// GasView selects how the GasProfiler groups the gas it recorded.
+type GasView int
+
+const (
+	ByOpcode  GasView = iota // one row per opcode
+	ByPC                     // one row per instruction of each contract
+	ByAddress                // one row per contract
+)
+
+// ParseGasView parses the name of a view: opcode, pc or address.
+func ParseGasView(name string) (GasView, error) {
+	switch name {
+	case "opcode":
+		return ByOpcode, nil
+	case "pc":
+		return ByPC, nil
+	case "address":
+		return ByAddress, nil
+	}
+	return 0, fmt.Errorf("unknown view %q, want opcode, pc or address", name)
+}
+
+// GasStat is the gas used and the number of executions of an opcode, an
+// instruction or a contract, depending on the view. Fields that are not
+// part of the view are zero.
+type GasStat struct {
+	Address [20]byte
+	PC      uint64
+	Op      byte
+	Count   uint64
+	Gas     uint64
+}
+
+// GasProfiler is a Tracer that adds up the gas used by each instruction
+// across all the transactions it traces.
+//
+// Instructions are charged the gas they consumed themselves: a CALL or
+// CREATE is charged its own cost but not the gas used by the frame it
+// starts, which is charged to the instructions of that frame. A failing
+// instruction is charged the gas it burned. Intrinsic gas and refunds are
+// not part of the profile.
+type GasProfiler struct {
+	NoopTracer
+	frames  []*profFrame
+	samples map[string]*profSample
+}
+
+// profFrame is a call frame being profiled.
+type profFrame struct {
+	code    [20]byte // the account whose code runs
+	gas     uint64   // gas at the start of the frame
+	pending *profOp  // the last instruction, charged once the next one starts
+}
+
+// profOp is an instruction whose gas isn't known yet.
+type profOp struct {
+	pc       uint64
+	op       byte
+	gas      uint64 // gas before the instruction
+	children uint64 // gas used by the frames it started
+}
+
+// profLoc is an instruction of a contract.
+type profLoc struct {
+	addr [20]byte
+	pc   uint64
+	op   byte
+}
+
+// profSample is the gas used by an instruction reached through a given
+// chain of calls, innermost first.
+type profSample struct {
+	stack []profLoc
+	count uint64
+	gas   uint64
+}
+
+// NewGasProfiler returns an empty GasProfiler.
+func NewGasProfiler() *GasProfiler {
+	return &GasProfiler{samples: make(map[string]*profSample)}
+}
+
+func (p *GasProfiler) OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int) {
+	p.frames = append(p.frames, &profFrame{code: to, gas: gas})
+}
+
+func (p *GasProfiler) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	if len(p.frames) == 0 {
+		return
+	}
+	f := p.frames[len(p.frames)-1]
+	p.finish(f.gas - min(gasUsed, f.gas))
+	p.frames = p.frames[:len(p.frames)-1]
+
+	if len(p.frames) > 0 {
+		if parent := p.frames[len(p.frames)-1].pending; parent != nil {
+			parent.children += gasUsed
+		}
+	}
+}
+
+func (p *GasProfiler) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	if len(p.frames) == 0 {
+		return
+	}
+	p.finish(gas)
+	p.frames[len(p.frames)-1].pending = &profOp{pc: pc, op: op, gas: gas}
+}
+
+// finish charges the pending instruction of the innermost frame, given the
+// gas left after it.
+func (p *GasProfiler) finish(gasLeft uint64) {
+	f := p.frames[len(p.frames)-1]
+	op := f.pending
+	if op == nil {
+		return
+	}
+	f.pending = nil
+
+	var used uint64
+	if spent := op.gas - min(gasLeft, op.gas); spent > op.children {
+		used = spent - op.children
+	}
+
+	// The instruction, then the calls that led to it.
+	stack := []profLoc{{addr: f.code, pc: op.pc, op: op.op}}
+	for i := len(p.frames) - 2; i >= 0; i-- {
+		if caller := p.frames[i].pending; caller != nil {
+			stack = append(stack, profLoc{addr: p.frames[i].code, pc: caller.pc, op: caller.op})
+		}
+	}
+	key := fmt.Sprint(stack)
+	s := p.samples[key]
+	if s == nil {
+		s = &profSample{stack: stack}
+		p.samples[key] = s
+	}
+	s.count++
+	s.gas += used
+}
+
+// Stats returns the recorded gas grouped by view, the most expensive
+// first.
+func (p *GasProfiler) Stats(view GasView) []GasStat {
+	stats := make(map[GasStat]*GasStat)
+	for _, s := range p.samples {
+		var key GasStat
+		loc := s.stack[0]
+		switch view {
+		case ByOpcode:
+			key.Op = loc.op
+		case ByPC:
+			key.Address, key.PC, key.Op = loc.addr, loc.pc, loc.op
+		case ByAddress:
+			key.Address = loc.addr
+		}
+		st := stats[key]
+		if st == nil {
+			st = &GasStat{Address: key.Address, PC: key.PC, Op: key.Op}
+			stats[key] = st
+		}
+		st.Count += s.count
+		st.Gas += s.gas
+	}
+
+	out := make([]GasStat, 0, len(stats))
+	for _, st := range stats {
+		out = append(out, *st)
+	}
+	slices.SortFunc(out, func(a, b GasStat) int {
+		return cmp.Or(
+			cmp.Compare(b.Gas, a.Gas),
+			cmp.Compare(b.Count, a.Count),
+			bytes.Compare(a.Address[:], b.Address[:]),
+			cmp.Compare(a.PC, b.PC),
+			cmp.Compare(a.Op, b.Op),
+		)
+	})
+	return out
+}
+
+// TotalGas returns the gas of all the recorded instructions.
+func (p *GasProfiler) TotalGas() uint64 {
+	var total uint64
+	for _, s := range p.samples {
+		total += s.gas
+	}
+	return total
+}
+
+// WriteTable writes the stats of view as an aligned table with each row's
+// share of the total gas. limit caps the number of rows if positive.
+func (p *GasProfiler) WriteTable(w io.Writer, view GasView, limit int) error {
+	stats := p.Stats(view)
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	total := p.TotalGas()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, gasHeader(view)+"\tCOUNT\tGAS\t%\t")
+	for _, st := range stats {
+		share := 0.0
+		if total > 0 {
+			share = 100 * float64(st.Gas) / float64(total)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f\t\n", gasKey(view, st), st.Count, st.Gas, share)
+	}
+	return tw.Flush()
+}
+
+// WriteCSV writes the stats of view as CSV, with a header row.
+func (p *GasProfiler) WriteCSV(w io.Writer, view GasView) error {
+	cw := csv.NewWriter(w)
+	var header []string
+	switch view {
+	case ByOpcode:
+		header = []string{"opcode"}
+	case ByPC:
+		header = []string{"address", "pc", "opcode"}
+	case ByAddress:
+		header = []string{"address"}
+	}
+	cw.Write(append(header, "count", "gas"))
+
+	for _, st := range p.Stats(view) {
+		var row []string
+		switch view {
+		case ByOpcode:
+			row = []string{opName(st.Op)}
+		case ByPC:
+			row = []string{fmt.Sprintf("0x%x", st.Address), strconv.FormatUint(st.PC, 10), opName(st.Op)}
+		case ByAddress:
+			row = []string{fmt.Sprintf("0x%x", st.Address)}
+		}
+		cw.Write(append(row, strconv.FormatUint(st.Count, 10), strconv.FormatUint(st.Gas, 10)))
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// gasHeader and gasKey return the key columns of a table row.
+func gasHeader(view GasView) string {
+	switch view {
+	case ByPC:
+		return "ADDRESS\tPC\tOPCODE"
+	case ByAddress:
+		return "ADDRESS"
+	}
+	return "OPCODE"
+}
+
+func gasKey(view GasView, st GasStat) string {
+	switch view {
+	case ByPC:
+		return fmt.Sprintf("0x%x\t%d\t%s", st.Address, st.PC, opName(st.Op))
+	case ByAddress:
+		return fmt.Sprintf("0x%x", st.Address)
+	}
+	return opName(st.Op)
+}
+
+// opName is OpcodeName, with a placeholder for undefined opcodes.
+func opName(op byte) string {
+	if name := OpcodeName(op); name != "" {
+		return name
+	}
+	return fmt.Sprintf("0x%02x", op)
+}
+
+// Profile returns the recorded gas as a pprof profile. Each contract is a
+// function and each instruction a line numbered by its PC, and samples
+// carry the chain of calls leading to them, so that 'go tool pprof' shows
+// the gas used below each call. Samples are labelled with their opcode.
+func (p *GasProfiler) Profile() *profile.Profile {
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "gas", Unit: "count"},
+			{Type: "instructions", Unit: "count"},
+		},
+		DefaultSampleType: "gas",
+	}
+	functions := make(map[[20]byte]*profile.Function)
+	locations := make(map[profLoc]*profile.Location)
+
+	location := func(loc profLoc) *profile.Location {
+		if l := locations[loc]; l != nil {
+			return l
+		}
+		fn := functions[loc.addr]
+		if fn == nil {
+			name := fmt.Sprintf("0x%x", loc.addr)
+			fn = &profile.Function{ID: uint64(len(prof.Function) + 1), Name: name, SystemName: name, Filename: name}
+			functions[loc.addr] = fn
+			prof.Function = append(prof.Function, fn)
+		}
+		l := &profile.Location{
+			ID:      uint64(len(prof.Location) + 1),
+			Address: loc.pc,
+			Line:    []profile.Line{{Function: fn, Line: int64(loc.pc)}},
+		}
+		locations[loc] = l
+		prof.Location = append(prof.Location, l)
+		return l
+	}
+
+	keys := make([]string, 0, len(p.samples))
+	for key := range p.samples {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		s := p.samples[key]
+		sample := &profile.Sample{
+			Value: []int64{int64(s.gas), int64(s.count)},
+			Label: map[string][]string{"opcode": {opName(s.stack[0].op)}},
+		}
+		for _, loc := range s.stack {
+			sample.Location = append(sample.Location, location(loc))
+		}
+		prof.Sample = append(prof.Sample, sample)
+	}
+	return prof
+}
+
+// WritePprof writes the profile in the gzipped protobuf format read by
+// 'go tool pprof'.
+func (p *GasProfiler) WritePprof(w io.Writer) error {
+	return p.Profile().Write(w)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/google/pprof/profile"
+)
+
+var (
+	profCaller = [20]byte{19: 0xaa}
+	profCallee = [20]byte{19: 0xbb}
+)
+
+// profileTransactions runs two transactions calling profCaller, which
+// calls profCallee, and returns the profiler that traced them along with
+// the gas the transactions used.
+func profileTransactions(t *testing.T) (*GasProfiler, uint64) {
+	t.Helper()
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1_000_000))
+	for addr, src := range map[[20]byte]string{
+		profCaller: "PUSH1 0 DUP1 DUP1 DUP1 DUP1 PUSH1 0xbb PUSH2 0xffff CALL POP STOP",
+		profCallee: "PUSH1 2 PUSH1 3 ADD POP STOP",
+	} {
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatalf("Unexpected assembler error: %v", err)
+		}
+		state.SetCode(addr, code)
+	}
+
+	profiler := NewGasProfiler()
+	evm := NewEVM(state, testBlock(nil))
+	evm.Config.Tracer = profiler
+	var used uint64
+	for nonce := range uint64(2) {
+		tx := &Transaction{Nonce: nonce, To: &profCaller, GasLimit: 100000, GasPrice: big.NewInt(1)}
+		res, err := evm.ProcessTransaction(tx, testSender)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if res.Failed() {
+			t.Fatalf("Unexpected execution error: %v", res.Err)
+		}
+		used += res.UsedGas
+	}
+	return profiler, used
+}
+
+// TestGasProfiler checks the gas and counts of each view across two
+// transactions, and their order: the most gas first, then the most
+// executions, then by address, PC and opcode. A CALL is charged its own
+// cost, cold in each transaction, but not the gas of the callee.
+func TestGasProfiler(t *testing.T) {
+	profiler, used := profileTransactions(t)
+
+	if want := used - 2*TxGas; profiler.TotalGas() != want {
+		t.Errorf("Expected a total of %d gas, the gas used without the intrinsic gas, got %d", want, profiler.TotalGas())
+	}
+
+	tests := []struct {
+		view GasView
+		want []GasStat
+	}{
+		{ByOpcode, []GasStat{
+			{Op: CALL, Count: 2, Gas: 2 * ColdAccountAccessCost},
+			{Op: PUSH1, Count: 8, Gas: 24},
+			{Op: DUP1, Count: 8, Gas: 24},
+			{Op: POP, Count: 4, Gas: 8},
+			{Op: ADD, Count: 2, Gas: 6},
+			{Op: PUSH2, Count: 2, Gas: 6},
+			{Op: STOP, Count: 4},
+		}},
+		{ByAddress, []GasStat{
+			{Address: profCaller, Count: 20, Gas: 2 * (21 + ColdAccountAccessCost + 2)},
+			{Address: profCallee, Count: 10, Gas: 2 * 11},
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := profiler.Stats(tt.view); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: Expected\n%+v\ngot\n%+v", tt.view, tt.want, got)
+		}
+	}
+
+	stats := profiler.Stats(ByPC)
+	if len(stats) != 15 {
+		t.Fatalf("Expected a row per instruction of both contracts, got %+v", stats)
+	}
+	if want := (GasStat{Address: profCaller, PC: 11, Op: CALL, Count: 2, Gas: 2 * ColdAccountAccessCost}); stats[0] != want {
+		t.Errorf("Expected the CALL first, got %+v", stats[0])
+	}
+	if want := (GasStat{Address: profCallee, PC: 4, Op: ADD, Count: 2, Gas: 6}); !slices.Contains(stats, want) {
+		t.Errorf("Expected %+v, got %+v", want, stats)
+	}
+}
+
+// TestGasProfilerPprof checks that the pprof output parses, with a sample
+// per instruction whose gas adds up to the total, and the instructions of
+// the callee below the CALL that reached them.
+func TestGasProfilerPprof(t *testing.T) {
+	profiler, _ := profileTransactions(t)
+
+	var buf bytes.Buffer
+	if err := profiler.WritePprof(&buf); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	prof, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatalf("Unexpected parse error: %v", err)
+	}
+	if prof.DefaultSampleType != "gas" || len(prof.SampleType) != 2 {
+		t.Errorf("Expected the gas and instructions sample types, got %v", prof.SampleType)
+	}
+	if len(prof.Sample) != 15 {
+		t.Fatalf("Expected 15 samples, got %d", len(prof.Sample))
+	}
+
+	var gas int64
+	for _, s := range prof.Sample {
+		gas += s.Value[0]
+		leaf := s.Location[0].Line[0]
+		if leaf.Function.Name != "0x00000000000000000000000000000000000000bb" {
+			continue
+		}
+		if len(s.Location) != 2 {
+			t.Errorf("Expected the callee's %s below the CALL, got %d locations", s.Label["opcode"], len(s.Location))
+			continue
+		}
+		if caller := s.Location[1].Line[0]; caller.Function.Name != "0x00000000000000000000000000000000000000aa" || caller.Line != 11 {
+			t.Errorf("Expected the CALL at 0xaa:11 as the caller, got %s:%d", caller.Function.Name, caller.Line)
+		}
+	}
+	if uint64(gas) != profiler.TotalGas() {
+		t.Errorf("Expected the samples to add up to %d gas, got %d", profiler.TotalGas(), gas)
+	}
+}
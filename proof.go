@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"prevm/config"
+	"prevm/hexutil"
+	"prevm/rlp"
+	"prevm/trie"
+)
+
+var ErrProofMismatch = errors.New("proof does not match claimed value")
+
+// AccountResult is an account with its Merkle proof against the state root
+// and proofs for some of its storage slots. It marshals to the JSON shape
+// returned by eth_getProof (EIP-1186).
+type AccountResult struct {
+	Address      hexutil.Bytes   `json:"address"`
+	AccountProof []hexutil.Bytes `json:"accountProof"`
+	Balance      *hexutil.Big    `json:"balance"`
+	CodeHash     hexutil.Bytes   `json:"codeHash"`
+	Nonce        hexutil.Uint64  `json:"nonce"`
+	StorageHash  hexutil.Bytes   `json:"storageHash"`
+	StorageProof []StorageResult `json:"storageProof"`
+}
+
+// StorageResult is a storage slot with its Merkle proof against the
+// account's storage root.
+type StorageResult struct {
+	Key   hexutil.Bytes   `json:"key"`
+	Value *hexutil.Big    `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// GetProof returns the proof of the account at addr and of the given
+// storage slots. Accounts and slots that don't exist get proofs of absence.
+func (s *StateDB) GetProof(addr [20]byte, keys [][32]byte) *AccountResult {
+	acc := s.fullAccount(addr, s.GetAccount(addr))
+	storage := acc.storageTrie()
+	storageRoot := storage.Hash()
+	codeHash := acc.CodeHash()
+
+	result := &AccountResult{
+		Address:      addr[:],
+		AccountProof: toHexList(s.stateTrie().Prove(addr[:])),
+		Balance:      (*hexutil.Big)(new(big.Int).Set(acc.Balance)),
+		CodeHash:     codeHash[:],
+		Nonce:        hexutil.Uint64(acc.Nonce),
+		StorageHash:  storageRoot[:],
+		StorageProof: make([]StorageResult, len(keys)),
+	}
+	for i, key := range keys {
+		value := new(big.Int).SetBytes(acc.Storage[key])
+		result.StorageProof[i] = StorageResult{
+			Key:   append([]byte(nil), key[:]...),
+			Value: (*hexutil.Big)(value),
+			Proof: toHexList(storage.Prove(key[:])),
+		}
+	}
+	return result
+}
+
+// VerifyAccountProof checks the account and storage proofs of res against
+// the state root, and that they prove the values claimed in res.
+func VerifyAccountProof(root [32]byte, res *AccountResult) error {
+	if len(res.Address) != 20 {
+		return fmt.Errorf("%w: %d bytes", ErrInvalidAddress, len(res.Address))
+	}
+
+	value, err := trie.VerifyProof(root, config.Hash(res.Address), fromHexList(res.AccountProof))
+	if err != nil {
+		return err
+	}
+
+	// A missing account is proven to be empty.
+	nonce, balance := uint64(0), new(big.Int)
+	codeHash, storageRoot := EmptyCodeHash[:], trie.EmptyRoot[:]
+	if value != nil {
+		item, err := rlp.Decode(value)
+		if err != nil {
+			return err
+		}
+		fields, err := item.Items(4)
+		if err != nil {
+			return err
+		}
+		if nonce, err = fields[0].Uint64(); err != nil {
+			return err
+		}
+		if balance, err = fields[1].BigInt(); err != nil {
+			return err
+		}
+		if storageRoot, err = fields[2].Bytes(); err != nil {
+			return err
+		}
+		if codeHash, err = fields[3].Bytes(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case uint64(res.Nonce) != nonce:
+		return fmt.Errorf("%w: nonce %d, proven %d", ErrProofMismatch, res.Nonce, nonce)
+	case res.Balance == nil || res.Balance.ToInt().Cmp(balance) != 0:
+		return fmt.Errorf("%w: balance, proven %v", ErrProofMismatch, balance)
+	case string(res.CodeHash) != string(codeHash):
+		return fmt.Errorf("%w: code hash, proven %x", ErrProofMismatch, codeHash)
+	case string(res.StorageHash) != string(storageRoot):
+		return fmt.Errorf("%w: storage hash, proven %x", ErrProofMismatch, storageRoot)
+	}
+
+	var storageHash [32]byte
+	copy(storageHash[:], storageRoot)
+	for _, sp := range res.StorageProof {
+		if err := verifyStorageProof(storageHash, sp); err != nil {
+			return fmt.Errorf("storage slot %x: %w", []byte(sp.Key), err)
+		}
+	}
+	return nil
+}
+
+func verifyStorageProof(root [32]byte, sp StorageResult) error {
+	if len(sp.Key) != 32 {
+		return fmt.Errorf("%w: key of %d bytes", ErrInvalidHashSize, len(sp.Key))
+	}
+
+	value, err := trie.VerifyProof(root, config.Hash(sp.Key), fromHexList(sp.Proof))
+	if err != nil {
+		return err
+	}
+
+	proven := new(big.Int)
+	if value != nil {
+		item, err := rlp.Decode(value)
+		if err != nil {
+			return err
+		}
+		raw, err := item.Bytes()
+		if err != nil {
+			return err
+		}
+		proven.SetBytes(raw)
+	}
+	if sp.Value == nil || sp.Value.ToInt().Cmp(proven) != 0 {
+		return fmt.Errorf("%w: value, proven %v", ErrProofMismatch, proven)
+	}
+	return nil
+}
+
+func toHexList(list [][]byte) []hexutil.Bytes {
+	out := make([]hexutil.Bytes, len(list))
+	for i, b := range list {
+		out[i] = b
+	}
+	return out
+}
+
+func fromHexList(list []hexutil.Bytes) [][]byte {
+	out := make([][]byte, len(list))
+	for i, b := range list {
+		out[i] = b
+	}
+	return out
+}
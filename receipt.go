@@ -0,0 +1,98 @@
+package main
+
+import (
+	"math/big"
+	"prevm/config"
+)
+
+// Receipt status values.
+const (
+	ReceiptStatusFailed     = uint64(0)
+	ReceiptStatusSuccessful = uint64(1)
+)
+
+// BloomByteLength is the size of a logs bloom filter in bytes.
+const BloomByteLength = 256
+
+// Bloom is the 2048-bit bloom filter over the addresses and topics of a set
+// of logs, as stored in receipts and block headers.
+type Bloom [BloomByteLength]byte
+
+// Add adds a value (an address or a topic) to the filter. Three 11-bit
+// indices are taken from the first six bytes of its Keccak-256 hash.
+func (b *Bloom) Add(data []byte) {
+	hash := config.Hash(data)
+	for i := 0; i < 6; i += 2 {
+		bit := (uint(hash[i])<<8 | uint(hash[i+1])) & 2047
+		b[BloomByteLength-1-bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Test reports whether data may have been added to the filter.
+func (b *Bloom) Test(data []byte) bool {
+	var probe Bloom
+	probe.Add(data)
+	for i := range probe {
+		if probe[i]&b[i] != probe[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Or merges other into the filter.
+func (b *Bloom) Or(other *Bloom) {
+	for i := range b {
+		b[i] |= other[i]
+	}
+}
+
+// Log is an event emitted by the LOG0-LOG4 opcodes.
+type Log struct {
+	// Consensus fields.
+	Address [20]byte
+	Topics  [][32]byte
+	Data    []byte
+
+	// Derived fields, filled in when the log is included in a block.
+	BlockNumber uint64
+	BlockHash   [32]byte
+	TxHash      [32]byte
+	TxIndex     uint
+	Index       uint // index of the log in the block
+	Removed     bool
+}
+
+// LogsBloom returns the bloom filter of the given logs.
+func LogsBloom(logs []*Log) Bloom {
+	var bloom Bloom
+	for _, log := range logs {
+		bloom.Add(log.Address[:])
+		for _, topic := range log.Topics {
+			bloom.Add(topic[:])
+		}
+	}
+	return bloom
+}
+
+// Receipt records the outcome of a transaction included in a block.
+type Receipt struct {
+	// Consensus fields.
+	Type              byte
+	Status            uint64
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*Log
+
+	// Derived fields.
+	TxHash            [32]byte
+	ContractAddress   *[20]byte
+	GasUsed           uint64
+	EffectiveGasPrice *big.Int
+	BlobGasUsed       uint64
+	BlobGasPrice      *big.Int
+
+	BlockHash        [32]byte
+	BlockNumber      *big.Int
+	TransactionIndex uint
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"math/big"
+	"prevm/machine"
+	"slices"
+)
+
+// Step is an instruction recorded by a Recorder, with the changes that
+// led to the state before it. Replaying the changes of the steps up to an
+// instruction rebuilds the state at that point.
+type Step struct {
+	PC    uint64
+	Op    byte
+	Gas   uint64 // gas left before the instruction
+	Cost  uint64 // cost of the instruction
+	Depth int
+	Frame int   // index of the call frame, in the order frames started
+	Err   error // set if the instruction can't run
+
+	// The changes since the previous step of the same frame, or since the
+	// frame started: Pops were taken off the stack and Pushes put in their
+	// place, bottom first, and memory was resized to MemSize.
+	Pops, Pushes []*big.Int
+	MemSize      uint64
+	MemWrite     *MemWrite // nil if memory wasn't written
+
+	// The storage writes since the previous step of the transaction,
+	// including those undoing the writes of frames that failed.
+	StorageWrites []StorageWrite
+}
+
+// MemWrite is a write to the memory of a frame.
+type MemWrite struct {
+	Offset uint64
+	Prev   []byte
+	Data   []byte
+}
+
+// StorageWrite is a write to a storage slot.
+type StorageWrite struct {
+	Address [20]byte
+	Slot    [32]byte
+	Prev    [32]byte
+	Value   [32]byte
+}
+
+// Recorder is a Tracer that records every instruction of a transaction
+// with the changes it made to the stack, memory and storage, so that the
+// state at any point of the execution can be rebuilt, going backwards as
+// well as forwards. It only keeps the last transaction.
+type Recorder struct {
+	NoopTracer
+	state   *StateDB
+	steps   []*Step
+	frames  []*recFrame // every frame, in the order they started
+	active  []*recFrame // the frames running, innermost last
+	log     []StorageWrite
+	pending []StorageWrite // writes not attached to a step yet
+	initial map[[20]byte]map[[32]byte][32]byte
+}
+
+// recFrame is a call frame seen by the Recorder.
+type recFrame struct {
+	index   int
+	address [20]byte // the account whose storage is used
+	code    []byte
+	steps   []int // the steps run by the frame
+	writes  int   // length of the storage log when the frame started
+
+	// The stack and memory as of the last step.
+	stack  []*big.Int
+	memory []byte
+}
+
+// NewRecorder returns an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{initial: make(map[[20]byte]map[[32]byte][32]byte)}
+}
+
+// Steps returns the recorded steps.
+func (r *Recorder) Steps() []*Step {
+	return r.steps
+}
+
+func (r *Recorder) OnTxStart(evm *EVM, tx *Transaction, sender [20]byte) {
+	*r = Recorder{state: evm.State, initial: make(map[[20]byte]map[[32]byte][32]byte)}
+}
+
+func (r *Recorder) OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int) {
+	f := &recFrame{index: len(r.frames), writes: len(r.log)}
+	r.frames = append(r.frames, f)
+	r.active = append(r.active, f)
+}
+
+func (r *Recorder) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	if len(r.active) == 0 {
+		return
+	}
+	f := r.active[len(r.active)-1]
+	r.active = r.active[:len(r.active)-1]
+	if err == nil {
+		return
+	}
+	// The state reverts without reporting it: undo the writes of the
+	// frame, and of the frames it started, in reverse.
+	for i := len(r.log) - 1; i >= f.writes; i-- {
+		w := r.log[i]
+		r.write(StorageWrite{Address: w.Address, Slot: w.Slot, Prev: w.Value, Value: w.Prev})
+	}
+}
+
+func (r *Recorder) OnStorageChange(addr [20]byte, slot, prev, value [32]byte) {
+	r.write(StorageWrite{Address: addr, Slot: slot, Prev: prev, Value: value})
+}
+
+func (r *Recorder) write(w StorageWrite) {
+	slots := r.initial[w.Address]
+	if slots == nil {
+		slots = make(map[[32]byte][32]byte)
+		r.initial[w.Address] = slots
+	}
+	if _, ok := slots[w.Slot]; !ok {
+		slots[w.Slot] = w.Prev
+	}
+	r.log = append(r.log, w)
+	r.pending = append(r.pending, w)
+}
+
+func (r *Recorder) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	if len(r.active) == 0 {
+		return
+	}
+	f := r.active[len(r.active)-1]
+	if len(f.steps) == 0 {
+		f.address, f.code = ec.Address, ec.Bytecode
+	}
+	s := &Step{
+		PC:            pc,
+		Op:            op,
+		Gas:           gas,
+		Cost:          cost,
+		Depth:         depth,
+		Frame:         f.index,
+		Err:           err,
+		StorageWrites: r.pending,
+	}
+	r.pending = nil
+
+	// The items above the part of the stack left untouched were replaced.
+	stack := ec.Stack.GetData()
+	keep := 0
+	for keep < len(f.stack) && keep < len(stack) && f.stack[keep].Cmp(stack[keep]) == 0 {
+		keep++
+	}
+	s.Pops = slices.Clone(f.stack[keep:])
+	for _, v := range stack[keep:] {
+		s.Pushes = append(s.Pushes, new(big.Int).Set(v))
+	}
+	f.stack = append(f.stack[:keep], s.Pushes...)
+
+	// Memory only grows, and a single instruction writes a single range.
+	mem := ec.Memory.GetData()
+	if len(mem) > len(f.memory) {
+		f.memory = append(f.memory, make([]byte, len(mem)-len(f.memory))...)
+	}
+	s.MemSize = uint64(len(mem))
+	if !bytes.Equal(f.memory, mem) {
+		start, end := 0, len(mem)
+		for f.memory[start] == mem[start] {
+			start++
+		}
+		for f.memory[end-1] == mem[end-1] {
+			end--
+		}
+		s.MemWrite = &MemWrite{
+			Offset: uint64(start),
+			Prev:   slices.Clone(f.memory[start:end]),
+			Data:   slices.Clone(mem[start:end]),
+		}
+		copy(f.memory[start:end], mem[start:end])
+	}
+
+	f.steps = append(f.steps, len(r.steps))
+	r.steps = append(r.steps, s)
+}
+
+// State rebuilds the state before the i-th recorded step. Storage slots
+// the transaction didn't write are read from the current state.
+func (r *Recorder) State(i int) *DebugState {
+	s := r.steps[i]
+	f := r.frames[s.Frame]
+
+	var stack []*big.Int
+	var mem []byte
+	for _, j := range f.steps {
+		if j > i {
+			break
+		}
+		st := r.steps[j]
+		stack = append(stack[:len(stack)-len(st.Pops)], st.Pushes...)
+		if uint64(len(mem)) < st.MemSize {
+			mem = append(mem, make([]byte, st.MemSize-uint64(len(mem)))...)
+		}
+		if w := st.MemWrite; w != nil {
+			copy(mem[w.Offset:], w.Data)
+		}
+	}
+
+	state := &DebugState{
+		Step:    i,
+		PC:      s.PC,
+		Op:      s.Op,
+		Gas:     s.Gas,
+		Cost:    s.Cost,
+		Depth:   s.Depth,
+		Address: f.address,
+		Code:    f.code,
+		Stack:   machine.NewStack(1024),
+		Memory:  machine.NewMemory(),
+		Storage: accountStorage(r.state, f.address),
+		Err:     s.Err,
+	}
+	for _, v := range stack {
+		state.Stack.Push(new(big.Int).Set(v))
+	}
+	state.Memory.Set(0, mem)
+
+	for slot, value := range r.initial[f.address] {
+		state.Storage[slot] = value
+	}
+	for _, st := range r.steps[:i+1] {
+		for _, w := range st.StorageWrites {
+			if w.Address == f.address {
+				state.Storage[w.Slot] = w.Value
+			}
+		}
+	}
+	// Slots holding zero are empty.
+	maps.DeleteFunc(state.Storage, func(slot, value [32]byte) bool {
+		return value == [32]byte{}
+	})
+	return state
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// liveStates is a Tracer taking a snapshot of the state before every
+// instruction, to check what a Recorder rebuilds against.
+type liveStates struct {
+	NoopTracer
+	state  *StateDB
+	states []*DebugState
+}
+
+func (l *liveStates) OnTxStart(evm *EVM, tx *Transaction, sender [20]byte) {
+	l.state = evm.State
+}
+
+func (l *liveStates) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	l.states = append(l.states, &DebugState{
+		Step:    len(l.states),
+		PC:      pc,
+		Op:      op,
+		Gas:     gas,
+		Cost:    cost,
+		Depth:   ec.Depth,
+		Address: ec.Address,
+		Code:    ec.Bytecode,
+		Stack:   ec.Stack.Copy(),
+		Memory:  ec.Memory.Copy(),
+		Storage: accountStorage(l.state, ec.Address),
+		Err:     err,
+	})
+}
+
+// TestRecorderState checks the state the Recorder rebuilds before every
+// step against the live state at that step, going backwards from the end.
+// The transaction calls a contract that writes memory and storage, and
+// delegates to a contract that writes its storage and reverts.
+func TestRecorderState(t *testing.T) {
+	state := NewStateDB()
+	state.SetBalance(testSender, big.NewInt(1_000_000))
+	for addr, src := range map[byte]string{
+		// SSTORE(0, 1), MSTORE(0, 0xff), CALL 0xbb, then MSTORE(32, the
+		// success of the call) and SLOAD(0).
+		0xaa: `PUSH1 1 PUSH1 0 SSTORE PUSH1 0xff PUSH1 0 MSTORE
+			PUSH1 0 DUP1 DUP1 DUP1 DUP1 PUSH1 0xbb PUSH2 0xffff CALL
+			PUSH1 32 MSTORE PUSH1 0 SLOAD POP STOP`,
+		// MSTORE(0, 3), DELEGATECALL 0xcc, SSTORE(2, 7) and RETURN(0, 32).
+		0xbb: `PUSH1 3 PUSH1 0 MSTORE
+			PUSH1 0 DUP1 DUP1 DUP1 PUSH1 0xcc PUSH2 0xffff DELEGATECALL POP
+			PUSH1 7 PUSH1 2 SSTORE PUSH1 32 PUSH1 0 RETURN`,
+		// SSTORE(1, 5), MSTORE(0, 9) and REVERT(0, 0).
+		0xcc: "PUSH1 5 PUSH1 1 SSTORE PUSH1 9 PUSH1 0 MSTORE PUSH1 0 DUP1 REVERT",
+	} {
+		code, err := Assemble(src)
+		if err != nil {
+			t.Fatalf("Unexpected assembler error: %v", err)
+		}
+		state.SetCode([20]byte{19: addr}, code)
+	}
+	// Written by 0xcc for 0xbb, and reverted.
+	state.SetStorage([20]byte{19: 0xbb}, [32]byte{31: 1}, []byte{0x01})
+
+	recorder, live := NewRecorder(), &liveStates{}
+	evm := NewEVM(state, testBlock(nil))
+	evm.Config.Tracer = MultiTracer{recorder, live}
+	to := [20]byte{19: 0xaa}
+	res, err := evm.ProcessTransaction(&Transaction{To: &to, GasLimit: 200000, GasPrice: big.NewInt(1)}, testSender)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if res.Failed() {
+		t.Fatalf("Unexpected execution error: %v", res.Err)
+	}
+
+	if len(recorder.Steps()) != len(live.states) {
+		t.Fatalf("Expected %d steps, got %d", len(live.states), len(recorder.Steps()))
+	}
+	isZero := func(slot, value [32]byte) bool { return value == [32]byte{} }
+	for i := len(live.states) - 1; i >= 0; i-- {
+		want, got := live.states[i], recorder.State(i)
+		name := OpcodeName(want.Op)
+		if got.Step != want.Step || got.PC != want.PC || got.Op != want.Op || got.Gas != want.Gas ||
+			got.Cost != want.Cost || got.Depth != want.Depth || got.Address != want.Address || !bytes.Equal(got.Code, want.Code) {
+			t.Errorf("%d %s: Expected %+v, got %+v", i, name, want, got)
+		}
+		if !reflect.DeepEqual(got.Stack.GetData(), want.Stack.GetData()) {
+			t.Errorf("%d %s: Expected the stack %v, got %v", i, name, want.Stack.GetData(), got.Stack.GetData())
+		}
+		if !bytes.Equal(got.Memory.GetData(), want.Memory.GetData()) {
+			t.Errorf("%d %s: Expected the memory %x, got %x", i, name, want.Memory.GetData(), got.Memory.GetData())
+		}
+		maps.DeleteFunc(want.Storage, isZero)
+		if !maps.Equal(got.Storage, want.Storage) {
+			t.Errorf("%d %s: Expected the storage %x, got %x", i, name, want.Storage, got.Storage)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package rlp
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+var (
+	ErrUnexpectedEnd   = errors.New("rlp: unexpected end of input")
+	ErrTrailingBytes   = errors.New("rlp: trailing bytes after value")
+	ErrNonCanonical    = errors.New("rlp: non-canonical encoding")
+	ErrExpectedString  = errors.New("rlp: expected string")
+	ErrExpectedList    = errors.New("rlp: expected list")
+	ErrUintOverflow    = errors.New("rlp: integer too large")
+	ErrLeadingZeroInt  = errors.New("rlp: integer has leading zero bytes")
+	ErrValueTooLarge   = errors.New("rlp: value size exceeds input")
+	ErrWrongListLength = errors.New("rlp: wrong number of list elements")
+)
+
+// Item is a decoded RLP value: either a byte string or a list of items.
+type Item struct {
+	IsList bool
+	// Data holds the payload of a string item.
+	Data []byte
+	// List holds the elements of a list item.
+	List []Item
+	// Raw is the full encoding of the item, header included.
+	Raw []byte
+}
+
+// Decode decodes exactly one RLP value from b.
+func Decode(b []byte) (Item, error) {
+	item, rest, err := decodeItem(b)
+	if err != nil {
+		return Item{}, err
+	}
+	if len(rest) > 0 {
+		return Item{}, ErrTrailingBytes
+	}
+	return item, nil
+}
+
+// Split returns the first value of b without decoding its content, along
+// with its payload and the bytes that follow it.
+func Split(b []byte) (isList bool, content, rest []byte, err error) {
+	if len(b) == 0 {
+		return false, nil, nil, ErrUnexpectedEnd
+	}
+
+	prefix := b[0]
+	switch {
+	case prefix < 0x80:
+		return false, b[:1], b[1:], nil
+
+	case prefix < 0xb8:
+		size := int(prefix - 0x80)
+		if size > len(b)-1 {
+			return false, nil, nil, ErrValueTooLarge
+		}
+		// A single byte below 0x80 must be encoded as itself.
+		if size == 1 && b[1] < 0x80 {
+			return false, nil, nil, ErrNonCanonical
+		}
+		return false, b[1 : 1+size], b[1+size:], nil
+
+	case prefix < 0xc0:
+		size, headerLen, err := readLongSize(b, prefix-0xb7)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		return false, b[headerLen : headerLen+size], b[headerLen+size:], nil
+
+	case prefix < 0xf8:
+		size := int(prefix - 0xc0)
+		if size > len(b)-1 {
+			return false, nil, nil, ErrValueTooLarge
+		}
+		return true, b[1 : 1+size], b[1+size:], nil
+
+	default:
+		size, headerLen, err := readLongSize(b, prefix-0xf7)
+		if err != nil {
+			return false, nil, nil, err
+		}
+		return true, b[headerLen : headerLen+size], b[headerLen+size:], nil
+	}
+}
+
+// readLongSize reads the big-endian payload size that follows the prefix of
+// a long string or list, returning the size and the total header length.
+func readLongSize(b []byte, sizeLen byte) (int, int, error) {
+	headerLen := 1 + int(sizeLen)
+	if len(b) < headerLen {
+		return 0, 0, ErrUnexpectedEnd
+	}
+	if b[1] == 0 {
+		return 0, 0, ErrNonCanonical
+	}
+	if sizeLen > 8 {
+		return 0, 0, ErrValueTooLarge
+	}
+
+	var size uint64
+	for _, c := range b[1:headerLen] {
+		size = size<<8 | uint64(c)
+	}
+	// Payloads below 56 bytes must use the short form.
+	if size < 56 {
+		return 0, 0, ErrNonCanonical
+	}
+	if size > uint64(len(b)-headerLen) {
+		return 0, 0, ErrValueTooLarge
+	}
+	return int(size), headerLen, nil
+}
+
+func decodeItem(b []byte) (Item, []byte, error) {
+	isList, content, rest, err := Split(b)
+	if err != nil {
+		return Item{}, nil, err
+	}
+	raw := b[:len(b)-len(rest)]
+
+	if !isList {
+		return Item{Data: content, Raw: raw}, rest, nil
+	}
+
+	item := Item{IsList: true, List: []Item{}, Raw: raw}
+	for len(content) > 0 {
+		var elem Item
+		elem, content, err = decodeItem(content)
+		if err != nil {
+			return Item{}, nil, err
+		}
+		item.List = append(item.List, elem)
+	}
+	return item, rest, nil
+}
+
+// Bytes returns the payload of a string item.
+func (it Item) Bytes() ([]byte, error) {
+	if it.IsList {
+		return nil, ErrExpectedString
+	}
+	return it.Data, nil
+}
+
+// Uint64 decodes a string item as a canonical unsigned integer.
+func (it Item) Uint64() (uint64, error) {
+	if it.IsList {
+		return 0, ErrExpectedString
+	}
+	if len(it.Data) > 8 {
+		return 0, ErrUintOverflow
+	}
+	if len(it.Data) > 0 && it.Data[0] == 0 {
+		return 0, ErrLeadingZeroInt
+	}
+
+	var u uint64
+	for _, c := range it.Data {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// BigInt decodes a string item as a canonical unsigned integer of at most
+// 256 bits.
+func (it Item) BigInt() (*big.Int, error) {
+	if it.IsList {
+		return nil, ErrExpectedString
+	}
+	if len(it.Data) > 32 {
+		return nil, ErrUintOverflow
+	}
+	if len(it.Data) > 0 && it.Data[0] == 0 {
+		return nil, ErrLeadingZeroInt
+	}
+	return new(big.Int).SetBytes(it.Data), nil
+}
+
+// Items returns the elements of a list item, checking that there are
+// exactly n of them. A negative n skips the length check.
+func (it Item) Items(n int) ([]Item, error) {
+	if !it.IsList {
+		return nil, ErrExpectedList
+	}
+	if n >= 0 && len(it.List) != n {
+		return nil, fmt.Errorf("%w: have %d, want %d", ErrWrongListLength, len(it.List), n)
+	}
+	return it.List, nil
+}
@@ -0,0 +1,76 @@
+package rlp
+
+import (
+	"math/big"
+)
+
+// EncodeBytes encodes a byte string. A single byte below 0x80 is its own
+// encoding; anything else is prefixed with its length.
+func EncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(encodeLength(len(b), 0x80), b...)
+}
+
+// EncodeString encodes a Go string as a byte string.
+func EncodeString(s string) []byte {
+	return EncodeBytes([]byte(s))
+}
+
+// EncodeUint encodes an unsigned integer as a big-endian byte string with
+// no leading zeros. Zero is encoded as the empty string.
+func EncodeUint(u uint64) []byte {
+	return EncodeBytes(uintBytes(u))
+}
+
+// EncodeBigInt encodes a non-negative big integer the same way as EncodeUint.
+// A nil integer is encoded as zero.
+func EncodeBigInt(i *big.Int) []byte {
+	if i == nil {
+		return EncodeBytes(nil)
+	}
+	return EncodeBytes(i.Bytes())
+}
+
+// EncodeList wraps already encoded items into a list.
+func EncodeList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+
+	out := encodeLength(size, 0xc0)
+	for _, item := range items {
+		out = append(out, item...)
+	}
+	return out
+}
+
+// encodeLength returns the header for a payload of the given size. offset is
+// 0x80 for strings and 0xc0 for lists.
+func encodeLength(size int, offset byte) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+
+	sizeBytes := uintBytes(uint64(size))
+	header := make([]byte, 0, 1+len(sizeBytes))
+	header = append(header, offset+55+byte(len(sizeBytes)))
+	return append(header, sizeBytes...)
+}
+
+// uintBytes returns the minimal big-endian representation of u.
+func uintBytes(u uint64) []byte {
+	var buf [8]byte
+	n := 0
+	for i := 7; i >= 0; i-- {
+		b := byte(u >> (8 * uint(i)))
+		if n == 0 && b == 0 {
+			continue
+		}
+		buf[n] = b
+		n++
+	}
+	return buf[:n]
+}
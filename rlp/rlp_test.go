@@ -0,0 +1,140 @@
+package rlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func unhex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// TestEncodeVectors checks the encoder against the examples from the
+// Ethereum wiki.
+func TestEncodeVectors(t *testing.T) {
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"dog", EncodeString("dog"), "83646f67"},
+		{"empty string", EncodeBytes(nil), "80"},
+		{"single byte", EncodeBytes([]byte{0x0f}), "0f"},
+		{"byte 0x80", EncodeBytes([]byte{0x80}), "8180"},
+		{"zero", EncodeUint(0), "80"},
+		{"fifteen", EncodeUint(15), "0f"},
+		{"1024", EncodeUint(1024), "820400"},
+		{"big int", EncodeBigInt(big.NewInt(1024)), "820400"},
+		{"nil big int", EncodeBigInt(nil), "80"},
+		{"empty list", EncodeList(), "c0"},
+		{"cat dog", EncodeList(EncodeString("cat"), EncodeString("dog")), "c88363617483646f67"},
+		{
+			// [ [], [[]], [ [], [[]] ] ]
+			"set theoretic",
+			EncodeList(EncodeList(), EncodeList(EncodeList()), EncodeList(EncodeList(), EncodeList(EncodeList()))),
+			"c7c0c1c0c3c0c1c0",
+		},
+		{
+			"long string",
+			EncodeString("Lorem ipsum dolor sit amet, consectetur adipisicing elit"),
+			"b8384c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e7365637465747572206164697069736963696e6720656c6974",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := hex.EncodeToString(tt.got); got != tt.want {
+			t.Errorf("%s: Expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestDecodeRoundTrip checks that decoding an encoded list gives back the
+// original values.
+func TestDecodeRoundTrip(t *testing.T) {
+	long := []byte(strings.Repeat("a", 1024))
+	enc := EncodeList(
+		EncodeUint(0),
+		EncodeUint(1<<40),
+		EncodeBigInt(new(big.Int).Lsh(big.NewInt(1), 255)),
+		EncodeBytes(long),
+		EncodeList(EncodeString("cat")),
+	)
+
+	item, err := Decode(enc)
+	if err != nil {
+		t.Fatalf("Unexpected decode error: %v", err)
+	}
+	elems, err := item.Items(5)
+	if err != nil {
+		t.Fatalf("Unexpected list error: %v", err)
+	}
+
+	if v, err := elems[0].Uint64(); err != nil || v != 0 {
+		t.Errorf("Expected 0, got %d (%v)", v, err)
+	}
+	if v, err := elems[1].Uint64(); err != nil || v != 1<<40 {
+		t.Errorf("Expected %d, got %d (%v)", uint64(1<<40), v, err)
+	}
+	if v, err := elems[2].BigInt(); err != nil || v.BitLen() != 256 {
+		t.Errorf("Expected 2^255, got %v (%v)", v, err)
+	}
+	if v, err := elems[3].Bytes(); err != nil || !bytes.Equal(v, long) {
+		t.Errorf("Long string did not round trip (%v)", err)
+	}
+	if !elems[4].IsList || string(elems[4].List[0].Data) != "cat" {
+		t.Errorf("Nested list did not round trip")
+	}
+	if !bytes.Equal(item.Raw, enc) {
+		t.Errorf("Expected raw encoding to match input")
+	}
+}
+
+// TestDecodeErrors checks that malformed and non-canonical input is rejected.
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty input", "", ErrUnexpectedEnd},
+		{"short string overrun", "83646f", ErrValueTooLarge},
+		{"single byte as string", "8105", ErrNonCanonical},
+		{"long form for short string", "b80100", ErrNonCanonical},
+		{"leading zero in size", "b90000", ErrNonCanonical},
+		{"list overrun", "c3c0", ErrValueTooLarge},
+		{"trailing bytes", "8000", ErrTrailingBytes},
+	}
+
+	for _, tt := range tests {
+		_, err := Decode(unhex(tt.input))
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected error %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+// TestDecodeIntegerErrors checks the canonical integer rules.
+func TestDecodeIntegerErrors(t *testing.T) {
+	item, _ := Decode(unhex("820001"))
+	if _, err := item.Uint64(); !errors.Is(err, ErrLeadingZeroInt) {
+		t.Errorf("Expected leading zero error, got %v", err)
+	}
+
+	item, _ = Decode(EncodeBytes(make([]byte, 9)))
+	if _, err := item.Uint64(); !errors.Is(err, ErrUintOverflow) {
+		t.Errorf("Expected overflow error, got %v", err)
+	}
+
+	item, _ = Decode(EncodeList())
+	if _, err := item.Bytes(); !errors.Is(err, ErrExpectedString) {
+		t.Errorf("Expected string error, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"prevm/config"
+	"prevm/rlp"
+	"prevm/trie"
+)
+
+// EmptyCodeHash is the Keccak-256 hash of empty code, the code hash of
+// every account without code.
+var EmptyCodeHash = [32]byte{
+	0xc5, 0xd2, 0x46, 0x01, 0x86, 0xf7, 0x23, 0x3c, 0x92, 0x7e, 0x7d, 0xb2, 0xdc, 0xc7, 0x03, 0xc0,
+	0xe5, 0x00, 0xb6, 0x53, 0xca, 0x82, 0x27, 0x3b, 0x7b, 0xfa, 0xd8, 0x04, 0x5d, 0x85, 0xa4, 0x70,
+}
+
+// CodeHash returns the Keccak-256 hash of the account's code.
+func (a *Account) CodeHash() [32]byte {
+	if len(a.Code) == 0 {
+		return EmptyCodeHash
+	}
+	var hash [32]byte
+	copy(hash[:], config.Hash(a.Code))
+	return hash
+}
+
+// storageTrie builds the secure storage trie of an account. Slots are keyed
+// by their hash and hold the RLP encoding of the value without leading
+// zeros; zero slots are left out.
+func (a *Account) storageTrie() *trie.SecureTrie {
+	t := trie.NewSecure()
+	for key, value := range a.Storage {
+		value = bytes.TrimLeft(value, "\x00")
+		if len(value) == 0 {
+			continue
+		}
+		t.Update(key[:], rlp.EncodeBytes(value))
+	}
+	return t
+}
+
+// encodeAccount returns the RLP encoding of an account as stored in the
+// state trie: [nonce, balance, storageRoot, codeHash].
+func encodeAccount(acc *Account, storageRoot [32]byte) []byte {
+	codeHash := acc.CodeHash()
+	return rlp.EncodeList(
+		rlp.EncodeUint(acc.Nonce),
+		rlp.EncodeBigInt(acc.Balance),
+		rlp.EncodeBytes(storageRoot[:]),
+		rlp.EncodeBytes(codeHash[:]),
+	)
+}
+
+// StorageRoot returns the storage root of addr.
+func (s *StateDB) StorageRoot(addr [20]byte) [32]byte {
+	acc := s.loadAccount(addr)
+	if acc == nil {
+		return trie.EmptyRoot
+	}
+	return s.fullAccount(addr, acc).storageTrie().Hash()
+}
+
+// stateTrie builds the secure state trie over all accounts.
+func (s *StateDB) stateTrie() *trie.SecureTrie {
+	t := trie.NewSecure()
+	s.ForEachAccount(func(addr [20]byte, acc *Account) {
+		t.Update(addr[:], encodeAccount(acc, acc.storageTrie().Hash()))
+	})
+	return t
+}
+
+// StateRoot returns the root hash of the world state, comparable with the
+// stateRoot of a client's block header. The trie is rebuilt from scratch on
+// every call.
+func (s *StateDB) StateRoot() [32]byte {
+	return s.stateTrie().Hash()
+}
+
+// TransactionsRoot returns the transactions root of a block body.
+func TransactionsRoot(txs []*Transaction) ([32]byte, error) {
+	values := make([][]byte, len(txs))
+	for i, tx := range txs {
+		enc, err := tx.MarshalBinary()
+		if err != nil {
+			return [32]byte{}, err
+		}
+		values[i] = enc
+	}
+	return trie.DeriveRoot(values), nil
+}
+
+// ReceiptsRoot returns the receipts root of a block.
+func ReceiptsRoot(receipts []*Receipt) [32]byte {
+	values := make([][]byte, len(receipts))
+	for i, receipt := range receipts {
+		values[i] = receipt.MarshalBinary()
+	}
+	return trie.DeriveRoot(values)
+}
+
+// WithdrawalsRoot returns the withdrawals root of a block (EIP-4895).
+func WithdrawalsRoot(withdrawals []Withdrawal) [32]byte {
+	values := make([][]byte, len(withdrawals))
+	for i, w := range withdrawals {
+		values[i] = rlp.EncodeList(
+			rlp.EncodeUint(w.Index),
+			rlp.EncodeUint(w.Validator),
+			rlp.EncodeBytes(w.Address[:]),
+			rlp.EncodeUint(w.Amount),
+		)
+	}
+	return trie.DeriveRoot(values)
+}
+
+// MarshalBinary returns the consensus encoding of the receipt:
+// rlp([status, cumulativeGasUsed, bloom, logs]), prefixed with the
+// transaction type for typed transactions.
+func (r *Receipt) MarshalBinary() []byte {
+	logs := make([][]byte, len(r.Logs))
+	for i, log := range r.Logs {
+		topics := make([][]byte, len(log.Topics))
+		for j, topic := range log.Topics {
+			topics[j] = rlp.EncodeBytes(topic[:])
+		}
+		logs[i] = rlp.EncodeList(
+			rlp.EncodeBytes(log.Address[:]),
+			rlp.EncodeList(topics...),
+			rlp.EncodeBytes(log.Data),
+		)
+	}
+
+	enc := rlp.EncodeList(
+		rlp.EncodeUint(r.Status),
+		rlp.EncodeUint(r.CumulativeGasUsed),
+		rlp.EncodeBytes(r.Bloom[:]),
+		rlp.EncodeList(logs...),
+	)
+	if r.Type == LegacyTxType {
+		return enc
+	}
+	return append([]byte{r.Type}, enc...)
+}
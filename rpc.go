@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// JSON-RPC 2.0 error codes, and the codes Ethereum nodes use on top of
+// them.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcServerError    = -32000
+	rpcReverted       = 3 // execution reverted, with the revert data
+)
+
+// maxRequestSize is the largest request body the server reads.
+const maxRequestSize = 5 << 20
+
+// RPCError is a JSON-RPC error. Methods return one to pick the code sent
+// to the client; other errors are sent with the generic server error code.
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return e.Message
+}
+
+// invalidParams returns the error of a method called with bad parameters.
+func invalidParams(format string, args ...any) *RPCError {
+	return &RPCError{Code: rpcInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// RPCMethod handles a JSON-RPC method. It is called with the raw params of
+// the request, which may be missing, and returns a value encoded as the
+// result.
+type RPCMethod func(params json.RawMessage) (any, error)
+
+// RPCServer serves JSON-RPC 2.0 over HTTP and WebSocket, single and batch
+// requests. WebSocket clients can also subscribe to notifications.
+type RPCServer struct {
+	mu            sync.RWMutex
+	methods       map[string]RPCMethod
+	subscriptions map[string]RPCSubscription
+}
+
+// NewRPCServer returns a server without methods.
+func NewRPCServer() *RPCServer {
+	return &RPCServer{
+		methods:       make(map[string]RPCMethod),
+		subscriptions: make(map[string]RPCSubscription),
+	}
+}
+
+// Register adds a method to the server, replacing any method of the same
+// name.
+func (s *RPCServer) Register(name string, method RPCMethod) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.methods[name] = method
+}
+
+type rpcRequest struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+}
+
+func (s *RPCServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if websocket.IsWebSocketUpgrade(r) {
+		s.serveWebSocket(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	out := s.HandleMessage(body)
+	if out == nil {
+		// Only notifications: there is nothing to answer.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
+// HandleMessage handles a single or batch request encoded as JSON and
+// returns the encoded response, or nil if the message only held
+// notifications.
+func (s *RPCServer) HandleMessage(msg []byte) []byte {
+	return s.handleMessage(msg, nil)
+}
+
+// handleMessage is HandleMessage with methods of the connection the
+// message came from, which take precedence over those of the server.
+func (s *RPCServer) handleMessage(msg []byte, local map[string]RPCMethod) []byte {
+	msg = bytes.TrimSpace(msg)
+	if len(msg) > 0 && msg[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(msg, &batch); err != nil {
+			return encodeResponse(errorResponse(nil, &RPCError{Code: rpcParseError, Message: err.Error()}))
+		}
+		if len(batch) == 0 {
+			return encodeResponse(errorResponse(nil, &RPCError{Code: rpcInvalidRequest, Message: "empty batch"}))
+		}
+		var responses []*rpcResponse
+		for _, req := range batch {
+			if resp := s.handle(req, local); resp != nil {
+				responses = append(responses, resp)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return encodeResponse(responses)
+	}
+	resp := s.handle(msg, local)
+	if resp == nil {
+		return nil
+	}
+	return encodeResponse(resp)
+}
+
+// handle handles a single request. It returns nil for a notification, a
+// request without id.
+func (s *RPCServer) handle(msg json.RawMessage, local map[string]RPCMethod) *rpcResponse {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return errorResponse(nil, &RPCError{Code: rpcParseError, Message: err.Error()})
+		}
+		return errorResponse(nil, &RPCError{Code: rpcInvalidRequest, Message: err.Error()})
+	}
+	if req.Version != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, &RPCError{Code: rpcInvalidRequest, Message: "invalid request"})
+	}
+
+	method, ok := local[req.Method]
+	if !ok {
+		s.mu.RLock()
+		method, ok = s.methods[req.Method]
+		s.mu.RUnlock()
+	}
+	if !ok {
+		if req.ID == nil {
+			return nil
+		}
+		message := fmt.Sprintf("the method %s does not exist/is not available", req.Method)
+		if req.Method == "eth_subscribe" || req.Method == "eth_unsubscribe" {
+			message = "notifications not supported"
+		}
+		return errorResponse(req.ID, &RPCError{Code: rpcMethodNotFound, Message: message})
+	}
+
+	result, err := method(req.Params)
+	logger.Debug("Served RPC call", "method", req.Method, "err", err)
+	if req.ID == nil {
+		return nil
+	}
+	if err != nil {
+		var rpcErr *RPCError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &RPCError{Code: rpcServerError, Message: err.Error()}
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+	enc, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, &RPCError{Code: rpcInternalError, Message: err.Error()})
+	}
+	return &rpcResponse{Version: "2.0", ID: req.ID, Result: enc}
+}
+
+func errorResponse(id json.RawMessage, err *RPCError) *rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &rpcResponse{Version: "2.0", ID: id, Error: err}
+}
+
+func encodeResponse(resp any) []byte {
+	out, err := json.Marshal(resp)
+	if err != nil {
+		// The responses are made of raw JSON and strings.
+		panic(err)
+	}
+	return out
+}
+
+// parseParams decodes the positional params of a request into args, which
+// are pointers. The first required args must be given; the others may be
+// left out, or be null, and keep their value.
+func parseParams(params json.RawMessage, required int, args ...any) error {
+	var list []json.RawMessage
+	if len(params) > 0 && string(params) != "null" {
+		if err := json.Unmarshal(params, &list); err != nil {
+			return invalidParams("non-array args")
+		}
+	}
+	if len(list) < required {
+		return invalidParams("missing value for required argument %d", len(list))
+	}
+	if len(list) > len(args) {
+		return invalidParams("too many arguments, want at most %d", len(args))
+	}
+	for i, raw := range list {
+		if string(raw) == "null" {
+			if i < required {
+				return invalidParams("missing value for required argument %d", i)
+			}
+			continue
+		}
+		if err := json.Unmarshal(raw, args[i]); err != nil {
+			return invalidParams("invalid argument %d: %v", i, err)
+		}
+	}
+	return nil
+}
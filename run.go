@@ -0,0 +1,360 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"prevm/config"
+	"prevm/hexutil"
+	"strings"
+
+	"github.com/charmbracelet/log"
+)
+
+var (
+	defaultSender   = [20]byte{0x73, 0x65, 0x6e, 0x64, 0x65, 0x72}             // "sender"
+	defaultReceiver = [20]byte{0x72, 0x65, 0x63, 0x65, 0x69, 0x76, 0x65, 0x72} // "receiver"
+)
+
+// runCommand implements 'prevm run': it runs bytecode as the code of the
+// receiver account, called by the sender, and prints the outcome.
+func runCommand(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: prevm run [flags] [codefile]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Runs the bytecode given with --code, or read as hex from codefile ('-' for stdin).")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	var (
+		call     = addCallFlags(fs)
+		dumpStk  = fs.Bool("stack", false, "print the final stack")
+		dumpMem  = fs.Bool("memory", false, "print the final memory")
+		debug    = fs.Bool("debug", false, "log every executed opcode")
+		jsonOut  = fs.Bool("json", false, "write an EIP-3155 JSON trace to stderr")
+		traceMem = fs.Bool("trace.memory", false, "include the memory in the JSON trace")
+		traceSto = fs.Bool("trace.storage", false, "include the accessed storage in the JSON trace")
+		noStack  = fs.Bool("trace.nostack", false, "leave the stack out of the JSON trace")
+		calls    = fs.Bool("calls", false, "print the tree of calls made")
+		callJSON = fs.Bool("calls.json", false, "print the calls made as JSON, in the format of geth's callTracer")
+		profView = fs.String("profile", "", "print the gas used by `view`: opcode, pc or address")
+		profCSV  = fs.Bool("profile.csv", false, "print the gas profile as CSV instead of a table")
+		pprofOut = fs.String("profile.pprof", "", "write the gas profile to `file` for 'go tool pprof'")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*debug {
+		config.Logger.SetLevel(log.InfoLevel)
+	}
+
+	c, err := call.setup(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	var tracers MultiTracer
+	switch {
+	case *jsonOut:
+		tracers = append(tracers, NewJSONTracer(os.Stderr, JSONTracerConfig{
+			EnableMemory:  *traceMem,
+			DisableStack:  *noStack,
+			EnableStorage: *traceSto,
+		}))
+	case *debug:
+		tracers = append(tracers, NewLogTracer(config.Logger))
+	}
+	callTracer := NewCallTracer()
+	if *calls || *callJSON {
+		tracers = append(tracers, callTracer)
+	}
+	var view GasView
+	if *profView != "" {
+		if view, err = ParseGasView(*profView); err != nil {
+			return fmt.Errorf("--profile: %w", err)
+		}
+	}
+	profiler := NewGasProfiler()
+	if *profView != "" || *pprofOut != "" {
+		tracers = append(tracers, profiler)
+	}
+
+	switch len(tracers) {
+	case 0:
+	case 1:
+		c.evm.Config.Tracer = tracers[0]
+	default:
+		c.evm.Config.Tracer = tracers
+	}
+	ec, ret, err := c.run()
+	if err != nil && ec == nil {
+		return err
+	}
+
+	fmt.Printf("Return data: %s\n", hexutil.Encode(ret))
+	fmt.Printf("Gas used:    %d\n", c.gas-ec.Gas)
+	switch {
+	case err == nil:
+		fmt.Println("Status:      success")
+	case errors.Is(err, ErrExecutionReverted):
+		fmt.Println("Status:      reverted")
+	default:
+		fmt.Printf("Status:      error: %v\n", err)
+	}
+
+	if *dumpStk {
+		printStack(os.Stdout, ec.Stack.GetData())
+	}
+	if *dumpMem {
+		printMemory(os.Stdout, ec.Memory.GetData())
+	}
+	if *calls {
+		fmt.Println("Calls:")
+		fmt.Print(callTracer.Result().Tree())
+	}
+	if *callJSON {
+		out, err := json.MarshalIndent(callTracer.Result(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	}
+	if *profView != "" {
+		fmt.Println("Gas profile:")
+		if *profCSV {
+			err = profiler.WriteCSV(os.Stdout, view)
+		} else {
+			err = profiler.WriteTable(os.Stdout, view, 0)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if *pprofOut != "" {
+		f, err := os.Create(*pprofOut)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := profiler.WritePprof(f); err != nil {
+			return err
+		}
+	}
+	return c.evm.State.Commit()
+}
+
+// callFlags are the flags describing the call made by 'prevm run' and
+// 'prevm debug'.
+type callFlags struct {
+	code, input, value, sender, receiver, genesis, datadir *string
+	gas                                                    *uint64
+}
+
+func addCallFlags(fs *flag.FlagSet) *callFlags {
+	return &callFlags{
+		code:     fs.String("code", "", "bytecode to run, as hex"),
+		input:    fs.String("input", "", "call data, as hex"),
+		value:    fs.String("value", "0", "value sent with the call in wei, as hex or decimal"),
+		gas:      fs.Uint64("gas", 10_000_000, "gas limit of the call"),
+		sender:   fs.String("sender", fmt.Sprintf("0x%x", defaultSender), "address of the caller"),
+		receiver: fs.String("receiver", fmt.Sprintf("0x%x", defaultReceiver), "address the code runs at"),
+		genesis:  fs.String("genesis", "", "genesis file holding the prestate and block context"),
+		datadir:  fs.String("datadir", "", "directory of the database holding the state, which the changes are committed to"),
+	}
+}
+
+// callSetup is a call ready to run.
+type callSetup struct {
+	evm         *EVM
+	from, to    [20]byte
+	code, input []byte
+	value       *big.Int
+	gas         uint64
+	closeDB     func() error
+}
+
+// setup parses the flags and prepares the call, reading the code from
+// codefile if it isn't given with --code. The database of --datadir is
+// open until the call is closed.
+func (f *callFlags) setup(codefile string) (_ *callSetup, err error) {
+	from, err := parseAddress(*f.sender)
+	if err != nil {
+		return nil, fmt.Errorf("--sender: %w", err)
+	}
+	to, err := parseAddress(*f.receiver)
+	if err != nil {
+		return nil, fmt.Errorf("--receiver: %w", err)
+	}
+	data, err := DecodeHex(*f.input)
+	if err != nil {
+		return nil, fmt.Errorf("--input: %w", err)
+	}
+	var amount hexutil.HexOrDecimal256
+	if err := amount.UnmarshalJSON([]byte(*f.value)); err != nil {
+		return nil, fmt.Errorf("--value: %w", err)
+	}
+
+	state, closeDB, err := openState(*f.datadir)
+	if err != nil {
+		return nil, fmt.Errorf("--datadir: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			closeDB()
+		}
+	}()
+
+	block := &BlockContext{
+		Number:     new(big.Int),
+		Timestamp:  new(big.Int),
+		Difficulty: new(big.Int),
+		GasLimit:   new(big.Int).SetUint64(*f.gas),
+		BaseFee:    new(big.Int),
+		ChainID:    big.NewInt(1),
+	}
+	if *f.genesis != "" {
+		g, err := LoadGenesis(*f.genesis)
+		if err != nil {
+			return nil, err
+		}
+		g.Apply(state)
+		block = g.ToBlock()
+	}
+
+	bytecode, err := readCode(*f.code, codefile)
+	if err != nil {
+		return nil, err
+	}
+	if bytecode == nil {
+		bytecode = state.GetCode(to)
+	}
+	if len(bytecode) == 0 {
+		return nil, errors.New("no code given, use --code or a codefile")
+	}
+
+	return &callSetup{
+		evm:     NewEVM(state, block),
+		from:    from,
+		to:      to,
+		code:    bytecode,
+		input:   data,
+		value:   amount.ToInt(),
+		gas:     *f.gas,
+		closeDB: closeDB,
+	}, nil
+}
+
+// run makes the call, see EVM.runCode.
+func (c *callSetup) run() (*ExecutionContext, []byte, error) {
+	return c.evm.runCode(c.from, c.to, c.code, c.input, c.value, c.gas)
+}
+
+// close closes the database of the state, if any.
+func (c *callSetup) close() error {
+	return c.closeDB()
+}
+
+// readCode returns the code given as hex on the command line or, if empty,
+// read from the file at path, "-" meaning stdin. It returns nil if neither
+// is given.
+func readCode(code, path string) ([]byte, error) {
+	if code == "" && path == "" {
+		return nil, nil
+	}
+	if code == "" {
+		var (
+			text []byte
+			err  error
+		)
+		if path == "-" {
+			text, err = io.ReadAll(os.Stdin)
+		} else {
+			text, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Allow the hex to be wrapped over several lines.
+		code = strings.Join(strings.Fields(string(text)), "")
+	}
+	b, err := DecodeHex(code)
+	if err != nil {
+		return nil, fmt.Errorf("code: %w", err)
+	}
+	return b, nil
+}
+
+// runCode runs code as the code of addr, called by caller, outside of a
+// transaction: no intrinsic gas is charged and no fees are paid. It returns
+// the frame the code ran in, so that its final stack and memory can be
+// inspected, along with the return data and the execution error. The frame
+// is nil if the call couldn't be made.
+func (evm *EVM) runCode(caller, addr [20]byte, code, input []byte, value *big.Int, gas uint64) (*ExecutionContext, []byte, error) {
+	if balance := evm.State.GetBalance(caller); balance.Cmp(value) < 0 {
+		return nil, nil, fmt.Errorf("%w: address 0x%x have %d want %d", ErrInsufficientFunds, caller, balance, value)
+	}
+	evm.State.Prepare()
+	evm.State.SetCode(addr, code)
+	snapshot := evm.State.Snapshot()
+
+	tracer := evm.Config.Tracer
+	if tracer != nil {
+		tracer.OnTxStart(evm, &Transaction{To: &addr, Value: value, Data: input, GasLimit: gas}, caller)
+		evm.State.tracer = tracer
+		defer func() { evm.State.tracer = nil }()
+	}
+	evm.State.Transfer(caller, addr, value)
+
+	txCtx := &TransactionContext{
+		Origin:   caller,
+		GasPrice: new(big.Int),
+		Value:    value,
+		Data:     input,
+	}
+	ec := NewExecutionContext(caller, addr, code, input, value, gas)
+	ec.Depth = 1
+	if tracer != nil {
+		tracer.OnEnter(ec.Depth, CALL, caller, addr, input, gas, value)
+	}
+	ret, err := evm.Execute(ec, txCtx)
+	if err != nil {
+		evm.State.RevertToSnapshot(snapshot)
+		if !errors.Is(err, ErrExecutionReverted) {
+			ec.Gas = 0
+		}
+	}
+	if tracer != nil {
+		tracer.OnExit(ec.Depth, ret, gas-ec.Gas, err)
+		tracer.OnTxEnd(&ExecutionResult{UsedGas: gas - ec.Gas, Err: err, ReturnData: ret}, nil)
+	}
+	return ec, ret, err
+}
+
+// printStack prints the stack top first, one 32-byte word per line.
+func printStack(w io.Writer, stack []*big.Int) {
+	fmt.Fprintln(w, "Stack:")
+	if len(stack) == 0 {
+		fmt.Fprintln(w, "  [ empty ]")
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		fmt.Fprintf(w, "  [%d]: 0x%064x\n", len(stack)-1-i, stack[i])
+	}
+}
+
+// printMemory prints the memory in rows of 32 bytes.
+func printMemory(w io.Writer, memory []byte) {
+	fmt.Fprintln(w, "Memory:")
+	if len(memory) == 0 {
+		fmt.Fprintln(w, "  [ empty ]")
+	}
+	for i := 0; i < len(memory); i += 32 {
+		end := min(i+32, len(memory))
+		fmt.Fprintf(w, "  0x%04x: %x\n", i, memory[i:end])
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout runs fn with the standard output redirected and returns
+// what it printed.
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	err = fn()
+	w.Close()
+	return <-out, err
+}
+
+// TestRunCommand checks the output of 'prevm run' for code given on the
+// command line, in a file and on stdin.
+func TestRunCommand(t *testing.T) {
+	dir := t.TempDir()
+	codefile := filepath.Join(dir, "code.hex")
+	// PUSH1 1, PUSH1 2, ADD, wrapped over two lines.
+	if err := os.WriteFile(codefile, []byte("600160\n0201\n"), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		args  []string
+		stdin string
+		want  []string
+	}{
+		{
+			name: "code flag",
+			args: []string{"--code", "0x6001600201", "--stack"},
+			want: []string{"Gas used:    9\n", "Status:      success\n", "[0]: 0x" + strings.Repeat("0", 63) + "3\n"},
+		},
+		{
+			name: "return data and memory",
+			// MSTORE(0, CALLDATALOAD(0)), RETURN(0, 32)
+			args: []string{"--code", "60003560005260206000f3", "--input", "0x" + strings.Repeat("ab", 32), "--memory"},
+			want: []string{"Return data: 0x" + strings.Repeat("ab", 32) + "\n", "0x0000: " + strings.Repeat("ab", 32) + "\n"},
+		},
+		{
+			name: "reverted",
+			args: []string{"--code", "60006000fd"},
+			want: []string{"Status:      reverted\n"},
+		},
+		{
+			name: "codefile",
+			args: []string{"--stack", codefile},
+			want: []string{"Status:      success\n", "[0]: 0x" + strings.Repeat("0", 63) + "3\n"},
+		},
+		{
+			name:  "stdin",
+			args:  []string{"--stack", "-"},
+			stdin: "0x6001600201\n",
+			want:  []string{"Status:      success\n", "[0]: 0x" + strings.Repeat("0", 63) + "3\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		stdin := os.Stdin
+		if tt.stdin != "" {
+			path := filepath.Join(dir, "stdin")
+			if err := os.WriteFile(path, []byte(tt.stdin), 0o644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer f.Close()
+			os.Stdin = f
+		}
+		out, err := captureStdout(t, func() error { return runCommand(tt.args) })
+		os.Stdin = stdin
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: Expected the output to contain %q, got\n%s", tt.name, want, out)
+			}
+		}
+	}
+}
+
+// TestRunCommandFlags checks that invalid flags are reported.
+func TestRunCommandFlags(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no code", []string{}, "no code given"},
+		{"bad code", []string{"--code", "0xzz"}, "code:"},
+		{"bad input", []string{"--code", "00", "--input", "zz"}, "--input"},
+		{"bad value", []string{"--code", "00", "--value", "ten"}, "--value"},
+		{"bad sender", []string{"--code", "00", "--sender", "0x01"}, "--sender"},
+		{"bad receiver", []string{"--code", "00", "--receiver", "0x"}, "--receiver"},
+		{"unknown flag", []string{"--nope"}, "not defined"},
+		{"missing codefile", []string{filepath.Join(t.TempDir(), "none")}, "no such file"},
+		{"missing genesis", []string{"--code", "00", "--genesis", filepath.Join(t.TempDir(), "none")}, "no such file"},
+	}
+
+	for _, tt := range tests {
+		_, err := captureStdout(t, func() error {
+			// Keep the flag package quiet about the unknown flag.
+			stderr := os.Stderr
+			os.Stderr, _ = os.Open(os.DevNull)
+			defer func() { os.Stderr = stderr }()
+			return runCommand(tt.args)
+		})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Expected an error containing %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+// TestRunCommandGenesis checks that the prestate and block context of a
+// genesis file are used, the receiver's code running when none is given.
+func TestRunCommandGenesis(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "genesis.json")
+	genesis := `{
+  "config": {"chainId": 5},
+  "number": "0x10",
+  "gasLimit": "0x1000000",
+  "alloc": {
+    "0x7265636569766572000000000000000000000000": {
+      "code": "0x6000544601430160005260206000f3",
+      "storage": {"0x00": "0x100"}
+    },
+    "0x73656e6465720000000000000000000000000000": {"balance": "1000"}
+  }
+}`
+	if err := os.WriteFile(path, []byte(genesis), 0o644); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// SLOAD(0) + CHAINID + NUMBER, returned as a word.
+	out, err := captureStdout(t, func() error {
+		return runCommand([]string{"--genesis", path, "--value", "1000"})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "Return data: 0x" + strings.Repeat("0", 61) + "115\n"; !strings.Contains(out, want) {
+		t.Errorf("Expected the output to contain %q, got\n%s", want, out)
+	}
+
+	// The sender can't send more than its balance.
+	_, err = captureStdout(t, func() error {
+		return runCommand([]string{"--genesis", path, "--value", "1001"})
+	})
+	if err == nil || !strings.Contains(err.Error(), "insufficient funds") {
+		t.Errorf("Expected an insufficient funds error, got %v", err)
+	}
+}
+
+// TestRunCommandDatadir checks that the changes of a run are committed to
+// the datadir and seen by the next run.
+func TestRunCommandDatadir(t *testing.T) {
+	datadir := t.TempDir()
+
+	// SSTORE(0, 42)
+	if _, err := captureStdout(t, func() error {
+		return runCommand([]string{"--datadir", datadir, "--code", "602a600055"})
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// MSTORE(0, SLOAD(0)), RETURN(0, 32)
+	out, err := captureStdout(t, func() error {
+		return runCommand([]string{"--datadir", datadir, "--code", "60005460005260206000f3"})
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := "Return data: 0x" + strings.Repeat("0", 62) + "2a\n"; !strings.Contains(out, want) {
+		t.Errorf("Expected the output to contain %q, got\n%s", want, out)
+	}
+}
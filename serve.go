@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"prevm/config"
+
+	"github.com/charmbracelet/log"
+)
+
+// serveCommand implements 'prevm serve': it runs a local chain that mines
+// a block for every transaction and serves it over JSON-RPC.
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: prevm serve [flags]")
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintln(fs.Output(), "Serves the eth_ JSON-RPC methods over HTTP and WebSocket. Without --genesis, the")
+		fmt.Fprintln(fs.Output(), "chain starts with the development accounts funded.")
+		fmt.Fprintln(fs.Output())
+		fs.PrintDefaults()
+	}
+	var (
+		addr        = fs.String("addr", "127.0.0.1:8545", "`address` to listen on")
+		genesisPath = fs.String("genesis", "", "start the chain from the genesis `file`")
+		datadir     = fs.String("datadir", "", "`directory` of the database holding the state, which mined blocks are committed to")
+		debug       = fs.Bool("debug", false, "log every call and mined block")
+	)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*debug {
+		config.Logger.SetLevel(log.InfoLevel)
+	}
+
+	genesis := DevGenesis()
+	if *genesisPath != "" {
+		var err error
+		if genesis, err = LoadGenesis(*genesisPath); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("Development accounts (10000 ETH each):")
+		for i, hex := range DevKeys {
+			key, _ := HexToPrivateKey(hex)
+			fmt.Printf("  (%d) 0x%x  key 0x%s\n", i, PrivateKeyToAddress(key), hex)
+		}
+		fmt.Println()
+	}
+	state, closeDB, err := openState(*datadir)
+	if err != nil {
+		return fmt.Errorf("--datadir: %w", err)
+	}
+	defer closeDB()
+	node := NewNode(genesis, state)
+
+	server := NewRPCServer()
+	newEthAPI(node).register(server)
+
+	logger.Info("Serving JSON-RPC", "addr", "http://"+*addr, "chainId", node.ChainID().String())
+	return http.ListenAndServe(*addr, server)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// DelegationPrefix starts the code of an account that delegates to another
+// account's code (EIP-7702). The delegated address follows it.
+var DelegationPrefix = []byte{0xef, 0x01, 0x00}
+
+// TxAuthBaseGas is the part of the per-authorization intrinsic gas that is
+// kept when the authority account already exists. The rest is refunded.
+const TxAuthBaseGas uint64 = 12500
+
+var (
+	ErrAuthorizationWrongChainID       = errors.New("EIP-7702 authorization chain ID mismatch")
+	ErrAuthorizationNonceOverflow      = errors.New("EIP-7702 authorization nonce > 64 bit")
+	ErrAuthorizationNonceMismatch      = errors.New("EIP-7702 authorization nonce does not match current account nonce")
+	ErrAuthorizationDestinationHasCode = errors.New("EIP-7702 authorization destination is a contract")
+)
+
+// ParseDelegation returns the address an account delegates to if code is a
+// delegation designator.
+func ParseDelegation(code []byte) ([20]byte, bool) {
+	var addr [20]byte
+	if len(code) != len(DelegationPrefix)+20 || !bytes.HasPrefix(code, DelegationPrefix) {
+		return addr, false
+	}
+	copy(addr[:], code[len(DelegationPrefix):])
+	return addr, true
+}
+
+// AddressToDelegation returns the delegation designator pointing at addr.
+func AddressToDelegation(addr [20]byte) []byte {
+	return append(append([]byte{}, DelegationPrefix...), addr[:]...)
+}
+
+// applyAuthorizations processes the authorization list of a set code
+// transaction. Invalid authorizations are skipped, they don't invalidate
+// the transaction.
+func (evm *EVM) applyAuthorizations(tx *Transaction) {
+	for i := range tx.AuthList {
+		auth := &tx.AuthList[i]
+
+		authority, err := evm.validateAuthorization(auth)
+		if err != nil {
+			logger.Debug("Skipping authorization", "index", i, "error", err)
+			continue
+		}
+
+		// The intrinsic gas assumed a new account; refund the difference
+		// if the authority already exists.
+		if evm.State.Exist(authority) {
+			evm.State.AddRefund(TxAuthTupleGas - TxAuthBaseGas)
+		}
+
+		// Delegating to the zero address clears the delegation.
+		if auth.Address == ([20]byte{}) {
+			evm.State.SetCode(authority, nil)
+		} else {
+			evm.State.SetCode(authority, AddressToDelegation(auth.Address))
+		}
+		evm.State.SetNonce(authority, auth.Nonce+1)
+	}
+}
+
+// validateAuthorization checks an authorization against the current state
+// and returns its authority.
+func (evm *EVM) validateAuthorization(auth *Authorization) ([20]byte, error) {
+	var authority [20]byte
+
+	if auth.ChainID != nil && auth.ChainID.Sign() != 0 && evm.BlockCtx.ChainID != nil && auth.ChainID.Cmp(evm.BlockCtx.ChainID) != 0 {
+		return authority, fmt.Errorf("%w: have %d, want %d", ErrAuthorizationWrongChainID, auth.ChainID, evm.BlockCtx.ChainID)
+	}
+	if auth.Nonce+1 < auth.Nonce {
+		return authority, ErrAuthorizationNonceOverflow
+	}
+
+	authority, err := auth.Authority()
+	if err != nil {
+		return authority, err
+	}
+	// The authority is accessed whether or not the rest is valid.
+	evm.State.WarmAddress(authority)
+
+	// Only EOAs, or accounts that already delegate, may be delegated.
+	if code := evm.State.GetCode(authority); len(code) > 0 {
+		if _, ok := ParseDelegation(code); !ok {
+			return authority, ErrAuthorizationDestinationHasCode
+		}
+	}
+	if have := evm.State.GetNonce(authority); have != auth.Nonce {
+		return authority, fmt.Errorf("%w: have %d, want %d", ErrAuthorizationNonceMismatch, have, auth.Nonce)
+	}
+	return authority, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"prevm/config"
+	"prevm/rlp"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// SetCodeAuthorizationMagic is the domain separator prepended to the RLP of
+// an EIP-7702 authorization before hashing.
+const SetCodeAuthorizationMagic = 0x05
+
+var (
+	ErrInvalidSig     = errors.New("invalid transaction v, r, s values")
+	ErrUnsigned       = errors.New("transaction is not signed")
+	ErrSenderMismatch = errors.New("recovered sender does not match")
+)
+
+// DevKeys are the well-known private keys of the default development
+// mnemonic ("test test ... junk") used by Hardhat and Anvil. They hold no
+// value on any public network and are only meant for tests and examples.
+var DevKeys = []string{
+	"ac0974bec39a17e36ba4a6b4d238ff944bacb478cbed5efcae784d7bf4f2ff80",
+	"59c6995e998f97a5a0044966f0945389dc9e86dae88c7a8412f4603b6b78690d",
+	"5de4111afa1a4b94908f83103eb1f1706367c2e68ca870fc3fb9a804cdab365a",
+	"7c852118294e51e653712a81e05800f419141751be58f605c371e15141b007a6",
+	"47e179ec197488593b187f80a00eb0da91f1b9d0b13f8733639f19c30a34926a",
+}
+
+// SigningHash returns the hash the sender signs. Typed transactions sign
+// keccak256(type || rlp(payload)). Legacy transactions with a ChainID sign
+// with EIP-155 replay protection, appending (chainID, 0, 0) to the payload;
+// without a ChainID they use the original Homestead scheme.
+func (tx *Transaction) SigningHash() ([32]byte, error) {
+	var hash [32]byte
+
+	fields, err := tx.unsignedFields()
+	if err != nil {
+		return hash, err
+	}
+
+	var enc []byte
+	if tx.Type == LegacyTxType {
+		if tx.isProtected() {
+			fields = append(fields, rlp.EncodeBigInt(tx.ChainID), rlp.EncodeUint(0), rlp.EncodeUint(0))
+		}
+		enc = rlp.EncodeList(fields...)
+	} else {
+		enc = append([]byte{tx.Type}, rlp.EncodeList(fields...)...)
+	}
+
+	copy(hash[:], config.Hash(enc))
+	return hash, nil
+}
+
+// isProtected reports whether a legacy transaction uses EIP-155.
+func (tx *Transaction) isProtected() bool {
+	return tx.ChainID != nil && tx.ChainID.Sign() != 0
+}
+
+// Sender recovers the address that signed the transaction.
+func (tx *Transaction) Sender() ([20]byte, error) {
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return [20]byte{}, ErrUnsigned
+	}
+
+	yParity, err := tx.yParity()
+	if err != nil {
+		return [20]byte{}, err
+	}
+
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return [20]byte{}, err
+	}
+	return recoverAddress(hash, tx.R, tx.S, yParity)
+}
+
+// yParity extracts the recovery id from V. Legacy transactions use 27/28,
+// or chainID*2 + 35/36 under EIP-155.
+func (tx *Transaction) yParity() (byte, error) {
+	v := tx.V
+	if tx.Type != LegacyTxType {
+		if !v.IsUint64() || v.Uint64() > 1 {
+			return 0, fmt.Errorf("%w: v = %d", ErrInvalidSig, v)
+		}
+		return byte(v.Uint64()), nil
+	}
+
+	if !tx.isProtected() {
+		if v.Cmp(big.NewInt(27)) != 0 && v.Cmp(big.NewInt(28)) != 0 {
+			return 0, fmt.Errorf("%w: v = %d", ErrInvalidSig, v)
+		}
+		return byte(v.Uint64() - 27), nil
+	}
+
+	parity := new(big.Int).Sub(v, new(big.Int).Lsh(tx.ChainID, 1))
+	parity.Sub(parity, big.NewInt(35))
+	if !parity.IsUint64() || parity.Uint64() > 1 {
+		return 0, fmt.Errorf("%w: v = %d for chain id %d", ErrInvalidSig, v, tx.ChainID)
+	}
+	return byte(parity.Uint64()), nil
+}
+
+// deriveChainID returns the chain id encoded in the V value of a legacy
+// transaction, or nil if the transaction is not EIP-155 protected.
+func deriveChainID(v *big.Int) *big.Int {
+	if v == nil || v.Cmp(big.NewInt(35)) < 0 {
+		return nil
+	}
+	id := new(big.Int).Sub(v, big.NewInt(35))
+	return id.Rsh(id, 1)
+}
+
+// SignTransaction returns a copy of tx signed with the given key. Legacy
+// transactions are signed with EIP-155 when tx.ChainID is set.
+func SignTransaction(tx *Transaction, key *ecdsa.PrivateKey) (*Transaction, error) {
+	hash, err := tx.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return nil, err
+	}
+
+	signed := *tx
+	signed.R = new(big.Int).SetBytes(sig[:32])
+	signed.S = new(big.Int).SetBytes(sig[32:64])
+	signed.V = new(big.Int).SetUint64(uint64(sig[64]))
+
+	if tx.Type == LegacyTxType {
+		if tx.isProtected() {
+			signed.V.Add(signed.V, new(big.Int).Lsh(tx.ChainID, 1))
+			signed.V.Add(signed.V, big.NewInt(35))
+		} else {
+			signed.V.Add(signed.V, big.NewInt(27))
+		}
+	}
+	return &signed, nil
+}
+
+// HexToPrivateKey parses a hex encoded secp256k1 private key.
+func HexToPrivateKey(s string) (*ecdsa.PrivateKey, error) {
+	b, err := DecodeHex(s)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.ToECDSA(b)
+}
+
+// PrivateKeyToAddress returns the address controlled by the given key.
+func PrivateKeyToAddress(key *ecdsa.PrivateKey) [20]byte {
+	return crypto.PubkeyToAddress(key.PublicKey)
+}
+
+// SigningHash returns the hash the authority signs for an EIP-7702
+// authorization: keccak256(0x05 || rlp([chain_id, address, nonce])).
+func (auth *Authorization) SigningHash() [32]byte {
+	enc := rlp.EncodeList(
+		rlp.EncodeBigInt(auth.ChainID),
+		rlp.EncodeBytes(auth.Address[:]),
+		rlp.EncodeUint(auth.Nonce),
+	)
+
+	var hash [32]byte
+	copy(hash[:], config.Hash(append([]byte{SetCodeAuthorizationMagic}, enc...)))
+	return hash
+}
+
+// Authority recovers the account that signed the authorization.
+func (auth *Authorization) Authority() ([20]byte, error) {
+	if auth.R == nil || auth.S == nil {
+		return [20]byte{}, ErrUnsigned
+	}
+	if auth.V > 1 {
+		return [20]byte{}, fmt.Errorf("%w: v = %d", ErrInvalidSig, auth.V)
+	}
+	return recoverAddress(auth.SigningHash(), auth.R, auth.S, auth.V)
+}
+
+// SignAuthorization returns a copy of auth signed with the given key.
+func SignAuthorization(auth Authorization, key *ecdsa.PrivateKey) (Authorization, error) {
+	hash := auth.SigningHash()
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		return Authorization{}, err
+	}
+
+	auth.R = new(big.Int).SetBytes(sig[:32])
+	auth.S = new(big.Int).SetBytes(sig[32:64])
+	auth.V = sig[64]
+	return auth, nil
+}
+
+// recoverAddress recovers the signer address of hash from a signature. Only
+// low-s signatures are accepted (EIP-2).
+func recoverAddress(hash [32]byte, r, s *big.Int, yParity byte) ([20]byte, error) {
+	var addr [20]byte
+
+	if r.BitLen() > 256 || s.BitLen() > 256 || !crypto.ValidateSignatureValues(yParity, r, s, true) {
+		return addr, ErrInvalidSig
+	}
+
+	sig := make([]byte, crypto.SignatureLength)
+	r.FillBytes(sig[:32])
+	s.FillBytes(sig[32:64])
+	sig[64] = yParity
+
+	pub, err := crypto.Ecrecover(hash[:], sig)
+	if err != nil {
+		return addr, fmt.Errorf("%w: %v", ErrInvalidSig, err)
+	}
+	if len(pub) == 0 || pub[0] != 4 {
+		return addr, ErrInvalidSig
+	}
+
+	copy(addr[:], config.Hash(pub[1:])[12:])
+	return addr, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// vectorKey is the private key of the EIP-155 example, which signed every
+// transaction of txVectors.
+const vectorKey = "4646464646464646464646464646464646464646464646464646464646464646"
+
+// vectorSender is the address of vectorKey.
+var vectorSender = [20]byte{0x9d, 0x8a, 0x62, 0xf6, 0x56, 0xa8, 0xd1, 0x61, 0x5c, 0x12, 0x94, 0xfd, 0x71, 0xe9, 0xcf, 0xb3, 0xe4, 0x85, 0x5a, 0x4f}
+
+// TestSender checks the signing hash of each transaction type against
+// geth's, and that the sender is recovered from the signature.
+func TestSender(t *testing.T) {
+	for _, tt := range txVectors {
+		tx, err := ParseRawTransaction(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		hash, err := tx.SigningHash()
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if fmt.Sprintf("0x%x", hash) != tt.sigHash {
+			t.Errorf("%s: Expected signing hash %s, got 0x%x", tt.name, tt.sigHash, hash)
+		}
+
+		sender, err := tx.Sender()
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if sender != vectorSender {
+			t.Errorf("%s: Expected sender 0x%x, got 0x%x", tt.name, vectorSender, sender)
+		}
+	}
+}
+
+// TestSenderErrors checks that signatures that don't recover to a single
+// sender are rejected.
+func TestSenderErrors(t *testing.T) {
+	n := crypto.S256().Params().N
+
+	tests := []struct {
+		name   string
+		raw    string
+		change func(tx *Transaction)
+		want   error
+	}{
+		{"unsigned", txVectors[3].raw, func(tx *Transaction) { tx.V, tx.R, tx.S = nil, nil, nil }, ErrUnsigned},
+		{
+			// The same signature with s mirrored into the upper half of the
+			// curve order, which recovers the same key (EIP-2).
+			"high s",
+			txVectors[3].raw,
+			func(tx *Transaction) { tx.S.Sub(n, tx.S); tx.V.SetUint64(1 - tx.V.Uint64()) },
+			ErrInvalidSig,
+		},
+		{"legacy high s", txVectors[1].raw, func(tx *Transaction) { tx.S.Sub(n, tx.S) }, ErrInvalidSig},
+		{"zero r", txVectors[3].raw, func(tx *Transaction) { tx.R.SetUint64(0) }, ErrInvalidSig},
+		{"r above the curve order", txVectors[3].raw, func(tx *Transaction) { tx.R.Set(n) }, ErrInvalidSig},
+		{"typed parity", txVectors[3].raw, func(tx *Transaction) { tx.V.SetUint64(2) }, ErrInvalidSig},
+		{"legacy v", txVectors[1].raw, func(tx *Transaction) { tx.V.SetUint64(29) }, ErrInvalidSig},
+		{"chain id of another v", txVectors[0].raw, func(tx *Transaction) { tx.ChainID = big.NewInt(5) }, ErrInvalidSig},
+		{"eip-155 v for another chain", txVectors[0].raw, func(tx *Transaction) { tx.V.SetUint64(39) }, ErrInvalidSig},
+	}
+
+	for _, tt := range tests {
+		tx, err := ParseRawTransaction(tt.raw)
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		tt.change(tx)
+		if _, err := tx.Sender(); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// A valid signature over other values recovers someone else.
+	tx, _ := ParseRawTransaction(txVectors[3].raw)
+	tx.Nonce++
+	if sender, err := tx.Sender(); err == nil && sender == vectorSender {
+		t.Errorf("Expected another sender once the nonce changed")
+	}
+}
+
+// TestSignTransaction checks that signing reproduces geth's signatures and
+// that the sender of every signed transaction is the signer.
+func TestSignTransaction(t *testing.T) {
+	key, err := HexToPrivateKey(vectorKey)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if addr := PrivateKeyToAddress(key); addr != vectorSender {
+		t.Fatalf("Expected address 0x%x, got 0x%x", vectorSender, addr)
+	}
+
+	// Signatures are deterministic (RFC 6979), so re-signing a vector
+	// gives back the same bytes.
+	for _, tt := range txVectors {
+		tx, _ := ParseRawTransaction(tt.raw)
+		signed, err := SignTransaction(tx, key)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		enc, _ := signed.MarshalBinary()
+		if fmt.Sprintf("0x%x", enc) != tt.raw {
+			t.Errorf("%s: Expected\n%s\ngot\n0x%x", tt.name, tt.raw, enc)
+		}
+	}
+
+	to := [20]byte{0x01}
+	tests := []struct {
+		name string
+		tx   Transaction
+		v    int64 // of the signature, either parity
+	}{
+		{"homestead", Transaction{To: &to, GasPrice: big.NewInt(1)}, 27},
+		{"eip-155", Transaction{ChainID: big.NewInt(1337), To: &to, GasPrice: big.NewInt(1)}, 1337*2 + 35},
+		{"dynamic fee", Transaction{Type: DynamicFeeTxType, ChainID: big.NewInt(1337), MaxFeePerGas: big.NewInt(1), MaxPriorityFeePerGas: big.NewInt(1)}, 0},
+	}
+
+	for i, tt := range tests {
+		devKey, err := HexToPrivateKey(DevKeys[i])
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		signed, err := SignTransaction(&tt.tx, devKey)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if v := signed.V.Int64(); v != tt.v && v != tt.v+1 {
+			t.Errorf("%s: Expected v %d or %d, got %d", tt.name, tt.v, tt.v+1, v)
+		}
+		if tt.tx.V != nil {
+			t.Errorf("%s: Expected the original to stay unsigned", tt.name)
+		}
+
+		// The sender survives the encoding.
+		enc, _ := signed.MarshalBinary()
+		decoded, err := DecodeTransaction(enc)
+		if err != nil {
+			t.Fatalf("%s: Unexpected decoding error: %v", tt.name, err)
+		}
+		sender, err := decoded.Sender()
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if sender != PrivateKeyToAddress(devKey) {
+			t.Errorf("%s: Expected sender 0x%x, got 0x%x", tt.name, PrivateKeyToAddress(devKey), sender)
+		}
+	}
+}
+
+// TestSignAuthorization checks an EIP-7702 authorization signed by geth and
+// the recovery of its authority.
+func TestSignAuthorization(t *testing.T) {
+	key, _ := HexToPrivateKey(vectorKey)
+	auth := Authorization{ChainID: big.NewInt(1), Address: [20]byte{19: 0xcc}, Nonce: 6}
+
+	hash := auth.SigningHash()
+	if want := "0xf43a3867bc1035cef1565d1c1301f2669b5b123bacf9b4a2e109a36beadd4035"; fmt.Sprintf("0x%x", hash) != want {
+		t.Errorf("Expected signing hash %s, got 0x%x", want, hash)
+	}
+
+	signed, err := SignAuthorization(auth, key)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := "0xe7968dab6b777a74211d8838f4231a611d405d2270625b925d3e1e33b641fb63"
+	s := "0x70e4cdf42796f71daa0c7f9b9e97dd48b4afadf58fdeeaec4a661132b16d0311"
+	if signed.V != 1 || fmt.Sprintf("0x%x", signed.R) != r || fmt.Sprintf("0x%x", signed.S) != s {
+		t.Errorf("Expected v 1, r %s, s %s, got %d, 0x%x, 0x%x", r, s, signed.V, signed.R, signed.S)
+	}
+
+	authority, err := signed.Authority()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if authority != vectorSender {
+		t.Errorf("Expected authority 0x%x, got 0x%x", vectorSender, authority)
+	}
+
+	highS := signed
+	highS.S = new(big.Int).Sub(crypto.S256().Params().N, signed.S)
+	highS.V = 0
+	if _, err := highS.Authority(); !errors.Is(err, ErrInvalidSig) {
+		t.Errorf("Expected %v for a high s, got %v", ErrInvalidSig, err)
+	}
+	badV := signed
+	badV.V = 2
+	if _, err := badV.Authority(); !errors.Is(err, ErrInvalidSig) {
+		t.Errorf("Expected %v for v 2, got %v", ErrInvalidSig, err)
+	}
+}
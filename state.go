@@ -1,28 +1,364 @@
 package main
 
+import (
+	"math/big"
+	"prevm/db"
+)
+
 // StateDB represents the world state.
 type StateDB struct {
+	// accounts holds every account when the state is in memory only, and
+	// acts as a cache of the accounts read or written so far when it is
+	// backed by a database.
 	accounts map[[20]byte]*Account
+
+	// backend is the database the state is persisted to, nil if none.
+	backend db.KeyValueStore
+	// pending are the accounts changed since the last Commit. Those that
+	// are no longer in accounts have been deleted.
+	pending map[[20]byte]struct{}
+	// dirtySlots are the storage slots written since the last Commit.
+	// Only those of stored accounts are written back: the others are
+	// rewritten whole.
+	dirtySlots map[storageSlot]struct{}
+	// dbErr is the first error hit while reading the backend.
+	dbErr error
+
+	// recorder, when set, records the prestate of everything accessed.
+	recorder *prestateRecorder
+	// tracer, when set, is told about every state change.
+	tracer Tracer
+
+	// journal records every state change so that a failed call can be
+	// rolled back to a snapshot.
+	journal *journal
+	// refund is the gas refund counter of the current transaction.
+	refund uint64
+	// logs are the logs emitted by the current transaction.
+	logs []*Log
+	// originStorage holds the value of the slots written by the current
+	// transaction as they were when it started.
+	originStorage map[storageSlot][]byte
+	// accessedAddrs and accessedSlots are the addresses and storage slots
+	// accessed by the current transaction, which are warm (EIP-2929).
+	accessedAddrs map[[20]byte]struct{}
+	accessedSlots map[storageSlot]struct{}
 }
 
 func NewStateDB() *StateDB {
 	return &StateDB{
 		accounts: make(map[[20]byte]*Account),
+		journal:  newJournal(),
+		pending:  make(map[[20]byte]struct{}),
+
+		dirtySlots:    make(map[storageSlot]struct{}),
+		originStorage: make(map[storageSlot][]byte),
+		accessedAddrs: make(map[[20]byte]struct{}),
+		accessedSlots: make(map[storageSlot]struct{}),
 	}
 }
 
+// storageSlot identifies a storage slot of an account.
+type storageSlot struct {
+	addr [20]byte
+	key  [32]byte
+}
+
+// OpenStateDB returns a state persisted to backend. Accounts are read from
+// it as they are first accessed, and changes are written back by Commit.
+func OpenStateDB(backend db.KeyValueStore) *StateDB {
+	s := NewStateDB()
+	s.backend = backend
+	return s
+}
+
 // Helper functions to interact with the state.
 func (s *StateDB) GetAccount(addr [20]byte) *Account {
-	if acc, ok := s.accounts[addr]; ok {
+	if acc := s.loadAccount(addr); acc != nil {
 		return acc
 	}
 	return NewAccount() // Return a new, empty account if it doesn't exist.
 }
 
+// loadAccount returns the account at addr, or nil if it doesn't exist.
+// Every account access of the EVM goes through it.
+func (s *StateDB) loadAccount(addr [20]byte) *Account {
+	acc := s.fetchAccount(addr)
+	if s.recorder != nil {
+		s.recorder.recordAccount(addr, acc)
+	}
+	return acc
+}
+
+// fetchAccount looks addr up in the cache, then in the backend. Accounts
+// found in the backend are cached.
+func (s *StateDB) fetchAccount(addr [20]byte) *Account {
+	if acc, ok := s.accounts[addr]; ok {
+		return acc
+	}
+	if s.backend == nil {
+		return nil
+	}
+	if _, deleted := s.pending[addr]; deleted {
+		return nil
+	}
+
+	acc, err := readAccount(s.backend, addr)
+	if err != nil {
+		s.setError(err)
+		return nil
+	}
+	if acc != nil {
+		s.accounts[addr] = acc
+	}
+	return acc
+}
+
+// getOrNewAccount returns the account at addr, creating it if it doesn't
+// exist. Use it for writes; GetAccount's placeholder is never stored.
+func (s *StateDB) getOrNewAccount(addr [20]byte) *Account {
+	if acc := s.loadAccount(addr); acc != nil {
+		return acc
+	}
+	return s.CreateAccount(addr)
+}
+
+// CreateAccount creates a new empty account at addr, replacing any
+// existing one.
+func (s *StateDB) CreateAccount(addr [20]byte) *Account {
+	prev := s.loadAccount(addr)
+	s.journal.append(createAccountChange{account: addr, prev: prev})
+
+	acc := NewAccount()
+	s.accounts[addr] = acc
+	return acc
+}
+
+// Exist reports whether an account exists at addr.
+func (s *StateDB) Exist(addr [20]byte) bool {
+	return s.loadAccount(addr) != nil
+}
+
+// Empty reports whether the account at addr is empty as defined by
+// EIP-161: zero nonce, zero balance and no code.
+func (s *StateDB) Empty(addr [20]byte) bool {
+	return s.GetAccount(addr).IsEmpty()
+}
+
+// GetBalance returns a copy of the balance of addr.
+func (s *StateDB) GetBalance(addr [20]byte) *big.Int {
+	return new(big.Int).Set(s.GetAccount(addr).Balance)
+}
+
+// SetBalance sets the balance of addr.
+func (s *StateDB) SetBalance(addr [20]byte, amount *big.Int) {
+	acc := s.getOrNewAccount(addr)
+	s.journal.append(balanceChange{account: addr, prev: new(big.Int).Set(acc.Balance)})
+	if s.tracer != nil {
+		s.tracer.OnBalanceChange(addr, new(big.Int).Set(acc.Balance), new(big.Int).Set(amount))
+	}
+	acc.Balance = new(big.Int).Set(amount)
+}
+
+// AddBalance adds amount to the balance of addr.
+func (s *StateDB) AddBalance(addr [20]byte, amount *big.Int) {
+	s.SetBalance(addr, new(big.Int).Add(s.GetAccount(addr).Balance, amount))
+}
+
+// SubBalance subtracts amount from the balance of addr. Callers are
+// expected to have checked that the balance is sufficient.
+func (s *StateDB) SubBalance(addr [20]byte, amount *big.Int) {
+	s.SetBalance(addr, new(big.Int).Sub(s.GetAccount(addr).Balance, amount))
+}
+
+// GetNonce returns the nonce of addr.
+func (s *StateDB) GetNonce(addr [20]byte) uint64 {
+	return s.GetAccount(addr).Nonce
+}
+
+// SetNonce sets the nonce of addr.
+func (s *StateDB) SetNonce(addr [20]byte, nonce uint64) {
+	acc := s.getOrNewAccount(addr)
+	s.journal.append(nonceChange{account: addr, prev: acc.Nonce})
+	if s.tracer != nil {
+		s.tracer.OnNonceChange(addr, acc.Nonce, nonce)
+	}
+	acc.Nonce = nonce
+}
+
+// GetCode returns the code of addr.
+func (s *StateDB) GetCode(addr [20]byte) []byte {
+	return s.GetAccount(addr).Code
+}
+
 func (s *StateDB) SetCode(addr [20]byte, code []byte) {
-	s.GetAccount(addr).Code = code
+	acc := s.getOrNewAccount(addr)
+	s.journal.append(codeChange{account: addr, prev: acc.Code})
+	if s.tracer != nil {
+		s.tracer.OnCodeChange(addr, acc.Code, code)
+	}
+	acc.Code = code
+}
+
+// GetStorage returns the value of a storage slot, nil if it was never set.
+func (s *StateDB) GetStorage(addr [20]byte, key [32]byte) []byte {
+	value := s.accountSlot(addr, s.GetAccount(addr), key)
+	if s.recorder != nil {
+		s.recorder.recordSlot(addr, key, value)
+	}
+	return value
+}
+
+// GetCommittedStorage returns the value a storage slot had at the start of
+// the current transaction.
+func (s *StateDB) GetCommittedStorage(addr [20]byte, key [32]byte) []byte {
+	if value, ok := s.originStorage[storageSlot{addr, key}]; ok {
+		return value
+	}
+	return s.GetStorage(addr, key)
 }
 
 func (s *StateDB) SetStorage(addr [20]byte, key [32]byte, value []byte) {
-	s.GetAccount(addr).Storage[key] = value
+	acc := s.getOrNewAccount(addr)
+	s.accountSlot(addr, acc, key)
+	prev, existed := acc.Storage[key]
+	if s.recorder != nil {
+		s.recorder.recordSlot(addr, key, prev)
+	}
+	if _, ok := s.originStorage[storageSlot{addr, key}]; !ok {
+		s.originStorage[storageSlot{addr, key}] = prev
+	}
+	s.journal.append(storageChange{account: addr, key: key, prev: prev, existed: existed})
+	if s.tracer != nil {
+		s.tracer.OnStorageChange(addr, key, toWord(prev), toWord(value))
+	}
+	acc.Storage[key] = value
+}
+
+// Transfer moves amount from one account to another.
+func (s *StateDB) Transfer(from, to [20]byte, amount *big.Int) {
+	s.SubBalance(from, amount)
+	s.AddBalance(to, amount)
+}
+
+// AddRefund adds gas to the refund counter.
+func (s *StateDB) AddRefund(gas uint64) {
+	s.journal.append(refundChange{prev: s.refund})
+	s.refund += gas
+}
+
+// SubRefund removes gas from the refund counter.
+func (s *StateDB) SubRefund(gas uint64) {
+	s.journal.append(refundChange{prev: s.refund})
+	if gas > s.refund {
+		s.refund = 0
+		return
+	}
+	s.refund -= gas
+}
+
+// GetRefund returns the current value of the refund counter.
+func (s *StateDB) GetRefund() uint64 {
+	return s.refund
+}
+
+// AddLog records a log emitted by the current transaction.
+func (s *StateDB) AddLog(log *Log) {
+	s.journal.append(addLogChange{})
+	s.logs = append(s.logs, log)
+}
+
+// Logs returns the logs emitted by the current transaction.
+func (s *StateDB) Logs() []*Log {
+	return s.logs
+}
+
+// Snapshot returns an identifier for the current state, to be passed to
+// RevertToSnapshot.
+func (s *StateDB) Snapshot() int {
+	return s.journal.length()
+}
+
+// RevertToSnapshot undoes every change made since the given snapshot.
+func (s *StateDB) RevertToSnapshot(id int) {
+	s.journal.revert(s, id)
+}
+
+// Finalise ends the current transaction: accounts it touched that are
+// left empty are deleted, as required by EIP-161.
+func (s *StateDB) Finalise() {
+	for addr := range s.journal.dirties {
+		if acc, ok := s.accounts[addr]; ok && acc.IsEmpty() {
+			delete(s.accounts, addr)
+		}
+	}
+	s.resetJournal()
+}
+
+// Prepare resets the per-transaction bookkeeping (journal, refund counter,
+// logs and accessed addresses and slots) before a new transaction is
+// executed.
+func (s *StateDB) Prepare() {
+	s.resetJournal()
+	s.refund = 0
+	s.logs = nil
+	s.accessedAddrs = make(map[[20]byte]struct{})
+	s.accessedSlots = make(map[storageSlot]struct{})
+}
+
+// WarmAddress marks addr as accessed by the current transaction and
+// reports whether it was cold, i.e. not accessed before (EIP-2929).
+func (s *StateDB) WarmAddress(addr [20]byte) bool {
+	if _, ok := s.accessedAddrs[addr]; ok {
+		return false
+	}
+	s.journal.append(accessAddressChange{address: addr})
+	s.accessedAddrs[addr] = struct{}{}
+	return true
+}
+
+// WarmSlot marks a storage slot of addr as accessed by the current
+// transaction and reports whether it was cold (EIP-2929).
+func (s *StateDB) WarmSlot(addr [20]byte, key [32]byte) bool {
+	slot := storageSlot{addr, key}
+	if _, ok := s.accessedSlots[slot]; ok {
+		return false
+	}
+	s.journal.append(accessSlotChange{slot: slot})
+	s.accessedSlots[slot] = struct{}{}
+	return true
+}
+
+// resetJournal drops the journal, keeping track of the accounts and, for a
+// persisted state, the slots it touched for the next Commit.
+func (s *StateDB) resetJournal() {
+	for addr := range s.journal.dirties {
+		s.pending[addr] = struct{}{}
+	}
+	if s.backend != nil {
+		for _, entry := range s.journal.entries {
+			if ch, ok := entry.(storageChange); ok {
+				s.dirtySlots[storageSlot{ch.account, ch.key}] = struct{}{}
+			}
+		}
+	}
+	s.journal = newJournal()
+	s.originStorage = make(map[storageSlot][]byte)
+}
+
+// Copy returns a copy of the state that can be changed without affecting
+// s, e.g. to run a call whose changes are thrown away. It must be made
+// between transactions. A copy of a persisted state reads from the same
+// backend and must not be committed.
+func (s *StateDB) Copy() *StateDB {
+	cpy := NewStateDB()
+	cpy.backend = s.backend
+	cpy.dbErr = s.dbErr
+	for addr, acc := range s.accounts {
+		cpy.accounts[addr] = copyAccount(acc, true)
+	}
+	for addr := range s.pending {
+		cpy.pending[addr] = struct{}{}
+	}
+	return cpy
 }
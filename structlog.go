@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"prevm/hexutil"
+)
+
+// JSONTracerConfig selects what the JSONTracer includes in each step.
+type JSONTracerConfig struct {
+	EnableMemory  bool // include the full memory
+	DisableStack  bool // leave out the stack
+	EnableStorage bool // include the storage slots accessed so far, on SLOAD and SSTORE
+}
+
+// JSONTracer writes an EIP-3155 trace: one JSON object per executed
+// instruction, and a summary when the top-level call ends, one per line.
+// The fields and their order follow geth's 'evm --json' output.
+type JSONTracer struct {
+	NoopTracer
+	enc     *json.Encoder
+	cfg     JSONTracerConfig
+	state   *StateDB
+	storage map[[20]byte]map[[32]byte][32]byte
+}
+
+// NewJSONTracer returns a JSONTracer writing to w.
+func NewJSONTracer(w io.Writer, cfg JSONTracerConfig) *JSONTracer {
+	return &JSONTracer{
+		enc:     json.NewEncoder(w),
+		cfg:     cfg,
+		storage: make(map[[20]byte]map[[32]byte][32]byte),
+	}
+}
+
+// structLog is a single step of an EIP-3155 trace.
+type structLog struct {
+	Pc         uint64            `json:"pc"`
+	Op         byte              `json:"op"`
+	Gas        hexutil.Uint64    `json:"gas"`
+	GasCost    hexutil.Uint64    `json:"gasCost"`
+	Memory     hexutil.Bytes     `json:"memory,omitempty"`
+	MemorySize int               `json:"memSize"`
+	Stack      []*hexutil.Big    `json:"stack"`
+	Storage    map[string]string `json:"storage,omitempty"`
+	Depth      int               `json:"depth"`
+	Refund     uint64            `json:"refund"`
+	OpName     string            `json:"opName"`
+	Error      string            `json:"error,omitempty"`
+}
+
+// endLog is the summary line of an EIP-3155 trace.
+type endLog struct {
+	Output  string         `json:"output"`
+	GasUsed hexutil.Uint64 `json:"gasUsed"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func (t *JSONTracer) OnTxStart(evm *EVM, tx *Transaction, sender [20]byte) {
+	t.state = evm.State
+	t.storage = make(map[[20]byte]map[[32]byte][32]byte)
+}
+
+func (t *JSONTracer) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	memory := ec.Memory.GetData()
+	log := structLog{
+		Pc:         pc,
+		Op:         op,
+		Gas:        hexutil.Uint64(gas),
+		GasCost:    hexutil.Uint64(cost),
+		MemorySize: len(memory),
+		Depth:      depth,
+		OpName:     OpcodeName(op),
+	}
+	if log.OpName == "" {
+		log.OpName = "opcode " + hexutil.EncodeUint64(uint64(op)) + " not defined"
+	}
+	if t.state != nil {
+		log.Refund = t.state.GetRefund()
+	}
+	if t.cfg.EnableMemory {
+		log.Memory = memory
+	}
+	stack := ec.Stack.GetData()
+	if !t.cfg.DisableStack {
+		log.Stack = make([]*hexutil.Big, len(stack))
+		for i, item := range stack {
+			log.Stack[i] = (*hexutil.Big)(new(big.Int).Set(item))
+		}
+	}
+	if t.cfg.EnableStorage && (op == SLOAD || op == SSTORE) {
+		log.Storage = t.captureStorage(ec.Address, op, stack)
+	}
+	if err != nil {
+		log.Error = err.Error()
+	}
+	t.enc.Encode(log)
+}
+
+// captureStorage records the slot accessed by an SLOAD or SSTORE about to
+// run and returns the slots of addr accessed so far.
+func (t *JSONTracer) captureStorage(addr [20]byte, op byte, stack []*big.Int) map[string]string {
+	slots := t.storage[addr]
+	if slots == nil {
+		slots = make(map[[32]byte][32]byte)
+		t.storage[addr] = slots
+	}
+
+	var key, value [32]byte
+	switch {
+	case op == SLOAD && len(stack) >= 1 && t.state != nil:
+		key = toWord256(stack[len(stack)-1])
+		value = toWord(t.state.GetStorage(addr, key))
+		slots[key] = value
+	case op == SSTORE && len(stack) >= 2:
+		key = toWord256(stack[len(stack)-1])
+		value = toWord256(stack[len(stack)-2])
+		slots[key] = value
+	}
+
+	out := make(map[string]string, len(slots))
+	for k, v := range slots {
+		out[hexutil.Encode(k[:])] = hexutil.Encode(v[:])
+	}
+	return out
+}
+
+// OnFault repeats the failing step with its error, as geth does.
+func (t *JSONTracer) OnFault(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	t.OnOpcode(pc, op, gas, cost, ec, depth, err)
+}
+
+func (t *JSONTracer) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	if depth != 1 {
+		return
+	}
+	log := endLog{
+		Output:  hexutil.Encode(output)[2:],
+		GasUsed: hexutil.Uint64(gasUsed),
+	}
+	if err != nil {
+		log.Error = err.Error()
+	}
+	t.enc.Encode(log)
+}
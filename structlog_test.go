@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestJSONTracer checks the trace of each program against the output of
+// geth's JSON logger for it, in testdata/jsontrace. The faulting programs
+// end with the failing step, which carries the error.
+func TestJSONTracer(t *testing.T) {
+	tests := []struct {
+		name   string
+		code   string
+		gas    uint64
+		memory bool
+	}{
+		{"add", "600160020100", 100000, false},
+		// MSTORE(0, 1), MSTORE(0, KECCAK256(0, 32)), RETURN(0, 32)
+		{"memory", "6001600052602060002060005260206000f3", 100000, true},
+		{"exp", "600160ff0a50", 100000, false},
+		{"revert", "60206000fd", 100000, false},
+		// ADD with a single operand.
+		{"underflow", "600101", 100000, false},
+		// MSTORE(32, 1) without the gas for the second word of memory.
+		{"outofgas", "6001602052", 14, false},
+	}
+
+	for _, tt := range tests {
+		want, err := os.ReadFile(filepath.Join("testdata", "jsontrace", tt.name+".json"))
+		if err != nil {
+			t.Fatalf("%s: Unexpected error: %v", tt.name, err)
+		}
+		code, _ := DecodeHex(tt.code)
+
+		var out bytes.Buffer
+		evm := NewEVM(NewStateDB(), testBlock(nil))
+		evm.Config.Tracer = NewJSONTracer(&out, JSONTracerConfig{EnableMemory: tt.memory})
+		evm.runCode(defaultSender, defaultReceiver, code, nil, new(big.Int), tt.gas)
+		if !bytes.Equal(out.Bytes(), want) {
+			t.Errorf("%s: Expected\n%s\ngot\n%s", tt.name, want, out.Bytes())
+		}
+	}
+}
+
+// TestJSONTracerStorage checks the storage of the SLOAD and SSTORE steps,
+// which holds the slots of the contract accessed so far.
+func TestJSONTracerStorage(t *testing.T) {
+	var out bytes.Buffer
+	state := NewStateDB()
+	state.SetStorage(defaultReceiver, [32]byte{31: 1}, []byte{0x2a})
+	evm := NewEVM(state, testBlock(nil))
+	evm.Config.Tracer = NewJSONTracer(&out, JSONTracerConfig{EnableStorage: true, DisableStack: true})
+
+	// SSTORE(0, SLOAD(1))
+	code, _ := DecodeHex("600154600055")
+	if _, _, err := evm.runCode(defaultSender, defaultReceiver, code, nil, new(big.Int), 100000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	one := `"0x0000000000000000000000000000000000000000000000000000000000000001":"0x000000000000000000000000000000000000000000000000000000000000002a"`
+	zero := `"0x0000000000000000000000000000000000000000000000000000000000000000":"0x000000000000000000000000000000000000000000000000000000000000002a"`
+	if !bytes.Contains(lines[1], []byte(`"storage":{`+one+`}`)) {
+		t.Errorf("Expected the SLOAD step to hold slot 1, got\n%s", lines[1])
+	}
+	if !bytes.Contains(lines[3], []byte(`"storage":{`+zero+`,`+one+`}`)) {
+		t.Errorf("Expected the SSTORE step to hold slots 0 and 1, got\n%s", lines[3])
+	}
+	if !bytes.Contains(lines[0], []byte(`"stack":null`)) {
+		t.Errorf("Expected no stack, got\n%s", lines[0])
+	}
+}
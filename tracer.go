@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/charmbracelet/log"
+)
+
+// Tracer receives the events of a transaction as it runs. Set it in
+// Config.Tracer. Embed NoopTracer to only implement the hooks you need.
+//
+// The ExecutionContext passed to OnOpcode and OnFault is the live frame:
+// tracers must copy what they want to keep of its stack and memory.
+type Tracer interface {
+	// OnTxStart is called before the transaction is validated.
+	OnTxStart(evm *EVM, tx *Transaction, sender [20]byte)
+	// OnTxEnd is called with the outcome of the transaction. err is set
+	// when the transaction was invalid, res otherwise.
+	OnTxEnd(res *ExecutionResult, err error)
+
+	// OnEnter is called when a call frame starts. typ is the opcode of the
+	// call, CALL or CREATE for the top-level frame, and depth starts at 1.
+	OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int)
+	// OnExit is called when a call frame ends, with its return data, the
+	// gas it used and its error, ErrExecutionReverted on REVERT.
+	OnExit(depth int, output []byte, gasUsed uint64, err error)
+
+	// OnOpcode is called before each instruction is executed, with the gas
+	// left and the cost of the instruction. err is set if the instruction
+	// can't be run at all, e.g. it is invalid, underflows the stack or is
+	// out of gas.
+	OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error)
+	// OnFault is called when an instruction fails, after its OnOpcode.
+	OnFault(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error)
+
+	// OnStorageRead is called by SLOAD.
+	OnStorageRead(addr [20]byte, slot, value [32]byte)
+	// The change hooks are called for every state write of the
+	// transaction, including fee payments. Writes undone by a revert are
+	// not reported again.
+	OnStorageChange(addr [20]byte, slot, prev, value [32]byte)
+	OnBalanceChange(addr [20]byte, prev, value *big.Int)
+	OnNonceChange(addr [20]byte, prev, value uint64)
+	OnCodeChange(addr [20]byte, prev, code []byte)
+}
+
+// NoopTracer implements Tracer with hooks that do nothing.
+type NoopTracer struct{}
+
+func (NoopTracer) OnTxStart(*EVM, *Transaction, [20]byte)                               {}
+func (NoopTracer) OnTxEnd(*ExecutionResult, error)                                      {}
+func (NoopTracer) OnEnter(int, byte, [20]byte, [20]byte, []byte, uint64, *big.Int)      {}
+func (NoopTracer) OnExit(int, []byte, uint64, error)                                    {}
+func (NoopTracer) OnOpcode(uint64, byte, uint64, uint64, *ExecutionContext, int, error) {}
+func (NoopTracer) OnFault(uint64, byte, uint64, uint64, *ExecutionContext, int, error)  {}
+func (NoopTracer) OnStorageRead([20]byte, [32]byte, [32]byte)                           {}
+func (NoopTracer) OnStorageChange([20]byte, [32]byte, [32]byte, [32]byte)               {}
+func (NoopTracer) OnBalanceChange([20]byte, *big.Int, *big.Int)                         {}
+func (NoopTracer) OnNonceChange([20]byte, uint64, uint64)                               {}
+func (NoopTracer) OnCodeChange([20]byte, []byte, []byte)                                {}
+
+// MultiTracer forwards every event to each of its tracers in turn.
+type MultiTracer []Tracer
+
+func (m MultiTracer) OnTxStart(evm *EVM, tx *Transaction, sender [20]byte) {
+	for _, t := range m {
+		t.OnTxStart(evm, tx, sender)
+	}
+}
+
+func (m MultiTracer) OnTxEnd(res *ExecutionResult, err error) {
+	for _, t := range m {
+		t.OnTxEnd(res, err)
+	}
+}
+
+func (m MultiTracer) OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int) {
+	for _, t := range m {
+		t.OnEnter(depth, typ, from, to, input, gas, value)
+	}
+}
+
+func (m MultiTracer) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	for _, t := range m {
+		t.OnExit(depth, output, gasUsed, err)
+	}
+}
+
+func (m MultiTracer) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	for _, t := range m {
+		t.OnOpcode(pc, op, gas, cost, ec, depth, err)
+	}
+}
+
+func (m MultiTracer) OnFault(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	for _, t := range m {
+		t.OnFault(pc, op, gas, cost, ec, depth, err)
+	}
+}
+
+func (m MultiTracer) OnStorageRead(addr [20]byte, slot, value [32]byte) {
+	for _, t := range m {
+		t.OnStorageRead(addr, slot, value)
+	}
+}
+
+func (m MultiTracer) OnStorageChange(addr [20]byte, slot, prev, value [32]byte) {
+	for _, t := range m {
+		t.OnStorageChange(addr, slot, prev, value)
+	}
+}
+
+func (m MultiTracer) OnBalanceChange(addr [20]byte, prev, value *big.Int) {
+	for _, t := range m {
+		t.OnBalanceChange(addr, prev, value)
+	}
+}
+
+func (m MultiTracer) OnNonceChange(addr [20]byte, prev, value uint64) {
+	for _, t := range m {
+		t.OnNonceChange(addr, prev, value)
+	}
+}
+
+func (m MultiTracer) OnCodeChange(addr [20]byte, prev, code []byte) {
+	for _, t := range m {
+		t.OnCodeChange(addr, prev, code)
+	}
+}
+
+// LogTracer logs every instruction and state change at debug level. It
+// replaces the debug logging that used to be built into the opcodes.
+type LogTracer struct {
+	NoopTracer
+	Logger *log.Logger
+}
+
+// NewLogTracer returns a LogTracer writing to logger.
+func NewLogTracer(logger *log.Logger) *LogTracer {
+	return &LogTracer{Logger: logger}
+}
+
+func (t *LogTracer) OnEnter(depth int, typ byte, from, to [20]byte, input []byte, gas uint64, value *big.Int) {
+	t.Logger.Debug(OpcodeName(typ), "depth", depth, "from", fmt.Sprintf("0x%x", from), "to", fmt.Sprintf("0x%x", to), "input", fmt.Sprintf("0x%x", input), "gas", gas, "value", value)
+}
+
+func (t *LogTracer) OnExit(depth int, output []byte, gasUsed uint64, err error) {
+	t.Logger.Debug("Exit", "depth", depth, "output", fmt.Sprintf("0x%x", output), "gasUsed", gasUsed, "error", err)
+}
+
+func (t *LogTracer) OnOpcode(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	t.Logger.Debug(OpcodeName(op), "pc", pc, "gas", gas, "cost", cost, "depth", depth, "stack", ec.Stack.GetData())
+	if err != nil {
+		t.Logger.Debug("Failed", "pc", pc, "error", err)
+	}
+}
+
+func (t *LogTracer) OnFault(pc uint64, op byte, gas, cost uint64, ec *ExecutionContext, depth int, err error) {
+	t.Logger.Debug("Failed", "pc", pc, "op", OpcodeName(op), "error", err)
+}
+
+func (t *LogTracer) OnStorageRead(addr [20]byte, slot, value [32]byte) {
+	t.Logger.Debug("SLOAD", "address", fmt.Sprintf("0x%x", addr), "slot", fmt.Sprintf("0x%x", slot), "value", fmt.Sprintf("0x%x", value))
+}
+
+func (t *LogTracer) OnStorageChange(addr [20]byte, slot, prev, value [32]byte) {
+	t.Logger.Debug("Storage", "address", fmt.Sprintf("0x%x", addr), "slot", fmt.Sprintf("0x%x", slot), "from", fmt.Sprintf("0x%x", prev), "to", fmt.Sprintf("0x%x", value))
+}
+
+func (t *LogTracer) OnBalanceChange(addr [20]byte, prev, value *big.Int) {
+	t.Logger.Debug("Balance", "address", fmt.Sprintf("0x%x", addr), "from", prev, "to", value)
+}
+
+func (t *LogTracer) OnNonceChange(addr [20]byte, prev, value uint64) {
+	t.Logger.Debug("Nonce", "address", fmt.Sprintf("0x%x", addr), "from", prev, "to", value)
+}
+
+func (t *LogTracer) OnCodeChange(addr [20]byte, prev, code []byte) {
+	t.Logger.Debug("Code", "address", fmt.Sprintf("0x%x", addr), "size", len(code))
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Transaction types as defined by EIP-2718. The type byte prefixes the
+// payload of every typed transaction; legacy transactions carry no prefix.
+const (
+	LegacyTxType     = 0x00
+	AccessListTxType = 0x01 // EIP-2930
+	DynamicFeeTxType = 0x02 // EIP-1559
+	BlobTxType       = 0x03 // EIP-4844
+	SetCodeTxType    = 0x04 // EIP-7702
+)
+
+// Gas constants used for intrinsic gas and blob fee calculations.
+const (
+	TxGas                     uint64 = 21000 // Base cost of every transaction
+	TxGasContractCreation     uint64 = 53000 // Base cost of a contract creation transaction
+	TxDataZeroGas             uint64 = 4     // Per zero byte of calldata
+	TxDataNonZeroGas          uint64 = 16    // Per non-zero byte of calldata (EIP-2028)
+	InitCodeWordGas           uint64 = 2     // Per 32-byte word of init code (EIP-3860)
+	TxAccessListAddressGas    uint64 = 2400  // Per address in the access list (EIP-2930)
+	TxAccessListStorageKeyGas uint64 = 1900  // Per storage key in the access list (EIP-2930)
+	TxAuthTupleGas            uint64 = 25000 // Per authorization tuple (EIP-7702)
+
+	GasPerBlob             uint64 = 1 << 17 // Blob gas consumed by a single blob (EIP-4844)
+	MaxBlobsPerTransaction        = 6
+	MaxInitCodeSize               = 2 * 24576 // EIP-3860
+)
+
+// BlobHashVersionKZG is the version byte of a KZG versioned blob hash.
+const BlobHashVersionKZG = 0x01
+
+var (
+	ErrTxTypeNotSupported = errors.New("transaction type not supported")
+	ErrInvalidChainID     = errors.New("invalid chain id")
+	ErrIntrinsicGas       = errors.New("intrinsic gas too low")
+	ErrGasUintOverflow    = errors.New("gas uint64 overflow")
+	ErrFeeCapTooLow       = errors.New("max fee per gas less than block base fee")
+	ErrTipAboveFeeCap     = errors.New("max priority fee per gas higher than max fee per gas")
+	ErrFeeCapVeryHigh     = errors.New("max fee per gas higher than 2^256-1")
+	ErrTipVeryHigh        = errors.New("max priority fee per gas higher than 2^256-1")
+	ErrMissingGasPrice    = errors.New("missing gas price")
+	ErrMaxInitCodeSize    = errors.New("max initcode size exceeded")
+	ErrUnexpectedField    = errors.New("field not allowed for transaction type")
+	ErrBlobTxCreate       = errors.New("blob transaction of type create")
+	ErrMissingBlobHashes  = errors.New("blob transaction missing blob hashes")
+	ErrTooManyBlobs       = errors.New("blob transaction has too many blobs")
+	ErrInvalidBlobHash    = errors.New("invalid blob versioned hash")
+	ErrBlobFeeCapTooLow   = errors.New("max fee per blob gas less than block blob base fee")
+	ErrSetCodeTxCreate    = errors.New("set code transaction of type create")
+	ErrEmptyAuthList      = errors.New("set code transaction with empty auth list")
+	ErrNegativeValue      = errors.New("negative value")
+)
+
+// AccessTuple is a single entry of an EIP-2930 access list: an address and
+// the storage slots of that address the transaction plans to touch.
+type AccessTuple struct {
+	Address     [20]byte
+	StorageKeys [][32]byte
+}
+
+// AccessList is the list of addresses and storage slots pre-declared by an
+// access list transaction.
+type AccessList []AccessTuple
+
+// StorageKeys returns the total number of storage keys in the access list.
+func (al AccessList) StorageKeys() int {
+	total := 0
+	for _, tuple := range al {
+		total += len(tuple.StorageKeys)
+	}
+	return total
+}
+
+// Authorization is an EIP-7702 authorization tuple. It allows an EOA to
+// delegate its code to the contract at Address.
+type Authorization struct {
+	ChainID *big.Int
+	Address [20]byte
+	Nonce   uint64
+	V       uint8 // y-parity of the authority's signature
+	R       *big.Int
+	S       *big.Int
+}
+
+// This is the full transaction object, with the nonce.
+// Fields that don't apply to a given Type are left at their zero value.
+type Transaction struct {
+	// Type is the EIP-2718 transaction type.
+	Type byte
+	// ChainID is the chain the transaction is valid on. Required for typed
+	// transactions; legacy transactions encode it in V (EIP-155) and leave
+	// it nil when unprotected.
+	ChainID  *big.Int
+	Nonce    uint64
+	GasLimit uint64
+	// GasPrice is the fixed price per gas of legacy and access list transactions.
+	GasPrice *big.Int
+	// MaxPriorityFeePerGas is the tip paid to the block producer (EIP-1559).
+	MaxPriorityFeePerGas *big.Int
+	// MaxFeePerGas is the most the sender will pay per gas, base fee included (EIP-1559).
+	MaxFeePerGas *big.Int
+	// From     *[20]byte // read from ethereum docs and change
+	To    *[20]byte
+	Value *big.Int
+	Data  []byte
+	// AccessList pre-declares warm addresses and slots (EIP-2930 and later types).
+	AccessList AccessList
+	// MaxFeePerBlobGas is the most the sender will pay per unit of blob gas (EIP-4844).
+	MaxFeePerBlobGas *big.Int
+	// BlobHashes are the versioned hashes of the blobs carried by the transaction (EIP-4844).
+	BlobHashes [][32]byte
+	// AuthList holds the code delegations to apply before execution (EIP-7702).
+	AuthList []Authorization
+
+	// V, R, S are the signature values. For typed transactions V is the
+	// y-parity (0 or 1); legacy transactions use the EIP-155 encoding.
+	V *big.Int
+	R *big.Int
+	S *big.Int
+}
+
+// FeeCap returns the maximum price per gas the sender is willing to pay.
+func (tx *Transaction) FeeCap() *big.Int {
+	switch tx.Type {
+	case LegacyTxType, AccessListTxType:
+		return tx.GasPrice
+	default:
+		return tx.MaxFeePerGas
+	}
+}
+
+// TipCap returns the maximum priority fee per gas the sender is willing to pay.
+// For legacy and access list transactions the whole gas price is the tip cap.
+func (tx *Transaction) TipCap() *big.Int {
+	switch tx.Type {
+	case LegacyTxType, AccessListTxType:
+		return tx.GasPrice
+	default:
+		return tx.MaxPriorityFeePerGas
+	}
+}
+
+// EffectiveGasPrice returns the price per gas actually paid by the
+// transaction in a block with the given base fee:
+// min(MaxFeePerGas, baseFee + MaxPriorityFeePerGas) for EIP-1559 style
+// transactions, and GasPrice otherwise. A nil base fee means the block
+// predates EIP-1559, in which case the fee cap is paid in full.
+func (tx *Transaction) EffectiveGasPrice(baseFee *big.Int) *big.Int {
+	feeCap := tx.FeeCap()
+	if feeCap == nil {
+		return new(big.Int)
+	}
+	if baseFee == nil || tx.Type == LegacyTxType || tx.Type == AccessListTxType {
+		return new(big.Int).Set(feeCap)
+	}
+
+	price := new(big.Int).Add(baseFee, tx.TipCap())
+	if price.Cmp(feeCap) > 0 {
+		price.Set(feeCap)
+	}
+	return price
+}
+
+// BlobGas returns the total blob gas consumed by the transaction.
+func (tx *Transaction) BlobGas() uint64 {
+	return GasPerBlob * uint64(len(tx.BlobHashes))
+}
+
+// IntrinsicGas returns the gas charged before any code is executed: the base
+// transaction cost plus the cost of calldata, init code, access list entries
+// and authorization tuples.
+func (tx *Transaction) IntrinsicGas() (uint64, error) {
+	gas := TxGas
+	isCreate := tx.To == nil
+	if isCreate {
+		gas = TxGasContractCreation
+	}
+
+	dataLen := uint64(len(tx.Data))
+	if dataLen > 0 {
+		var nonZero uint64
+		for _, b := range tx.Data {
+			if b != 0 {
+				nonZero++
+			}
+		}
+		zero := dataLen - nonZero
+
+		if nonZero > (^uint64(0)-gas)/TxDataNonZeroGas {
+			return 0, ErrGasUintOverflow
+		}
+		gas += nonZero * TxDataNonZeroGas
+
+		if zero > (^uint64(0)-gas)/TxDataZeroGas {
+			return 0, ErrGasUintOverflow
+		}
+		gas += zero * TxDataZeroGas
+
+		if isCreate {
+			words := (dataLen + 31) / 32
+			if words > (^uint64(0)-gas)/InitCodeWordGas {
+				return 0, ErrGasUintOverflow
+			}
+			gas += words * InitCodeWordGas
+		}
+	}
+
+	addresses := uint64(len(tx.AccessList))
+	if addresses > (^uint64(0)-gas)/TxAccessListAddressGas {
+		return 0, ErrGasUintOverflow
+	}
+	gas += addresses * TxAccessListAddressGas
+
+	keys := uint64(tx.AccessList.StorageKeys())
+	if keys > (^uint64(0)-gas)/TxAccessListStorageKeyGas {
+		return 0, ErrGasUintOverflow
+	}
+	gas += keys * TxAccessListStorageKeyGas
+
+	auths := uint64(len(tx.AuthList))
+	if auths > (^uint64(0)-gas)/TxAuthTupleGas {
+		return 0, ErrGasUintOverflow
+	}
+	gas += auths * TxAuthTupleGas
+
+	return gas, nil
+}
+
+// Validate checks the transaction against the rules of its type and the
+// block it is about to be included in. It does not look at the world state,
+// so nonce and balance checks are left to the caller.
+func (tx *Transaction) Validate(block *BlockContext) error {
+	if err := tx.validateFields(); err != nil {
+		return err
+	}
+
+	// Unprotected legacy transactions are valid on every chain.
+	if tx.ChainID != nil && block.ChainID != nil && tx.ChainID.Cmp(block.ChainID) != 0 {
+		return fmt.Errorf("%w: have %d, want %d", ErrInvalidChainID, tx.ChainID, block.ChainID)
+	}
+
+	if tx.Value != nil && tx.Value.Sign() < 0 {
+		return ErrNegativeValue
+	}
+
+	if tx.To == nil && len(tx.Data) > MaxInitCodeSize {
+		return fmt.Errorf("%w: code size %d, limit %d", ErrMaxInitCodeSize, len(tx.Data), MaxInitCodeSize)
+	}
+
+	// Fee checks.
+	feeCap, tipCap := tx.FeeCap(), tx.TipCap()
+	if feeCap == nil || tipCap == nil {
+		return ErrMissingGasPrice
+	}
+	if feeCap.BitLen() > 256 {
+		return ErrFeeCapVeryHigh
+	}
+	if tipCap.BitLen() > 256 {
+		return ErrTipVeryHigh
+	}
+	if feeCap.Cmp(tipCap) < 0 {
+		return fmt.Errorf("%w: tip %d, fee cap %d", ErrTipAboveFeeCap, tipCap, feeCap)
+	}
+	if block.BaseFee != nil && feeCap.Cmp(block.BaseFee) < 0 {
+		return fmt.Errorf("%w: fee cap %d, base fee %d", ErrFeeCapTooLow, feeCap, block.BaseFee)
+	}
+
+	// Blob checks.
+	if tx.Type == BlobTxType {
+		if tx.MaxFeePerBlobGas == nil {
+			return ErrMissingGasPrice
+		}
+		if block.BlobBaseFee != nil && tx.MaxFeePerBlobGas.Cmp(block.BlobBaseFee) < 0 {
+			return fmt.Errorf("%w: blob fee cap %d, blob base fee %d", ErrBlobFeeCapTooLow, tx.MaxFeePerBlobGas, block.BlobBaseFee)
+		}
+	}
+
+	intrinsicGas, err := tx.IntrinsicGas()
+	if err != nil {
+		return err
+	}
+	if tx.GasLimit < intrinsicGas {
+		return fmt.Errorf("%w: have %d, want %d", ErrIntrinsicGas, tx.GasLimit, intrinsicGas)
+	}
+
+	return nil
+}
+
+// validateFields checks that the transaction only carries the fields
+// allowed for its type and that the type specific fields are well formed.
+func (tx *Transaction) validateFields() error {
+	switch tx.Type {
+	case LegacyTxType:
+		if tx.MaxFeePerGas != nil || tx.MaxPriorityFeePerGas != nil {
+			return fmt.Errorf("%w: legacy transaction with dynamic fee", ErrUnexpectedField)
+		}
+		if len(tx.AccessList) > 0 {
+			return fmt.Errorf("%w: legacy transaction with access list", ErrUnexpectedField)
+		}
+
+	case AccessListTxType:
+		if tx.MaxFeePerGas != nil || tx.MaxPriorityFeePerGas != nil {
+			return fmt.Errorf("%w: access list transaction with dynamic fee", ErrUnexpectedField)
+		}
+
+	case DynamicFeeTxType, BlobTxType, SetCodeTxType:
+		if tx.GasPrice != nil {
+			return fmt.Errorf("%w: dynamic fee transaction with gas price", ErrUnexpectedField)
+		}
+
+	default:
+		return fmt.Errorf("%w: type %d", ErrTxTypeNotSupported, tx.Type)
+	}
+
+	if tx.Type != LegacyTxType && tx.ChainID == nil {
+		return fmt.Errorf("%w: missing chain id", ErrInvalidChainID)
+	}
+
+	if tx.Type != BlobTxType && (len(tx.BlobHashes) > 0 || tx.MaxFeePerBlobGas != nil) {
+		return fmt.Errorf("%w: blob fields on type %d", ErrUnexpectedField, tx.Type)
+	}
+	if tx.Type != SetCodeTxType && len(tx.AuthList) > 0 {
+		return fmt.Errorf("%w: authorization list on type %d", ErrUnexpectedField, tx.Type)
+	}
+
+	if tx.Type == BlobTxType {
+		if tx.To == nil {
+			return ErrBlobTxCreate
+		}
+		if len(tx.BlobHashes) == 0 {
+			return ErrMissingBlobHashes
+		}
+		if len(tx.BlobHashes) > MaxBlobsPerTransaction {
+			return fmt.Errorf("%w: have %d, limit %d", ErrTooManyBlobs, len(tx.BlobHashes), MaxBlobsPerTransaction)
+		}
+		for i, hash := range tx.BlobHashes {
+			if hash[0] != BlobHashVersionKZG {
+				return fmt.Errorf("%w: blob %d has version %d", ErrInvalidBlobHash, i, hash[0])
+			}
+		}
+	}
+
+	if tx.Type == SetCodeTxType {
+		if tx.To == nil {
+			return ErrSetCodeTxCreate
+		}
+		if len(tx.AuthList) == 0 {
+			return ErrEmptyAuthList
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// TestIntrinsicGas checks each term of the intrinsic gas: calldata bytes,
+// contract creation and its init code words, access list entries and
+// authorization tuples.
+func TestIntrinsicGas(t *testing.T) {
+	to := [20]byte{0x01}
+	tests := []struct {
+		name string
+		tx   Transaction
+		want uint64
+	}{
+		{"transfer", Transaction{To: &to}, 21000},
+		{"zero and non-zero bytes", Transaction{To: &to, Data: []byte{0, 1, 0, 0xff}}, 21000 + 2*4 + 2*16},
+		{"empty create", Transaction{}, 53000},
+		{"create", Transaction{Data: make([]byte, 33)}, 53000 + 33*4 + 2*2},
+		{
+			"access list",
+			Transaction{To: &to, AccessList: AccessList{
+				{Address: [20]byte{0x0a}, StorageKeys: [][32]byte{{}, {31: 1}}},
+				{Address: [20]byte{0x0b}, StorageKeys: [][32]byte{{}}},
+			}},
+			21000 + 2*2400 + 3*1900,
+		},
+		{"authorizations", Transaction{To: &to, AuthList: make([]Authorization, 2)}, 21000 + 2*25000},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.tx.IntrinsicGas()
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestEffectiveGasPrice checks the price paid per gas by each kind of
+// transaction, with and without a base fee.
+func TestEffectiveGasPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		tx      Transaction
+		baseFee *big.Int
+		want    int64
+	}{
+		{"legacy", Transaction{GasPrice: big.NewInt(10)}, big.NewInt(5), 10},
+		{"access list", Transaction{Type: AccessListTxType, GasPrice: big.NewInt(10)}, big.NewInt(5), 10},
+		{
+			"base fee plus tip",
+			Transaction{Type: DynamicFeeTxType, MaxFeePerGas: big.NewInt(100), MaxPriorityFeePerGas: big.NewInt(2)},
+			big.NewInt(50),
+			52,
+		},
+		{
+			"capped at the fee cap",
+			Transaction{Type: DynamicFeeTxType, MaxFeePerGas: big.NewInt(51), MaxPriorityFeePerGas: big.NewInt(2)},
+			big.NewInt(50),
+			51,
+		},
+		{
+			"no base fee",
+			Transaction{Type: DynamicFeeTxType, MaxFeePerGas: big.NewInt(100), MaxPriorityFeePerGas: big.NewInt(2)},
+			nil,
+			100,
+		},
+		{"no fee cap", Transaction{Type: DynamicFeeTxType}, big.NewInt(50), 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.tx.EffectiveGasPrice(tt.baseFee); got.Cmp(big.NewInt(tt.want)) != 0 {
+			t.Errorf("%s: Expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestValidate checks the rules every transaction type is validated
+// against, each case breaking a single rule of a valid transaction.
+func TestValidate(t *testing.T) {
+	to := [20]byte{0x01}
+	block := &BlockContext{ChainID: big.NewInt(1), BaseFee: big.NewInt(10), BlobBaseFee: big.NewInt(1)}
+	blobHash := [32]byte{BlobHashVersionKZG}
+
+	legacy := func(change func(*Transaction)) Transaction {
+		tx := Transaction{To: &to, GasLimit: 21000, GasPrice: big.NewInt(10)}
+		change(&tx)
+		return tx
+	}
+	dynamic := func(typ byte, change func(*Transaction)) Transaction {
+		tx := Transaction{
+			Type:                 typ,
+			ChainID:              big.NewInt(1),
+			To:                   &to,
+			GasLimit:             100000,
+			MaxFeePerGas:         big.NewInt(20),
+			MaxPriorityFeePerGas: big.NewInt(1),
+		}
+		switch typ {
+		case BlobTxType:
+			tx.BlobHashes = [][32]byte{blobHash}
+			tx.MaxFeePerBlobGas = big.NewInt(1)
+		case SetCodeTxType:
+			tx.AuthList = []Authorization{{ChainID: big.NewInt(1)}}
+		}
+		change(&tx)
+		return tx
+	}
+	none := func(*Transaction) {}
+
+	tests := []struct {
+		name string
+		tx   Transaction
+		want error
+	}{
+		{"legacy", legacy(none), nil},
+		{"unprotected legacy on any chain", legacy(func(tx *Transaction) { tx.ChainID = nil }), nil},
+		{"access list", legacy(func(tx *Transaction) {
+			tx.Type, tx.ChainID, tx.GasLimit = AccessListTxType, big.NewInt(1), 23400
+			tx.AccessList = AccessList{{Address: to}}
+		}), nil},
+		{"dynamic fee", dynamic(DynamicFeeTxType, none), nil},
+		{"blob", dynamic(BlobTxType, none), nil},
+		{"set code", dynamic(SetCodeTxType, none), nil},
+
+		{"unknown type", legacy(func(tx *Transaction) { tx.Type = 5 }), ErrTxTypeNotSupported},
+		{"legacy with fee cap", legacy(func(tx *Transaction) { tx.MaxFeePerGas = big.NewInt(10) }), ErrUnexpectedField},
+		{"legacy with access list", legacy(func(tx *Transaction) { tx.AccessList = AccessList{{}} }), ErrUnexpectedField},
+		{"dynamic fee with gas price", dynamic(DynamicFeeTxType, func(tx *Transaction) { tx.GasPrice = big.NewInt(10) }), ErrUnexpectedField},
+		{"blob fields", dynamic(DynamicFeeTxType, func(tx *Transaction) { tx.BlobHashes = [][32]byte{blobHash} }), ErrUnexpectedField},
+		{"authorizations", dynamic(DynamicFeeTxType, func(tx *Transaction) { tx.AuthList = []Authorization{{}} }), ErrUnexpectedField},
+		{"missing chain id", dynamic(DynamicFeeTxType, func(tx *Transaction) { tx.ChainID = nil }), ErrInvalidChainID},
+		{"wrong chain id", dynamic(DynamicFeeTxType, func(tx *Transaction) { tx.ChainID = big.NewInt(2) }), ErrInvalidChainID},
+		{"wrong legacy chain id", legacy(func(tx *Transaction) { tx.ChainID = big.NewInt(2) }), ErrInvalidChainID},
+		{"negative value", legacy(func(tx *Transaction) { tx.Value = big.NewInt(-1) }), ErrNegativeValue},
+		{"init code too large", legacy(func(tx *Transaction) {
+			tx.To, tx.Data, tx.GasLimit = nil, make([]byte, MaxInitCodeSize+1), 1_000_000
+		}), ErrMaxInitCodeSize},
+		{"missing gas price", legacy(func(tx *Transaction) { tx.GasPrice = nil }), ErrMissingGasPrice},
+		{"fee cap above 2^256", dynamic(DynamicFeeTxType, func(tx *Transaction) {
+			tx.MaxFeePerGas = new(big.Int).Lsh(big.NewInt(1), 256)
+		}), ErrFeeCapVeryHigh},
+		{"tip above 2^256", dynamic(DynamicFeeTxType, func(tx *Transaction) {
+			tx.MaxPriorityFeePerGas = new(big.Int).Lsh(big.NewInt(1), 256)
+		}), ErrTipVeryHigh},
+		{"tip above fee cap", dynamic(DynamicFeeTxType, func(tx *Transaction) { tx.MaxPriorityFeePerGas = big.NewInt(21) }), ErrTipAboveFeeCap},
+		{"fee cap below base fee", dynamic(DynamicFeeTxType, func(tx *Transaction) {
+			tx.MaxFeePerGas, tx.MaxPriorityFeePerGas = big.NewInt(9), big.NewInt(0)
+		}), ErrFeeCapTooLow},
+		{"blob create", dynamic(BlobTxType, func(tx *Transaction) { tx.To = nil }), ErrBlobTxCreate},
+		{"no blobs", dynamic(BlobTxType, func(tx *Transaction) { tx.BlobHashes = nil }), ErrMissingBlobHashes},
+		{"too many blobs", dynamic(BlobTxType, func(tx *Transaction) {
+			tx.BlobHashes = make([][32]byte, MaxBlobsPerTransaction+1)
+		}), ErrTooManyBlobs},
+		{"blob hash version", dynamic(BlobTxType, func(tx *Transaction) { tx.BlobHashes = [][32]byte{{0x02}} }), ErrInvalidBlobHash},
+		{"missing blob fee cap", dynamic(BlobTxType, func(tx *Transaction) { tx.MaxFeePerBlobGas = nil }), ErrMissingGasPrice},
+		{"blob fee cap below blob base fee", dynamic(BlobTxType, func(tx *Transaction) {
+			tx.MaxFeePerBlobGas = big.NewInt(0)
+		}), ErrBlobFeeCapTooLow},
+		{"set code create", dynamic(SetCodeTxType, func(tx *Transaction) { tx.To = nil }), ErrSetCodeTxCreate},
+		{"empty authorization list", dynamic(SetCodeTxType, func(tx *Transaction) { tx.AuthList = nil }), ErrEmptyAuthList},
+		{"intrinsic gas", legacy(func(tx *Transaction) { tx.GasLimit = 20999 }), ErrIntrinsicGas},
+	}
+
+	for _, tt := range tests {
+		err := tt.tx.Validate(block)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("%s: Unexpected error: %v", tt.name, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: Expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
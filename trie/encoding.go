@@ -0,0 +1,77 @@
+package trie
+
+// Trie keys are handled as sequences of nibbles ("hex" encoding). A key
+// that ends at a value carries a terminator nibble (16) at the end. On the
+// wire, node keys use the compact (hex-prefix) encoding from the yellow paper.
+
+const terminator = 16
+
+// keybytesToHex converts a key to nibbles and appends the terminator.
+func keybytesToHex(key []byte) []byte {
+	nibbles := make([]byte, len(key)*2+1)
+	for i, b := range key {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[len(nibbles)-1] = terminator
+	return nibbles
+}
+
+// hexToCompact converts nibbles to the hex-prefix encoding. The first
+// nibble of the output holds two flags: bit 1 is set for leaves
+// (terminated keys) and bit 0 for odd length keys.
+func hexToCompact(hex []byte) []byte {
+	var flag byte
+	if hasTerm(hex) {
+		flag = 2
+		hex = hex[:len(hex)-1]
+	}
+
+	buf := make([]byte, len(hex)/2+1)
+	buf[0] = flag << 4
+	if len(hex)&1 == 1 {
+		buf[0] |= 1<<4 | hex[0]
+		hex = hex[1:]
+	}
+	for i := 0; i < len(hex); i += 2 {
+		buf[i/2+1] = hex[i]<<4 | hex[i+1]
+	}
+	return buf
+}
+
+// compactToHex reverses hexToCompact.
+func compactToHex(compact []byte) []byte {
+	if len(compact) == 0 {
+		return nil
+	}
+
+	nibbles := make([]byte, 0, len(compact)*2+1)
+	for _, b := range compact {
+		nibbles = append(nibbles, b/16, b%16)
+	}
+
+	flag := nibbles[0]
+	// Drop the flag nibble, and the padding nibble for even lengths.
+	if flag&1 == 1 {
+		nibbles = nibbles[1:]
+	} else {
+		nibbles = nibbles[2:]
+	}
+	if flag&2 == 2 {
+		nibbles = append(nibbles, terminator)
+	}
+	return nibbles
+}
+
+func hasTerm(hex []byte) bool {
+	return len(hex) > 0 && hex[len(hex)-1] == terminator
+}
+
+// prefixLen returns the length of the common prefix of a and b.
+func prefixLen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
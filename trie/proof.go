@@ -0,0 +1,131 @@
+package trie
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"prevm/rlp"
+)
+
+var (
+	ErrMissingNode  = errors.New("trie: proof node missing")
+	ErrInvalidProof = errors.New("trie: invalid proof node")
+)
+
+// Prove returns the Merkle proof for key: the RLP encoded nodes on the path
+// from the root towards the key, root first. Nodes small enough to be
+// embedded in their parent are not listed separately. The proof is valid
+// whether or not the key is present; for a missing key it proves absence.
+func (t *Trie) Prove(key []byte) [][]byte {
+	var proof [][]byte
+	n := t.root
+	hexKey := keybytesToHex(key)
+
+	for n != nil {
+		enc := encodeNode(n)
+		if len(proof) == 0 || len(enc) >= 32 {
+			proof = append(proof, enc)
+		}
+
+		switch cur := n.(type) {
+		case *shortNode:
+			if len(hexKey) < len(cur.Key) || !bytes.Equal(cur.Key, hexKey[:len(cur.Key)]) {
+				return proof
+			}
+			hexKey = hexKey[len(cur.Key):]
+			n = cur.Val
+		case *fullNode:
+			n = cur.Children[hexKey[0]]
+			hexKey = hexKey[1:]
+		default:
+			return proof
+		}
+		if _, ok := n.(valueNode); ok {
+			return proof
+		}
+	}
+	return proof
+}
+
+// Prove returns the Merkle proof for key. See Trie.Prove.
+func (t *SecureTrie) Prove(key []byte) [][]byte {
+	hashed := keccak(key)
+	return t.trie.Prove(hashed[:])
+}
+
+// VerifyProof checks a proof produced by Prove against root and returns the
+// value stored at key. A nil value with a nil error proves that the key is
+// absent from the trie.
+func VerifyProof(root [32]byte, key []byte, proof [][]byte) ([]byte, error) {
+	nodes := make(map[[32]byte][]byte, len(proof))
+	for _, enc := range proof {
+		nodes[keccak(enc)] = enc
+	}
+
+	hexKey := keybytesToHex(key)
+	wantHash := root
+	for {
+		enc, ok := nodes[wantHash]
+		if !ok {
+			if wantHash == EmptyRoot && len(proof) == 0 {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%w: %x", ErrMissingNode, wantHash)
+		}
+		item, err := rlp.Decode(enc)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+		}
+
+		// Walk the node and any nodes embedded in it, until we either
+		// resolve the key or reach a reference to another proof node.
+		for {
+			var child rlp.Item
+			child, hexKey, err = step(item, hexKey)
+			if err != nil {
+				return nil, err
+			}
+
+			switch {
+			case child.IsList:
+				item = child
+				continue
+			case len(child.Data) == 0:
+				return nil, nil // empty slot: the key is absent
+			case len(hexKey) == 0:
+				return child.Data, nil
+			case len(child.Data) == 32:
+				copy(wantHash[:], child.Data)
+			default:
+				return nil, fmt.Errorf("%w: bad child reference", ErrInvalidProof)
+			}
+			break
+		}
+	}
+}
+
+// step follows key through a single decoded node and returns the child it
+// leads to along with the rest of the key. An empty child means the key is
+// not in the trie.
+func step(item rlp.Item, key []byte) (rlp.Item, []byte, error) {
+	if !item.IsList {
+		return rlp.Item{}, nil, fmt.Errorf("%w: expected list", ErrInvalidProof)
+	}
+
+	switch len(item.List) {
+	case 2:
+		compact, err := item.List[0].Bytes()
+		if err != nil {
+			return rlp.Item{}, nil, fmt.Errorf("%w: %v", ErrInvalidProof, err)
+		}
+		nodeKey := compactToHex(compact)
+		if len(key) < len(nodeKey) || !bytes.Equal(nodeKey, key[:len(nodeKey)]) {
+			return rlp.Item{}, nil, nil
+		}
+		return item.List[1], key[len(nodeKey):], nil
+	case 17:
+		return item.List[key[0]], key[1:], nil
+	default:
+		return rlp.Item{}, nil, fmt.Errorf("%w: node with %d items", ErrInvalidProof, len(item.List))
+	}
+}
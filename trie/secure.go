@@ -0,0 +1,50 @@
+package trie
+
+import (
+	"prevm/rlp"
+)
+
+// SecureTrie is a trie whose keys are hashed with Keccak-256 before use,
+// which keeps it balanced no matter what keys are inserted. The state trie
+// and the storage tries are secure tries.
+type SecureTrie struct {
+	trie Trie
+}
+
+// NewSecure returns an empty secure trie.
+func NewSecure() *SecureTrie {
+	return &SecureTrie{}
+}
+
+// Get returns the value stored at key, or nil.
+func (t *SecureTrie) Get(key []byte) []byte {
+	hashed := keccak(key)
+	return t.trie.Get(hashed[:])
+}
+
+// Update stores value at key. An empty value deletes the key.
+func (t *SecureTrie) Update(key, value []byte) {
+	hashed := keccak(key)
+	t.trie.Update(hashed[:], value)
+}
+
+// Delete removes key from the trie.
+func (t *SecureTrie) Delete(key []byte) {
+	hashed := keccak(key)
+	t.trie.Delete(hashed[:])
+}
+
+// Hash returns the root hash of the trie.
+func (t *SecureTrie) Hash() [32]byte {
+	return t.trie.Hash()
+}
+
+// DeriveRoot returns the root of the trie mapping rlp(i) to values[i]. It
+// is used for the transactions, receipts and withdrawals roots of a block.
+func DeriveRoot(values [][]byte) [32]byte {
+	t := New()
+	for i, value := range values {
+		t.Update(rlp.EncodeUint(uint64(i)), value)
+	}
+	return t.Hash()
+}
@@ -0,0 +1,226 @@
+// Package trie implements the Merkle Patricia Trie used by Ethereum for
+// the state, storage, transaction and receipt roots.
+package trie
+
+import (
+	"bytes"
+	"prevm/config"
+	"prevm/rlp"
+)
+
+// EmptyRoot is the root hash of an empty trie: keccak256(rlp("")).
+var EmptyRoot = [32]byte{
+	0x56, 0xe8, 0x1f, 0x17, 0x1b, 0xcc, 0x55, 0xa6, 0xff, 0x83, 0x45, 0xe6, 0x92, 0xc0, 0xf8, 0x6e,
+	0x5b, 0x48, 0xe0, 0x1b, 0x99, 0x6c, 0xad, 0xc0, 0x01, 0x62, 0x2f, 0xb5, 0xe3, 0x63, 0xb4, 0x21,
+}
+
+type (
+	node interface{}
+
+	// fullNode is a branch: one child per nibble plus a value slot for keys
+	// ending at this node.
+	fullNode struct {
+		Children [17]node
+	}
+
+	// shortNode is a leaf when Key ends with the terminator and Val is a
+	// valueNode, and an extension otherwise.
+	shortNode struct {
+		Key []byte
+		Val node
+	}
+
+	valueNode []byte
+)
+
+// Trie is an in-memory Merkle Patricia Trie. Keys are used as given; see
+// SecureTrie for the variant with hashed keys used by the state.
+type Trie struct {
+	root node
+}
+
+// New returns an empty trie.
+func New() *Trie {
+	return &Trie{}
+}
+
+// Get returns the value stored at key, or nil.
+func (t *Trie) Get(key []byte) []byte {
+	return get(t.root, keybytesToHex(key))
+}
+
+func get(n node, key []byte) []byte {
+	switch n := n.(type) {
+	case *shortNode:
+		if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+			return nil
+		}
+		return get(n.Val, key[len(n.Key):])
+	case *fullNode:
+		return get(n.Children[key[0]], key[1:])
+	case valueNode:
+		return n
+	default:
+		return nil
+	}
+}
+
+// Update stores value at key. An empty value deletes the key.
+func (t *Trie) Update(key, value []byte) {
+	hexKey := keybytesToHex(key)
+	if len(value) == 0 {
+		t.root = remove(t.root, hexKey)
+		return
+	}
+	t.root = insert(t.root, hexKey, valueNode(append([]byte(nil), value...)))
+}
+
+// Delete removes key from the trie.
+func (t *Trie) Delete(key []byte) {
+	t.root = remove(t.root, keybytesToHex(key))
+}
+
+func insert(n node, key []byte, value node) node {
+	if len(key) == 0 {
+		return value
+	}
+
+	switch n := n.(type) {
+	case *shortNode:
+		matchlen := prefixLen(key, n.Key)
+		// The whole key of the short node matches: descend into it.
+		if matchlen == len(n.Key) {
+			return &shortNode{Key: n.Key, Val: insert(n.Val, key[matchlen:], value)}
+		}
+
+		// Otherwise branch out where the keys differ.
+		branch := &fullNode{}
+		branch.Children[n.Key[matchlen]] = insert(nil, n.Key[matchlen+1:], n.Val)
+		branch.Children[key[matchlen]] = insert(nil, key[matchlen+1:], value)
+		if matchlen == 0 {
+			return branch
+		}
+		return &shortNode{Key: key[:matchlen], Val: branch}
+
+	case *fullNode:
+		branch := *n
+		branch.Children[key[0]] = insert(n.Children[key[0]], key[1:], value)
+		return &branch
+
+	case nil:
+		return &shortNode{Key: key, Val: value}
+
+	default:
+		panic("trie: invalid node type on insert")
+	}
+}
+
+func remove(n node, key []byte) node {
+	switch n := n.(type) {
+	case *shortNode:
+		matchlen := prefixLen(key, n.Key)
+		if matchlen < len(n.Key) {
+			return n // key not in trie
+		}
+		if matchlen == len(key) {
+			return nil // the leaf itself
+		}
+
+		child := remove(n.Val, key[len(n.Key):])
+		switch child := child.(type) {
+		case *shortNode:
+			// Merge the extension with the short node below it.
+			merged := append(append([]byte{}, n.Key...), child.Key...)
+			return &shortNode{Key: merged, Val: child.Val}
+		case nil:
+			return nil
+		default:
+			return &shortNode{Key: n.Key, Val: child}
+		}
+
+	case *fullNode:
+		branch := *n
+		branch.Children[key[0]] = remove(n.Children[key[0]], key[1:])
+
+		// Find out whether the branch is left with a single child.
+		pos := -1
+		for i, child := range branch.Children {
+			if child == nil {
+				continue
+			}
+			if pos != -1 {
+				return &branch
+			}
+			pos = i
+		}
+		if pos == -1 {
+			return nil
+		}
+
+		// Collapse the branch into a short node.
+		if pos != terminator {
+			if child, ok := branch.Children[pos].(*shortNode); ok {
+				k := append([]byte{byte(pos)}, child.Key...)
+				return &shortNode{Key: k, Val: child.Val}
+			}
+		}
+		return &shortNode{Key: []byte{byte(pos)}, Val: branch.Children[pos]}
+
+	case valueNode:
+		return nil
+
+	default:
+		return nil
+	}
+}
+
+// Hash returns the root hash of the trie.
+func (t *Trie) Hash() [32]byte {
+	if t.root == nil {
+		return EmptyRoot
+	}
+	return keccak(encodeNode(t.root))
+}
+
+// encodeNode returns the RLP encoding of a node, with its children
+// referenced by hash or embedded.
+func encodeNode(n node) []byte {
+	switch n := n.(type) {
+	case *shortNode:
+		return rlp.EncodeList(rlp.EncodeBytes(hexToCompact(n.Key)), nodeRef(n.Val))
+	case *fullNode:
+		items := make([][]byte, 17)
+		for i, child := range n.Children {
+			items[i] = nodeRef(child)
+		}
+		return rlp.EncodeList(items...)
+	case valueNode:
+		return rlp.EncodeBytes(n)
+	default:
+		return rlp.EncodeBytes(nil)
+	}
+}
+
+// nodeRef returns how a parent refers to a child: nodes whose encoding is
+// shorter than 32 bytes are embedded, others are referenced by hash.
+func nodeRef(n node) []byte {
+	switch n := n.(type) {
+	case nil:
+		return rlp.EncodeBytes(nil)
+	case valueNode:
+		return rlp.EncodeBytes(n)
+	default:
+		enc := encodeNode(n)
+		if len(enc) < 32 {
+			return enc
+		}
+		hash := keccak(enc)
+		return rlp.EncodeBytes(hash[:])
+	}
+}
+
+func keccak(data []byte) [32]byte {
+	var hash [32]byte
+	copy(hash[:], config.Hash(data))
+	return hash
+}
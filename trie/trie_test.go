@@ -0,0 +1,191 @@
+package trie
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func hashHex(h [32]byte) string {
+	return hex.EncodeToString(h[:])
+}
+
+// TestEmptyTrie checks the root of an empty trie.
+func TestEmptyTrie(t *testing.T) {
+	tr := New()
+	want := "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"
+	if got := hashHex(tr.Hash()); got != want {
+		t.Errorf("Expected empty root %s, got %s", want, got)
+	}
+}
+
+// TestInsert checks root hashes against known vectors.
+func TestInsert(t *testing.T) {
+	tr := New()
+	tr.Update([]byte("doe"), []byte("reindeer"))
+	tr.Update([]byte("dog"), []byte("puppy"))
+	tr.Update([]byte("dogglesworth"), []byte("cat"))
+
+	want := "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"
+	if got := hashHex(tr.Hash()); got != want {
+		t.Errorf("Expected root %s, got %s", want, got)
+	}
+
+	tr = New()
+	tr.Update([]byte("A"), []byte(strings.Repeat("a", 50)))
+
+	want = "d23786fb4a010da3ce639d66d5e904a11dbc02746d1ce25029e53290cabf28ab"
+	if got := hashHex(tr.Hash()); got != want {
+		t.Errorf("Expected root %s, got %s", want, got)
+	}
+}
+
+// TestGet checks lookups of present and missing keys.
+func TestGet(t *testing.T) {
+	tr := New()
+	tr.Update([]byte("doe"), []byte("reindeer"))
+	tr.Update([]byte("dog"), []byte("puppy"))
+	tr.Update([]byte("dogglesworth"), []byte("cat"))
+
+	if got := tr.Get([]byte("dog")); !bytes.Equal(got, []byte("puppy")) {
+		t.Errorf("Expected puppy, got %q", got)
+	}
+	if got := tr.Get([]byte("dogglesworth")); !bytes.Equal(got, []byte("cat")) {
+		t.Errorf("Expected cat, got %q", got)
+	}
+	if got := tr.Get([]byte("unknown")); got != nil {
+		t.Errorf("Expected nil for missing key, got %q", got)
+	}
+	if got := tr.Get([]byte("do")); got != nil {
+		t.Errorf("Expected nil for key prefix, got %q", got)
+	}
+}
+
+// TestDelete checks that deleting keys, directly or with an empty value,
+// gives the same root as never inserting them.
+func TestDelete(t *testing.T) {
+	tr := New()
+	vals := []struct{ k, v string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"ether", ""},
+		{"dog", "puppy"},
+		{"shaman", ""},
+	}
+	for _, val := range vals {
+		tr.Update([]byte(val.k), []byte(val.v))
+	}
+
+	want := "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"
+	if got := hashHex(tr.Hash()); got != want {
+		t.Errorf("Expected root %s, got %s", want, got)
+	}
+
+	fresh := New()
+	fresh.Update([]byte("do"), []byte("verb"))
+	fresh.Update([]byte("horse"), []byte("stallion"))
+	fresh.Update([]byte("doge"), []byte("coin"))
+	fresh.Update([]byte("dog"), []byte("puppy"))
+	if tr.Hash() != fresh.Hash() {
+		t.Errorf("Expected deleted keys to leave no trace in the root")
+	}
+
+	for _, k := range []string{"do", "horse", "doge", "dog"} {
+		tr.Delete([]byte(k))
+	}
+	if tr.Hash() != EmptyRoot {
+		t.Errorf("Expected empty root after deleting every key, got %s", hashHex(tr.Hash()))
+	}
+}
+
+// TestCompactEncoding checks the hex-prefix encoding round trip.
+func TestCompactEncoding(t *testing.T) {
+	tests := []struct{ hex, compact []byte }{
+		{[]byte{}, []byte{0x00}},
+		{[]byte{terminator}, []byte{0x20}},
+		{[]byte{1, 2, 3, 4, 5}, []byte{0x11, 0x23, 0x45}},
+		{[]byte{0, 1, 2, 3, 4, 5}, []byte{0x00, 0x01, 0x23, 0x45}},
+		{[]byte{15, 1, 12, 11, 8, terminator}, []byte{0x3f, 0x1c, 0xb8}},
+		{[]byte{0, 15, 1, 12, 11, 8, terminator}, []byte{0x20, 0x0f, 0x1c, 0xb8}},
+	}
+	for _, tt := range tests {
+		if got := hexToCompact(tt.hex); !bytes.Equal(got, tt.compact) {
+			t.Errorf("hexToCompact(%x): Expected %x, got %x", tt.hex, tt.compact, got)
+		}
+		if got := compactToHex(tt.compact); !bytes.Equal(got, tt.hex) {
+			t.Errorf("compactToHex(%x): Expected %x, got %x", tt.compact, tt.hex, got)
+		}
+	}
+}
+
+// TestProof checks that proofs of present and missing keys verify against
+// the root, and that a proof fails against another root.
+func TestProof(t *testing.T) {
+	tr := NewSecure()
+	for i := 0; i < 200; i++ {
+		key := []byte{byte(i), byte(i * 7)}
+		tr.Update(key, bytes.Repeat([]byte{byte(i) + 1}, i%40+1))
+	}
+	root := tr.Hash()
+
+	for i := 0; i < 200; i++ {
+		key := []byte{byte(i), byte(i * 7)}
+		hashed := keccak(key)
+		value, err := VerifyProof(root, hashed[:], tr.Prove(key))
+		if err != nil {
+			t.Fatalf("Expected proof of key %x to verify, got %v", key, err)
+		}
+		if want := tr.Get(key); !bytes.Equal(value, want) {
+			t.Errorf("Expected value %x, got %x", want, value)
+		}
+	}
+
+	missing := []byte("missing")
+	hashed := keccak(missing)
+	value, err := VerifyProof(root, hashed[:], tr.Prove(missing))
+	if err != nil || value != nil {
+		t.Errorf("Expected proof of absence, got value %x and error %v", value, err)
+	}
+
+	key := []byte{1, 7}
+	hashed = keccak(key)
+	if _, err := VerifyProof(EmptyRoot, hashed[:], tr.Prove(key)); err == nil {
+		t.Errorf("Expected proof to fail against another root")
+	}
+}
+
+// TestProofEmptyTrie checks proofs of absence in an empty trie.
+func TestProofEmptyTrie(t *testing.T) {
+	tr := New()
+	proof := tr.Prove([]byte("key"))
+	if len(proof) != 0 {
+		t.Errorf("Expected an empty proof, got %d nodes", len(proof))
+	}
+	value, err := VerifyProof(EmptyRoot, []byte("key"), proof)
+	if err != nil || value != nil {
+		t.Errorf("Expected proof of absence, got value %x and error %v", value, err)
+	}
+}
+
+// TestProofEmbeddedNodes checks proofs through nodes small enough to be
+// embedded in their parent.
+func TestProofEmbeddedNodes(t *testing.T) {
+	tr := New()
+	for _, k := range []string{"do", "dog", "doge", "horse"} {
+		tr.Update([]byte(k), []byte(k[:1]))
+	}
+	root := tr.Hash()
+	for _, k := range []string{"do", "dog", "doge", "horse", "cat", "dogs"} {
+		value, err := VerifyProof(root, []byte(k), tr.Prove([]byte(k)))
+		if err != nil {
+			t.Fatalf("Expected proof of %q to verify, got %v", k, err)
+		}
+		if want := tr.Get([]byte(k)); !bytes.Equal(value, want) {
+			t.Errorf("Expected value %q for %q, got %q", want, k, value)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsQueueSize is the number of messages waiting to be written to a
+// WebSocket client. Clients that fall further behind are disconnected.
+const wsQueueSize = 256
+
+var upgrader = websocket.Upgrader{
+	// The node is a local development node: dapps served from any origin
+	// may connect to it.
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// RPCSubscription starts a subscription of a WebSocket client, made with
+// eth_subscribe. It is called with the params following the name of the
+// subscription and calls notify with every result to send to the client;
+// notify doesn't block. It returns the function ending the subscription.
+type RPCSubscription func(params json.RawMessage, notify func(result any)) (unsubscribe func(), err error)
+
+// RegisterSubscription adds a subscription to the server, replacing any
+// subscription of the same name.
+func (s *RPCServer) RegisterSubscription(name string, sub RPCSubscription) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscriptions[name] = sub
+}
+
+// wsConn is a WebSocket connection to the server.
+type wsConn struct {
+	server *RPCServer
+	conn   *websocket.Conn
+	out    chan []byte
+	done   chan struct{}
+
+	mu   sync.Mutex
+	subs map[string]*wsSubscription // nil once the connection is closed
+}
+
+// wsSubscription is a subscription of a connection.
+type wsSubscription struct {
+	id          string
+	unsubscribe func()
+	// Notifications are held back until the client has been sent the id of
+	// the subscription.
+	active bool
+	queued [][]byte
+}
+
+type rpcNotification struct {
+	Version string                `json:"jsonrpc"`
+	Method  string                `json:"method"`
+	Params  rpcSubscriptionResult `json:"params"`
+}
+
+type rpcSubscriptionResult struct {
+	Subscription string `json:"subscription"`
+	Result       any    `json:"result"`
+}
+
+// serveWebSocket serves JSON-RPC on a WebSocket connection until it closes.
+func (s *RPCServer) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade replied with the error.
+		return
+	}
+	c := &wsConn{
+		server: s,
+		conn:   conn,
+		out:    make(chan []byte, wsQueueSize),
+		done:   make(chan struct{}),
+		subs:   make(map[string]*wsSubscription),
+	}
+	go c.writeLoop()
+	c.readLoop()
+}
+
+func (c *wsConn) readLoop() {
+	defer c.close()
+	c.conn.SetReadLimit(maxRequestSize)
+	local := map[string]RPCMethod{
+		"eth_subscribe":   c.subscribe,
+		"eth_unsubscribe": c.unsubscribe,
+	}
+	for {
+		_, msg, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if out := c.server.handleMessage(msg, local); out != nil {
+			select {
+			case c.out <- out:
+			case <-c.done:
+				return
+			}
+		}
+		c.activate()
+	}
+}
+
+func (c *wsConn) writeLoop() {
+	for {
+		select {
+		case msg := <-c.out:
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.conn.Close()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// close ends the subscriptions of the connection and closes it.
+func (c *wsConn) close() {
+	c.mu.Lock()
+	subs := c.subs
+	c.subs = nil
+	c.mu.Unlock()
+
+	close(c.done)
+	for _, sub := range subs {
+		sub.unsubscribe()
+	}
+	c.conn.Close()
+}
+
+// queue queues msg for the client without blocking. A client too slow to
+// keep up is disconnected; the read loop then cleans up. It runs with c.mu
+// held.
+func (c *wsConn) queue(msg []byte) {
+	select {
+	case c.out <- msg:
+	default:
+		c.conn.Close()
+	}
+}
+
+// activate sends the notifications held back by the subscriptions whose
+// ids were sent.
+func (c *wsConn) activate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sub := range c.subs {
+		if sub.active {
+			continue
+		}
+		sub.active = true
+		for _, msg := range sub.queued {
+			c.queue(msg)
+		}
+		sub.queued = nil
+	}
+}
+
+func (c *wsConn) notify(sub *wsSubscription, result any) {
+	msg, err := json.Marshal(rpcNotification{
+		Version: "2.0",
+		Method:  "eth_subscription",
+		Params:  rpcSubscriptionResult{Subscription: sub.id, Result: result},
+	})
+	if err != nil {
+		logger.Error("Cannot encode notification", "err", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.subs[sub.id] != sub {
+		// Unsubscribed, or the connection closed.
+		return
+	}
+	if !sub.active {
+		sub.queued = append(sub.queued, msg)
+		return
+	}
+	c.queue(msg)
+}
+
+// subscribe implements eth_subscribe: the first param is the name of the
+// subscription, the others are its params.
+func (c *wsConn) subscribe(params json.RawMessage) (any, error) {
+	var list []json.RawMessage
+	if err := json.Unmarshal(params, &list); err != nil || len(list) == 0 {
+		return nil, invalidParams("expected subscription name as first argument")
+	}
+	var name string
+	if err := json.Unmarshal(list[0], &name); err != nil {
+		return nil, invalidParams("invalid subscription name: %v", err)
+	}
+	c.server.mu.RLock()
+	start, ok := c.server.subscriptions[name]
+	c.server.mu.RUnlock()
+	if !ok {
+		return nil, &RPCError{Code: rpcMethodNotFound, Message: `no "` + name + `" subscription in eth namespace`}
+	}
+	rest, err := json.Marshal(list[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	// The read loop handles the requests of the connection one at a time
+	// and closes it: it can't close while subscribing.
+	sub := &wsSubscription{id: newFilterID()}
+	c.mu.Lock()
+	c.subs[sub.id] = sub
+	c.mu.Unlock()
+
+	// The subscription may lock what notifies it: start it without holding
+	// c.mu, which notify takes.
+	unsubscribe, err := start(rest, func(result any) { c.notify(sub, result) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		delete(c.subs, sub.id)
+		return nil, err
+	}
+	sub.unsubscribe = unsubscribe
+	return sub.id, nil
+}
+
+// unsubscribe implements eth_unsubscribe.
+func (c *wsConn) unsubscribe(params json.RawMessage) (any, error) {
+	var id string
+	if err := parseParams(params, 1, &id); err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	sub, ok := c.subs[id]
+	if ok {
+		delete(c.subs, id)
+	}
+	c.mu.Unlock()
+	if ok {
+		sub.unsubscribe()
+	}
+	return ok, nil
+}
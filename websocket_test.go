@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"prevm/hexutil"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsDial opens a WebSocket connection to the server at url.
+func wsDial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// wsMessage is a response or a notification read from a WebSocket.
+type wsMessage struct {
+	ID     json.RawMessage `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *RPCError       `json:"error"`
+	Method string          `json:"method"`
+	Params struct {
+		Subscription string          `json:"subscription"`
+		Result       json.RawMessage `json:"result"`
+	} `json:"params"`
+}
+
+// wsCall sends a request with the given id.
+func wsCall(t *testing.T, conn *websocket.Conn, id int, method string, params ...any) {
+	t.Helper()
+	if params == nil {
+		params = []any{}
+	}
+	if err := conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// wsRead reads the next message.
+func wsRead(t *testing.T, conn *websocket.Conn) *wsMessage {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg wsMessage
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return &msg
+}
+
+// wsResponse reads the next message, which must be the response to the
+// request with id, and decodes its result into v.
+func wsResponse(t *testing.T, conn *websocket.Conn, id int, v any) {
+	t.Helper()
+	msg := wsRead(t, conn)
+	if string(msg.ID) != strconv.Itoa(id) || msg.Error != nil {
+		t.Fatalf("Expected the response to request %d, got %+v", id, msg)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// wsNotification reads the next message, which must be a notification of
+// sub, and decodes its result into v.
+func wsNotification(t *testing.T, conn *websocket.Conn, sub string, v any) {
+	t.Helper()
+	msg := wsRead(t, conn)
+	if msg.Method != "eth_subscription" || msg.Params.Subscription != sub {
+		t.Fatalf("Expected a notification of %s, got %+v", sub, msg)
+	}
+	if err := json.Unmarshal(msg.Params.Result, v); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// TestWebSocketSubscribe checks that the id of a subscription is sent
+// before its notifications, even those sent as it starts, and the
+// notifications of the newHeads, logs and newPendingTransactions
+// subscriptions.
+func TestWebSocketSubscribe(t *testing.T) {
+	url, node, server := newTestServer(t)
+	server.RegisterSubscription("eager", func(params json.RawMessage, notify func(any)) (func(), error) {
+		notify("first")
+		notify("second")
+		return func() {}, nil
+	})
+	conn := wsDial(t, url)
+
+	var eager string
+	wsCall(t, conn, 1, "eth_subscribe", "eager")
+	wsResponse(t, conn, 1, &eager)
+	for _, want := range []string{"first", "second"} {
+		var got string
+		if wsNotification(t, conn, eager, &got); got != want {
+			t.Errorf("Expected %q, got %q", want, got)
+		}
+	}
+
+	// A contract logging LOG0 of nothing.
+	contract := [20]byte{19: 0xc0}
+	node.ReadState(func(state *StateDB) {
+		state.SetCode(contract, []byte{0x60, 0x00, 0x80, 0xa0}) // PUSH1 0 DUP1 LOG0
+		state.Finalise()
+	})
+
+	var heads, logs, pending string
+	wsCall(t, conn, 2, "eth_subscribe", "newHeads")
+	wsResponse(t, conn, 2, &heads)
+	wsCall(t, conn, 3, "eth_subscribe", "logs", map[string]any{"address": hexutil.Encode(contract[:])})
+	wsResponse(t, conn, 3, &logs)
+	wsCall(t, conn, 4, "eth_subscribe", "newPendingTransactions")
+	wsResponse(t, conn, 4, &pending)
+
+	tx := transfer(t, 0, contract, 0)
+	raw, _ := tx.MarshalBinary()
+	if _, rpcErr := rpcCall(t, url, "eth_sendRawTransaction", hexutil.Encode(raw)); rpcErr != nil {
+		t.Fatalf("Unexpected error: %v", rpcErr)
+	}
+	head := node.Head()
+
+	// In the order of the subscriptions.
+	var header headerJSON
+	if wsNotification(t, conn, heads, &header); header.Number != 1 || header.Hash != head.Hash {
+		t.Errorf("Expected the header of block 1, got %+v", header)
+	}
+	var log logJSON
+	if wsNotification(t, conn, logs, &log); log.Address != contract || log.BlockHash != head.Hash || log.TransactionHash != tx.Hash() {
+		t.Errorf("Expected the log of the contract, got %+v", log)
+	}
+	var hash rpcHash
+	if wsNotification(t, conn, pending, &hash); hash != tx.Hash() {
+		t.Errorf("Expected the hash 0x%x, got 0x%x", tx.Hash(), hash)
+	}
+
+	// An unknown subscription.
+	wsCall(t, conn, 5, "eth_subscribe", "nope")
+	if msg := wsRead(t, conn); msg.Error == nil || msg.Error.Code != rpcMethodNotFound {
+		t.Errorf("Expected a method not found error, got %+v", msg)
+	}
+}
+
+// TestWebSocketUnsubscribe checks that a subscription ended with
+// eth_unsubscribe gets no more notifications.
+func TestWebSocketUnsubscribe(t *testing.T) {
+	url, _, _ := newTestServer(t)
+	conn := wsDial(t, url)
+
+	var heads string
+	wsCall(t, conn, 1, "eth_subscribe", "newHeads")
+	wsResponse(t, conn, 1, &heads)
+
+	var ok bool
+	wsCall(t, conn, 2, "eth_unsubscribe", heads)
+	if wsResponse(t, conn, 2, &ok); !ok {
+		t.Errorf("Expected the subscription to end")
+	}
+	wsCall(t, conn, 3, "eth_unsubscribe", heads)
+	if wsResponse(t, conn, 3, &ok); ok {
+		t.Errorf("Expected the subscription to be unknown")
+	}
+
+	// The block is notified as it is mined, before the response to
+	// eth_sendRawTransaction: a notification would come first.
+	raw, _ := transfer(t, 0, [20]byte{19: 0x2a}, 1).MarshalBinary()
+	if _, rpcErr := rpcCall(t, url, "eth_sendRawTransaction", hexutil.Encode(raw)); rpcErr != nil {
+		t.Fatalf("Unexpected error: %v", rpcErr)
+	}
+	var number hexutil.Uint64
+	wsCall(t, conn, 4, "eth_blockNumber")
+	if wsResponse(t, conn, 4, &number); number != 1 {
+		t.Errorf("Expected block 1, got %d", number)
+	}
+}
+
+// TestWebSocketSlowClient checks that a client that doesn't read its
+// notifications is disconnected, ending its subscriptions.
+func TestWebSocketSlowClient(t *testing.T) {
+	url, _, server := newTestServer(t)
+	ended := make(chan struct{})
+	server.RegisterSubscription("flood", func(params json.RawMessage, notify func(any)) (func(), error) {
+		stop := make(chan struct{})
+		go func() {
+			result := strings.Repeat("x", 1<<14)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					notify(result)
+				}
+			}
+		}()
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				close(stop)
+				close(ended)
+			})
+		}, nil
+	})
+	conn := wsDial(t, url)
+
+	var sub string
+	wsCall(t, conn, 1, "eth_subscribe", "flood")
+	wsResponse(t, conn, 1, &sub)
+
+	select {
+	case <-ended:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("Expected the subscription of the slow client to end")
+	}
+
+	// What was sent before is still there, then the connection is closed.
+	var err error
+	for err == nil {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, _, err = conn.ReadMessage()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		t.Errorf("Expected the connection to be closed, got %v", err)
+	}
+}